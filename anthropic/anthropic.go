@@ -103,6 +103,20 @@ type ContentBlock struct {
 	// For thinking blocks - pointer so field only appears when set (SDK requires it for accumulation)
 	Thinking  *string `json:"thinking,omitempty"`
 	Signature string  `json:"signature,omitempty"`
+
+	// For document blocks
+	Title   string `json:"title,omitempty"`
+	Context string `json:"context,omitempty"`
+
+	// CacheControl marks the end of a prefix to cache
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks a prompt caching breakpoint. It is accepted for
+// compatibility but not used since the runner caches the whole prompt.
+type CacheControl struct {
+	Type string `json:"type"`          // "ephemeral"
+	TTL  string `json:"ttl,omitempty"` // "5m" or "1h"; accepted but not used
 }
 
 // ImageSource represents the source of an image
@@ -119,6 +133,8 @@ type Tool struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description,omitempty"`
 	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // ToolChoice controls how the model uses tools
@@ -139,6 +155,16 @@ type Metadata struct {
 	UserID string `json:"user_id,omitempty"`
 }
 
+// CountTokensRequest represents an Anthropic Count Message Tokens API request
+type CountTokensRequest struct {
+	Model      string          `json:"model"`
+	Messages   []MessageParam  `json:"messages"`
+	System     any             `json:"system,omitempty"` // string or []ContentBlock
+	Tools      []Tool          `json:"tools,omitempty"`
+	ToolChoice *ToolChoice     `json:"tool_choice,omitempty"`
+	Thinking   *ThinkingConfig `json:"thinking,omitempty"`
+}
+
 // Response types
 
 // MessagesResponse represents an Anthropic Messages API response
@@ -153,10 +179,31 @@ type MessagesResponse struct {
 	Usage        Usage          `json:"usage"`
 }
 
-// Usage contains token usage information
+// Usage contains token usage information. InputTokens only counts tokens
+// that were neither read from nor written to the cache.
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+// NewUsage returns the usage for a response with the given metrics. Prompt
+// tokens reused from the runner's prompt cache are reported as read from the
+// cache. The runner caches every prompt without pinning any part of it, so no
+// tokens are reported as written to the cache.
+func NewUsage(m api.Metrics) Usage {
+	read := min(m.PromptCachedCount, m.PromptEvalCount)
+	return Usage{
+		InputTokens:          m.PromptEvalCount - read,
+		CacheReadInputTokens: read,
+		OutputTokens:         m.EvalCount,
+	}
+}
+
+// CountTokensResponse represents an Anthropic Count Message Tokens API response
+type CountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
 }
 
 // Streaming event types
@@ -211,7 +258,10 @@ type MessageDelta struct {
 
 // DeltaUsage contains cumulative token usage
 type DeltaUsage struct {
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+	OutputTokens             int `json:"output_tokens"`
 }
 
 // MessageStopEvent signals the end of the message
@@ -312,6 +362,28 @@ func FromMessagesRequest(r MessagesRequest) (*api.ChatRequest, error) {
 	}, nil
 }
 
+// FromCountTokensRequest converts an Anthropic CountTokensRequest to an Ollama CountTokensRequest
+func FromCountTokensRequest(r CountTokensRequest) (*api.CountTokensRequest, error) {
+	chatReq, err := FromMessagesRequest(MessagesRequest{
+		Model:      r.Model,
+		Messages:   r.Messages,
+		System:     r.System,
+		Tools:      r.Tools,
+		ToolChoice: r.ToolChoice,
+		Thinking:   r.Thinking,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.CountTokensRequest{
+		Model:    chatReq.Model,
+		Messages: chatReq.Messages,
+		Tools:    chatReq.Tools,
+		Think:    chatReq.Think,
+	}, nil
+}
+
 // convertMessage converts an Anthropic MessageParam to Ollama api.Message(s)
 func convertMessage(msg MessageParam) ([]api.Message, error) {
 	var messages []api.Message
@@ -327,6 +399,7 @@ func convertMessage(msg MessageParam) ([]api.Message, error) {
 		var toolCalls []api.ToolCall
 		var thinking string
 		var toolResults []api.Message
+		var afterDocument bool
 
 		for _, block := range content {
 			blockMap, ok := block.(map[string]any)
@@ -339,6 +412,10 @@ func convertMessage(msg MessageParam) ([]api.Message, error) {
 			switch blockType {
 			case "text":
 				if text, ok := blockMap["text"].(string); ok {
+					if afterDocument && text != "" {
+						textContent.WriteString("\n\n")
+						afterDocument = false
+					}
 					textContent.WriteString(text)
 				}
 
@@ -410,6 +487,18 @@ func convertMessage(msg MessageParam) ([]api.Message, error) {
 				if t, ok := blockMap["thinking"].(string); ok {
 					thinking = t
 				}
+
+			case "document":
+				text, err := documentText(blockMap)
+				if err != nil {
+					return nil, err
+				}
+				// separate documents from the text around them
+				if textContent.Len() > 0 {
+					textContent.WriteString("\n\n")
+				}
+				textContent.WriteString(text)
+				afterDocument = true
 			}
 		}
 
@@ -434,6 +523,51 @@ func convertMessage(msg MessageParam) ([]api.Message, error) {
 	return messages, nil
 }
 
+// documentText returns the text of a document block. Plain text and content
+// sources are supported; PDFs and URLs are not.
+func documentText(block map[string]any) (string, error) {
+	source, ok := block["source"].(map[string]any)
+	if !ok {
+		return "", errors.New("invalid document source")
+	}
+
+	var text strings.Builder
+	if title, _ := block["title"].(string); title != "" {
+		text.WriteString(title + "\n\n")
+	}
+	if context, _ := block["context"].(string); context != "" {
+		text.WriteString(context + "\n\n")
+	}
+
+	switch sourceType, _ := source["type"].(string); sourceType {
+	case "text":
+		data, ok := source["data"].(string)
+		if !ok {
+			return "", errors.New("text document source missing required 'data' field")
+		}
+		text.WriteString(data)
+	case "content":
+		switch content := source["content"].(type) {
+		case string:
+			text.WriteString(content)
+		case []any:
+			for _, cb := range content {
+				if cbMap, ok := cb.(map[string]any); ok && cbMap["type"] == "text" {
+					if t, ok := cbMap["text"].(string); ok {
+						text.WriteString(t)
+					}
+				}
+			}
+		default:
+			return "", errors.New("invalid document source content")
+		}
+	default:
+		return "", fmt.Errorf("invalid document source type: %s. Only text and content documents are supported.", sourceType)
+	}
+
+	return text.String(), nil
+}
+
 // convertTool converts an Anthropic Tool to an Ollama api.Tool
 func convertTool(t Tool) (api.Tool, error) {
 	var params api.ToolFunctionParameters
@@ -489,10 +623,7 @@ func ToMessagesResponse(id string, r api.ChatResponse) MessagesResponse {
 		Model:      r.Model,
 		Content:    content,
 		StopReason: stopReason,
-		Usage: Usage{
-			InputTokens:  r.Metrics.PromptEvalCount,
-			OutputTokens: r.Metrics.EvalCount,
-		},
+		Usage:      NewUsage(r.Metrics),
 	}
 }
 
@@ -517,8 +648,9 @@ func mapStopReason(reason string, hasToolCalls bool) string {
 
 // StreamConverter manages state for converting Ollama streaming responses to Anthropic format
 type StreamConverter struct {
-	ID              string
-	Model           string
+	ID    string
+	Model string
+
 	firstWrite      bool
 	contentIndex    int
 	inputTokens     int
@@ -722,6 +854,7 @@ func (c *StreamConverter) Process(r api.ChatResponse) []StreamEvent {
 		}
 
 		c.outputTokens = r.Metrics.EvalCount
+		usage := NewUsage(r.Metrics)
 		stopReason := mapStopReason(r.DoneReason, len(c.toolCallsSent) > 0)
 
 		events = append(events, StreamEvent{
@@ -732,7 +865,10 @@ func (c *StreamConverter) Process(r api.ChatResponse) []StreamEvent {
 					StopReason: stopReason,
 				},
 				Usage: DeltaUsage{
-					OutputTokens: c.outputTokens,
+					InputTokens:              usage.InputTokens,
+					CacheCreationInputTokens: usage.CacheCreationInputTokens,
+					CacheReadInputTokens:     usage.CacheReadInputTokens,
+					OutputTokens:             c.outputTokens,
 				},
 			},
 		})
@@ -951,3 +951,118 @@ func TestStreamConverter_ContentBlockStartIncludesEmptyFields(t *testing.T) {
 		}
 	})
 }
+
+func TestFromMessagesRequest_WithDocuments(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    string
+		err     string
+	}{
+		{
+			name:    "text",
+			content: `[{"type": "document", "source": {"type": "text", "media_type": "text/plain", "data": "The grass is green."}}, {"type": "text", "text": "What color is the grass?"}]`,
+			want:    "The grass is green.\n\nWhat color is the grass?",
+		},
+		{
+			name:    "title and context",
+			content: `[{"type": "text", "text": "Summarize this."}, {"type": "document", "title": "Notes", "context": "Written by Bob", "source": {"type": "text", "data": "Meeting at noon."}}]`,
+			want:    "Summarize this.\n\nNotes\n\nWritten by Bob\n\nMeeting at noon.",
+		},
+		{
+			name:    "content",
+			content: `[{"type": "document", "source": {"type": "content", "content": [{"type": "text", "text": "First. "}, {"type": "text", "text": "Second."}]}}]`,
+			want:    "First. Second.",
+		},
+		{
+			name:    "pdf",
+			content: `[{"type": "document", "source": {"type": "base64", "media_type": "application/pdf", "data": "JVBERi0="}}]`,
+			err:     "invalid document source type: base64. Only text and content documents are supported.",
+		},
+		{
+			name:    "missing source",
+			content: `[{"type": "document"}]`,
+			err:     "invalid document source",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var req MessagesRequest
+			if err := json.Unmarshal([]byte(`{"model": "test-model", "max_tokens": 1024, "messages": [{"role": "user", "content": `+tt.content+`}]}`), &req); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := FromMessagesRequest(req)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(result.Messages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(result.Messages))
+			}
+			if diff := cmp.Diff(tt.want, result.Messages[0].Content); diff != "" {
+				t.Errorf("content mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewUsage(t *testing.T) {
+	cases := []struct {
+		name    string
+		metrics api.Metrics
+		want    Usage
+	}{
+		{
+			name:    "no cache",
+			metrics: api.Metrics{PromptEvalCount: 100, EvalCount: 10},
+			want:    Usage{InputTokens: 100, OutputTokens: 10},
+		},
+		{
+			name:    "cache read",
+			metrics: api.Metrics{PromptEvalCount: 100, PromptCachedCount: 60, EvalCount: 10},
+			want:    Usage{InputTokens: 40, CacheReadInputTokens: 60, OutputTokens: 10},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, NewUsage(tt.metrics)); diff != "" {
+				t.Errorf("usage mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStreamConverter_CacheUsage(t *testing.T) {
+	conv := NewStreamConverter("msg_123", "test-model")
+
+	conv.Process(api.ChatResponse{Message: api.Message{Role: "assistant", Content: "Hi"}})
+	events := conv.Process(api.ChatResponse{
+		Done:       true,
+		DoneReason: "stop",
+		Metrics:    api.Metrics{PromptEvalCount: 100, PromptCachedCount: 60, EvalCount: 10},
+	})
+
+	var delta *MessageDeltaEvent
+	for _, e := range events {
+		if d, ok := e.Data.(MessageDeltaEvent); ok {
+			delta = &d
+		}
+	}
+	if delta == nil {
+		t.Fatal("expected message_delta event")
+	}
+
+	want := DeltaUsage{InputTokens: 40, CacheReadInputTokens: 60, OutputTokens: 10}
+	if diff := cmp.Diff(want, delta.Usage); diff != "" {
+		t.Errorf("usage mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -48,6 +48,12 @@ func checkError(resp *http.Response, body []byte) error {
 	if resp.StatusCode == http.StatusUnauthorized {
 		authError := AuthorizationError{StatusCode: resp.StatusCode}
 		json.Unmarshal(body, &authError)
+		if authError.Status == "" {
+			var apiError StatusError
+			if json.Unmarshal(body, &apiError) == nil {
+				authError.Status = apiError.ErrorMessage
+			}
+		}
 		return authError
 	}
 
@@ -140,6 +146,8 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 
 	if token != "" {
 		request.Header.Set("Authorization", token)
+	} else if key := envconfig.APIKey(); key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
 	}
 
 	respObj, err := c.http.Do(request)
@@ -206,6 +214,8 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 
 	if token != "" {
 		request.Header.Set("Authorization", token)
+	} else if key := envconfig.APIKey(); key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
 	}
 
 	response, err := c.http.Do(request)
@@ -430,12 +440,164 @@ func (c *Client) Embeddings(ctx context.Context, req *EmbeddingRequest) (*Embedd
 	return &resp, nil
 }
 
+// Rerank sorts documents by their relevance to a query using a cross-encoder
+// model.
+func (c *Client) Rerank(ctx context.Context, req *RerankRequest) (*RerankResponse, error) {
+	var resp RerankResponse
+	if err := c.do(ctx, http.MethodPost, "/api/rerank", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Transcribe converts speech in an audio file to text.
+func (c *Client) Transcribe(ctx context.Context, req *TranscribeRequest) (*TranscribeResponse, error) {
+	var resp TranscribeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/transcribe", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Tokenize converts text to token IDs using a model's tokenizer.
+func (c *Client) Tokenize(ctx context.Context, req *TokenizeRequest) (*TokenizeResponse, error) {
+	var resp TokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/tokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Detokenize converts token IDs back to text using a model's tokenizer.
+func (c *Client) Detokenize(ctx context.Context, req *DetokenizeRequest) (*DetokenizeResponse, error) {
+	var resp DetokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/detokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CountTokens returns the number of prompt tokens a chat request would use.
+func (c *Client) CountTokens(ctx context.Context, req *CountTokensRequest) (*CountTokensResponse, error) {
+	var resp CountTokensResponse
+	if err := c.do(ctx, http.MethodPost, "/api/chat/count", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PerplexityFunc is a function that [Client.Perplexity] invokes as each
+// window of the content is scored.
+type PerplexityFunc func(PerplexityResponse) error
+
+// Perplexity scores text with a model, streaming the log probability of each
+// scored token. The final response reports the perplexity of the text.
+func (c *Client) Perplexity(ctx context.Context, req *PerplexityRequest, fn PerplexityFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/perplexity", req, func(bts []byte) error {
+		var resp PerplexityResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
 // CreateBlob creates a blob from a file on the server. digest is the
 // expected SHA256 digest of the file, and r represents the file.
 func (c *Client) CreateBlob(ctx context.Context, digest string, r io.Reader) error {
 	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/blobs/%s", digest), r, nil)
 }
 
+// ExportFunc is a function that [Client.Export] invokes with the archive
+// stream once the server has responded. The stream starts at resp.Offset.
+type ExportFunc func(resp ExportResponse, r io.Reader) error
+
+// Export streams a model and all of its blobs as a tar archive. Set
+// req.Offset and req.ETag to resume an interrupted export.
+func (c *Client) Export(ctx context.Context, req *ExportRequest, fn ExportFunc) error {
+	requestURL := c.base.JoinPath("/api/export")
+	q := requestURL.Query()
+	q.Set("model", req.Model)
+
+	var token string
+	if envconfig.UseAuth() || c.base.Hostname() == "ollama.com" {
+		var err error
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		chal := fmt.Sprintf("%s,%s?ts=%s", http.MethodGet, "/api/export", now)
+		token, err = getAuthorizationToken(ctx, chal)
+		if err != nil {
+			return err
+		}
+
+		q.Set("ts", now)
+	}
+	requestURL.RawQuery = q.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/x-tar")
+	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	if req.Offset > 0 && req.ETag != "" {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", req.Offset))
+		request.Header.Set("If-Range", req.ETag)
+	}
+
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	} else if key := envconfig.APIKey(); key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	resp := ExportResponse{ETag: response.Header.Get("ETag")}
+	switch response.StatusCode {
+	case http.StatusOK:
+		resp.Size = response.ContentLength
+	case http.StatusPartialContent:
+		var end int64
+		if _, err := fmt.Sscanf(response.Header.Get("Content-Range"), "bytes %d-%d/%d", &resp.Offset, &end, &resp.Size); err != nil {
+			return fmt.Errorf("invalid Content-Range: %w", err)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The offset is at or past the end of an unchanged archive
+		if _, err := fmt.Sscanf(response.Header.Get("Content-Range"), "bytes */%d", &resp.Size); err != nil || resp.Size != req.Offset {
+			return StatusError{StatusCode: response.StatusCode, Status: response.Status, ErrorMessage: "invalid export offset"}
+		}
+		resp.Offset = resp.Size
+		return fn(resp, http.NoBody)
+	default:
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		if err := checkError(response, body); err != nil {
+			return err
+		}
+		return fmt.Errorf("unexpected status: %s", response.Status)
+	}
+
+	return fn(resp, response.Body)
+}
+
+// Import creates models from a tar archive written by [Client.Export].
+// Blobs already present on the server are not written again.
+func (c *Client) Import(ctx context.Context, r io.Reader) (*ImportResponse, error) {
+	var resp ImportResponse
+	if err := c.do(ctx, http.MethodPost, "/api/import", r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Version returns the Ollama server version as a string.
 func (c *Client) Version(ctx context.Context) (string, error) {
 	var version struct {
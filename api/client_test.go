@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -320,3 +321,32 @@ func TestClientDo(t *testing.T) {
 		})
 	}
 }
+
+func TestClientAPIKey(t *testing.T) {
+	t.Setenv("OLLAMA_API_KEY", "secret")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid API key"})
+			return
+		}
+		json.NewEncoder(w).Encode(ListResponse{})
+	}))
+	defer ts.Close()
+
+	client := NewClient(&url.URL{Scheme: "http", Host: ts.Listener.Addr().String()}, http.DefaultClient)
+	if _, err := client.List(t.Context()); err != nil {
+		t.Fatalf("expected API key to be sent, got %v", err)
+	}
+
+	t.Setenv("OLLAMA_API_KEY", "wrong")
+	_, err := client.List(t.Context())
+	var authErr AuthorizationError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected AuthorizationError, got %v", err)
+	}
+	if err.Error() != "invalid API key" {
+		t.Errorf("expected server error message, got %q", err.Error())
+	}
+}
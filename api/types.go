@@ -56,6 +56,9 @@ func (e AuthorizationError) Error() string {
 // ImageData represents the raw binary data of an image file.
 type ImageData []byte
 
+// AudioData represents the raw binary data of a WAV or FLAC audio file.
+type AudioData []byte
+
 // GenerateRequest describes a request sent by [Client.Generate]. While you
 // have to specify the Model and Prompt fields, all the other fields have
 // reasonable defaults for basic uses.
@@ -141,6 +144,22 @@ type GenerateRequest struct {
 	// Steps is the number of diffusion steps for image generation.
 	// Only used for image generation models.
 	Steps int32 `json:"steps,omitempty"`
+
+	// Strength controls how much an init image passed in Images is changed,
+	// from near 0 (barely changed) to 1 (fully regenerated). 0, the same as
+	// unset, selects the default of 0.75. Only used for image generation
+	// models.
+	Strength float32 `json:"strength,omitempty"`
+
+	// Mask is an optional inpainting mask for the init image. White areas
+	// are regenerated and black areas are kept. Only used for image
+	// generation models.
+	Mask ImageData `json:"mask,omitempty"`
+
+	// Preview requests a low-resolution preview of the image after each
+	// denoising step, returned in GenerateResponse.Preview. Only used for
+	// image generation models.
+	Preview bool `json:"preview,omitempty"`
 }
 
 // ChatRequest describes a request sent by [Client.Chat].
@@ -207,7 +226,7 @@ func (t Tool) String() string {
 
 // Message is a single message in a chat sequence. The message contains the
 // role ("system", "user", or "assistant"), the content and an optional list
-// of images.
+// of images and audio.
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -215,6 +234,7 @@ type Message struct {
 	// original model output when ChatRequest.Think is enabled.
 	Thinking   string      `json:"thinking,omitempty"`
 	Images     []ImageData `json:"images,omitempty"`
+	Audio      []AudioData `json:"audio,omitempty"`
 	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
 	ToolName   string      `json:"tool_name,omitempty"`
 	ToolCallID string      `json:"tool_call_id,omitempty"`
@@ -574,6 +594,17 @@ type Metrics struct {
 	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int           `json:"eval_count,omitempty"`
 	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+
+	// PromptCachedCount is the number of prompt tokens, included in
+	// PromptEvalCount, that were reused from the prompt cache instead of
+	// being evaluated.
+	PromptCachedCount int `json:"prompt_cached_count,omitempty"`
+
+	// TimeToFirstToken is the time from the request reaching the model to the
+	// first generated token, and InterTokenLatency the mean time between each
+	// token after that.
+	TimeToFirstToken  time.Duration `json:"time_to_first_token,omitempty"`
+	InterTokenLatency time.Duration `json:"inter_token_latency,omitempty"`
 }
 
 // Options specified in [GenerateRequest].  If you add a new option here, also
@@ -595,6 +626,14 @@ type Options struct {
 	PresencePenalty  float32  `json:"presence_penalty,omitempty"`
 	FrequencyPenalty float32  `json:"frequency_penalty,omitempty"`
 	Stop             []string `json:"stop,omitempty"`
+
+	// AdapterScale is the strength of the model's LoRA adapters, when they
+	// can be applied per request. 0 disables them.
+	AdapterScale float32 `json:"adapter_scale,omitempty"`
+
+	// ControlStrength scales the model's control vectors. Negative values
+	// steer away from them and 0 disables them.
+	ControlStrength float32 `json:"control_strength,omitempty"`
 }
 
 // Runner options which must be set when the model is loaded into memory
@@ -605,6 +644,21 @@ type Runner struct {
 	MainGPU   int   `json:"main_gpu,omitempty"`
 	UseMMap   *bool `json:"use_mmap,omitempty"`
 	NumThread int   `json:"num_thread,omitempty"`
+
+	// NumPrefillChunk limits the number of prompt tokens in each batch while
+	// other requests are generating. 0 uses the full batch.
+	NumPrefillChunk int `json:"num_prefill_chunk,omitempty"`
+
+	// RoPE scaling overrides for running models past their trained context
+	// length. Unset values use the model's metadata.
+	RopeScalingType    string  `json:"rope_scaling_type,omitempty"`
+	RopeFrequencyBase  float32 `json:"rope_freq_base,omitempty"`
+	RopeFrequencyScale float32 `json:"rope_freq_scale,omitempty"`
+	YarnOrigCtx        int     `json:"yarn_orig_ctx,omitempty"`
+	YarnExtFactor      float32 `json:"yarn_ext_factor,omitempty"`
+	YarnAttnFactor     float32 `json:"yarn_attn_factor,omitempty"`
+	YarnBetaFast       float32 `json:"yarn_beta_fast,omitempty"`
+	YarnBetaSlow       float32 `json:"yarn_beta_slow,omitempty"`
 }
 
 // EmbedRequest is the request passed to [Client.Embed].
@@ -639,6 +693,116 @@ type EmbedResponse struct {
 	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
 }
 
+// RerankRequest is the request passed to [Client.Rerank].
+type RerankRequest struct {
+	// Model is the model name. It must be a cross-encoder model with the
+	// rerank capability.
+	Model string `json:"model"`
+
+	// Query is the text the documents are ranked against.
+	Query string `json:"query"`
+
+	// Documents are the texts to rank.
+	Documents []string `json:"documents"`
+
+	// TopN limits the results to the TopN most relevant documents. All
+	// documents are returned if it is zero.
+	TopN int `json:"top_n,omitempty"`
+
+	// ReturnDocuments includes the text of each document in the results.
+	ReturnDocuments bool `json:"return_documents,omitempty"`
+
+	// Truncate truncates documents so the query and each document fit the
+	// model's max sequence length. It defaults to true.
+	Truncate *bool `json:"truncate,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// RerankResult is the relevance of one document to the query.
+type RerankResult struct {
+	// Index is the position of the document in the request.
+	Index int `json:"index"`
+
+	// Document is the text of the document, set if requested.
+	Document string `json:"document,omitempty"`
+
+	// RelevanceScore is the relevance of the document to the query, between
+	// 0 and 1.
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+// RerankResponse is the response from [Client.Rerank].
+type RerankResponse struct {
+	Model string `json:"model"`
+
+	// Results are sorted by relevance, most relevant first.
+	Results []RerankResult `json:"results"`
+
+	TotalDuration   time.Duration `json:"total_duration,omitempty"`
+	LoadDuration    time.Duration `json:"load_duration,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+}
+
+// TranscribeRequest is the request passed to [Client.Transcribe].
+type TranscribeRequest struct {
+	// Model is the model name. It must be a model with the audio capability.
+	Model string `json:"model"`
+
+	// Audio is the WAV or FLAC audio to transcribe.
+	Audio AudioData `json:"audio"`
+
+	// Language is the ISO-639-1 code of the spoken language. It is detected
+	// from the start of the audio if empty.
+	Language string `json:"language,omitempty"`
+
+	// Prompt is text that precedes the audio, used to guide the spelling of
+	// names or the style of the transcription.
+	Prompt string `json:"prompt,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// TranscribeSegment is the transcription of part of the audio.
+type TranscribeSegment struct {
+	// Start and End are the offsets of the segment in seconds.
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+
+	Text string `json:"text"`
+}
+
+// TranscribeResponse is the response from [Client.Transcribe].
+type TranscribeResponse struct {
+	Model string `json:"model"`
+
+	// Text is the transcription of the whole audio.
+	Text string `json:"text"`
+
+	// Language is the ISO-639-1 code of the spoken language.
+	Language string `json:"language"`
+
+	// Duration is the length of the audio in seconds.
+	Duration float64 `json:"duration"`
+
+	Segments []TranscribeSegment `json:"segments"`
+
+	TotalDuration   time.Duration `json:"total_duration,omitempty"`
+	LoadDuration    time.Duration `json:"load_duration,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+}
+
 // EmbeddingRequest is the request passed to [Client.Embeddings].
 type EmbeddingRequest struct {
 	// Model is the model name.
@@ -660,6 +824,130 @@ type EmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
+// TokenizeRequest is the request passed to [Client.Tokenize].
+type TokenizeRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Content is the text to tokenize. It is tokenized as is, without a
+	// prompt template or special tokens added.
+	Content string `json:"content"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// TokenizeResponse is the response from [Client.Tokenize].
+type TokenizeResponse struct {
+	Model  string `json:"model"`
+	Tokens []int  `json:"tokens"`
+}
+
+// DetokenizeRequest is the request passed to [Client.Detokenize].
+type DetokenizeRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Tokens are the token IDs to convert back to text.
+	Tokens []int `json:"tokens"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// DetokenizeResponse is the response from [Client.Detokenize].
+type DetokenizeResponse struct {
+	Model   string `json:"model"`
+	Content string `json:"content"`
+}
+
+// CountTokensRequest is the request passed to [Client.CountTokens]. Its
+// fields match [ChatRequest] so a chat request can be counted before it is
+// sent.
+type CountTokensRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Messages is the messages of the chat conversation.
+	Messages []Message `json:"messages"`
+
+	// Tools is an optional list of tools the model has access to.
+	Tools `json:"tools,omitempty"`
+
+	// Think controls whether thinking/reasoning models will think before
+	// responding.
+	Think *ThinkValue `json:"think,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// CountTokensResponse is the response from [Client.CountTokens].
+type CountTokensResponse struct {
+	Model string `json:"model"`
+
+	// PromptEvalCount is the number of tokens in the prompt the request
+	// renders to, including the model's template, system prompt and tools.
+	PromptEvalCount int `json:"prompt_eval_count"`
+}
+
+// PerplexityRequest is the request passed to [Client.Perplexity].
+type PerplexityRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Content is the text to evaluate. It is split into windows of the
+	// model's context length and the second half of each window is scored,
+	// so every scored token has at least half a window of context.
+	Content string `json:"content"`
+
+	// TopLogprobs is the number of most likely tokens to return at each
+	// scored position, for comparing against another model.
+	TopLogprobs int `json:"top_logprobs,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
+// PerplexityResponse is the response passed to the function given to
+// [Client.Perplexity]. A response is sent for each window of the content,
+// followed by a final response with Done set.
+type PerplexityResponse struct {
+	Model string `json:"model"`
+
+	// Logprobs holds the log probability of each scored token in the window.
+	Logprobs []Logprob `json:"logprobs,omitempty"`
+
+	// Completed and Total are the number of windows scored so far and in
+	// total.
+	Completed int `json:"completed,omitempty"`
+	Total     int `json:"total,omitempty"`
+
+	Done bool `json:"done"`
+
+	// Perplexity is the perplexity over all scored tokens, set when Done.
+	Perplexity float64 `json:"perplexity,omitempty"`
+
+	// EvalCount is the number of tokens scored, set when Done.
+	EvalCount int `json:"eval_count,omitempty"`
+}
+
 // CreateRequest is the request passed to [Client.Create].
 type CreateRequest struct {
 	// Model is the model name to create.
@@ -683,6 +971,11 @@ type CreateRequest struct {
 	// Adapters is a map of LoRA adapters to include when creating the model.
 	Adapters map[string]string `json:"adapters,omitempty"`
 
+	// ControlVectors is a map of control vectors to include when creating the
+	// model. A GGUF file is one control vector, while safetensors files are
+	// converted together into one.
+	ControlVectors map[string]string `json:"control_vectors,omitempty"`
+
 	// Template is the template used when constructing a request to the model.
 	Template string `json:"template,omitempty"`
 
@@ -763,6 +1056,37 @@ type CopyRequest struct {
 	Destination string `json:"destination"`
 }
 
+// ExportRequest is the request passed to [Client.Export].
+type ExportRequest struct {
+	Model string `json:"model"`
+
+	// Offset resumes an interrupted export from the given byte offset of
+	// the archive. ETag must then be set to the ETag of the interrupted
+	// export; if the model has changed since, the export restarts from the
+	// beginning.
+	Offset int64  `json:"-"`
+	ETag   string `json:"-"`
+}
+
+// ExportResponse describes the archive stream passed to [ExportFunc].
+type ExportResponse struct {
+	// ETag identifies the archive contents for resuming an export.
+	ETag string
+
+	// Offset is the position in the archive the stream starts at. It is 0
+	// when the export was not resumed.
+	Offset int64
+
+	// Size is the total size of the archive in bytes.
+	Size int64
+}
+
+// ImportResponse is the response returned by [Client.Import].
+type ImportResponse struct {
+	// Models are the names of the models imported from the archive.
+	Models []string `json:"models"`
+}
+
 // PullRequest is the request passed to [Client.Pull].
 type PullRequest struct {
 	Model    string `json:"model"`
@@ -888,6 +1212,11 @@ type GenerateResponse struct {
 	// Total is the total number of steps for image generation.
 	// Only present for image generation models during streaming.
 	Total int64 `json:"total,omitempty"`
+
+	// Preview contains a base64-encoded low-resolution PNG of the image
+	// being generated. Only present for image generation models during
+	// streaming when GenerateRequest.Preview is set.
+	Preview string `json:"preview,omitempty"`
 }
 
 // ModelDetails provides details about a model.
@@ -932,6 +1261,10 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "prompt eval count:    %d token(s)\n", m.PromptEvalCount)
 	}
 
+	if m.PromptCachedCount > 0 {
+		fmt.Fprintf(os.Stderr, "prompt cached count:  %d token(s)\n", m.PromptCachedCount)
+	}
+
 	if m.PromptEvalDuration > 0 {
 		fmt.Fprintf(os.Stderr, "prompt eval duration: %s\n", m.PromptEvalDuration)
 		fmt.Fprintf(os.Stderr, "prompt eval rate:     %.2f tokens/s\n", float64(m.PromptEvalCount)/m.PromptEvalDuration.Seconds())
@@ -945,6 +1278,14 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "eval duration:        %s\n", m.EvalDuration)
 		fmt.Fprintf(os.Stderr, "eval rate:            %.2f tokens/s\n", float64(m.EvalCount)/m.EvalDuration.Seconds())
 	}
+
+	if m.TimeToFirstToken > 0 {
+		fmt.Fprintf(os.Stderr, "time to first token:  %s\n", m.TimeToFirstToken)
+	}
+
+	if m.InterTokenLatency > 0 {
+		fmt.Fprintf(os.Stderr, "inter-token latency:  %s\n", m.InterTokenLatency)
+	}
 }
 
 func (opts *Options) FromMap(m map[string]any) error {
@@ -1057,6 +1398,8 @@ func DefaultOptions() Options {
 		PresencePenalty:  0.0,
 		FrequencyPenalty: 0.0,
 		Seed:             -1,
+		AdapterScale:     1.0,
+		ControlStrength:  1.0,
 
 		Runner: Runner{
 			// options set when the model is loaded
@@ -1065,6 +1408,8 @@ func DefaultOptions() Options {
 			NumGPU:    -1, // -1 here indicates that NumGPU should be set dynamically
 			NumThread: 0,  // let the runtime decide
 			UseMMap:   nil,
+
+			NumPrefillChunk: int(envconfig.PrefillChunk()),
 		},
 	}
 }
@@ -232,6 +232,17 @@ func TestUseMmapFormatParams(t *testing.T) {
 	}
 }
 
+func TestNumPrefillChunk(t *testing.T) {
+	t.Setenv("OLLAMA_PREFILL_CHUNK", "64")
+
+	opts := DefaultOptions()
+	assert.Equal(t, 64, opts.NumPrefillChunk)
+
+	err := opts.FromMap(map[string]any{"num_prefill_chunk": float64(16)})
+	require.NoError(t, err)
+	assert.Equal(t, 16, opts.NumPrefillChunk)
+}
+
 func TestMessage_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		input    string
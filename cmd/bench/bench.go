@@ -30,6 +30,13 @@ type flagOptions struct {
 	outputFile  *string
 	debug       *bool
 	verbose     *bool
+
+	// load mode
+	concurrency *string
+	requests    *int
+	rate        *float64
+	arrival     *string
+	dataset     *string
 }
 
 type Metrics struct {
@@ -39,6 +46,11 @@ type Metrics struct {
 	Duration time.Duration
 }
 
+// tokens reports whether m counts tokens, rather than timing a request.
+func (m Metrics) tokens() bool {
+	return m.Step == "generate" || m.Step == "prefill" || m.Step == "throughput"
+}
+
 var once sync.Once
 
 const DefaultPrompt = `Please write a descriptive story about a llama named Alonso who grows up to be President of the Land of Llamas. Include details about Alonso's childhood, adolescent years, and how he grew up to be a political mover and shaker. Write the story with a sense of whimsy.`
@@ -54,7 +66,7 @@ func OutputMetrics(w io.Writer, format string, metrics []Metrics, verbose bool)
 			once.Do(printHeader)
 		}
 		for _, m := range metrics {
-			if m.Step == "generate" || m.Step == "prefill" {
+			if m.tokens() {
 				if m.Count > 0 {
 					nsPerToken := float64(m.Duration.Nanoseconds()) / float64(m.Count)
 					tokensPerSec := float64(m.Count) / (float64(m.Duration.Nanoseconds()) + 1e-12) * 1e9
@@ -67,8 +79,8 @@ func OutputMetrics(w io.Writer, format string, metrics []Metrics, verbose bool)
 				}
 			} else {
 				var suffix string
-				if m.Step == "load" {
-					suffix = "/step=load"
+				if m.Step != "total" {
+					suffix = "/step=" + m.Step
 				}
 				fmt.Fprintf(w, "BenchmarkModel/name=%s%s 1 %d ns/request\n",
 					m.Model, suffix, m.Duration.Nanoseconds())
@@ -82,7 +94,7 @@ func OutputMetrics(w io.Writer, format string, metrics []Metrics, verbose bool)
 		once.Do(printHeader)
 
 		for _, m := range metrics {
-			if m.Step == "generate" || m.Step == "prefill" {
+			if m.tokens() {
 				var nsPerToken float64
 				var tokensPerSec float64
 				if m.Count > 0 {
@@ -105,7 +117,7 @@ func OutputMetrics(w io.Writer, format string, metrics []Metrics, verbose bool)
 			var nsPerToken, tokensPerSec float64
 			var nsPerTokenStr, tokensPerSecStr string
 
-			if m.Step == "generate" || m.Step == "prefill" {
+			if m.tokens() {
 				nsPerToken = float64(m.Duration.Nanoseconds()) / float64(m.Count)
 				tokensPerSec = float64(m.Count) / (float64(m.Duration.Nanoseconds()) + 1e-12) * 1e9
 				nsPerTokenStr = fmt.Sprintf("%.2f", nsPerToken)
@@ -293,6 +305,11 @@ func main() {
 		outputFile:  flag.String("output", "", "Output file for results (stdout if empty)"),
 		verbose:     flag.Bool("v", false, "Show system information"),
 		debug:       flag.Bool("debug", false, "Show debug information"),
+		concurrency: flag.String("concurrency", "", "Run in load mode with these comma separated concurrency levels"),
+		requests:    flag.Int("requests", 32, "Number of requests per concurrency level in load mode"),
+		rate:        flag.Float64("rate", 0, "Request arrival rate per second in load mode (0 sends as fast as concurrency allows)"),
+		arrival:     flag.String("arrival", "constant", "Request arrival distribution in load mode [constant|poisson]"),
+		dataset:     flag.String("dataset", "", "JSONL file of prompts to use in load mode"),
 	}
 
 	flag.Usage = func() {
@@ -303,6 +320,7 @@ func main() {
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  bench -model gpt-oss:20b -epochs 3 -temperature 0.7\n")
+		fmt.Fprintf(os.Stderr, "  bench -model gpt-oss:20b -concurrency 1,4,8 -requests 64 -rate 2 -arrival poisson\n")
 	}
 	flag.Parse()
 
@@ -317,5 +335,12 @@ func main() {
 		return
 	}
 
+	if *fOpt.concurrency != "" {
+		if err := BenchmarkLoad(fOpt); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	BenchmarkChat(fOpt)
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// loadResult is the client side timing of a single request in load mode.
+type loadResult struct {
+	// ttft is the time from when the request was scheduled to be sent to
+	// receiving the first content or thinking
+	ttft time.Duration
+
+	// itl holds the gaps between later chunks. Each streamed chunk carries
+	// one token so these are the inter-token latencies.
+	itl []time.Duration
+
+	evalCount int
+	err       error
+}
+
+// datasetEntry is a line of a load mode dataset. Either Prompt or Messages
+// should be set.
+type datasetEntry struct {
+	Prompt   string        `json:"prompt"`
+	Messages []api.Message `json:"messages"`
+}
+
+// readDataset reads prompts for load mode from a JSONL file with one
+// {"prompt": "..."} or {"messages": [...]} object per line.
+func readDataset(r io.Reader) ([][]api.Message, error) {
+	var dataset [][]api.Message
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var e datasetEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		switch {
+		case len(e.Messages) > 0:
+			dataset = append(dataset, e.Messages)
+		case e.Prompt != "":
+			dataset = append(dataset, []api.Message{{Role: "user", Content: e.Prompt}})
+		default:
+			return nil, fmt.Errorf("line %d: expected prompt or messages", n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(dataset) == 0 {
+		return nil, errors.New("dataset is empty")
+	}
+
+	return dataset, nil
+}
+
+// parseConcurrency parses a comma separated list of concurrency levels.
+func parseConcurrency(s string) ([]int, error) {
+	var levels []int
+	for f := range strings.SplitSeq(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid concurrency %q", f)
+		}
+		levels = append(levels, n)
+	}
+	return levels, nil
+}
+
+// interarrival returns the time to wait before sending the next request for
+// the given rate in requests per second. A zero rate sends requests as soon
+// as a slot is free.
+func interarrival(arrival string, rate float64, rng *rand.Rand) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+
+	seconds := 1 / rate
+	if arrival == "poisson" {
+		seconds = rng.ExpFloat64() / rate
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// percentile returns the p-th percentile of sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// loadMetrics summarizes the results of a load run.
+func loadMetrics(name string, results []loadResult, elapsed time.Duration) []Metrics {
+	var ttfts, itls []time.Duration
+	var evalCount int
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		ttfts = append(ttfts, r.ttft)
+		itls = append(itls, r.itl...)
+		evalCount += r.evalCount
+	}
+
+	slices.Sort(ttfts)
+	slices.Sort(itls)
+
+	var metrics []Metrics
+	for _, p := range []float64{50, 90, 99} {
+		metrics = append(metrics, Metrics{
+			Model:    name,
+			Step:     fmt.Sprintf("ttft_p%d", int(p)),
+			Count:    len(ttfts),
+			Duration: percentile(ttfts, p),
+		})
+	}
+	for _, p := range []float64{50, 90, 99} {
+		metrics = append(metrics, Metrics{
+			Model:    name,
+			Step:     fmt.Sprintf("itl_p%d", int(p)),
+			Count:    len(itls),
+			Duration: percentile(itls, p),
+		})
+	}
+
+	// throughput is generated tokens across all requests over wall time
+	metrics = append(metrics, Metrics{
+		Model:    name,
+		Step:     "throughput",
+		Count:    evalCount,
+		Duration: elapsed,
+	})
+
+	return metrics
+}
+
+// loadRequest sends req and times the response from start, the time the
+// request was scheduled to be sent.
+func loadRequest(ctx context.Context, client *api.Client, req *api.ChatRequest, start time.Time, debug bool) loadResult {
+	var result loadResult
+
+	last := start
+	err := client.Chat(ctx, req, func(resp api.ChatResponse) error {
+		now := time.Now()
+		if resp.Message.Content != "" || resp.Message.Thinking != "" {
+			if result.ttft == 0 {
+				result.ttft = now.Sub(start)
+			} else {
+				result.itl = append(result.itl, now.Sub(last))
+			}
+			last = now
+
+			if debug {
+				fmt.Fprintf(os.Stderr, "%s", cmp.Or(resp.Message.Thinking, resp.Message.Content))
+			}
+		}
+
+		if resp.Done {
+			result.evalCount = resp.EvalCount
+		}
+		return nil
+	})
+	if err != nil {
+		result.err = err
+	} else if result.ttft == 0 {
+		result.err = errors.New("no tokens received")
+	}
+
+	return result
+}
+
+// BenchmarkLoad sends requests to each model concurrently, at each
+// concurrency level, and reports latency percentiles and throughput.
+func BenchmarkLoad(fOpt flagOptions) error {
+	models := strings.Split(*fOpt.models, ",")
+
+	levels, err := parseConcurrency(*fOpt.concurrency)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return err
+	}
+
+	if !slices.Contains([]string{"constant", "poisson"}, *fOpt.arrival) {
+		err := fmt.Errorf("unknown arrival distribution '%s'", *fOpt.arrival)
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return err
+	}
+
+	dataset := [][]api.Message{{{Role: "user", Content: *fOpt.prompt}}}
+	if *fOpt.dataset != "" {
+		f, err := os.Open(*fOpt.dataset)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Couldn't read dataset '%s': %v\n", *fOpt.dataset, err)
+			return err
+		}
+		dataset, err = readDataset(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Couldn't read dataset '%s': %v\n", *fOpt.dataset, err)
+			return err
+		}
+	} else if *fOpt.imageFile != "" {
+		imgData, err := readImage(*fOpt.imageFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Couldn't read image '%s': %v\n", *fOpt.imageFile, err)
+			return err
+		}
+		dataset[0][0].Images = []api.ImageData{imgData}
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Couldn't create ollama client: %v\n", err)
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if fOpt.outputFile != nil && *fOpt.outputFile != "" {
+		f, err := os.OpenFile(*fOpt.outputFile, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot open output file %s: %v\n", *fOpt.outputFile, err)
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	options := make(map[string]any)
+	if *fOpt.maxTokens > 0 {
+		options["num_predict"] = *fOpt.maxTokens
+	}
+	options["temperature"] = *fOpt.temperature
+	if fOpt.seed != nil && *fOpt.seed > 0 {
+		options["seed"] = *fOpt.seed
+	}
+
+	rng := rand.New(rand.NewPCG(uint64(*fOpt.seed), 0))
+
+	// failures are reported after every model and level has run
+	var failedLoads, failedRequests int
+	for _, model := range models {
+		// load the model first so the load time is not counted as latency
+		if err := client.Chat(context.Background(), &api.ChatRequest{Model: model}, func(api.ChatResponse) error { return nil }); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Couldn't load model '%s': %v\n", model, err)
+			failedLoads++
+			continue
+		}
+
+		for _, concurrency := range levels {
+			results := make([]loadResult, *fOpt.requests)
+			sem := make(chan struct{}, concurrency)
+
+			// With a rate, requests are sent on a schedule that does not
+			// depend on earlier responses and are timed from when they were
+			// scheduled, so time spent waiting for a free slot counts as
+			// latency. Without one, each request is sent when a slot frees.
+			open := *fOpt.rate > 0
+
+			var wg sync.WaitGroup
+			start := time.Now()
+			next := start
+			for i := range *fOpt.requests {
+				if open {
+					if i > 0 {
+						next = next.Add(interarrival(*fOpt.arrival, *fOpt.rate, rng))
+					}
+					time.Sleep(time.Until(next))
+				} else {
+					sem <- struct{}{}
+					next = time.Now()
+				}
+
+				wg.Add(1)
+				go func(scheduled time.Time) {
+					defer wg.Done()
+					if open {
+						sem <- struct{}{}
+					}
+					defer func() { <-sem }()
+
+					ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*fOpt.timeout)*time.Second)
+					defer cancel()
+
+					results[i] = loadRequest(ctx, client, &api.ChatRequest{
+						Model:    model,
+						Messages: dataset[i%len(dataset)],
+						Options:  options,
+					}, scheduled, *fOpt.debug)
+				}(next)
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+
+			if *fOpt.debug {
+				fmt.Fprintln(os.Stderr)
+			}
+
+			var failed int
+			for _, r := range results {
+				if r.err != nil {
+					failed++
+					if *fOpt.debug {
+						fmt.Fprintf(os.Stderr, "ERROR: request to model '%s' failed: %v\n", model, r.err)
+					}
+				}
+			}
+			if failed > 0 {
+				fmt.Fprintf(os.Stderr, "WARNING: %d of %d requests to model '%s' failed at concurrency %d\n", failed, len(results), model, concurrency)
+				failedRequests += failed
+			}
+
+			name := fmt.Sprintf("%s/concurrency=%d", model, concurrency)
+			OutputMetrics(out, *fOpt.format, loadMetrics(name, results, elapsed), *fOpt.verbose)
+		}
+	}
+
+	var errs []error
+	if failedLoads > 0 {
+		errs = append(errs, fmt.Errorf("%d model(s) failed to load", failedLoads))
+	}
+	if failedRequests > 0 {
+		errs = append(errs, fmt.Errorf("%d requests failed", failedRequests))
+	}
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return err
+	}
+
+	return nil
+}
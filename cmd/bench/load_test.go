@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func createLoadFlagOptions(concurrency string) flagOptions {
+	fOpt := createTestFlagOptions()
+	requests := 8
+	rate := 0.0
+	arrival := "constant"
+	dataset := ""
+	fOpt.concurrency = &concurrency
+	fOpt.requests = &requests
+	fOpt.rate = &rate
+	fOpt.arrival = &arrival
+	fOpt.dataset = &dataset
+	return fOpt
+}
+
+func TestReadDataset(t *testing.T) {
+	input := `{"prompt": "Why is the sky blue?"}
+
+{"messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Hi"}]}
+`
+	dataset, err := readDataset(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]api.Message{
+		{{Role: "user", Content: "Why is the sky blue?"}},
+		{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Hi"}},
+	}
+	if diff := cmp.Diff(want, dataset); diff != "" {
+		t.Errorf("dataset mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, input := range []string{"", `{"prompt": ""}`, `not json`} {
+		if _, err := readDataset(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestParseConcurrency(t *testing.T) {
+	levels, err := parseConcurrency("1, 4,8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 4, 8}, levels); diff != "" {
+		t.Errorf("levels mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []string{"0", "a", "1,,2", "-2"} {
+		if _, err := parseConcurrency(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	cases := map[float64]time.Duration{
+		50: 50 * time.Millisecond,
+		90: 90 * time.Millisecond,
+		99: 99 * time.Millisecond,
+	}
+	for p, want := range cases {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%v: expected %v, got %v", p, want, got)
+		}
+	}
+
+	if got := percentile([]time.Duration{time.Second}, 99); got != time.Second {
+		t.Errorf("expected single value, got %v", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("expected 0 for no values, got %v", got)
+	}
+}
+
+func TestInterarrival(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 0))
+
+	if got := interarrival("constant", 0, rng); got != 0 {
+		t.Errorf("expected no wait without a rate, got %v", got)
+	}
+	if got := interarrival("constant", 4, rng); got != 250*time.Millisecond {
+		t.Errorf("expected 250ms, got %v", got)
+	}
+
+	// poisson arrivals should average out to the rate
+	var total time.Duration
+	const n = 10000
+	for range n {
+		total += interarrival("poisson", 4, rng)
+	}
+	if mean := total / n; mean < 240*time.Millisecond || mean > 260*time.Millisecond {
+		t.Errorf("expected mean near 250ms, got %v", mean)
+	}
+}
+
+func TestBenchmarkLoad(t *testing.T) {
+	var mu sync.Mutex
+	var inflight, maxInflight, requests int
+	var prompts []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// the request loading the model has no messages
+		if len(req.Messages) == 0 {
+			json.NewEncoder(w).Encode(api.ChatResponse{Model: req.Model, Done: true, DoneReason: "load"})
+			return
+		}
+
+		mu.Lock()
+		inflight++
+		requests++
+		maxInflight = max(maxInflight, inflight)
+		prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+		}()
+
+		for i, content := range []string{"Hello", " there", "!"} {
+			time.Sleep(10 * time.Millisecond)
+			json.NewEncoder(w).Encode(api.ChatResponse{
+				Model:   req.Model,
+				Message: api.Message{Role: "assistant", Content: content},
+				Done:    i == 2,
+				Metrics: api.Metrics{EvalCount: 3},
+			})
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	dataset := filepath.Join(t.TempDir(), "prompts.jsonl")
+	if err := os.WriteFile(dataset, []byte(`{"prompt": "one"}`+"\n"+`{"prompt": "two"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fOpt := createLoadFlagOptions("2")
+	*fOpt.dataset = dataset
+
+	output := captureOutput(func() {
+		if err := BenchmarkLoad(fOpt); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	if requests != 8 {
+		t.Errorf("expected 8 requests, got %d", requests)
+	}
+	if maxInflight != 2 {
+		t.Errorf("expected 2 concurrent requests, got %d", maxInflight)
+	}
+	if strings.Count(strings.Join(prompts, ","), "one") != 4 {
+		t.Errorf("expected the dataset to be cycled through, got %v", prompts)
+	}
+
+	for _, step := range []string{"ttft_p50", "ttft_p90", "ttft_p99", "itl_p50", "itl_p90", "itl_p99"} {
+		if !strings.Contains(output, "BenchmarkModel/name=test-model/concurrency=2/step="+step+" 1 ") {
+			t.Errorf("Expected output to contain %s, got: %s", step, output)
+		}
+	}
+	if !strings.Contains(output, "BenchmarkModel/name=test-model/concurrency=2/step=throughput 24 ") {
+		t.Errorf("Expected output to contain throughput of 24 tokens, got: %s", output)
+	}
+}
+
+func TestBenchmarkLoad_Rate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(req.Messages) > 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(api.ChatResponse{
+			Model:   req.Model,
+			Message: api.Message{Role: "assistant", Content: "Hello"},
+			Done:    true,
+		})
+	}))
+	defer server.Close()
+
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	// requests arrive every 10ms but one at a time takes 50ms, so the last
+	// of 4 waits about 120ms for a slot before it is sent
+	fOpt := createLoadFlagOptions("1")
+	*fOpt.requests = 4
+	*fOpt.rate = 100
+
+	output := captureOutput(func() {
+		if err := BenchmarkLoad(fOpt); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	var ttft time.Duration
+	for line := range strings.Lines(output) {
+		if rest, ok := strings.CutPrefix(line, "BenchmarkModel/name=test-model/concurrency=1/step=ttft_p99 1 "); ok {
+			if _, err := fmt.Sscanf(rest, "%d ns/request", &ttft); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if ttft < 150*time.Millisecond {
+		t.Errorf("expected ttft to include the time waiting for a slot, got %v: %s", ttft, output)
+	}
+}
+
+func TestBenchmarkLoad_Failures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+
+		switch {
+		case req.Model == "missing":
+			http.Error(w, `{"error":"model 'missing' not found"}`, http.StatusNotFound)
+		case len(req.Messages) > 0 && req.Messages[0].Content == "two":
+			http.Error(w, `{"error":"boom"}`, http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(api.ChatResponse{
+				Model:   req.Model,
+				Message: api.Message{Role: "assistant", Content: "Hello"},
+				Done:    true,
+			})
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	dataset := filepath.Join(t.TempDir(), "prompts.jsonl")
+	if err := os.WriteFile(dataset, []byte(`{"prompt": "one"}`+"\n"+`{"prompt": "two"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fOpt := createLoadFlagOptions("2")
+	*fOpt.models = "test-model,missing"
+	*fOpt.dataset = dataset
+
+	var err error
+	captureOutput(func() {
+		err = BenchmarkLoad(fOpt)
+	})
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"1 model(s) failed to load", "4 requests failed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestBenchmarkLoad_InvalidOptions(t *testing.T) {
+	fOpt := createLoadFlagOptions("0")
+	captureOutput(func() {
+		if err := BenchmarkLoad(fOpt); err == nil {
+			t.Error("Expected error for invalid concurrency")
+		}
+	})
+
+	fOpt = createLoadFlagOptions("1")
+	*fOpt.arrival = "uniform"
+	captureOutput(func() {
+		if err := BenchmarkLoad(fOpt); err == nil {
+			t.Error("Expected error for unknown arrival distribution")
+		}
+	})
+}
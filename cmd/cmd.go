@@ -45,10 +45,12 @@ import (
 	"github.com/ollama/ollama/types/model"
 	"github.com/ollama/ollama/types/syncmap"
 	"github.com/ollama/ollama/version"
+	xagent "github.com/ollama/ollama/x/agent"
 	xcmd "github.com/ollama/ollama/x/cmd"
 	"github.com/ollama/ollama/x/create"
 	xcreateclient "github.com/ollama/ollama/x/create/client"
 	"github.com/ollama/ollama/x/imagegen"
+	xtools "github.com/ollama/ollama/x/tools"
 )
 
 const ConnectInstructions = "To sign in, navigate to:\n    %s\n\n"
@@ -249,12 +251,25 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		})
 	}
 
+	controlVectors := syncmap.NewSyncMap[string, string]()
+	for f, digest := range req.ControlVectors {
+		g.Go(func() error {
+			if _, err := createBlob(cmd, client, f, digest, p); err != nil {
+				return err
+			}
+
+			controlVectors.Store(filepath.Base(f), digest)
+			return nil
+		})
+	}
+
 	if err := g.Wait(); err != nil {
 		return err
 	}
 
 	req.Files = files.Items()
 	req.Adapters = adapters.Items()
+	req.ControlVectors = controlVectors.Items()
 
 	bars := make(map[string]*progress.Bar)
 	fn := func(resp api.ProgressResponse) error {
@@ -612,6 +627,10 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 	yoloMode, _ := cmd.Flags().GetBool("experimental-yolo")
 	enableWebsearch, _ := cmd.Flags().GetBool("experimental-websearch")
 
+	if isAgent, _ := cmd.Flags().GetBool("agent"); isAgent {
+		return runAgent(cmd, client, opts, info, yoloMode, enableWebsearch)
+	}
+
 	if interactive {
 		if err := loadOrUnloadModel(cmd, &opts); err != nil {
 			var sErr api.AuthorizationError
@@ -648,6 +667,63 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 	return generate(cmd, opts)
 }
 
+// runAgent runs the agent loop non-interactively and writes a JSON-lines
+// transcript to stdout.
+func runAgent(cmd *cobra.Command, client *api.Client, opts runOptions, info *api.ShowResponse, yoloMode, enableWebsearch bool) error {
+	prompt, err := cmd.Flags().GetString("prompt")
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		prompt = opts.Prompt
+	}
+	if prompt == "" {
+		return errors.New("agent mode requires a prompt. Usage: ollama run " + opts.Model + " --agent -p \"your task\"")
+	}
+
+	allow, err := cmd.Flags().GetStringSlice("agent-allow")
+	if err != nil {
+		return err
+	}
+	if yoloMode {
+		allow = append(allow, "*")
+	}
+
+	maxTurns, err := cmd.Flags().GetInt("agent-max-turns")
+	if err != nil {
+		return err
+	}
+
+	timeout, err := cmd.Flags().GetDuration("agent-timeout")
+	if err != nil {
+		return err
+	}
+
+	var toolRegistry *xtools.Registry
+	if slices.Contains(info.Capabilities, model.CapabilityTools) {
+		toolRegistry = xtools.DefaultRegistry()
+		if enableWebsearch {
+			toolRegistry.RegisterWebSearch()
+			toolRegistry.RegisterWebFetch()
+		}
+	}
+
+	return xcmd.RunAgent(cmd.Context(), client, xcmd.AgentOptions{
+		Model:     opts.Model,
+		Prompt:    prompt,
+		Format:    opts.Format,
+		Options:   opts.Options,
+		KeepAlive: opts.KeepAlive,
+		Think:     opts.Think,
+		Tools:     toolRegistry,
+		Policy: xagent.Policy{
+			AutoApprove: allow,
+			MaxTurns:    maxTurns,
+			MaxDuration: timeout,
+		},
+	})
+}
+
 func SigninHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -1868,6 +1944,11 @@ func NewCLI() *cobra.Command {
 	runCmd.Flags().Bool("experimental", false, "Enable experimental agent loop with tools")
 	runCmd.Flags().Bool("experimental-yolo", false, "Skip all tool approval prompts (use with caution)")
 	runCmd.Flags().Bool("experimental-websearch", false, "Enable web search tool in experimental mode")
+	runCmd.Flags().Bool("agent", false, "Run the agent loop non-interactively and print a JSON-lines transcript")
+	runCmd.Flags().StringP("prompt", "p", "", "Task for the non-interactive agent (--agent)")
+	runCmd.Flags().StringSlice("agent-allow", nil, "Tools the non-interactive agent may run without approval (e.g. bash, \"bash:go test\", bash:cat:src/, web_search, *)")
+	runCmd.Flags().Int("agent-max-turns", 20, "Maximum model turns for the non-interactive agent (0 for unlimited)")
+	runCmd.Flags().Duration("agent-timeout", 0, "Maximum run time for the non-interactive agent (e.g. 10m)")
 
 	// Image generation flags (width, height, steps, seed, etc.)
 	imagegen.RegisterFlags(runCmd)
@@ -1946,6 +2027,66 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	exportCmd := &cobra.Command{
+		Use:   "export MODEL",
+		Short: "Export a model to a tar archive",
+		Long: `Export a model and all of its layers to a tar archive that can be imported
+with "ollama import". The archive is written to stdout unless --output is
+set. An interrupted export to a file resumes when run again.`,
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ExportHandler,
+	}
+
+	exportCmd.Flags().StringP("output", "o", "", "Write the archive to a file instead of stdout")
+
+	importCmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import models from a tar archive",
+		Long: `Import models from an archive created by "ollama export". Use - to read the
+archive from stdin. Layers that already exist are not written again.`,
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ImportHandler,
+	}
+
+	evalCmd := &cobra.Command{
+		Use:   "eval MODEL",
+		Short: "Evaluate a model against a test suite",
+		Long: `Run each case of a JSONL test suite against a model and report the pass
+rate of each scorer. Cases are scored by exact match, regular expression,
+JSON schema validity, or for multiple choice, by the likelihood of each
+choice. Results written with --output can be compared between models with
+diff or passed to --baseline.`,
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    EvalHandler,
+	}
+
+	evalCmd.Flags().String("suite", "", "Test suite to evaluate (JSONL)")
+	evalCmd.Flags().StringP("output", "o", "", "Write the result of each case to a file (JSONL)")
+	evalCmd.Flags().String("baseline", "", "Compare against a previous results file")
+	_ = evalCmd.MarkFlagRequired("suite")
+
+	perplexityCmd := &cobra.Command{
+		Use:   "perplexity MODEL",
+		Short: "Measure the perplexity of a model on a text file",
+		Long: `Measure the perplexity of a model on a text file. The text is split into
+windows of the model's context length, set with OLLAMA_CONTEXT_LENGTH, and
+the second half of each window is scored. With --reference, the model is also
+compared to a reference model, such as the unquantized version of the same
+model, by the KL divergence of its predictions and how often both predict the
+same most likely token.`,
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    PerplexityHandler,
+	}
+
+	perplexityCmd.Flags().String("file", "", "Text file to score")
+	perplexityCmd.Flags().String("reference", "", "Reference model to compare against")
+	perplexityCmd.Flags().Int("top", 20, "Number of most likely tokens to compare with the reference model (max 20)")
+	_ = perplexityCmd.MarkFlagRequired("file")
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1980,6 +2121,10 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		psCmd,
 		copyCmd,
+		exportCmd,
+		importCmd,
+		evalCmd,
+		perplexityCmd,
 		deleteCmd,
 		serveCmd,
 	} {
@@ -2024,6 +2169,10 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		psCmd,
 		copyCmd,
+		exportCmd,
+		importCmd,
+		evalCmd,
+		perplexityCmd,
 		deleteCmd,
 		runnerCmd,
 	)
@@ -0,0 +1,645 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/progress"
+)
+
+// Eval scorers
+const (
+	scorerExact      = "exact"
+	scorerRegex      = "regex"
+	scorerJSONSchema = "json_schema"
+	scorerChoice     = "choice"
+)
+
+// evalCase is a line of an eval suite.
+type evalCase struct {
+	ID string `json:"id"`
+
+	// Prompt or Messages is sent to the model as a chat
+	Prompt   string        `json:"prompt,omitempty"`
+	Messages []api.Message `json:"messages,omitempty"`
+
+	Scorer string `json:"scorer"`
+
+	// Answer is the expected response for exact, or the correct choice for
+	// choice
+	Answer string `json:"answer,omitempty"`
+
+	// Pattern is the regular expression the response must match for regex
+	Pattern string `json:"pattern,omitempty"`
+
+	// Schema is the JSON schema the response must be valid against for
+	// json_schema
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	// Choices are the options for choice. They are labelled A, B, C, ...
+	// after the prompt and scored by the likelihood of each label as the
+	// first token of the response.
+	Choices []string `json:"choices,omitempty"`
+
+	Options map[string]any `json:"options,omitempty"`
+
+	pattern *regexp.Regexp
+	schema  any
+}
+
+// evalResult is a line of an eval results file. Results are written in suite
+// order without timing or model details so files from two models can be
+// compared with diff.
+type evalResult struct {
+	ID     string  `json:"id"`
+	Scorer string  `json:"scorer"`
+	Passed bool    `json:"passed"`
+	Score  float64 `json:"score"`
+	Output string  `json:"output"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// readEvalSuite reads and validates an eval suite in JSONL format.
+func readEvalSuite(r io.Reader) ([]*evalCase, error) {
+	var cases []*evalCase
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var c evalCase
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		if c.ID == "" {
+			return nil, fmt.Errorf("line %d: id is required", n)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("line %d: duplicate id %q", n, c.ID)
+		}
+		seen[c.ID] = true
+
+		if c.Prompt == "" && len(c.Messages) == 0 {
+			return nil, fmt.Errorf("%s: prompt or messages is required", c.ID)
+		}
+
+		switch c.Scorer {
+		case scorerExact:
+			if c.Answer == "" {
+				return nil, fmt.Errorf("%s: answer is required", c.ID)
+			}
+		case scorerRegex:
+			p, err := regexp.Compile(c.Pattern)
+			if err != nil || c.Pattern == "" {
+				return nil, fmt.Errorf("%s: invalid pattern %q", c.ID, c.Pattern)
+			}
+			c.pattern = p
+		case scorerJSONSchema:
+			if err := json.Unmarshal(c.Schema, &c.schema); err != nil {
+				return nil, fmt.Errorf("%s: invalid schema: %w", c.ID, err)
+			}
+		case scorerChoice:
+			if len(c.Choices) < 2 || len(c.Choices) > 26 {
+				return nil, fmt.Errorf("%s: between 2 and 26 choices are required", c.ID)
+			}
+			if !slices.Contains(c.Choices, c.Answer) {
+				return nil, fmt.Errorf("%s: answer %q is not one of the choices", c.ID, c.Answer)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown scorer %q", c.ID, c.Scorer)
+		}
+
+		cases = append(cases, &c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cases) == 0 {
+		return nil, errors.New("suite is empty")
+	}
+
+	return cases, nil
+}
+
+func choiceLabel(i int) string {
+	return string(rune('A' + i))
+}
+
+// request returns the chat request for c.
+func (c *evalCase) request(model string) *api.ChatRequest {
+	messages := slices.Clone(c.Messages)
+	if c.Prompt != "" {
+		messages = append(messages, api.Message{Role: "user", Content: c.Prompt})
+	}
+
+	// default to greedy sampling so results are repeatable
+	options := map[string]any{"temperature": 0}
+	for k, v := range c.Options {
+		options[k] = v
+	}
+
+	stream := false
+	req := &api.ChatRequest{
+		Model:    model,
+		Messages: messages,
+		Options:  options,
+		Stream:   &stream,
+	}
+
+	if c.Scorer == scorerChoice {
+		var sb strings.Builder
+		sb.WriteString(messages[len(messages)-1].Content)
+		sb.WriteString("\n\n")
+		for i, choice := range c.Choices {
+			fmt.Fprintf(&sb, "%s. %s\n", choiceLabel(i), choice)
+		}
+		sb.WriteString("\nAnswer with the letter of the correct choice.")
+		messages[len(messages)-1].Content = sb.String()
+
+		// only the distribution of the first token is needed
+		options["num_predict"] = 1
+		req.Logprobs = true
+		req.TopLogprobs = 20
+		req.Think = &api.ThinkValue{Value: false}
+	}
+
+	return req
+}
+
+// score scores the response to c.
+func (c *evalCase) score(resp api.ChatResponse) evalResult {
+	result := evalResult{ID: c.ID, Scorer: c.Scorer, Output: resp.Message.Content}
+
+	switch c.Scorer {
+	case scorerExact:
+		result.Passed = strings.TrimSpace(resp.Message.Content) == strings.TrimSpace(c.Answer)
+	case scorerRegex:
+		result.Passed = c.pattern.MatchString(resp.Message.Content)
+	case scorerJSONSchema:
+		var v any
+		if err := json.Unmarshal([]byte(trimCodeFence(resp.Message.Content)), &v); err != nil {
+			result.Error = fmt.Sprintf("invalid JSON: %v", err)
+		} else if err := validateSchema(c.schema, v, "$"); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Passed = true
+		}
+	case scorerChoice:
+		return c.scoreChoice(resp)
+	}
+
+	if result.Passed {
+		result.Score = 1
+	}
+	return result
+}
+
+// scoreChoice scores a choice case by the log probability of each choice's
+// label as the first token of the response. The score is the probability of
+// the correct label normalized over all labels.
+func (c *evalCase) scoreChoice(resp api.ChatResponse) evalResult {
+	result := evalResult{ID: c.ID, Scorer: c.Scorer}
+
+	if len(resp.Logprobs) == 0 {
+		result.Error = "no logprobs in response"
+		return result
+	}
+
+	logprobs := make([]float64, len(c.Choices))
+	for i := range logprobs {
+		logprobs[i] = math.Inf(-1)
+	}
+
+	for _, top := range resp.Logprobs[0].TopLogprobs {
+		token := strings.TrimRight(strings.TrimSpace(top.Token), ".):")
+		for i := range c.Choices {
+			if token == choiceLabel(i) {
+				logprobs[i] = max(logprobs[i], top.Logprob)
+			}
+		}
+	}
+
+	best := 0
+	var total float64
+	for i, lp := range logprobs {
+		total += math.Exp(lp)
+		if lp > logprobs[best] {
+			best = i
+		}
+	}
+
+	if math.IsInf(logprobs[best], -1) {
+		result.Output = resp.Logprobs[0].Token
+		result.Error = "no choice in top logprobs"
+		return result
+	}
+
+	answer := slices.Index(c.Choices, c.Answer)
+	result.Output = choiceLabel(best)
+	result.Passed = best == answer
+	result.Score = math.Exp(logprobs[answer]) / total
+	return result
+}
+
+// trimCodeFence removes a markdown code fence around s, if any.
+func trimCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "```"); ok {
+		// drop the language tag
+		if _, body, ok := strings.Cut(rest, "\n"); ok {
+			rest = body
+		}
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rest), "```"))
+	}
+	return s
+}
+
+// validateSchema checks v against a JSON schema. It supports the subset of
+// JSON schema used for structured outputs: type, enum, const, properties,
+// required, additionalProperties, items, min/max items, lengths and values,
+// pattern, and allOf, anyOf and oneOf.
+func validateSchema(schema, v any, path string) error {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		// true or an empty schema allows anything
+		if b, ok := schema.(bool); ok && !b {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	}
+
+	if t, ok := s["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []any:
+			for _, t := range t {
+				if t, ok := t.(string); ok {
+					types = append(types, t)
+				}
+			}
+		}
+		if !slices.ContainsFunc(types, func(t string) bool { return schemaTypeMatches(t, v) }) {
+			return fmt.Errorf("%s: expected %s", path, strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, v) }) {
+			return fmt.Errorf("%s: not one of the allowed values", path)
+		}
+	}
+
+	if c, ok := s["const"]; ok && !jsonEqual(c, v) {
+		return fmt.Errorf("%s: expected %v", path, c)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, ok := v[name]; !ok {
+						return fmt.Errorf("%s: missing required property %q", path, name)
+					}
+				}
+			}
+		}
+
+		properties, _ := s["properties"].(map[string]any)
+		for name, value := range v {
+			if p, ok := properties[name]; ok {
+				if err := validateSchema(p, value, path+"."+name); err != nil {
+					return err
+				}
+			} else if additional, ok := s["additionalProperties"]; ok {
+				if err := validateSchema(additional, value, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if n, ok := s["minItems"].(float64); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: expected at least %v items", path, n)
+		}
+		if n, ok := s["maxItems"].(float64); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: expected at most %v items", path, n)
+		}
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		if n, ok := s["minLength"].(float64); ok && float64(len([]rune(v))) < n {
+			return fmt.Errorf("%s: expected at least %v characters", path, n)
+		}
+		if n, ok := s["maxLength"].(float64); ok && float64(len([]rune(v))) > n {
+			return fmt.Errorf("%s: expected at most %v characters", path, n)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern %q", path, p)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: does not match %q", path, p)
+			}
+		}
+	case float64:
+		if n, ok := s["minimum"].(float64); ok && v < n {
+			return fmt.Errorf("%s: expected at least %v", path, n)
+		}
+		if n, ok := s["maximum"].(float64); ok && v > n {
+			return fmt.Errorf("%s: expected at most %v", path, n)
+		}
+		if n, ok := s["exclusiveMinimum"].(float64); ok && v <= n {
+			return fmt.Errorf("%s: expected more than %v", path, n)
+		}
+		if n, ok := s["exclusiveMaximum"].(float64); ok && v >= n {
+			return fmt.Errorf("%s: expected less than %v", path, n)
+		}
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			if err := validateSchema(sub, v, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		if !slices.ContainsFunc(anyOf, func(sub any) bool { return validateSchema(sub, v, path) == nil }) {
+			return fmt.Errorf("%s: does not match any allowed schema", path)
+		}
+	}
+
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		var matches int
+		for _, sub := range oneOf {
+			if validateSchema(sub, v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: matches %d schemas, expected exactly one", path, matches)
+		}
+	}
+
+	return nil
+}
+
+func schemaTypeMatches(t string, v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
+
+func jsonEqual(a, b any) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ja) == string(jb)
+}
+
+// readEvalResults reads an eval results file.
+func readEvalResults(r io.Reader) (map[string]evalResult, error) {
+	results := make(map[string]evalResult)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var result evalResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, err
+		}
+		results[result.ID] = result
+	}
+
+	return results, scanner.Err()
+}
+
+// summarizeEval writes the pass rate of each scorer, and the cases that
+// changed from a baseline if there is one. It returns the number of cases
+// that passed in the baseline but not in results.
+func summarizeEval(w io.Writer, results []evalResult, baseline map[string]evalResult) int {
+	type summary struct {
+		cases, passed int
+		score         float64
+	}
+
+	summaries := make(map[string]*summary)
+	var scorers []string
+	var total summary
+	for _, r := range results {
+		s, ok := summaries[r.Scorer]
+		if !ok {
+			s = &summary{}
+			summaries[r.Scorer] = s
+			scorers = append(scorers, r.Scorer)
+		}
+
+		for _, s := range []*summary{s, &total} {
+			s.cases++
+			s.score += r.Score
+			if r.Passed {
+				s.passed++
+			}
+		}
+	}
+
+	row := func(name string, s *summary) []string {
+		return []string{
+			name,
+			fmt.Sprint(s.cases),
+			fmt.Sprint(s.passed),
+			fmt.Sprintf("%.1f%%", float64(s.passed)/float64(s.cases)*100),
+			fmt.Sprintf("%.3f", s.score/float64(s.cases)),
+		}
+	}
+
+	var data [][]string
+	for _, scorer := range scorers {
+		data = append(data, row(scorer, summaries[scorer]))
+	}
+	data = append(data, row("total", &total))
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"SCORER", "CASES", "PASSED", "ACCURACY", "SCORE"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	if baseline == nil {
+		return 0
+	}
+
+	var regressed, improved []string
+	for _, r := range results {
+		b, ok := baseline[r.ID]
+		if !ok {
+			continue
+		}
+		switch {
+		case b.Passed && !r.Passed:
+			regressed = append(regressed, r.ID)
+		case !b.Passed && r.Passed:
+			improved = append(improved, r.ID)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d regressed, %d improved compared to the baseline\n", len(regressed), len(improved))
+	for _, id := range regressed {
+		fmt.Fprintf(w, "  - %s\n", id)
+	}
+	for _, id := range improved {
+		fmt.Fprintf(w, "  + %s\n", id)
+	}
+
+	return len(regressed)
+}
+
+func EvalHandler(cmd *cobra.Command, args []string) error {
+	suitePath, err := cmd.Flags().GetString("suite")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	baselinePath, err := cmd.Flags().GetString("baseline")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(suitePath)
+	if err != nil {
+		return err
+	}
+	cases, err := readEvalSuite(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", suitePath, err)
+	}
+
+	var baseline map[string]evalResult
+	if baselinePath != "" {
+		f, err := os.Open(baselinePath)
+		if err != nil {
+			return err
+		}
+		baseline, err = readEvalResults(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", baselinePath, err)
+		}
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	spinner := progress.NewSpinner("")
+	p.Add("", spinner)
+
+	results := make([]evalResult, 0, len(cases))
+	for i, c := range cases {
+		spinner.SetMessage(fmt.Sprintf("evaluating %s (%d/%d)", args[0], i+1, len(cases)))
+
+		var resp api.ChatResponse
+		err := client.Chat(cmd.Context(), c.request(args[0]), func(r api.ChatResponse) error {
+			resp = r
+			return nil
+		})
+
+		var statusErr api.StatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode < 500:
+			// the server rejected this case's request, e.g. its messages
+			// are invalid for the model, so count it as failed rather than
+			// stopping the run
+			results = append(results, evalResult{ID: c.ID, Scorer: c.Scorer, Error: err.Error()})
+		case err != nil:
+			p.Stop()
+			return err
+		default:
+			results = append(results, c.score(resp))
+		}
+	}
+	p.StopAndClear()
+
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		enc := json.NewEncoder(f)
+		for _, r := range results {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	// fail so scripts comparing against a baseline can detect regressions
+	if regressed := summarizeEval(os.Stdout, results, baseline); regressed > 0 {
+		return fmt.Errorf("%d case(s) regressed compared to the baseline", regressed)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestReadEvalSuite(t *testing.T) {
+	input := `{"id": "capital", "prompt": "What is the capital of France?", "scorer": "exact", "answer": "Paris"}
+
+{"id": "digits", "prompt": "Pick a number", "scorer": "regex", "pattern": "^\\d+$"}
+{"id": "json", "prompt": "Describe a cat", "scorer": "json_schema", "schema": {"type": "object"}}
+{"id": "mc", "messages": [{"role": "user", "content": "2+2?"}], "scorer": "choice", "choices": ["3", "4"], "answer": "4"}
+`
+	cases, err := readEvalSuite(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, c := range cases {
+		ids = append(ids, c.ID)
+	}
+	if diff := cmp.Diff([]string{"capital", "digits", "json", "mc"}, ids); diff != "" {
+		t.Errorf("ids mismatch (-want +got):\n%s", diff)
+	}
+
+	invalid := map[string]string{
+		"empty":            ``,
+		"not json":         `not json`,
+		"missing id":       `{"prompt": "hi", "scorer": "exact", "answer": "hi"}`,
+		"duplicate id":     `{"id": "a", "prompt": "hi", "scorer": "exact", "answer": "hi"}` + "\n" + `{"id": "a", "prompt": "hi", "scorer": "exact", "answer": "hi"}`,
+		"missing prompt":   `{"id": "a", "scorer": "exact", "answer": "hi"}`,
+		"unknown scorer":   `{"id": "a", "prompt": "hi", "scorer": "fuzzy"}`,
+		"missing answer":   `{"id": "a", "prompt": "hi", "scorer": "exact"}`,
+		"invalid pattern":  `{"id": "a", "prompt": "hi", "scorer": "regex", "pattern": "("}`,
+		"missing schema":   `{"id": "a", "prompt": "hi", "scorer": "json_schema"}`,
+		"one choice":       `{"id": "a", "prompt": "hi", "scorer": "choice", "choices": ["x"], "answer": "x"}`,
+		"answer not found": `{"id": "a", "prompt": "hi", "scorer": "choice", "choices": ["x", "y"], "answer": "z"}`,
+	}
+	for name, input := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readEvalSuite(strings.NewReader(input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestEvalCaseRequest(t *testing.T) {
+	c := evalCase{
+		ID:      "mc",
+		Prompt:  "What is 2+2?",
+		Scorer:  scorerChoice,
+		Choices: []string{"3", "4"},
+		Answer:  "4",
+		Options: map[string]any{"seed": 42},
+	}
+
+	req := c.request("test")
+	if !req.Logprobs || req.TopLogprobs == 0 {
+		t.Error("expected logprobs to be requested")
+	}
+	if diff := cmp.Diff(map[string]any{"temperature": 0, "num_predict": 1, "seed": 42}, req.Options); diff != "" {
+		t.Errorf("options mismatch (-want +got):\n%s", diff)
+	}
+
+	want := "What is 2+2?\n\nA. 3\nB. 4\n\nAnswer with the letter of the correct choice."
+	if diff := cmp.Diff(want, req.Messages[0].Content); diff != "" {
+		t.Errorf("prompt mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEvalCaseScore(t *testing.T) {
+	suite := `{"id": "exact", "prompt": "hi", "scorer": "exact", "answer": "Paris"}
+{"id": "regex", "prompt": "hi", "scorer": "regex", "pattern": "^\\d+$"}
+{"id": "json", "prompt": "hi", "scorer": "json_schema", "schema": {"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}}
+`
+	cases, err := readEvalSuite(strings.NewReader(suite))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		c      *evalCase
+		output string
+		passed bool
+	}{
+		{cases[0], " Paris\n", true},
+		{cases[0], "paris", false},
+		{cases[1], "42", true},
+		{cases[1], "forty two", false},
+		{cases[2], `{"name": "Tom"}`, true},
+		{cases[2], "```json\n{\"name\": \"Tom\"}\n```", true},
+		{cases[2], `{"age": 3}`, false},
+		{cases[2], `not json`, false},
+	}
+
+	for _, tt := range tests {
+		result := tt.c.score(api.ChatResponse{Message: api.Message{Content: tt.output}})
+		if result.Passed != tt.passed {
+			t.Errorf("%s: %q: expected passed %v, got %v (%s)", tt.c.ID, tt.output, tt.passed, result.Passed, result.Error)
+		}
+		if result.Passed != (result.Score == 1) {
+			t.Errorf("%s: %q: unexpected score %v", tt.c.ID, tt.output, result.Score)
+		}
+	}
+}
+
+func TestEvalCaseScoreChoice(t *testing.T) {
+	c := evalCase{ID: "mc", Scorer: scorerChoice, Choices: []string{"3", "4", "5"}, Answer: "4"}
+
+	resp := func(top ...api.TokenLogprob) api.ChatResponse {
+		return api.ChatResponse{Logprobs: []api.Logprob{{TokenLogprob: top[0], TopLogprobs: top}}}
+	}
+
+	result := c.score(resp(
+		api.TokenLogprob{Token: "B", Logprob: math.Log(0.6)},
+		api.TokenLogprob{Token: " A", Logprob: math.Log(0.2)},
+		api.TokenLogprob{Token: "B.", Logprob: math.Log(0.1)},
+		api.TokenLogprob{Token: "The", Logprob: math.Log(0.05)},
+	))
+	if !result.Passed || result.Output != "B" {
+		t.Errorf("expected B to pass, got %+v", result)
+	}
+	// C is missing so only A and B are normalized
+	if math.Abs(result.Score-0.75) > 1e-9 {
+		t.Errorf("expected score 0.75, got %v", result.Score)
+	}
+
+	result = c.score(resp(
+		api.TokenLogprob{Token: "C", Logprob: math.Log(0.7)},
+		api.TokenLogprob{Token: "B", Logprob: math.Log(0.3)},
+	))
+	if result.Passed || result.Output != "C" {
+		t.Errorf("expected C to fail, got %+v", result)
+	}
+
+	result = c.score(resp(api.TokenLogprob{Token: "The", Logprob: 0}))
+	if result.Passed || result.Error == "" {
+		t.Errorf("expected no choice to fail, got %+v", result)
+	}
+
+	if result := c.score(api.ChatResponse{}); result.Error == "" {
+		t.Error("expected error without logprobs")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "pattern": "^[A-Z]"},
+			"age": {"type": "integer", "minimum": 0, "maximum": 150},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"kind": {"enum": ["cat", "dog"]},
+			"id": {"anyOf": [{"type": "string"}, {"type": "integer"}]},
+			"extra": {"type": ["string", "null"]}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`
+
+	var s any
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{`{"name": "Tom"}`, true},
+		{`{"name": "Tom", "age": 3, "tags": ["a", "b"], "kind": "cat", "id": 7, "extra": null}`, true},
+		{`{"name": "Tom", "id": "x"}`, true},
+		{`[]`, false},
+		{`{}`, false},
+		{`{"name": ""}`, false},
+		{`{"name": "tom"}`, false},
+		{`{"name": "Tom", "age": 3.5}`, false},
+		{`{"name": "Tom", "age": -1}`, false},
+		{`{"name": "Tom", "tags": ["a", 1]}`, false},
+		{`{"name": "Tom", "tags": ["a", "b", "c"]}`, false},
+		{`{"name": "Tom", "kind": "bird"}`, false},
+		{`{"name": "Tom", "id": true}`, false},
+		{`{"name": "Tom", "color": "red"}`, false},
+	}
+
+	for _, tt := range tests {
+		var v any
+		if err := json.Unmarshal([]byte(tt.value), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		err := validateSchema(s, v, "$")
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.value, tt.valid, err)
+		}
+	}
+}
+
+func TestEvalHandler(t *testing.T) {
+	answers := map[string]string{
+		"What is the capital of France?": "Paris",
+		"Pick a number":                  "seven",
+	}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		content := req.Messages[len(req.Messages)-1].Content
+		resp := api.ChatResponse{Model: req.Model, Done: true, Message: api.Message{Role: "assistant", Content: answers[content]}}
+		if req.Logprobs {
+			resp.Message.Content = "B"
+			resp.Logprobs = []api.Logprob{{
+				TokenLogprob: api.TokenLogprob{Token: "B", Logprob: -0.1},
+				TopLogprobs: []api.TokenLogprob{
+					{Token: "B", Logprob: -0.1},
+					{Token: "A", Logprob: -2.5},
+				},
+			}}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+
+	t.Setenv("OLLAMA_HOST", mockServer.URL)
+	t.Cleanup(mockServer.Close)
+
+	dir := t.TempDir()
+	suite := filepath.Join(dir, "suite.jsonl")
+	if err := os.WriteFile(suite, []byte(`{"id": "capital", "prompt": "What is the capital of France?", "scorer": "exact", "answer": "Paris"}
+{"id": "digits", "prompt": "Pick a number", "scorer": "regex", "pattern": "^\\d+$"}
+{"id": "mc", "prompt": "2+2?", "scorer": "choice", "choices": ["3", "4"], "answer": "4"}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	baseline := filepath.Join(dir, "baseline.jsonl")
+	if err := os.WriteFile(baseline, []byte(`{"id": "capital", "scorer": "exact", "passed": false, "score": 0, "output": "Lyon"}
+{"id": "digits", "scorer": "regex", "passed": true, "score": 1, "output": "7"}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "results.jsonl")
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(t.Context())
+	cmd.Flags().String("suite", suite, "")
+	cmd.Flags().String("output", output, "")
+	cmd.Flags().String("baseline", baseline, "")
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := EvalHandler(cmd, []string{"test-model"})
+	w.Close()
+	os.Stdout = oldStdout
+	if err == nil || !strings.Contains(err.Error(), "1 case(s) regressed") {
+		t.Errorf("expected an error for the regression, got %v", err)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"66.7%", "1 regressed, 1 improved", "- digits", "+ capital"} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected output to contain %q, got:\n%s", s, out)
+		}
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	results, err := readEvalResults(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, passed := range map[string]bool{"capital": true, "digits": false, "mc": true} {
+		if results[id].Passed != passed {
+			t.Errorf("%s: expected passed %v, got %+v", id, passed, results[id])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/progress"
+)
+
+func ExportHandler(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.ExportRequest{Model: args[0]}
+
+	var f *os.File
+	var w io.Writer = os.Stdout
+	if output == "" || output == "-" {
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			return errors.New("refusing to write archive to a terminal, use --output or redirect stdout")
+		}
+	} else {
+		f, err = os.OpenFile(output, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+
+		// Resume a partial export of the same model
+		if etag, err := archiveETag(f); err == nil {
+			fi, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			req.Offset = fi.Size()
+			req.ETag = etag
+		}
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	return client.Export(cmd.Context(), &req, func(resp api.ExportResponse, r io.Reader) error {
+		if f != nil {
+			if err := f.Truncate(resp.Offset); err != nil {
+				return err
+			}
+			if _, err := f.Seek(resp.Offset, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		bar := progress.NewBar(fmt.Sprintf("exporting %s:", args[0]), resp.Size, resp.Offset)
+		p.Add(args[0], bar)
+
+		pw := &barWriter{bar: bar, n: resp.Offset}
+		if _, err := io.Copy(w, io.TeeReader(r, pw)); err != nil {
+			return err
+		}
+
+		if f != nil {
+			return f.Sync()
+		}
+		return nil
+	})
+}
+
+func ImportHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		bar := progress.NewBar("importing:", fi.Size(), 0)
+		p.Add("", bar)
+		r = io.TeeReader(f, &barWriter{bar: bar})
+	} else {
+		spinner := progress.NewSpinner("importing")
+		p.Add("", spinner)
+	}
+
+	resp, err := client.Import(cmd.Context(), r)
+	if err != nil {
+		return err
+	}
+
+	p.Stop()
+	for _, m := range resp.Models {
+		fmt.Printf("imported '%s'\n", m)
+	}
+	return nil
+}
+
+// archiveETag returns the ETag of the model archive partially written to f,
+// which is the quoted sha256 of its leading manifest entry.
+func archiveETag(f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	defer f.Seek(0, io.SeekStart)
+
+	tr := tar.NewReader(f)
+	hdr, err := tr.Next()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(hdr.Name, "manifests/") {
+		return "", errors.New("not a model archive")
+	}
+
+	sha256sum := sha256.New()
+	if _, err := io.Copy(sha256sum, tr); err != nil {
+		return "", err
+	}
+
+	return strconv.Quote(fmt.Sprintf("%x", sha256sum.Sum(nil))), nil
+}
+
+type barWriter struct {
+	bar *progress.Bar
+	n   int64
+}
+
+func (w *barWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	w.bar.Set(w.n)
+	return len(p), nil
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveETag(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "model.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := archiveETag(f); err == nil {
+		t.Fatal("expected error for empty file")
+	}
+
+	tw := tar.NewWriter(f)
+	if err := tw.WriteHeader(&tar.Header{Name: "manifests/registry.ollama.ai/library/test/latest", Size: int64(len(manifest)), Mode: 0o644}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		t.Fatal(err)
+	}
+	// Leave the archive unterminated, as an interrupted export would
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	etag, err := archiveETag(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(manifest))); etag != expected {
+		t.Errorf("expected etag %s, got %s", expected, etag)
+	}
+}
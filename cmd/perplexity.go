@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/progress"
+)
+
+// scoreText returns the logprobs of the scored tokens of content and its
+// perplexity.
+func scoreText(cmd *cobra.Command, client *api.Client, model, content string, topLogprobs int) ([]api.Logprob, float64, error) {
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
+
+	spinner := progress.NewSpinner(fmt.Sprintf("scoring %s", model))
+	p.Add("", spinner)
+
+	var logprobs []api.Logprob
+	var perplexity float64
+	err := client.Perplexity(cmd.Context(), &api.PerplexityRequest{
+		Model:       model,
+		Content:     content,
+		TopLogprobs: topLogprobs,
+	}, func(resp api.PerplexityResponse) error {
+		logprobs = append(logprobs, resp.Logprobs...)
+		if resp.Total > 0 {
+			spinner.SetMessage(fmt.Sprintf("scoring %s (%d/%d)", model, resp.Completed, resp.Total))
+		}
+		if resp.Done {
+			perplexity = resp.Perplexity
+		}
+		return nil
+	})
+	return logprobs, perplexity, err
+}
+
+// klDivergence returns the KL divergence of q from p at a position, where p
+// and q are the top tokens of two models. Tokens outside of the top tokens of
+// either model are combined into a single remaining token, so this is a lower
+// bound of the divergence over the full vocabulary.
+func klDivergence(p, q []api.TokenLogprob) float64 {
+	qs := make(map[string]float64, len(q))
+	for _, t := range q {
+		qs[t.Token] = t.Logprob
+	}
+
+	var kl float64
+	pRest, qRest := 1.0, 1.0
+	for _, t := range p {
+		ql, ok := qs[t.Token]
+		if !ok {
+			continue
+		}
+
+		kl += math.Exp(t.Logprob) * (t.Logprob - ql)
+		pRest -= math.Exp(t.Logprob)
+		qRest -= math.Exp(ql)
+	}
+
+	// the remaining probability is inexact as the top logprobs are rounded
+	if pRest > 1e-9 {
+		kl += pRest * math.Log(pRest/max(qRest, 1e-9))
+	}
+
+	return max(kl, 0)
+}
+
+func topToken(top []api.TokenLogprob) string {
+	if len(top) == 0 {
+		return ""
+	}
+	return slices.MaxFunc(top, func(a, b api.TokenLogprob) int {
+		switch {
+		case a.Logprob < b.Logprob:
+			return -1
+		case a.Logprob > b.Logprob:
+			return 1
+		}
+		return 0
+	}).Token
+}
+
+// divergence compares the logprobs of a model to those of a reference model
+// for the same text.
+type divergence struct {
+	mean, median, p99 float64
+
+	// sameTop is the fraction of positions where both models predict the
+	// same most likely token
+	sameTop float64
+}
+
+func compareLogprobs(logprobs, reference []api.Logprob) (divergence, error) {
+	if len(logprobs) != len(reference) {
+		return divergence{}, errors.New("the reference model tokenizes the text differently")
+	}
+
+	var d divergence
+	kls := make([]float64, len(logprobs))
+	var same int
+	for i := range logprobs {
+		if logprobs[i].Token != reference[i].Token {
+			return divergence{}, errors.New("the reference model tokenizes the text differently")
+		}
+
+		kls[i] = klDivergence(reference[i].TopLogprobs, logprobs[i].TopLogprobs)
+		d.mean += kls[i]
+
+		if topToken(reference[i].TopLogprobs) == topToken(logprobs[i].TopLogprobs) {
+			same++
+		}
+	}
+
+	slices.Sort(kls)
+	d.mean /= float64(len(kls))
+	d.median = kls[len(kls)/2]
+	d.p99 = kls[min(int(math.Ceil(0.99*float64(len(kls)))), len(kls))-1]
+	d.sameTop = float64(same) / float64(len(logprobs))
+	return d, nil
+}
+
+func writePerplexity(w io.Writer, perplexity float64, reference *float64, d *divergence) {
+	data := [][]string{{"perplexity", fmt.Sprintf("%.4f", perplexity)}}
+	if reference != nil {
+		data = append(data, []string{"reference perplexity", fmt.Sprintf("%.4f", *reference)})
+	}
+	if d != nil {
+		data = append(data,
+			[]string{"mean KL divergence", fmt.Sprintf("%.6f", d.mean)},
+			[]string{"median KL divergence", fmt.Sprintf("%.6f", d.median)},
+			[]string{"99th percentile KL divergence", fmt.Sprintf("%.6f", d.p99)},
+			[]string{"same top token", fmt.Sprintf("%.2f%%", d.sameTop*100)},
+		)
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+}
+
+func PerplexityHandler(cmd *cobra.Command, args []string) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+
+	reference, err := cmd.Flags().GetString("reference")
+	if err != nil {
+		return err
+	}
+
+	top, err := cmd.Flags().GetInt("top")
+	if err != nil {
+		return err
+	}
+
+	if reference != "" && (top < 1 || top > 20) {
+		return errors.New("--top must be between 1 and 20")
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if reference == "" {
+		_, perplexity, err := scoreText(cmd, client, args[0], string(content), 0)
+		if err != nil {
+			return err
+		}
+
+		writePerplexity(os.Stdout, perplexity, nil, nil)
+		return nil
+	}
+
+	// score the models one after the other so they don't need to fit in
+	// memory at the same time
+	referenceLogprobs, referencePerplexity, err := scoreText(cmd, client, reference, string(content), top)
+	if err != nil {
+		return err
+	}
+
+	logprobs, perplexity, err := scoreText(cmd, client, args[0], string(content), top)
+	if err != nil {
+		return err
+	}
+
+	d, err := compareLogprobs(logprobs, referenceLogprobs)
+	if err != nil {
+		return err
+	}
+
+	writePerplexity(os.Stdout, perplexity, &referencePerplexity, &d)
+	return nil
+}
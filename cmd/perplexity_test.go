@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestKLDivergence(t *testing.T) {
+	p := []api.TokenLogprob{
+		{Token: "a", Logprob: math.Log(0.5)},
+		{Token: "b", Logprob: math.Log(0.3)},
+	}
+
+	if kl := klDivergence(p, p); math.Abs(kl) > 1e-9 {
+		t.Errorf("expected no divergence from itself, got %v", kl)
+	}
+
+	q := []api.TokenLogprob{
+		{Token: "b", Logprob: math.Log(0.5)},
+		{Token: "a", Logprob: math.Log(0.3)},
+	}
+
+	// the remaining 0.2 of each is the same
+	want := 0.5*math.Log(0.5/0.3) + 0.3*math.Log(0.3/0.5)
+	if kl := klDivergence(p, q); math.Abs(kl-want) > 1e-9 {
+		t.Errorf("expected %v, got %v", want, kl)
+	}
+
+	// b is not in the top tokens of q so it is part of the remainder
+	q = []api.TokenLogprob{{Token: "a", Logprob: math.Log(0.9)}}
+	want = 0.5*math.Log(0.5/0.9) + 0.5*math.Log(0.5/0.1)
+	if kl := klDivergence(p, q); math.Abs(kl-want) > 1e-9 {
+		t.Errorf("expected %v, got %v", want, kl)
+	}
+}
+
+func TestCompareLogprobs(t *testing.T) {
+	logprob := func(token string, top ...string) api.Logprob {
+		lp := api.Logprob{TokenLogprob: api.TokenLogprob{Token: token}}
+		for i, t := range top {
+			lp.TopLogprobs = append(lp.TopLogprobs, api.TokenLogprob{Token: t, Logprob: math.Log(0.5 / float64(i+1))})
+		}
+		return lp
+	}
+
+	reference := []api.Logprob{logprob("a", "a", "b"), logprob("b", "a", "b"), logprob("c", "c", "a")}
+	logprobs := []api.Logprob{logprob("a", "a", "b"), logprob("b", "b", "a"), logprob("c", "c", "a")}
+
+	d, err := compareLogprobs(logprobs, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(d.sameTop-2.0/3) > 1e-9 {
+		t.Errorf("expected same top token 2/3 of the time, got %v", d.sameTop)
+	}
+	if d.median != 0 || d.mean <= 0 || d.p99 <= d.median {
+		t.Errorf("unexpected divergence %+v", d)
+	}
+
+	if _, err := compareLogprobs(logprobs[:2], reference); err == nil {
+		t.Error("expected error for different lengths")
+	}
+
+	logprobs[1].Token = "x"
+	if _, err := compareLogprobs(logprobs, reference); err == nil {
+		t.Error("expected error for different tokens")
+	}
+}
+
+func TestPerplexityHandler(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/perplexity" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req api.PerplexityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the reference is certain of each token, the model less so
+		p := 1.0
+		if req.Model == "test-model" {
+			p = 0.5
+		}
+
+		enc := json.NewEncoder(w)
+		for i, word := range strings.Fields(req.Content) {
+			lp := api.Logprob{TokenLogprob: api.TokenLogprob{Token: word, Logprob: math.Log(p)}}
+			if req.TopLogprobs > 0 {
+				lp.TopLogprobs = []api.TokenLogprob{{Token: word, Logprob: math.Log(p)}}
+			}
+			if err := enc.Encode(api.PerplexityResponse{Model: req.Model, Logprobs: []api.Logprob{lp}, Completed: i + 1, Total: 2}); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := enc.Encode(api.PerplexityResponse{Model: req.Model, Done: true, Perplexity: 1 / p, EvalCount: 2}); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	t.Setenv("OLLAMA_HOST", mockServer.URL)
+	t.Cleanup(mockServer.Close)
+
+	file := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(file, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(t *testing.T, reference string) string {
+		t.Helper()
+
+		cmd := &cobra.Command{}
+		cmd.SetContext(t.Context())
+		cmd.Flags().String("file", file, "")
+		cmd.Flags().String("reference", reference, "")
+		cmd.Flags().Int("top", 20, "")
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		err := PerplexityHandler(cmd, []string{"test-model"})
+		w.Close()
+		os.Stdout = oldStdout
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	t.Run("perplexity", func(t *testing.T) {
+		out := run(t, "")
+		if !strings.Contains(out, "perplexity    2.0000") {
+			t.Errorf("expected perplexity of 2, got:\n%s", out)
+		}
+		if strings.Contains(out, "KL divergence") {
+			t.Errorf("expected no comparison without a reference, got:\n%s", out)
+		}
+	})
+
+	t.Run("reference", func(t *testing.T) {
+		out := run(t, "reference-model")
+		for _, s := range []string{"reference perplexity", "1.0000", "mean KL divergence", "same top token", "100.00%"} {
+			if !strings.Contains(out, s) {
+				t.Errorf("expected output to contain %q, got:\n%s", s, out)
+			}
+		}
+	})
+}
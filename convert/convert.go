@@ -9,7 +9,9 @@ import (
 	"iter"
 	"log/slog"
 	"maps"
+	"math"
 	"os"
+	"regexp"
 	"slices"
 	"strings"
 
@@ -39,6 +41,36 @@ type AdapterParameters struct {
 		Alpha float32 `json:"alpha"`
 		Scale float32 `json:"scale"`
 	} `json:"lora_parameters"`
+
+	// PEFT adapter_config.json
+	PeftType      string             `json:"peft_type"`
+	Rank          uint32             `json:"r"`
+	TargetModules targetModules      `json:"target_modules"`
+	UseDora       bool               `json:"use_dora"`
+	UseRSLora     bool               `json:"use_rslora"`
+	RankPattern   map[string]uint32  `json:"rank_pattern"`
+	AlphaPattern  map[string]float32 `json:"alpha_pattern"`
+}
+
+// targetModules is the list of modules a PEFT adapter modifies. PEFT also
+// accepts a single string, which is either a regular expression or
+// "all-linear", and isn't a list of module names.
+type targetModules []string
+
+func (t *targetModules) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = nil
+		return nil
+	}
+
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+
+	*t = ss
+	return nil
 }
 
 type KV map[string]any
@@ -165,6 +197,11 @@ func (p AdapterParameters) KV() KV {
 		alpha = p.LoraParameters.Alpha
 	}
 
+	if p.UseRSLora && p.Rank > 0 {
+		// rsLoRA scales by alpha / sqrt(rank) rather than alpha / rank
+		alpha *= float32(math.Sqrt(float64(p.Rank)))
+	}
+
 	kv := KV{
 		"adapter.lora.alpha": alpha,
 		"adapter.type":       "lora",
@@ -214,6 +251,80 @@ type AdapterConverter interface {
 	Replacements() []string
 }
 
+// validate rejects adapters that can't be represented as a single alpha
+// applied to a set of low rank weights
+func (p AdapterParameters) validate() error {
+	if p.UseDora {
+		return errors.New("DoRA adapters are not supported, merge the adapter into the model or train it without use_dora")
+	}
+
+	if p.PeftType != "" && p.PeftType != "LORA" {
+		return fmt.Errorf("unsupported adapter type %s, only LORA adapters are supported", p.PeftType)
+	}
+
+	for module, alpha := range p.AlphaPattern {
+		if alpha != float32(p.Alpha) {
+			return fmt.Errorf("adapter sets lora_alpha %v for %s but per-module alpha is not supported", alpha, module)
+		}
+	}
+
+	if p.UseRSLora && len(p.RankPattern) > 0 {
+		return errors.New("rsLoRA adapters with a rank_pattern are not supported")
+	}
+
+	return nil
+}
+
+// visionTensor reports whether an adapter tensor modifies the vision tower or
+// projector of a multimodal model. Adapters trained with all-linear targets
+// include these but only the text model can be adapted.
+func visionTensor(name string) bool {
+	return strings.Contains(name, "vision_tower.") || strings.Contains(name, "multi_modal_projector.")
+}
+
+// validateTargetModules checks that each module a PEFT adapter targets is
+// one that conv can map to a model weight. Modules that only the tensors of
+// the vision tower use are allowed since those tensors are skipped.
+func (p AdapterParameters) validateTargetModules(conv AdapterConverter, arch string, ts []Tensor) error {
+	replacements := conv.Replacements()
+	supported := func(module string) bool {
+		for i := 0; i < len(replacements); i += 2 {
+			if s := replacements[i]; s == module || strings.HasSuffix(s, "."+module) {
+				return true
+			}
+		}
+		return false
+	}
+
+	visionOnly := func(module string) bool {
+		var vision bool
+		for _, t := range ts {
+			if slices.Contains(strings.Split(t.Name(), "."), module) {
+				if !visionTensor(t.Name()) {
+					return false
+				}
+				vision = true
+			}
+		}
+		return vision
+	}
+
+	for _, module := range p.TargetModules {
+		// modules may be given by their full path
+		if i := strings.LastIndex(module, "."); i >= 0 {
+			module = module[i+1:]
+		}
+
+		if !supported(module) && !visionOnly(module) {
+			return fmt.Errorf("adapter targets %s which is not supported for %s adapters", module, arch)
+		}
+	}
+
+	return nil
+}
+
+var loraTensorName = regexp.MustCompile(`^blk\.\d+\.[a-z_]+\.weight\.lora_[ab]$`)
+
 func ConvertAdapter(fsys fs.FS, f *os.File, baseKV ofs.Config) error {
 	bts, err := fs.ReadFile(fsys, "adapter_config.json")
 	if err != nil {
@@ -225,6 +336,10 @@ func ConvertAdapter(fsys fs.FS, f *os.File, baseKV ofs.Config) error {
 		return err
 	}
 
+	if err := p.validate(); err != nil {
+		return err
+	}
+
 	arch := baseKV.Architecture()
 	if arch == "" {
 		return errors.New("architecture not set for the base model")
@@ -236,8 +351,16 @@ func ConvertAdapter(fsys fs.FS, f *os.File, baseKV ofs.Config) error {
 		conv = &llamaAdapter{}
 	case "gemma2":
 		conv = &gemma2Adapter{}
+	case "gemma3":
+		conv = &gemma3Adapter{}
+	case "qwen2", "qwen3":
+		conv = &qwen2Adapter{arch: arch}
+	case "mistral3":
+		conv = &mistral3Adapter{}
+	case "phi3":
+		conv = &phi3Adapter{}
 	default:
-		return errors.New("unsupported architecture")
+		return fmt.Errorf("unsupported architecture %q", arch)
 	}
 
 	ts, err := parseTensors(fsys, strings.NewReplacer(conv.Replacements()...))
@@ -245,11 +368,40 @@ func ConvertAdapter(fsys fs.FS, f *os.File, baseKV ofs.Config) error {
 		return err
 	}
 
+	if err := p.validateTargetModules(conv, arch, ts); err != nil {
+		return err
+	}
+
+	var skipped int
+	ts = slices.DeleteFunc(ts, func(t Tensor) bool {
+		if visionTensor(t.Name()) {
+			skipped++
+			return true
+		}
+		return false
+	})
+
+	if skipped > 0 {
+		slog.Warn("skipping adapter tensors for the vision model, only the text model will be adapted", "tensors", skipped)
+	}
+
+	if len(ts) == 0 {
+		return fmt.Errorf("adapter has no tensors for the %s text model", arch)
+	}
+
 	if err := json.Unmarshal(bts, conv); err != nil {
 		return err
 	}
 
-	return writeFile(f, conv.KV(baseKV), conv.Tensors(ts))
+	kv := conv.KV(baseKV)
+	tensors := conv.Tensors(ts)
+	for _, t := range tensors {
+		if !loraTensorName.MatchString(t.Name) {
+			return fmt.Errorf("adapter tensor %s doesn't modify a supported %s weight", t.Name, arch)
+		}
+	}
+
+	return writeFile(f, kv, tensors)
 }
 
 func LoadModelMetadata(fsys fs.FS) (ModelKV, *Tokenizer, error) {
@@ -291,6 +443,8 @@ func LoadModelMetadata(fsys fs.FS) (ModelKV, *Tokenizer, error) {
 		conv = &gemma3nModel{}
 	case "Phi3ForCausalLM":
 		conv = &phi3Model{}
+	case "Phi4MMForCausalLM":
+		conv = &phi4mmModel{}
 	case "Qwen2ForCausalLM":
 		conv = &qwen2Model{}
 	case "Qwen2_5_VLForConditionalGeneration":
@@ -301,6 +455,8 @@ func LoadModelMetadata(fsys fs.FS) (ModelKV, *Tokenizer, error) {
 		conv = &olmoModel{}
 	case "BertModel":
 		conv = &bertModel{}
+	case "BertForSequenceClassification":
+		conv = &bertModel{classifier: true}
 	case "NomicBertModel", "NomicBertMoEModel":
 		conv = &nomicbertModel{}
 	case "CohereForCausalLM":
@@ -315,6 +471,12 @@ func LoadModelMetadata(fsys fs.FS) (ModelKV, *Tokenizer, error) {
 		conv = &glm4MoeLiteModel{}
 	case "Lfm2ForCausalLM":
 		conv = &lfm2Model{}
+	case "Mamba2ForCausalLM":
+		conv = &mamba2Model{}
+	case "GraniteMoeHybridForCausalLM":
+		conv = &graniteHybridModel{}
+	case "WhisperForConditionalGeneration":
+		conv = &whisperModel{}
 	default:
 		return nil, nil, fmt.Errorf("unsupported architecture %q", p.Architectures[0])
 	}
@@ -30,6 +30,10 @@ type bertModel struct {
 	NormEpsilon           float32 `json:"norm_epsilon"`
 	normalizeEmbeddings   bool
 
+	// classifier is set for cross-encoders, which score a query and
+	// document pair with a classification head instead of embedding them
+	classifier bool
+
 	PoolingType uint32
 }
 
@@ -39,6 +43,11 @@ var (
 )
 
 func (p *bertModel) parseMore(fsys fs.FS) error {
+	if p.classifier {
+		p.PoolingType = 4
+		return nil
+	}
+
 	bts, err := fs.ReadFile(fsys, "modules.json")
 	if err != nil {
 		return err
@@ -139,11 +148,12 @@ func (p *bertModel) KV(t *Tokenizer) KV {
 func (p *bertModel) Tensors(ts []Tensor) []*ggml.Tensor {
 	var out []*ggml.Tensor
 	for _, t := range ts {
-		if slices.Contains([]string{
-			"embeddings.position_ids",
-			"pooler.dense.weight",
-			"pooler.dense.bias",
-		}, t.Name()) {
+		if t.Name() == "embeddings.position_ids" {
+			continue
+		}
+
+		// the pooler is only used by the classification head
+		if !p.classifier && slices.Contains([]string{"cls.weight", "cls.bias"}, t.Name()) {
 			continue
 		}
 
@@ -160,6 +170,9 @@ func (p *bertModel) Tensors(ts []Tensor) []*ggml.Tensor {
 
 func (bertModel) Replacements() []string {
 	return []string{
+		"bert.", "",
+		"pooler.dense", "cls",
+		"classifier", "cls.output",
 		"encoder.layer", "blk",
 		"encoder.layers", "blk",
 		"embeddings.word_embeddings", "token_embd",
@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	ofs "github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+// ConvertControlVector converts a control vector saved as safetensors to the
+// GGUF format used by llama.cpp. The vector has a direction for each layer it
+// steers, named direction.N, layers.N or N, where N is the layer whose output
+// the direction is added to.
+func ConvertControlVector(fsys fs.FS, f *os.File, baseKV ofs.Config) error {
+	ts, err := parseTensors(fsys, strings.NewReplacer("layers.", "direction."))
+	if err != nil {
+		return err
+	}
+
+	embd := baseKV.Uint("embedding_length")
+	blocks := baseKV.Uint("block_count")
+
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		name := t.Name()
+		if !strings.HasPrefix(name, "direction.") {
+			name = "direction." + name
+		}
+
+		layer, err := strconv.Atoi(strings.TrimPrefix(name, "direction."))
+		if err != nil {
+			return fmt.Errorf("unexpected tensor in control vector: %s", t.Name())
+		}
+
+		if layer < 0 || layer >= int(blocks) {
+			return fmt.Errorf("control vector steers layer %d but the model has %d layers", layer, blocks)
+		}
+
+		if shape := t.Shape(); len(shape) != 1 || shape[0] != uint64(embd) {
+			return fmt.Errorf("control vector direction %s has shape %v but the model's embedding length is %d", t.Name(), shape, embd)
+		}
+
+		out = append(out, &ggml.Tensor{
+			Name:     name,
+			Kind:     t.Kind(),
+			Shape:    t.Shape(),
+			WriterTo: t,
+		})
+	}
+
+	if len(out) == 0 {
+		return errors.New("control vector has no directions")
+	}
+
+	return writeFile(f, KV{
+		"general.architecture":      "controlvector",
+		"controlvector.model_hint":  baseKV.Architecture(),
+		"controlvector.layer_count": uint32(len(out)),
+	}, out)
+}
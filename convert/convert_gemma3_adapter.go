@@ -0,0 +1,43 @@
+package convert
+
+import (
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type gemma3Adapter struct {
+	AdapterParameters
+}
+
+var _ AdapterConverter = (*gemma3Adapter)(nil)
+
+func (p *gemma3Adapter) KV(baseKV fs.Config) KV {
+	kv := p.AdapterParameters.KV()
+	kv["general.architecture"] = "gemma3"
+	return kv
+}
+
+func (p *gemma3Adapter) Tensors(ts []Tensor) []*ggml.Tensor {
+	return loraTensors(ts)
+}
+
+func (p *gemma3Adapter) Replacements() []string {
+	return []string{
+		"base_model.model.", "",
+		// multimodal models nest the text model
+		"language_model.model.layers", "blk",
+		"model.language_model.layers", "blk",
+		"model.layers", "blk",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.o_proj", "attn_output",
+		"mlp.gate_proj", "ffn_gate",
+		"mlp.down_proj", "ffn_down",
+		"mlp.up_proj", "ffn_up",
+		"lora_A.weight", "weight.lora_a",
+		"lora_B.weight", "weight.lora_b",
+		"lora_a", "weight.lora_a",
+		"lora_b", "weight.lora_b",
+	}
+}
@@ -0,0 +1,236 @@
+package convert
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type mamba2Model struct {
+	ModelParameters
+	HiddenSize        uint32  `json:"hidden_size"`
+	NumHiddenLayers   uint32  `json:"num_hidden_layers"`
+	StateSize         uint32  `json:"state_size"`
+	NumHeads          uint32  `json:"num_heads"`
+	HeadDim           uint32  `json:"head_dim"`
+	NGroups           uint32  `json:"n_groups"`
+	ConvKernel        uint32  `json:"conv_kernel"`
+	Expand            uint32  `json:"expand"`
+	LayerNormEpsilon  float32 `json:"layer_norm_epsilon"`
+	TieWordEmbeddings bool    `json:"tie_word_embeddings"`
+}
+
+var _ ModelConverter = (*mamba2Model)(nil)
+
+func (p *mamba2Model) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "mamba2"
+	kv["mamba2.block_count"] = p.NumHiddenLayers
+	kv["mamba2.embedding_length"] = p.HiddenSize
+	// mamba2 has no limit on the context length
+	kv["mamba2.context_length"] = uint32(1 << 20)
+	kv["mamba2.attention.head_count"] = uint32(0)
+	kv["mamba2.attention.head_count_kv"] = uint32(0)
+	kv["mamba2.attention.layer_norm_rms_epsilon"] = cmp.Or(p.LayerNormEpsilon, 1e-5)
+	kv["mamba2.ssm.conv_kernel"] = cmp.Or(p.ConvKernel, 4)
+	kv["mamba2.ssm.inner_size"] = cmp.Or(p.NumHeads*p.HeadDim, cmp.Or(p.Expand, 2)*p.HiddenSize)
+	kv["mamba2.ssm.state_size"] = p.StateSize
+	kv["mamba2.ssm.time_step_rank"] = p.NumHeads
+	kv["mamba2.ssm.group_count"] = cmp.Or(p.NGroups, 1)
+	return kv
+}
+
+func (p *mamba2Model) Tensors(ts []Tensor) []*ggml.Tensor {
+	out := ssmTensors(ts, cmp.Or(p.NGroups, 1))
+	if p.TieWordEmbeddings {
+		out = slices.DeleteFunc(out, func(t *ggml.Tensor) bool {
+			return t.Name == "output.weight"
+		})
+	}
+
+	return out
+}
+
+func (p *mamba2Model) Replacements() []string {
+	return []string{
+		"backbone.embeddings", "token_embd",
+		"backbone.norm_f", "output_norm",
+		"backbone.layers", "blk",
+		"lm_head", "output",
+		"mixer.in_proj", "ssm_in",
+		"mixer.conv1d", "ssm_conv1d",
+		"mixer.dt_bias", "ssm_dt.bias",
+		"mixer.A_log", "ssm_a",
+		"mixer.D", "ssm_d",
+		"mixer.norm", "ssm_norm",
+		"mixer.out_proj", "ssm_out",
+		".norm.", ".attn_norm.",
+	}
+}
+
+type graniteHybridModel struct {
+	ModelParameters
+	HiddenSize             uint32   `json:"hidden_size"`
+	NumHiddenLayers        uint32   `json:"num_hidden_layers"`
+	MaxPositionEmbeddings  uint32   `json:"max_position_embeddings"`
+	LayerTypes             []string `json:"layer_types"`
+	NumAttentionHeads      uint32   `json:"num_attention_heads"`
+	NumKeyValueHeads       uint32   `json:"num_key_value_heads"`
+	PositionEmbeddingType  string   `json:"position_embedding_type"`
+	RopeTheta              float32  `json:"rope_theta"`
+	RMSNormEPS             float32  `json:"rms_norm_eps"`
+	IntermediateSize       uint32   `json:"intermediate_size"`
+	SharedIntermediateSize uint32   `json:"shared_intermediate_size"`
+	NumLocalExperts        uint32   `json:"num_local_experts"`
+	NumExpertsPerTok       uint32   `json:"num_experts_per_tok"`
+	EmbeddingMultiplier    float32  `json:"embedding_multiplier"`
+	ResidualMultiplier     float32  `json:"residual_multiplier"`
+	AttentionMultiplier    float32  `json:"attention_multiplier"`
+	LogitsScaling          float32  `json:"logits_scaling"`
+	MambaNHeads            uint32   `json:"mamba_n_heads"`
+	MambaDHead             uint32   `json:"mamba_d_head"`
+	MambaDState            uint32   `json:"mamba_d_state"`
+	MambaNGroups           uint32   `json:"mamba_n_groups"`
+	MambaDConv             uint32   `json:"mamba_d_conv"`
+	TieWordEmbeddings      bool     `json:"tie_word_embeddings"`
+}
+
+var _ ModelConverter = (*graniteHybridModel)(nil)
+
+func (p *graniteHybridModel) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "granitehybrid"
+	kv["granitehybrid.block_count"] = p.NumHiddenLayers
+	kv["granitehybrid.embedding_length"] = p.HiddenSize
+	kv["granitehybrid.context_length"] = p.MaxPositionEmbeddings
+	kv["granitehybrid.attention.layer_norm_rms_epsilon"] = p.RMSNormEPS
+
+	// mamba layers have no kv heads
+	kvHeadCounts := make([]uint32, p.NumHiddenLayers)
+	for i := range p.NumHiddenLayers {
+		if int(i) < len(p.LayerTypes) && p.LayerTypes[i] == "attention" {
+			kvHeadCounts[i] = p.NumKeyValueHeads
+		}
+	}
+
+	kv["granitehybrid.attention.head_count"] = p.NumAttentionHeads
+	kv["granitehybrid.attention.head_count_kv"] = kvHeadCounts
+	kv["granitehybrid.attention.key_length"] = p.HiddenSize / p.NumAttentionHeads
+	kv["granitehybrid.attention.value_length"] = p.HiddenSize / p.NumAttentionHeads
+	kv["granitehybrid.rope.freq_base"] = cmp.Or(p.RopeTheta, 1e4)
+	kv["granitehybrid.rope.scaling.finetuned"] = p.PositionEmbeddingType == "rope"
+
+	kv["granitehybrid.ssm.conv_kernel"] = p.MambaDConv
+	kv["granitehybrid.ssm.inner_size"] = p.MambaNHeads * p.MambaDHead
+	kv["granitehybrid.ssm.state_size"] = p.MambaDState
+	kv["granitehybrid.ssm.time_step_rank"] = p.MambaNHeads
+	kv["granitehybrid.ssm.group_count"] = cmp.Or(p.MambaNGroups, 1)
+
+	if p.NumLocalExperts > 0 {
+		kv["granitehybrid.expert_count"] = p.NumLocalExperts
+		kv["granitehybrid.expert_used_count"] = p.NumExpertsPerTok
+		kv["granitehybrid.expert_feed_forward_length"] = p.IntermediateSize
+		kv["granitehybrid.expert_shared_feed_forward_length"] = p.SharedIntermediateSize
+	} else {
+		kv["granitehybrid.feed_forward_length"] = p.SharedIntermediateSize
+	}
+
+	kv["granitehybrid.embedding_scale"] = p.EmbeddingMultiplier
+	kv["granitehybrid.residual_scale"] = p.ResidualMultiplier
+	kv["granitehybrid.attention.scale"] = p.AttentionMultiplier
+	kv["granitehybrid.logit_scale"] = p.LogitsScaling
+	return kv
+}
+
+func (p *graniteHybridModel) Tensors(ts []Tensor) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ssmTensors(ts, cmp.Or(p.MambaNGroups, 1)) {
+		if p.TieWordEmbeddings && t.Name == "output.weight" {
+			continue
+		}
+
+		// dense models only have the shared mlp
+		if p.NumLocalExperts == 0 {
+			t.Name = strings.Replace(t.Name, "_shexp", "", 1)
+		}
+
+		out = append(out, t)
+	}
+
+	return out
+}
+
+func (p *graniteHybridModel) Replacements() []string {
+	return []string{
+		"model.embed_tokens", "token_embd",
+		"model.norm", "output_norm",
+		"model.layers", "blk",
+		"lm_head", "output",
+		"input_layernorm", "attn_norm",
+		"post_attention_layernorm", "ffn_norm",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.o_proj", "attn_output",
+		"mamba.in_proj", "ssm_in",
+		"mamba.conv1d", "ssm_conv1d",
+		"mamba.dt_bias", "ssm_dt.bias",
+		"mamba.A_log", "ssm_a",
+		"mamba.D", "ssm_d",
+		"mamba.norm", "ssm_norm",
+		"mamba.out_proj", "ssm_out",
+		"block_sparse_moe.router.layer", "ffn_gate_inp",
+		"block_sparse_moe.input_linear", "ffn_gate_up_exps",
+		"block_sparse_moe.output_linear", "ffn_down_exps",
+		"shared_mlp.input_linear", "ffn_gate_up_shexp",
+		"shared_mlp.output_linear", "ffn_down_shexp",
+	}
+}
+
+// ssmTensors converts the tensors of models with mamba2 layers. The state
+// space parameters are reshaped to the layout expected by the scan and the
+// fused gate and up projections are split.
+func ssmTensors(ts []Tensor, numGroups uint32) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		shape := slices.Clone(t.Shape())
+		switch {
+		case strings.HasSuffix(t.Name(), ".ssm_a"):
+			// A is stored as log(-A)
+			t.SetRepacker(func(_ string, data []float32, _ []uint64) ([]float32, error) {
+				for i := range data {
+					data[i] = -float32(math.Exp(float64(data[i])))
+				}
+				return data, nil
+			})
+			fallthrough
+		case strings.HasSuffix(t.Name(), ".ssm_d"):
+			shape = []uint64{shape[0], 1}
+		case strings.HasSuffix(t.Name(), ".ssm_conv1d.weight"):
+			// squeeze conv weights: [C, 1, K] -> [C, K]
+			if len(shape) == 3 && shape[1] == 1 {
+				shape = []uint64{shape[0], shape[2]}
+			}
+		case strings.HasSuffix(t.Name(), ".ssm_norm.weight"):
+			shape = []uint64{uint64(numGroups), shape[0] / uint64(numGroups)}
+		case strings.Contains(t.Name(), "ffn_gate_up_"):
+			out = append(out, slices.Collect(splitDim(t, len(shape)-2,
+				split{Replacer: strings.NewReplacer("gate_up", "gate")},
+				split{Replacer: strings.NewReplacer("gate_up", "up")},
+			))...)
+			continue
+		}
+
+		out = append(out, &ggml.Tensor{
+			Name:     t.Name(),
+			Kind:     t.Kind(),
+			Shape:    shape,
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,132 @@
+package convert
+
+import (
+	"cmp"
+	"strings"
+
+	"github.com/pdevine/tensor"
+	"github.com/pdevine/tensor/native"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type mistral3Adapter struct {
+	AdapterParameters
+	numAttentionHeads uint32
+	numKeyValueHeads  uint32
+}
+
+var _ AdapterConverter = (*mistral3Adapter)(nil)
+
+func (p *mistral3Adapter) KV(baseKV fs.Config) KV {
+	kv := p.AdapterParameters.KV()
+	kv["general.architecture"] = "mistral3"
+
+	p.numAttentionHeads = baseKV.Uint("attention.head_count")
+	p.numKeyValueHeads = baseKV.Uint("attention.head_count_kv")
+
+	return kv
+}
+
+func (p *mistral3Adapter) Tensors(ts []Tensor) []*ggml.Tensor {
+	var out []*ggml.Tensor
+	for _, t := range ts {
+		shape := t.Shape()
+		transpose := (strings.HasSuffix(t.Name(), "weight.lora_a") && shape[0] > shape[1]) ||
+			(strings.HasSuffix(t.Name(), "weight.lora_b") && shape[0] < shape[1])
+		if transpose {
+			shape[0], shape[1] = shape[1], shape[0]
+		}
+
+		// the model's q and k weights are permuted when converted so the
+		// rows of the matching lora_b need to be permuted the same way
+		var heads uint32
+		if strings.HasSuffix(t.Name(), "attn_q.weight.lora_b") {
+			heads = p.numAttentionHeads
+		} else if strings.HasSuffix(t.Name(), "attn_k.weight.lora_b") {
+			heads = cmp.Or(p.numKeyValueHeads, p.numAttentionHeads)
+		}
+
+		if transpose || heads > 0 {
+			t.SetRepacker(func(name string, data []float32, shape []uint64) ([]float32, error) {
+				if transpose {
+					var err error
+					data, err = transposeLora(name, data, shape)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				if heads > 0 {
+					return p.repack(data, shape, heads)
+				}
+
+				return data, nil
+			})
+		}
+
+		out = append(out, &ggml.Tensor{
+			Name:     t.Name(),
+			Kind:     t.Kind(),
+			Shape:    shape,
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *mistral3Adapter) Replacements() []string {
+	return []string{
+		"base_model.model.", "",
+		// multimodal models nest the text model
+		"language_model.model.layers", "blk",
+		"model.language_model.layers", "blk",
+		"model.layers", "blk",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.o_proj", "attn_output",
+		"mlp.gate_proj", "ffn_gate",
+		"mlp.down_proj", "ffn_down",
+		"mlp.up_proj", "ffn_up",
+		"lora_A.weight", "weight.lora_a",
+		"lora_B.weight", "weight.lora_b",
+		"lora_a", "weight.lora_a",
+		"lora_b", "weight.lora_b",
+	}
+}
+
+func (p *mistral3Adapter) repack(data []float32, shape []uint64, heads uint32) ([]float32, error) {
+	dims := []int{int(shape[0]), int(shape[1])}
+
+	n := tensor.New(tensor.WithShape(dims...), tensor.WithBacking(data))
+	if err := n.Reshape(int(heads), 2, dims[0]/int(heads)/2, dims[1]); err != nil {
+		return nil, err
+	}
+
+	if err := n.T(0, 2, 1, 3); err != nil {
+		return nil, err
+	}
+
+	if err := n.Reshape(dims...); err != nil {
+		return nil, err
+	}
+
+	if err := n.Transpose(); err != nil {
+		return nil, err
+	}
+
+	ts, err := native.SelectF32(n, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var f32s []float32
+	for _, t := range ts {
+		f32s = append(f32s, t...)
+	}
+
+	return f32s, nil
+}
@@ -13,17 +13,18 @@ import (
 
 type phi3Model struct {
 	ModelParameters
-	NumHiddenLayers   uint32  `json:"num_hidden_layers"`
-	NLayers           uint32  `json:"n_layers"`
-	HiddenSize        uint32  `json:"hidden_size"`
-	NEmbd             uint32  `json:"n_embd"`
-	IntermediateSize  uint32  `json:"intermediate_size"`
-	NumAttentionHeads uint32  `json:"num_attention_heads"`
-	NHead             uint32  `json:"n_head"`
-	NumKeyValueHeads  uint32  `json:"num_key_value_heads"`
-	NHeadKV           uint32  `json:"n_head_kv"`
-	RopeTheta         float32 `json:"rope_theta"`
-	RopeScaling       struct {
+	NumHiddenLayers     uint32  `json:"num_hidden_layers"`
+	NLayers             uint32  `json:"n_layers"`
+	HiddenSize          uint32  `json:"hidden_size"`
+	NEmbd               uint32  `json:"n_embd"`
+	IntermediateSize    uint32  `json:"intermediate_size"`
+	NumAttentionHeads   uint32  `json:"num_attention_heads"`
+	NHead               uint32  `json:"n_head"`
+	NumKeyValueHeads    uint32  `json:"num_key_value_heads"`
+	NHeadKV             uint32  `json:"n_head_kv"`
+	RopeTheta           float32 `json:"rope_theta"`
+	PartialRotaryFactor float32 `json:"partial_rotary_factor"`
+	RopeScaling         struct {
 		Type        string     `json:"type"`
 		LongFactor  ropeFactor `json:"long_factor"`
 		ShortFactor ropeFactor `json:"short_factor"`
@@ -47,7 +48,7 @@ func (p *phi3Model) KV(t *Tokenizer) KV {
 	kv["phi3.attention.head_count"] = cmp.Or(p.NumAttentionHeads, p.NHead)
 	kv["phi3.attention.head_count_kv"] = cmp.Or(p.NumKeyValueHeads, p.NHeadKV)
 	kv["phi3.attention.layer_norm_rms_epsilon"] = p.RMSNormEPS
-	kv["phi3.rope.dimension_count"] = p.HiddenSize / cmp.Or(p.NumAttentionHeads, p.NHead)
+	kv["phi3.rope.dimension_count"] = uint32(float32(cmp.Or(p.HiddenSize, p.NEmbd)/cmp.Or(p.NumAttentionHeads, p.NHead)) * cmp.Or(p.PartialRotaryFactor, 1))
 	kv["phi3.rope.freq_base"] = p.RopeTheta
 	kv["phi3.rope.scaling.original_context_length"] = p.OriginalMaxPositionEmbeddings
 	kv["phi3.attention.sliding_window"] = p.SlidingWindow
@@ -73,7 +74,7 @@ func (p *phi3Model) Tensors(ts []Tensor) []*ggml.Tensor {
 
 	out := make([]*ggml.Tensor, 0, len(ts)+2)
 	for _, t := range ts {
-		if strings.HasPrefix(t.Name(), "blk.0.") {
+		if strings.HasPrefix(t.Name(), "blk.0.") && len(p.RopeScaling.LongFactor) > 0 {
 			addRopeFactors.Do(func() {
 				out = append(out, &ggml.Tensor{
 					Name:     "rope_factors_long.weight",
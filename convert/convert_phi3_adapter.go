@@ -0,0 +1,37 @@
+package convert
+
+import (
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type phi3Adapter struct {
+	AdapterParameters
+}
+
+var _ AdapterConverter = (*phi3Adapter)(nil)
+
+func (p *phi3Adapter) KV(baseKV fs.Config) KV {
+	kv := p.AdapterParameters.KV()
+	kv["general.architecture"] = "phi3"
+	return kv
+}
+
+func (p *phi3Adapter) Tensors(ts []Tensor) []*ggml.Tensor {
+	return loraTensors(ts)
+}
+
+func (p *phi3Adapter) Replacements() []string {
+	return []string{
+		"base_model.model.", "",
+		"model.layers", "blk",
+		"self_attn.qkv_proj", "attn_qkv",
+		"self_attn.o_proj", "attn_output",
+		"mlp.gate_up_proj", "ffn_up",
+		"mlp.down_proj", "ffn_down",
+		"lora_A.weight", "weight.lora_a",
+		"lora_B.weight", "weight.lora_b",
+		"lora_a", "weight.lora_a",
+		"lora_b", "weight.lora_b",
+	}
+}
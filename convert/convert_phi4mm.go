@@ -0,0 +1,182 @@
+package convert
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/pdevine/tensor"
+	"github.com/pdevine/tensor/native"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+// phi4mmModel converts Phi-4-multimodal. The language model is Phi-4-mini with
+// LoRA adapters for vision and speech inputs. Since the runner can't switch
+// adapters by input modality, the vision adapter is merged into the language
+// model while the speech adapter and audio encoder are not converted.
+type phi4mmModel struct {
+	phi3Model
+
+	VisionLoRA struct {
+		Rank  uint32  `json:"r"`
+		Alpha float32 `json:"lora_alpha"`
+	} `json:"vision_lora"`
+
+	DynamicHD uint32 `json:"dynamic_hd"`
+}
+
+var _ ModelConverter = (*phi4mmModel)(nil)
+
+func (p *phi4mmModel) parseMore(fsys fs.FS) error {
+	bts, err := fs.ReadFile(fsys, "preprocessor_config.json")
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bts, p)
+}
+
+func (p *phi4mmModel) KV(t *Tokenizer) KV {
+	kv := KV{}
+	for k, v := range p.phi3Model.KV(t) {
+		if name, ok := strings.CutPrefix(k, "phi3."); ok {
+			k = "phi4mm." + name
+		}
+		kv[k] = v
+	}
+
+	kv["general.architecture"] = "phi4mm"
+
+	// the image encoder is SigLIP which isn't described by config.json. The
+	// image features are taken from its second to last layer
+	kv["phi4mm.vision.block_count"] = uint32(26)
+	kv["phi4mm.vision.embedding_length"] = uint32(1152)
+	kv["phi4mm.vision.feed_forward_length"] = uint32(4304)
+	kv["phi4mm.vision.attention.head_count"] = uint32(16)
+	kv["phi4mm.vision.attention.layer_norm_epsilon"] = float32(1e-6)
+	kv["phi4mm.vision.image_size"] = uint32(448)
+	kv["phi4mm.vision.patch_size"] = uint32(14)
+	kv["phi4mm.vision.num_channels"] = uint32(3)
+	kv["phi4mm.vision.max_crops"] = cmp.Or(p.DynamicHD, 36)
+	return kv
+}
+
+func (p *phi4mmModel) Tensors(ts []Tensor) []*ggml.Tensor {
+	loras := make(map[string]Tensor)
+	for _, t := range ts {
+		if strings.Contains(t.Name(), ".lora_") {
+			loras[t.Name()] = t
+		}
+	}
+
+	scale := float32(2)
+	if p.VisionLoRA.Rank > 0 {
+		scale = p.VisionLoRA.Alpha / float32(p.VisionLoRA.Rank)
+	}
+
+	var base []Tensor
+	for _, t := range ts {
+		switch name := t.Name(); {
+		case strings.Contains(name, ".lora_"),
+			strings.HasPrefix(name, "a."),
+			strings.HasPrefix(name, "v.head."),
+			strings.HasPrefix(name, "v.post_layernorm."),
+			strings.HasPrefix(name, "v.blk.26."):
+			// unused tensors
+			continue
+		case strings.HasPrefix(name, "blk."):
+			prefix := strings.TrimSuffix(name, ".weight")
+			a, b := loras[prefix+".lora_a.vision.weight"], loras[prefix+".lora_b.vision.weight"]
+			if a != nil && b != nil {
+				t.SetRepacker(mergeLoRA(a, b, scale))
+			}
+		}
+
+		base = append(base, t)
+	}
+
+	var out []*ggml.Tensor
+	for _, t := range p.phi3Model.Tensors(base) {
+		switch t.Name {
+		case "mm.glb_gn", "mm.sub_gn":
+			// squeeze separators: [1, 1, (1,) C] -> [C]
+			t.Shape = t.Shape[len(t.Shape)-1:]
+		}
+
+		out = append(out, t)
+	}
+
+	return out
+}
+
+func (p *phi4mmModel) Replacements() []string {
+	return append([]string{
+		"model.embed_tokens_extend.image_embed.img_processor.embeddings.", "v.",
+		"model.embed_tokens_extend.image_embed.img_processor.encoder.layers", "v.blk",
+		"model.embed_tokens_extend.image_embed.img_processor.", "v.",
+		"model.embed_tokens_extend.image_embed.img_projection.0", "mm.linear_1",
+		"model.embed_tokens_extend.image_embed.img_projection.2", "mm.linear_2",
+		"model.embed_tokens_extend.image_embed.glb_GN", "mm.glb_gn",
+		"model.embed_tokens_extend.image_embed.sub_GN", "mm.sub_gn",
+		"model.embed_tokens_extend.audio_embed.", "a.",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.out_proj", "attn_output",
+		".base_layer", "",
+		"lora_A", "lora_a",
+		"lora_B", "lora_b",
+	}, p.phi3Model.Replacements()...)
+}
+
+// mergeLoRA returns a repacker which adds the LoRA adapter with weights a and b
+// to a tensor, i.e. w + scale * b @ a
+func mergeLoRA(a, b Tensor, scale float32) Repacker {
+	return func(_ string, data []float32, _ []uint64) ([]float32, error) {
+		var tt [2]tensor.Tensor
+		for i, t := range []Tensor{b, a} {
+			f32s, err := readFloats(t)
+			if err != nil {
+				return nil, err
+			}
+
+			shape := t.Shape()
+			tt[i] = tensor.New(tensor.WithShape(int(shape[0]), int(shape[1])), tensor.WithBacking(f32s))
+		}
+
+		ba, err := tt[0].(*tensor.Dense).MatMul(tt[1])
+		if err != nil {
+			return nil, err
+		}
+
+		delta, err := native.VectorF32(ba)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range data {
+			data[i] += scale * delta[i]
+		}
+
+		return data, nil
+	}
+}
+
+// readFloats reads the data of a tensor as float32
+func readFloats(t Tensor) ([]float32, error) {
+	var f32s []float32
+	t = t.Clone()
+	t.SetRepacker(func(_ string, data []float32, _ []uint64) ([]float32, error) {
+		f32s = data
+		return data, nil
+	})
+
+	if _, err := t.WriteTo(io.Discard); err != nil {
+		return nil, err
+	}
+
+	return f32s, nil
+}
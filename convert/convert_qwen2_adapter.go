@@ -0,0 +1,43 @@
+package convert
+
+import (
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+// qwen2Adapter converts adapters for qwen2 and qwen3, which share their
+// tensor names
+type qwen2Adapter struct {
+	AdapterParameters
+	arch string
+}
+
+var _ AdapterConverter = (*qwen2Adapter)(nil)
+
+func (p *qwen2Adapter) KV(baseKV fs.Config) KV {
+	kv := p.AdapterParameters.KV()
+	kv["general.architecture"] = p.arch
+	return kv
+}
+
+func (p *qwen2Adapter) Tensors(ts []Tensor) []*ggml.Tensor {
+	return loraTensors(ts)
+}
+
+func (p *qwen2Adapter) Replacements() []string {
+	return []string{
+		"base_model.model.", "",
+		"model.layers", "blk",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.o_proj", "attn_output",
+		"mlp.gate_proj", "ffn_gate",
+		"mlp.down_proj", "ffn_down",
+		"mlp.up_proj", "ffn_up",
+		"lora_A.weight", "weight.lora_a",
+		"lora_B.weight", "weight.lora_b",
+		"lora_a", "weight.lora_a",
+		"lora_b", "weight.lora_b",
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	fsc "github.com/ollama/ollama/fs"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/x448/float16"
 )
 
 type tensorData struct {
@@ -469,3 +470,403 @@ func generateLoraTestData(t *testing.T, tempDir string) {
 		t.Fatal(err)
 	}
 }
+
+type loraTestTensor struct {
+	shape []int
+	data  []float32
+}
+
+func generateLoraSafetensors(t *testing.T, path string, tensors map[string]loraTestTensor) {
+	t.Helper()
+
+	td := map[string]*tensorData{"__metadata__": nil}
+	var data []float32
+	for _, name := range slices.Sorted(maps.Keys(tensors)) {
+		tt := tensors[name]
+		td[name] = &tensorData{
+			Offsets: []int{len(data) * 4, (len(data) + len(tt.data)) * 4},
+			Type:    "F32",
+			Shape:   tt.shape,
+		}
+		data = append(data, tt.data...)
+	}
+
+	header, err := json.Marshal(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, int64(len(header))); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Write(header)
+
+	if err := binary.Write(&buf, binary.LittleEndian, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func generatePeftTestData(t *testing.T, tempDir, config string, tensors map[string]loraTestTensor) {
+	t.Helper()
+
+	generateLoraSafetensors(t, filepath.Join(tempDir, "adapter_model.safetensors"), tensors)
+	if err := os.WriteFile(filepath.Join(tempDir, "adapter_config.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertPeftAdapter(t *testing.T) {
+	qwen2KV := KV{"general.architecture": "qwen2"}
+	mistral3KV := KV{
+		"general.architecture":             "mistral3",
+		"mistral3.attention.head_count":    uint32(1),
+		"mistral3.attention.head_count_kv": uint32(1),
+	}
+
+	qProj := map[string]loraTestTensor{
+		"base_model.model.model.layers.0.self_attn.q_proj.lora_A.weight": {shape: []int{2, 3}, data: []float32{0, 1, 2, 3, 4, 5}},
+		"base_model.model.model.layers.0.self_attn.q_proj.lora_B.weight": {shape: []int{4, 2}, data: []float32{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+
+	cases := []struct {
+		name    string
+		kv      KV
+		config  string
+		tensors map[string]loraTestTensor
+		alpha   float32
+		want    map[string][]float32
+		wantErr string
+	}{
+		{
+			name:    "Qwen2",
+			kv:      qwen2KV,
+			config:  `{"peft_type": "LORA", "r": 2, "lora_alpha": 4, "target_modules": ["q_proj", "v_proj"]}`,
+			tensors: qProj,
+			alpha:   4,
+			want: map[string][]float32{
+				"blk.0.attn_q.weight.lora_a": {0, 1, 2, 3, 4, 5},
+				"blk.0.attn_q.weight.lora_b": {0, 1, 2, 3, 4, 5, 6, 7},
+			},
+		},
+		{
+			name:    "Qwen3",
+			kv:      KV{"general.architecture": "qwen3"},
+			config:  `{"r": 2, "lora_alpha": 4, "target_modules": "all-linear"}`,
+			tensors: qProj,
+			alpha:   4,
+			want: map[string][]float32{
+				"blk.0.attn_q.weight.lora_a": {0, 1, 2, 3, 4, 5},
+				"blk.0.attn_q.weight.lora_b": {0, 1, 2, 3, 4, 5, 6, 7},
+			},
+		},
+		{
+			name:    "RSLora",
+			kv:      qwen2KV,
+			config:  `{"r": 4, "lora_alpha": 2, "use_rslora": true}`,
+			tensors: qProj,
+			alpha:   4,
+			want: map[string][]float32{
+				"blk.0.attn_q.weight.lora_a": {0, 1, 2, 3, 4, 5},
+				"blk.0.attn_q.weight.lora_b": {0, 1, 2, 3, 4, 5, 6, 7},
+			},
+		},
+		{
+			name:   "Gemma3Multimodal",
+			kv:     KV{"general.architecture": "gemma3"},
+			config: `{"r": 1, "lora_alpha": 1, "target_modules": ["model.language_model.layers.0.mlp.down_proj"]}`,
+			tensors: map[string]loraTestTensor{
+				"base_model.model.model.language_model.layers.0.mlp.down_proj.lora_A.weight": {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.language_model.layers.0.mlp.down_proj.lora_B.weight": {shape: []int{2, 1}, data: []float32{2, 3}},
+			},
+			alpha: 1,
+			want: map[string][]float32{
+				"blk.0.ffn_down.weight.lora_a": {0, 1},
+				"blk.0.ffn_down.weight.lora_b": {2, 3},
+			},
+		},
+		{
+			name:   "Phi3Transposed",
+			kv:     KV{"general.architecture": "phi3"},
+			config: `{"r": 2, "lora_alpha": 2, "target_modules": ["qkv_proj"]}`,
+			tensors: map[string]loraTestTensor{
+				"model.layers.0.self_attn.qkv_proj.lora_a": {shape: []int{3, 2}, data: []float32{0, 1, 2, 3, 4, 5}},
+				"model.layers.0.self_attn.qkv_proj.lora_b": {shape: []int{2, 3}, data: []float32{0, 1, 2, 3, 4, 5}},
+			},
+			alpha: 2,
+			want: map[string][]float32{
+				"blk.0.attn_qkv.weight.lora_a": {0, 2, 4, 1, 3, 5},
+				"blk.0.attn_qkv.weight.lora_b": {0, 3, 1, 4, 2, 5},
+			},
+		},
+		{
+			name:   "Mistral3Permuted",
+			kv:     mistral3KV,
+			config: `{"r": 1, "lora_alpha": 1, "target_modules": ["q_proj", "v_proj"]}`,
+			tensors: map[string]loraTestTensor{
+				"base_model.model.model.layers.0.self_attn.q_proj.lora_A.weight": {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.layers.0.self_attn.q_proj.lora_B.weight": {shape: []int{4, 1}, data: []float32{0, 1, 2, 3}},
+				"base_model.model.model.layers.0.self_attn.v_proj.lora_A.weight": {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.layers.0.self_attn.v_proj.lora_B.weight": {shape: []int{4, 1}, data: []float32{0, 1, 2, 3}},
+			},
+			alpha: 1,
+			want: map[string][]float32{
+				"blk.0.attn_q.weight.lora_a": {0, 1},
+				"blk.0.attn_q.weight.lora_b": {0, 2, 1, 3},
+				"blk.0.attn_v.weight.lora_a": {0, 1},
+				"blk.0.attn_v.weight.lora_b": {0, 1, 2, 3},
+			},
+		},
+		{
+			name:    "DoRA",
+			kv:      qwen2KV,
+			config:  `{"r": 2, "lora_alpha": 4, "use_dora": true}`,
+			tensors: qProj,
+			wantErr: "DoRA adapters are not supported",
+		},
+		{
+			name:    "NotLoRA",
+			kv:      qwen2KV,
+			config:  `{"peft_type": "LOHA", "r": 2, "alpha": 4}`,
+			tensors: qProj,
+			wantErr: "unsupported adapter type LOHA",
+		},
+		{
+			name:    "AlphaPattern",
+			kv:      qwen2KV,
+			config:  `{"r": 2, "lora_alpha": 4, "alpha_pattern": {"q_proj": 8}}`,
+			tensors: qProj,
+			wantErr: "per-module alpha is not supported",
+		},
+		{
+			name:    "UnsupportedTargetModule",
+			kv:      qwen2KV,
+			config:  `{"r": 2, "lora_alpha": 4, "target_modules": ["q_proj", "lm_head"]}`,
+			tensors: qProj,
+			wantErr: "adapter targets lm_head",
+		},
+		{
+			// lm_head and embed_tokens can't be adapted so these adapters
+			// fail to convert rather than failing to load
+			name:    "LlamaLmHead",
+			kv:      KV{"general.architecture": "llama"},
+			config:  `{"r": 2, "lora_alpha": 4, "target_modules": ["q_proj", "lm_head"]}`,
+			tensors: qProj,
+			wantErr: "adapter targets lm_head",
+		},
+		{
+			name:   "Gemma3VisionTower",
+			kv:     KV{"general.architecture": "gemma3"},
+			config: `{"r": 1, "lora_alpha": 1, "target_modules": ["q_proj", "fc1"]}`,
+			tensors: map[string]loraTestTensor{
+				"base_model.model.model.language_model.layers.0.self_attn.q_proj.lora_A.weight":                    {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.language_model.layers.0.self_attn.q_proj.lora_B.weight":                    {shape: []int{2, 1}, data: []float32{2, 3}},
+				"base_model.model.model.vision_tower.vision_model.encoder.layers.0.self_attn.q_proj.lora_A.weight": {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.vision_tower.vision_model.encoder.layers.0.self_attn.q_proj.lora_B.weight": {shape: []int{2, 1}, data: []float32{0, 1}},
+				"base_model.model.model.vision_tower.vision_model.encoder.layers.0.mlp.fc1.lora_A.weight":          {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.vision_tower.vision_model.encoder.layers.0.mlp.fc1.lora_B.weight":          {shape: []int{2, 1}, data: []float32{0, 1}},
+			},
+			alpha: 1,
+			want: map[string][]float32{
+				"blk.0.attn_q.weight.lora_a": {0, 1},
+				"blk.0.attn_q.weight.lora_b": {2, 3},
+			},
+		},
+		{
+			name:   "VisionTowerOnly",
+			kv:     KV{"general.architecture": "gemma3"},
+			config: `{"r": 1, "lora_alpha": 1, "target_modules": "all-linear"}`,
+			tensors: map[string]loraTestTensor{
+				"base_model.model.model.vision_tower.encoder.layers.0.self_attn.q_proj.lora_A.weight": {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.model.vision_tower.encoder.layers.0.self_attn.q_proj.lora_B.weight": {shape: []int{2, 1}, data: []float32{0, 1}},
+			},
+			wantErr: "no tensors for the gemma3 text model",
+		},
+		{
+			name:   "UnsupportedTensor",
+			kv:     KV{"general.architecture": "gemma3"},
+			config: `{"r": 1, "lora_alpha": 1, "target_modules": "all-linear"}`,
+			tensors: map[string]loraTestTensor{
+				"base_model.model.language_model.lm_head.lora_A.weight": {shape: []int{1, 2}, data: []float32{0, 1}},
+				"base_model.model.language_model.lm_head.lora_B.weight": {shape: []int{2, 1}, data: []float32{0, 1}},
+			},
+			wantErr: "doesn't modify a supported gemma3 weight",
+		},
+		{
+			name:    "UnsupportedArchitecture",
+			kv:      KV{"general.architecture": "bert"},
+			config:  `{"r": 2, "lora_alpha": 4}`,
+			tensors: qProj,
+			wantErr: `unsupported architecture "bert"`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			generatePeftTestData(t, tempDir, tt.config, tt.tensors)
+
+			f, err := os.CreateTemp(t.TempDir(), "f16")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			err = ConvertAdapter(os.DirFS(tempDir), f, tt.kv)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := os.Open(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			m, err := ggml.Decode(r, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if arch := m.KV().Architecture(); arch != tt.kv.Architecture() {
+				t.Errorf("expected architecture %s, got %s", tt.kv.Architecture(), arch)
+			}
+
+			if alpha := m.KV()["adapter.lora.alpha"]; alpha != tt.alpha {
+				t.Errorf("expected alpha %v, got %v", tt.alpha, alpha)
+			}
+
+			got := make(map[string][]float32)
+			for _, tensor := range m.Tensors().Items() {
+				bts := make([]byte, tensor.Size())
+				if _, err := r.ReadAt(bts, int64(m.Tensors().Offset+tensor.Offset)); err != nil {
+					t.Fatal(err)
+				}
+
+				f32s := make([]float32, tensor.Elements())
+				for i := range f32s {
+					f32s[i] = float16.Frombits(binary.LittleEndian.Uint16(bts[i*2:])).Float32()
+				}
+
+				got[tensor.Name] = f32s
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected tensors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertControlVector(t *testing.T) {
+	kv := KV{
+		"general.architecture":   "llama",
+		"llama.block_count":      uint32(4),
+		"llama.embedding_length": uint32(2),
+	}
+
+	cases := []struct {
+		name    string
+		tensors map[string]loraTestTensor
+		want    map[string][]float32
+		wantErr string
+	}{
+		{
+			name: "Names",
+			tensors: map[string]loraTestTensor{
+				"direction.1": {shape: []int{2}, data: []float32{1, 2}},
+				"layers.2":    {shape: []int{2}, data: []float32{3, 4}},
+				"3":           {shape: []int{2}, data: []float32{5, 6}},
+			},
+			want: map[string][]float32{
+				"direction.1": {1, 2},
+				"direction.2": {3, 4},
+				"direction.3": {5, 6},
+			},
+		},
+		{
+			name: "UnknownTensor",
+			tensors: map[string]loraTestTensor{
+				"model.layers.1.mlp": {shape: []int{2}, data: []float32{1, 2}},
+			},
+			wantErr: "unexpected tensor",
+		},
+		{
+			name: "LayerOutOfRange",
+			tensors: map[string]loraTestTensor{
+				"direction.4": {shape: []int{2}, data: []float32{1, 2}},
+			},
+			wantErr: "steers layer 4",
+		},
+		{
+			name: "WrongShape",
+			tensors: map[string]loraTestTensor{
+				"direction.1": {shape: []int{3}, data: []float32{1, 2, 3}},
+			},
+			wantErr: "embedding length is 2",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			generateLoraSafetensors(t, filepath.Join(tempDir, "control_vector.safetensors"), tt.tensors)
+
+			f, err := os.CreateTemp(t.TempDir(), "f32")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			err = ConvertControlVector(os.DirFS(tempDir), f, kv)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := os.Open(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			m, err := ggml.Decode(r, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if arch, hint := m.KV().Architecture(), m.KV().String("model_hint"); arch != "controlvector" || hint != "llama" {
+				t.Errorf("expected a llama control vector, got %s for %s", arch, hint)
+			}
+
+			got := make(map[string][]float32)
+			for _, tensor := range m.Tensors().Items() {
+				f32s := make([]float32, tensor.Elements())
+				sr := io.NewSectionReader(r, int64(m.Tensors().Offset+tensor.Offset), int64(tensor.Size()))
+				if err := binary.Read(sr, binary.LittleEndian, f32s); err != nil {
+					t.Fatal(err)
+				}
+
+				got[tensor.Name] = f32s
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected tensors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
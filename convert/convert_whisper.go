@@ -0,0 +1,93 @@
+package convert
+
+import (
+	"cmp"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+type whisperModel struct {
+	ModelParameters
+
+	DModel                uint32 `json:"d_model"`
+	NumMelBins            uint32 `json:"num_mel_bins"`
+	EncoderLayers         uint32 `json:"encoder_layers"`
+	EncoderAttentionHeads uint32 `json:"encoder_attention_heads"`
+	EncoderFFNDim         uint32 `json:"encoder_ffn_dim"`
+	MaxSourcePositions    uint32 `json:"max_source_positions"`
+	DecoderLayers         uint32 `json:"decoder_layers"`
+	DecoderAttentionHeads uint32 `json:"decoder_attention_heads"`
+	DecoderFFNDim         uint32 `json:"decoder_ffn_dim"`
+	MaxTargetPositions    uint32 `json:"max_target_positions"`
+}
+
+var _ ModelConverter = (*whisperModel)(nil)
+
+func (p *whisperModel) KV(t *Tokenizer) KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "whisper"
+	kv["whisper.block_count"] = p.DecoderLayers
+	kv["whisper.context_length"] = cmp.Or(p.MaxTargetPositions, 448)
+	kv["whisper.embedding_length"] = p.DModel
+	kv["whisper.feed_forward_length"] = p.DecoderFFNDim
+	kv["whisper.attention.head_count"] = p.DecoderAttentionHeads
+	kv["whisper.attention.layer_norm_epsilon"] = float32(1e-5)
+
+	kv["whisper.audio.block_count"] = p.EncoderLayers
+	kv["whisper.audio.context_length"] = cmp.Or(p.MaxSourcePositions, 1500)
+	kv["whisper.audio.embedding_length"] = p.DModel
+	kv["whisper.audio.feed_forward_length"] = p.EncoderFFNDim
+	kv["whisper.audio.attention.head_count"] = p.EncoderAttentionHeads
+	kv["whisper.audio.attention.layer_norm_epsilon"] = float32(1e-5)
+	kv["whisper.audio.num_mel_bins"] = cmp.Or(p.NumMelBins, 80)
+
+	// the prompt starts from the audio rather than a BOS token
+	kv["tokenizer.ggml.add_bos_token"] = false
+	return kv
+}
+
+func (p *whisperModel) Tensors(ts []Tensor) []*ggml.Tensor {
+	out := make([]*ggml.Tensor, 0, len(ts))
+	for _, t := range ts {
+		// the output projection is tied to the token embeddings
+		if t.Name() == "proj_out.weight" {
+			continue
+		}
+
+		out = append(out, &ggml.Tensor{
+			Name:     t.Name(),
+			Kind:     t.Kind(),
+			Shape:    t.Shape(),
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *whisperModel) Replacements() []string {
+	return []string{
+		"model.encoder.layers", "a.blk",
+		"model.encoder.conv1", "a.conv1",
+		"model.encoder.conv2", "a.conv2",
+		"model.encoder.embed_positions", "a.position_embd",
+		"model.encoder.layer_norm", "a.post_norm",
+		"model.decoder.layers", "blk",
+		"model.decoder.embed_tokens", "token_embd",
+		"model.decoder.embed_positions", "position_embd",
+		"model.decoder.layer_norm", "output_norm",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.out_proj", "attn_output",
+		"self_attn_layer_norm", "attn_norm",
+		"encoder_attn.q_proj", "cross_attn_q",
+		"encoder_attn.k_proj", "cross_attn_k",
+		"encoder_attn.v_proj", "cross_attn_v",
+		"encoder_attn.out_proj", "cross_attn_output",
+		"encoder_attn_layer_norm", "cross_attn_norm",
+		"fc1", "ffn_up",
+		"fc2", "ffn_down",
+		"final_layer_norm", "ffn_norm",
+	}
+}
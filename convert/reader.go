@@ -41,12 +41,16 @@ func (t tensorBase) Kind() uint32 {
 	if strings.HasSuffix(t.name, ".ffn_gate_inp.weight") ||
 		strings.HasSuffix(t.name, ".bias") ||
 		strings.HasSuffix(t.name, ".shortconv.conv.weight") ||
+		strings.HasSuffix(t.name, ".ssm_conv1d.weight") ||
 		t.name == "token_types.weight" ||
+		t.name == "mm.glb_gn" ||
+		t.name == "mm.sub_gn" ||
 		t.name == "v.positional_embedding_vlm" ||
 		t.name == "v.tile_position_embd.weight" ||
 		t.name == "v.pre_tile_position_embd.weight" ||
 		t.name == "v.post_tile_position_embd.weight" ||
 		t.name == "s.position_embd" ||
+		t.name == "a.position_embd.weight" ||
 		strings.HasSuffix(t.name, "rel_pos_h") ||
 		strings.HasSuffix(t.name, "rel_pos_w") {
 		// these tensors are always F32
@@ -148,6 +148,64 @@ func Remotes() []string {
 	return r
 }
 
+// Mirrors returns the registries to try, in order, before the default
+// registry when pulling models. Mirrors can be configured via the
+// OLLAMA_MIRRORS environment variable as a comma separated list of URLs.
+// Entries without a scheme default to "http".
+func Mirrors() (mirrors []*url.URL) {
+	for _, s := range strings.Split(Var("OLLAMA_MIRRORS"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "://") {
+			s = "http://" + s
+		}
+
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			slog.Warn("invalid mirror, ignoring", "mirror", s)
+			continue
+		}
+
+		mirrors = append(mirrors, u)
+	}
+
+	return mirrors
+}
+
+// redactedMirrors formats the configured mirrors without any API keys, which
+// are given as userinfo, so they can be logged.
+func redactedMirrors() string {
+	var s []string
+	for _, u := range Mirrors() {
+		if u.User != nil {
+			u.User = url.User("xxxxx")
+		}
+		s = append(s, u.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// OTLPHeaders returns the headers to send with exported spans. Headers can be
+// configured via the OTEL_EXPORTER_OTLP_HEADERS environment variable as a
+// comma separated list of key=value pairs.
+func OTLPHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, kv := range strings.Split(Var("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = unescaped
+		}
+		headers[k] = v
+	}
+	return headers
+}
+
 func BoolWithDefault(k string) func(defaultValue bool) bool {
 	return func(defaultValue bool) bool {
 		if s := Var(k); s != "" {
@@ -206,6 +264,8 @@ var (
 	UseAuth = Bool("OLLAMA_AUTH")
 	// Enable Vulkan backend
 	EnableVulkan = Bool("OLLAMA_VULKAN")
+	// ServeRegistry serves local models as a read-only registry
+	ServeRegistry = Bool("OLLAMA_SERVE_REGISTRY")
 )
 
 func String(s string) func() string {
@@ -223,6 +283,18 @@ var (
 	VkVisibleDevices      = String("GGML_VK_VISIBLE_DEVICES")
 	GpuDeviceOrdinal      = String("GPU_DEVICE_ORDINAL")
 	HsaOverrideGfxVersion = String("HSA_OVERRIDE_GFX_VERSION")
+
+	// APIKeysFile is a JSON file of API keys the server requires. If unset,
+	// the server does not authenticate requests.
+	APIKeysFile = String("OLLAMA_API_KEYS_FILE")
+	// APIKey is sent as a bearer token to servers that require API keys.
+	APIKey = String("OLLAMA_API_KEY")
+
+	// OTLPEndpoint is the OTLP/HTTP collector to export traces to. Tracing is
+	// disabled if unset.
+	OTLPEndpoint = String("OTEL_EXPORTER_OTLP_ENDPOINT")
+	// OTelServiceName overrides the service name reported with traces.
+	OTelServiceName = String("OTEL_SERVICE_NAME")
 )
 
 func Uint(key string, defaultValue uint) func() uint {
@@ -246,6 +318,16 @@ var (
 	MaxRunners = Uint("OLLAMA_MAX_LOADED_MODELS", 0)
 	// MaxQueue sets the maximum number of queued requests. MaxQueue can be configured via the OLLAMA_MAX_QUEUE environment variable.
 	MaxQueue = Uint("OLLAMA_MAX_QUEUE", 512)
+	// KvCacheSize sets the number of tokens in a K/V cache shared by parallel requests. KvCacheSize can be configured via the OLLAMA_KV_CACHE_SIZE environment variable.
+	KvCacheSize = Uint("OLLAMA_KV_CACHE_SIZE", 0)
+	// KvCacheHost sets the number of tokens in the K/V cache that are kept in system memory. KvCacheHost can be configured via the OLLAMA_KV_CACHE_HOST environment variable.
+	KvCacheHost = Uint("OLLAMA_KV_CACHE_HOST", 0)
+	// PrefillChunk sets the number of prompt tokens processed in each batch while other requests are generating. PrefillChunk can be configured via the OLLAMA_PREFILL_CHUNK environment variable.
+	PrefillChunk = Uint("OLLAMA_PREFILL_CHUNK", 0)
+	// MaxAdapters sets the number of LoRA adapters and control vectors that a loaded model can apply per request. MaxAdapters can be configured via the OLLAMA_MAX_ADAPTERS environment variable.
+	MaxAdapters = Uint("OLLAMA_MAX_ADAPTERS", 4)
+	// MaxStoredResponses sets the maximum number of Responses API responses kept on disk. MaxStoredResponses can be configured via the OLLAMA_MAX_STORED_RESPONSES environment variable.
+	MaxStoredResponses = Uint("OLLAMA_MAX_STORED_RESPONSES", 1000)
 )
 
 func Uint64(key string, defaultValue uint64) func() uint64 {
@@ -273,26 +355,37 @@ type EnvVar struct {
 
 func AsMap() map[string]EnvVar {
 	ret := map[string]EnvVar{
-		"OLLAMA_DEBUG":             {"OLLAMA_DEBUG", LogLevel(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
-		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention(false), "Enabled flash attention"},
-		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
-		"OLLAMA_GPU_OVERHEAD":      {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
-		"OLLAMA_HOST":              {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
-		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
-		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
-		"OLLAMA_LOAD_TIMEOUT":      {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
-		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
-		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
-		"OLLAMA_MODELS":            {"OLLAMA_MODELS", Models(), "The path to the models directory"},
-		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
-		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
-		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
-		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", AllowedOrigins(), "A comma separated list of allowed origins"},
-		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
-		"OLLAMA_MULTIUSER_CACHE":   {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
-		"OLLAMA_CONTEXT_LENGTH":    {"OLLAMA_CONTEXT_LENGTH", ContextLength(), "Context length to use unless otherwise specified (default: 4096)"},
-		"OLLAMA_NEW_ENGINE":        {"OLLAMA_NEW_ENGINE", NewEngine(), "Enable the new Ollama engine"},
-		"OLLAMA_REMOTES":           {"OLLAMA_REMOTES", Remotes(), "Allowed hosts for remote models (default \"ollama.com\")"},
+		"OLLAMA_API_KEYS_FILE":        {"OLLAMA_API_KEYS_FILE", APIKeysFile(), "JSON file of API keys required to call the server"},
+		"OLLAMA_DEBUG":                {"OLLAMA_DEBUG", LogLevel(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
+		"OLLAMA_FLASH_ATTENTION":      {"OLLAMA_FLASH_ATTENTION", FlashAttention(false), "Enabled flash attention"},
+		"OLLAMA_KV_CACHE_HOST":        {"OLLAMA_KV_CACHE_HOST", KvCacheHost(), "Number of tokens in the K/V cache kept in system memory rather than on the GPU (default: 0)"},
+		"OLLAMA_KV_CACHE_SIZE":        {"OLLAMA_KV_CACHE_SIZE", KvCacheSize(), "Number of tokens in the K/V cache shared by parallel requests (default: context length * parallel)"},
+		"OLLAMA_KV_CACHE_TYPE":        {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache, optionally per layer (e.g. q4_0,f16@0-3) (default: f16)"},
+		"OLLAMA_GPU_OVERHEAD":         {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
+		"OLLAMA_HOST":                 {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
+		"OLLAMA_KEEP_ALIVE":           {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
+		"OLLAMA_LLM_LIBRARY":          {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
+		"OLLAMA_LOAD_TIMEOUT":         {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
+		"OLLAMA_MAX_ADAPTERS":         {"OLLAMA_MAX_ADAPTERS", MaxAdapters(), "Maximum number of LoRA adapters and control vectors loaded into a model (default 4)"},
+		"OLLAMA_MAX_LOADED_MODELS":    {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
+		"OLLAMA_MAX_QUEUE":            {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
+		"OLLAMA_MAX_STORED_RESPONSES": {"OLLAMA_MAX_STORED_RESPONSES", MaxStoredResponses(), "Maximum number of stored Responses API responses (default 1000)"},
+		"OLLAMA_MIRRORS":              {"OLLAMA_MIRRORS", redactedMirrors(), "A comma separated list of registry mirrors to pull from before the default registry"},
+		"OLLAMA_MODELS":               {"OLLAMA_MODELS", Models(), "The path to the models directory"},
+		"OLLAMA_NOHISTORY":            {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
+		"OLLAMA_NOPRUNE":              {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
+		"OLLAMA_NUM_PARALLEL":         {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
+		"OLLAMA_ORIGINS":              {"OLLAMA_ORIGINS", AllowedOrigins(), "A comma separated list of allowed origins"},
+		"OLLAMA_SCHED_SPREAD":         {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
+		"OLLAMA_SERVE_REGISTRY":       {"OLLAMA_SERVE_REGISTRY", ServeRegistry(), "Serve local models as a read-only registry for other Ollama instances"},
+		"OLLAMA_MULTIUSER_CACHE":      {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
+		"OLLAMA_CONTEXT_LENGTH":       {"OLLAMA_CONTEXT_LENGTH", ContextLength(), "Context length to use unless otherwise specified (default: 4096)"},
+		"OLLAMA_NEW_ENGINE":           {"OLLAMA_NEW_ENGINE", NewEngine(), "Enable the new Ollama engine"},
+		"OLLAMA_PREFILL_CHUNK":        {"OLLAMA_PREFILL_CHUNK", PrefillChunk(), "Prompt tokens per batch while other requests are generating (default: num_batch)"},
+		"OLLAMA_REMOTES":              {"OLLAMA_REMOTES", Remotes(), "Allowed hosts for remote models (default \"ollama.com\")"},
+
+		"OTEL_EXPORTER_OTLP_ENDPOINT": {"OTEL_EXPORTER_OTLP_ENDPOINT", OTLPEndpoint(), "OTLP/HTTP endpoint to export traces to (e.g. http://localhost:4318)"},
+		"OTEL_SERVICE_NAME":           {"OTEL_SERVICE_NAME", OTelServiceName(), "Service name reported with traces (default \"ollama\")"},
 
 		// Informational
 		"HTTP_PROXY":  {"HTTP_PROXY", String("HTTP_PROXY")(), "HTTP proxy"},
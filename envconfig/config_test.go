@@ -148,6 +148,47 @@ func TestOrigins(t *testing.T) {
 	}
 }
 
+func TestMirrors(t *testing.T) {
+	cases := map[string][]string{
+		"":                                 nil,
+		"mirror.local:11434":               {"http://mirror.local:11434"},
+		"https://a.example, b.local:11434": {"https://a.example", "http://b.local:11434"},
+		"http://,c.local":                  {"http://c.local"},
+	}
+
+	for value, expect := range cases {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("OLLAMA_MIRRORS", value)
+
+			var actual []string
+			for _, u := range Mirrors() {
+				actual = append(actual, u.String())
+			}
+
+			if diff := cmp.Diff(expect, actual); diff != "" {
+				t.Errorf("%s: mismatch (-want +got):\n%s", value, diff)
+			}
+		})
+	}
+}
+
+func TestOTLPHeaders(t *testing.T) {
+	cases := map[string]map[string]string{
+		"":                                 {},
+		"authorization=Bearer%20abc":       {"authorization": "Bearer abc"},
+		" x-a = 1 ,x-b=2,invalid,=skipped": {"x-a": "1", "x-b": "2"},
+	}
+
+	for value, expect := range cases {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", value)
+			if diff := cmp.Diff(expect, OTLPHeaders()); diff != "" {
+				t.Errorf("%s: mismatch (-want +got):\n%s", value, diff)
+			}
+		})
+	}
+}
+
 func TestBool(t *testing.T) {
 	cases := map[string]bool{
 		"":      false,
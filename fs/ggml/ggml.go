@@ -11,6 +11,7 @@ import (
 	"maps"
 	"math"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ollama/ollama/format"
@@ -261,16 +262,20 @@ func (kv KV) OllamaEngineRequired() bool {
 		"gemma3",
 		"gemma3n",
 		"gptoss", "gpt-oss",
+		"granitehybrid",
 		"llama4",
+		"mamba2",
 		"mistral3",
 		"mllama",
 		"nomic-bert",
 		"olmo3",
+		"phi4mm",
 		"qwen25vl",
 		"qwen3", "qwen3moe",
 		"qwen3vl", "qwen3vlmoe",
 		"glm4moelite",
 		"lfm2",
+		"whisper",
 	}, kv.Architecture())
 }
 
@@ -828,6 +833,55 @@ func (f GGML) SupportsKVCacheType(cacheType string) bool {
 	return slices.Contains([]string{"q8_0", "q4_0"}, cacheType)
 }
 
+// ParseKVCacheType splits a cache type into the type of all layers and the
+// types of individual layers. Layers are overridden with type@layers where
+// layers is a layer number or an inclusive range, e.g. "q4_0,f16@0-3,f16@31".
+func ParseKVCacheType(cacheType string) (string, map[int]string, error) {
+	var defaultType string
+	var layerTypes map[int]string
+	for entry := range strings.SplitSeq(cacheType, ",") {
+		entry = strings.TrimSpace(entry)
+		t, layers, ok := strings.Cut(entry, "@")
+		if !ok {
+			if defaultType != "" {
+				return "", nil, fmt.Errorf("multiple default cache types: %q", cacheType)
+			}
+
+			defaultType = entry
+			continue
+		}
+
+		first, last, isRange := strings.Cut(layers, "-")
+		if !isRange {
+			last = first
+		}
+
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid layers %q in cache type: %w", layers, err)
+		}
+
+		to, err := strconv.Atoi(last)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid layers %q in cache type: %w", layers, err)
+		}
+
+		if from < 0 || to < from {
+			return "", nil, fmt.Errorf("invalid layers %q in cache type", layers)
+		}
+
+		if layerTypes == nil {
+			layerTypes = make(map[int]string)
+		}
+
+		for i := from; i <= to; i++ {
+			layerTypes[i] = t
+		}
+	}
+
+	return defaultType, layerTypes, nil
+}
+
 // KVCacheTypeIsQuantized checks if the requested cache type is a quantized type
 func (f GGML) KVCacheTypeIsQuantized(cacheType string) bool {
 	if cacheType == "" || cacheType == "f16" || cacheType == "f32" || cacheType == "bf16" {
@@ -299,3 +299,46 @@ func TestHeadCount(t *testing.T) {
 		}
 	}
 }
+
+func TestParseKVCacheType(t *testing.T) {
+	cases := []struct {
+		cacheType   string
+		defaultType string
+		layerTypes  map[int]string
+		err         bool
+	}{
+		{cacheType: "", defaultType: ""},
+		{cacheType: "q8_0", defaultType: "q8_0"},
+		{
+			cacheType:   "q4_0,f16@0-2,q8_0@5",
+			defaultType: "q4_0",
+			layerTypes:  map[int]string{0: "f16", 1: "f16", 2: "f16", 5: "q8_0"},
+		},
+		{cacheType: "f16@1", layerTypes: map[int]string{1: "f16"}},
+		{cacheType: "q4_0,q8_0", err: true},
+		{cacheType: "f16@a", err: true},
+		{cacheType: "f16@3-1", err: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.cacheType, func(t *testing.T) {
+			defaultType, layerTypes, err := ParseKVCacheType(tt.cacheType)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if defaultType != tt.defaultType {
+				t.Errorf("default type: got %q want %q", defaultType, tt.defaultType)
+			}
+
+			if diff := cmp.Diff(tt.layerTypes, layerTypes); diff != "" {
+				t.Errorf("layer types mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package tracing
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config configures span export.
+type Config struct {
+	// Endpoint is the URL of an OTLP/HTTP collector, e.g.
+	// "http://localhost:4318". Spans are sent to Endpoint/v1/traces.
+	Endpoint string
+
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string
+
+	// ServiceName and ServiceVersion identify this process in the
+	// exported resource.
+	ServiceName    string
+	ServiceVersion string
+
+	// BatchSize is the maximum number of spans per export request. If zero,
+	// 512 is used.
+	BatchSize int
+
+	// Interval is the maximum time a span waits before being exported. If
+	// zero, 5 seconds is used.
+	Interval time.Duration
+
+	// HTTPClient is used to send spans. If nil, a client with a 10 second
+	// timeout is used.
+	HTTPClient *http.Client
+}
+
+// maxQueuedSpans bounds memory use when the collector is slow or down. Spans
+// ended while the queue is full are dropped.
+const maxQueuedSpans = 2048
+
+type tracer struct {
+	cfg    Config
+	url    string
+	client *http.Client
+
+	spans chan *Span
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+// Init starts exporting spans as configured and returns a function that
+// flushes queued spans and stops exporting. It replaces any previous
+// configuration.
+func Init(cfg Config) (shutdown func(context.Context) error, _ error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("tracing: endpoint is required")
+	}
+
+	t := &tracer{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		client: cmp.Or(cfg.HTTPClient, &http.Client{Timeout: 10 * time.Second}),
+		spans:  make(chan *Span, maxQueuedSpans),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	t.cfg.ServiceName = cmp.Or(cfg.ServiceName, "ollama")
+	t.cfg.BatchSize = cmp.Or(cfg.BatchSize, 512)
+	t.cfg.Interval = cmp.Or(cfg.Interval, 5*time.Second)
+
+	go t.run()
+
+	if old := current.Swap(t); old != nil {
+		old.shutdown(context.Background())
+	}
+
+	return func(ctx context.Context) error {
+		current.CompareAndSwap(t, nil)
+		return t.shutdown(ctx)
+	}, nil
+}
+
+func (t *tracer) export(s *Span) {
+	select {
+	case t.spans <- s:
+	default:
+		slog.Debug("tracing: queue full, dropping span", "name", s.name)
+	}
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) > 0 {
+			if err := t.send(context.Background(), batch); err != nil {
+				slog.Warn("tracing: failed to export spans", "count", len(batch), "error", err)
+			}
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= t.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.quit:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+					if len(batch) >= t.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *tracer) shutdown(ctx context.Context) error {
+	select {
+	case <-t.quit:
+	default:
+		close(t.quit)
+	}
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *tracer) send(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The types below are the OTLP/HTTP JSON encoding of an export request.
+// Trace and span IDs are hex encoded and 64 bit integers are strings.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanJSON struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const statusError = 2
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func toKeyValue(a Attr) keyValue {
+	kv := keyValue{Key: a.Key}
+	switch v := a.Value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case bool:
+		kv.Value.BoolValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
+
+func (t *tracer) request(spans []*Span) exportRequest {
+	res := []keyValue{toKeyValue(String("service.name", t.cfg.ServiceName))}
+	if t.cfg.ServiceVersion != "" {
+		res = append(res, toKeyValue(String("service.version", t.cfg.ServiceVersion)))
+	}
+
+	out := make([]spanJSON, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		out[i] = spanJSON{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent.IsValid() {
+			out[i].ParentSpanID = s.parent.String()
+		}
+		for _, a := range s.attrs {
+			out[i].Attributes = append(out[i].Attributes, toKeyValue(a))
+		}
+		if s.err != "" {
+			out[i].Status = status{Code: statusError, Message: s.err}
+		}
+		s.mu.Unlock()
+	}
+
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: res},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "github.com/ollama/ollama"}, Spans: out}},
+	}}}
+}
@@ -0,0 +1,260 @@
+// Package tracing records spans and exports them to an OpenTelemetry
+// collector with OTLP over HTTP.
+//
+// Tracing is disabled until [Init] is called with an endpoint. While disabled,
+// [Start] returns a nil *Span whose methods are no-ops, so callers never need
+// to check whether tracing is enabled. Trace context is propagated between
+// processes with the W3C traceparent header regardless.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind describes the relationship of a span to its callers and callees.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attr is a span attribute.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int) Attr   { return Attr{key, int64(value)} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// Span is an operation within a trace. A nil *Span is valid and does nothing.
+type Span struct {
+	tracer *tracer
+
+	name   string
+	kind   Kind
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []Attr
+	err   string
+	ended bool
+}
+
+// SpanContext returns the identity of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End completes the span and queues it for export. Calls after the first
+// have no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.export(s)
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// Option configures a span started with [Start].
+type Option func(*Span)
+
+// WithKind sets the kind of the span. The default is [KindInternal].
+func WithKind(kind Kind) Option {
+	return func(s *Span) { s.kind = kind }
+}
+
+// WithAttributes sets attributes on the span when it starts.
+func WithAttributes(attrs ...Attr) Option {
+	return func(s *Span) { s.attrs = append(s.attrs, attrs...) }
+}
+
+// Start starts a span as a child of the span in ctx, or of the remote span
+// extracted into ctx by [Extract], and returns a context holding the new
+// span. The span must be ended with [Span.End].
+func Start(ctx context.Context, name string, opts ...Option) (context.Context, *Span) {
+	t := current.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   KindInternal,
+		start:  time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if parent := spanContextFromContext(ctx); parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+	}
+	rand.Read(s.sc.SpanID[:])
+	s.sc.Sampled = true
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func spanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+const traceparentHeader = "traceparent"
+
+// Inject sets the traceparent header for the current span in ctx, so a
+// request to another process continues the trace.
+func Inject(ctx context.Context, h http.Header) {
+	sc := spanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(traceparentHeader, FormatTraceparent(sc))
+}
+
+// Extract returns a context carrying the remote span context from the
+// traceparent header in h, if it is present and valid.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(traceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// FormatTraceparent formats sc as a version 00 W3C traceparent value.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a W3C traceparent value.
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, errInvalidTraceparent
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, errInvalidTraceparent
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+var current atomic.Pointer[tracer]
+
+// Enabled reports whether spans are being recorded.
+func Enabled() bool {
+	return current.Load() != nil
+}
@@ -0,0 +1,120 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ollama/ollama/internal/tracing"
+	"github.com/ollama/ollama/internal/tracing/tracingtest"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":     true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ext": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ext": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":     false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":     false,
+		"00-4bf92f3577b34da6a3ce929d0e0e47361234-00f067aa0ba902b7-01": false,
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":     false,
+		"": false,
+	}
+
+	for value, valid := range cases {
+		sc, err := tracing.ParseTraceparent(value)
+		if valid != (err == nil) {
+			t.Errorf("%q: expected valid=%v, got error %v", value, valid, err)
+			continue
+		}
+		if valid && value[:2] == "00" {
+			if got := tracing.FormatTraceparent(sc); got != value {
+				t.Errorf("%q: round trip got %q", value, got)
+			}
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), "noop")
+	if span != nil {
+		t.Fatal("expected nil span while tracing is disabled")
+	}
+
+	// A nil span is safe to use
+	span.SetAttributes(tracing.String("k", "v"))
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	// Incoming trace context is still propagated
+	in := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx = tracing.Extract(ctx, in)
+	out := make(http.Header)
+	tracing.Inject(ctx, out)
+	if got := out.Get("traceparent"); got != in.Get("traceparent") {
+		t.Errorf("expected traceparent to be propagated, got %q", got)
+	}
+}
+
+func TestExport(t *testing.T) {
+	c := tracingtest.Start(t)
+
+	ctx := tracing.Extract(context.Background(), http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+
+	ctx, parent := tracing.Start(ctx, "parent", tracing.WithKind(tracing.KindServer), tracing.WithAttributes(tracing.String("model", "test")))
+	_, child := tracing.Start(ctx, "child")
+	child.SetAttributes(tracing.Int("tokens", 42), tracing.Bool("cached", true))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+
+	h := make(http.Header)
+	tracing.Inject(ctx, h)
+	if want := tracing.FormatTraceparent(parent.SpanContext()); h.Get("traceparent") != want {
+		t.Errorf("expected traceparent %q, got %q", want, h.Get("traceparent"))
+	}
+	parent.End()
+
+	spans := c.Flush(t)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	p, ok := tracingtest.Find(spans, "parent")
+	if !ok {
+		t.Fatal("parent span not exported")
+	}
+	if p.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || p.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("parent did not continue remote trace: %+v", p)
+	}
+	if p.Kind != int(tracing.KindServer) || p.Attributes["model"] != "test" {
+		t.Errorf("unexpected parent span %+v", p)
+	}
+
+	ch, ok := tracingtest.Find(spans, "child")
+	if !ok {
+		t.Fatal("child span not exported")
+	}
+	if ch.TraceID != p.TraceID || ch.ParentSpanID != p.SpanID {
+		t.Errorf("child is not a child of parent: %+v", ch)
+	}
+	if ch.Attributes["tokens"] != "42" || ch.Attributes["cached"] != "true" {
+		t.Errorf("unexpected child attributes %v", ch.Attributes)
+	}
+	if ch.StatusCode != 2 || ch.StatusMsg != "boom" {
+		t.Errorf("expected error status, got %d %q", ch.StatusCode, ch.StatusMsg)
+	}
+
+	if r := c.Resource(); r["service.name"] != "ollama" || r["service.version"] != "test" {
+		t.Errorf("unexpected resource %v", r)
+	}
+
+	if tracing.Enabled() {
+		t.Error("expected tracing to be disabled after flush")
+	}
+}
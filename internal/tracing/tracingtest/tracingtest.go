@@ -0,0 +1,174 @@
+// Package tracingtest provides an in-process OTLP collector for tests.
+package tracingtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ollama/ollama/internal/tracing"
+)
+
+// Span is an exported span as received by the collector.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         int
+	Attributes   map[string]string
+	StatusCode   int
+	StatusMsg    string
+}
+
+// Collector receives spans exported with OTLP/HTTP JSON.
+type Collector struct {
+	srv      *httptest.Server
+	shutdown func(context.Context) error
+
+	mu       sync.Mutex
+	spans    []Span
+	resource map[string]string
+}
+
+// Start starts a collector and enables tracing to it for the duration of the
+// test.
+func Start(t *testing.T) *Collector {
+	t.Helper()
+
+	c := &Collector{}
+	c.srv = httptest.NewServer(http.HandlerFunc(c.handle))
+	t.Cleanup(c.srv.Close)
+
+	shutdown, err := tracing.Init(tracing.Config{Endpoint: c.srv.URL, ServiceVersion: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.shutdown = shutdown
+	t.Cleanup(func() { shutdown(context.Background()) })
+	return c
+}
+
+// URL returns the base URL of the collector.
+func (c *Collector) URL() string {
+	return c.srv.URL
+}
+
+// Flush stops tracing, waits for queued spans to be exported and returns
+// every span received.
+func (c *Collector) Flush(t *testing.T) []Span {
+	t.Helper()
+	if err := c.shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c.Spans()
+}
+
+// Spans returns the spans received so far.
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Resource returns the resource attributes of the last export request.
+func (c *Collector) Resource() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resource
+}
+
+// Find returns the first span with the given name.
+func Find(spans []Span, name string) (Span, bool) {
+	for _, s := range spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Span{}, false
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string `json:"stringValue"`
+		IntValue    *string `json:"intValue"`
+		BoolValue   *bool   `json:"boolValue"`
+	} `json:"value"`
+}
+
+func attributes(kvs []keyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		switch {
+		case kv.Value.StringValue != nil:
+			m[kv.Key] = *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			m[kv.Key] = *kv.Value.IntValue
+		case kv.Value.BoolValue != nil:
+			if *kv.Value.BoolValue {
+				m[kv.Key] = "true"
+			} else {
+				m[kv.Key] = "false"
+			}
+		}
+	}
+	return m
+}
+
+func (c *Collector) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []keyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string     `json:"traceId"`
+					SpanID       string     `json:"spanId"`
+					ParentSpanID string     `json:"parentSpanId"`
+					Name         string     `json:"name"`
+					Kind         int        `json:"kind"`
+					Attributes   []keyValue `json:"attributes"`
+					Status       struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		c.resource = attributes(rs.Resource.Attributes)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans = append(c.spans, Span{
+					TraceID:      s.TraceID,
+					SpanID:       s.SpanID,
+					ParentSpanID: s.ParentSpanID,
+					Name:         s.Name,
+					Kind:         s.Kind,
+					Attributes:   attributes(s.Attributes),
+					StatusCode:   s.Status.Code,
+					StatusMsg:    s.Status.Message,
+				})
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
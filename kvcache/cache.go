@@ -75,3 +75,47 @@ type Cache interface {
 	// removed by calling Remove(seq, 0, math.MaxInt32)
 	Remove(seq int, beginIndex, endIndex int32) error
 }
+
+// CheckpointCache is a cache that can only resume a sequence from some of its
+// earlier positions, such as one holding the state of recurrent layers.
+type CheckpointCache interface {
+	Cache
+
+	// Checkpoint returns the latest position no later than pos that the
+	// sequence can resume from.
+	Checkpoint(seq int, pos int32) int32
+}
+
+// BlockCache is a cache that can allocate entries to sequences in fixed size
+// blocks from a pool shared by all sequences, rather than reserving the full
+// capacity of each sequence up front. Blocks only control where entries are
+// stored; there is no block table and attention is not paged.
+type BlockCache interface {
+	Cache
+
+	// SetBlockAllocation limits the cache to poolSize entries shared by all
+	// sequences, allocated blockSize entries at a time. It must be called
+	// before Init.
+	SetBlockAllocation(poolSize, blockSize int)
+}
+
+// LayerDTypeCache is a cache that can store the entries of some layers with a
+// different data type than the one passed to Init.
+type LayerDTypeCache interface {
+	Cache
+
+	// SetLayerDTypes overrides the data type of the given layers. It must be
+	// called before Init.
+	SetLayerDTypes(dtypes map[int]ml.DType)
+}
+
+// HostCache is a cache that can keep some of its entries in system memory
+// rather than with their layer, so that long contexts don't need to move
+// whole layers off of the GPU.
+type HostCache interface {
+	Cache
+
+	// SetHostCapacity keeps up to cells entries of each layer in system
+	// memory. It must be called before Init.
+	SetHostCapacity(cells int)
+}
@@ -29,6 +29,24 @@ type Causal struct {
 
 	chunkSize int32
 
+	// blockSize is the number of cells allocated to a sequence at a time.
+	// Sequences only add entries to blocks that hold no other sequence, which
+	// keeps their entries close together. This only affects where entries are
+	// stored: attention still covers the full cell range of each sequence,
+	// including blocks of other sequences in between, which are masked out.
+	// poolSize limits the number of cells shared by all sequences. Both are 0
+	// if block allocation is not being used.
+	blockSize int
+	poolSize  int
+
+	// layerDTypes overrides DType for individual layers
+	layerDTypes map[int]ml.DType
+
+	// hostCells is the number of cells at the start of the cache that are
+	// kept in system memory rather than with their layer. Free cells are
+	// filled in order so these generally hold the oldest entries.
+	hostCells int
+
 	opts CausalOptions
 
 	// maxBatch is the largest batch that we might receive
@@ -45,6 +63,12 @@ type Causal struct {
 	// locations for data storage for this batch
 	curLoc ml.Tensor
 
+	// locations for data storage for this batch in the cells in system memory
+	// and on the device, plus the indices of the entries of the batch stored
+	// there if not all of them
+	curHostLoc, curHostIdx ml.Tensor
+	curDevLoc, curDevIdx   ml.Tensor
+
 	// mask of the cache as used by this batch
 	curMask ml.Tensor
 
@@ -60,6 +84,11 @@ type Causal struct {
 	// curPositions is the positions corresponding to this pass's entries in the cache
 	curPositions []int32
 
+	// curLocs and prevRanges record the cells this pass allocated and the
+	// ranges of its sequences beforehand, so the pass can be undone
+	curLocs    []int32
+	prevRanges map[int]*cellRange
+
 	// ** cache metadata **
 
 	// for each possible location in the cache, stores the position and set of sequences
@@ -75,6 +104,9 @@ type Causal struct {
 	backend      ml.Backend
 	ctxs         map[int]ml.Context
 	keys, values map[int]ml.Tensor
+
+	// hostKeys and hostValues store the cells in system memory
+	hostKeys, hostValues map[int]ml.Tensor
 }
 
 type cacheCell struct {
@@ -89,10 +121,12 @@ type cellRange struct {
 
 func NewCausalCache(shift shiftFn) *Causal {
 	return &Causal{
-		shiftFn: shift,
-		ctxs:    make(map[int]ml.Context),
-		keys:    make(map[int]ml.Tensor),
-		values:  make(map[int]ml.Tensor),
+		shiftFn:    shift,
+		ctxs:       make(map[int]ml.Context),
+		keys:       make(map[int]ml.Tensor),
+		values:     make(map[int]ml.Tensor),
+		hostKeys:   make(map[int]ml.Tensor),
+		hostValues: make(map[int]ml.Tensor),
 	}
 }
 
@@ -103,6 +137,8 @@ func NewSWACache(windowSize int32, shift shiftFn) *Causal {
 		ctxs:          make(map[int]ml.Context),
 		keys:          make(map[int]ml.Tensor),
 		values:        make(map[int]ml.Tensor),
+		hostKeys:      make(map[int]ml.Tensor),
+		hostValues:    make(map[int]ml.Tensor),
 	}
 }
 
@@ -114,16 +150,20 @@ func NewSWAMemCache(windowSize int32, memorySize int32, shift shiftFn) *Causal {
 		ctxs:          make(map[int]ml.Context),
 		keys:          make(map[int]ml.Tensor),
 		values:        make(map[int]ml.Tensor),
+		hostKeys:      make(map[int]ml.Tensor),
+		hostValues:    make(map[int]ml.Tensor),
 	}
 }
 
 func NewChunkedAttentionCache(chunkSize int32, shift shiftFn) *Causal {
 	return &Causal{
-		chunkSize: chunkSize,
-		shiftFn:   shift,
-		ctxs:      make(map[int]ml.Context),
-		keys:      make(map[int]ml.Tensor),
-		values:    make(map[int]ml.Tensor),
+		chunkSize:  chunkSize,
+		shiftFn:    shift,
+		ctxs:       make(map[int]ml.Context),
+		keys:       make(map[int]ml.Tensor),
+		values:     make(map[int]ml.Tensor),
+		hostKeys:   make(map[int]ml.Tensor),
+		hostValues: make(map[int]ml.Tensor),
 	}
 }
 
@@ -172,15 +212,63 @@ func (c *Causal) Init(backend ml.Backend, dtype ml.DType, maxSequences, capacity
 	} else {
 		cacheSize = (maxSequences * int(c.swaMemorySize)) + maxBatch
 	}
+
+	if c.blockSize > 0 {
+		c.blockSize = roundUp(c.blockSize, c.config.CachePadding)
+		if c.poolSize > 0 {
+			cacheSize = min(cacheSize, max(c.poolSize, capacity, maxBatch))
+		}
+		cacheSize = roundUp(cacheSize, c.blockSize)
+	}
+
 	cacheSize = roundUp(cacheSize, c.config.CachePadding)
 	c.cells = make([]cacheCell, cacheSize)
 
+	if c.hostCells > 0 {
+		// keep room for at least a batch on the device
+		c.hostCells = min(roundDown(c.hostCells, c.config.CachePadding), cacheSize-roundUp(maxBatch, c.config.CachePadding))
+		c.hostCells = max(c.hostCells, 0)
+	}
+
 	c.DType = dtype
 	c.cellRanges = make(map[int]cellRange)
 	c.backend = backend
 	c.maxBatch = maxBatch
 }
 
+func (c *Causal) SetBlockAllocation(poolSize, blockSize int) {
+	c.poolSize = poolSize
+	c.blockSize = blockSize
+}
+
+func (c *Causal) SetLayerDTypes(dtypes map[int]ml.DType) {
+	c.layerDTypes = dtypes
+}
+
+func (c *Causal) SetHostCapacity(cells int) {
+	c.hostCells = cells
+}
+
+// layerHostCells returns the number of cells of a layer that are in system
+// memory. Quantized entries can't be joined for attention so those layers
+// are kept together.
+func (c *Causal) layerHostCells(layer int) int {
+	switch c.layerDType(layer) {
+	case ml.DTypeF16, ml.DTypeF32:
+		return c.hostCells
+	default:
+		return 0
+	}
+}
+
+func (c *Causal) layerDType(layer int) ml.DType {
+	if dtype, ok := c.layerDTypes[layer]; ok {
+		return dtype
+	}
+
+	return c.DType
+}
+
 func (c *Causal) SetConfig(config ml.CacheConfig) {
 	if c.config != nil {
 		panic("config cannot be changed after being previously set, either by the model or backend")
@@ -200,6 +288,7 @@ func (c *Causal) StartForward(ctx ml.Context, batch input.Batch, reserve bool) e
 	c.curSequences = batch.Sequences
 	c.curPositions = batch.Positions
 	c.opts.Except = nil
+	c.curLocs, c.prevRanges = nil, nil
 
 	var locs []int32
 	if !reserve {
@@ -211,6 +300,20 @@ func (c *Causal) StartForward(ctx ml.Context, batch input.Batch, reserve bool) e
 			return err
 		}
 
+		c.curLocs = locs
+		c.prevRanges = make(map[int]*cellRange)
+		for _, seq := range batch.Sequences {
+			if _, ok := c.prevRanges[seq]; ok {
+				continue
+			}
+
+			if seqRange, ok := c.cellRanges[seq]; ok {
+				c.prevRanges[seq] = &seqRange
+			} else {
+				c.prevRanges[seq] = nil
+			}
+		}
+
 		for i, pos := range batch.Positions {
 			seq := batch.Sequences[i]
 			loc := int(locs[i])
@@ -242,11 +345,65 @@ func (c *Causal) StartForward(ctx ml.Context, batch input.Batch, reserve bool) e
 	}
 
 	c.curLoc = ctx.Input().FromInts(locs, len(locs))
+	if c.hostCells > 0 {
+		c.splitLocs(ctx, locs, reserve)
+	}
 	c.curMask = c.buildMask(ctx)
 
 	return nil
 }
 
+// undoForward frees the cells allocated by the last call to StartForward,
+// for when a batch is abandoned before it is computed.
+func (c *Causal) undoForward() {
+	for _, loc := range c.curLocs {
+		c.cells[loc] = cacheCell{}
+	}
+
+	for seq, seqRange := range c.prevRanges {
+		if seqRange != nil {
+			c.cellRanges[seq] = *seqRange
+		} else {
+			delete(c.cellRanges, seq)
+		}
+	}
+
+	c.curLocs, c.prevRanges = nil, nil
+}
+
+// splitLocs divides the locations of the batch between the cells in system
+// memory and on the device. When reserving, all of the batch is stored in
+// both to account for the worst case.
+func (c *Causal) splitLocs(ctx ml.Context, locs []int32, reserve bool) {
+	var hostLocs, hostIdxs, devLocs, devIdxs []int32
+	for i, loc := range locs {
+		if reserve || int(loc) < c.hostCells {
+			hostLocs = append(hostLocs, loc)
+			hostIdxs = append(hostIdxs, int32(i))
+		}
+
+		if reserve || int(loc) >= c.hostCells {
+			devLocs = append(devLocs, max(loc-int32(c.hostCells), 0))
+			devIdxs = append(devIdxs, int32(i))
+		}
+	}
+
+	c.curHostLoc, c.curHostIdx, c.curDevLoc, c.curDevIdx = nil, nil, nil, nil
+	if len(hostLocs) > 0 {
+		c.curHostLoc = ctx.Input().FromInts(hostLocs, len(hostLocs))
+		if reserve || len(hostLocs) < len(locs) {
+			c.curHostIdx = ctx.Input().FromInts(hostIdxs, len(hostIdxs))
+		}
+	}
+
+	if len(devLocs) > 0 {
+		c.curDevLoc = ctx.Input().FromInts(devLocs, len(devLocs))
+		if reserve || len(devLocs) < len(locs) {
+			c.curDevIdx = ctx.Input().FromInts(devIdxs, len(devIdxs))
+		}
+	}
+}
+
 func newRange() cellRange {
 	return cellRange{
 		min: math.MaxInt,
@@ -256,6 +413,10 @@ func newRange() cellRange {
 
 // Returns a slice of locations where each token in the batch should be stored
 func (c *Causal) findLocs() ([]int32, error) {
+	if c.blockSize > 0 {
+		return c.findBlockLocs()
+	}
+
 	loc := make([]int32, 0, c.curBatchSize)
 
 	for i := range c.cells {
@@ -270,6 +431,92 @@ func (c *Causal) findLocs() ([]int32, error) {
 	return nil, fmt.Errorf("%w (cache: %v batch: %v)", ErrKvCacheFull, len(c.cells), c.curBatchSize)
 }
 
+// blockShared marks blocks holding entries of more than one sequence
+const blockShared = -2
+
+// findBlockLocs is findLocs when allocating by block. Cells are allocated to
+// sequences a block at a time but there is no block table: the owner of each
+// block is found by scanning the cells once per batch. Tokens are stored in
+// free cells of blocks that only hold their sequence, otherwise in a new
+// block. If there are no free blocks, any free cell is used.
+func (c *Causal) findBlockLocs() ([]int32, error) {
+	numBlocks := len(c.cells) / c.blockSize
+
+	// owners is the sequence stored in each block, -1 if the block is free
+	owners := make([]int, numBlocks)
+	seqBlocks := make(map[int][]int)
+	for b := range owners {
+		owners[b] = -1
+		for _, cell := range c.cells[b*c.blockSize : (b+1)*c.blockSize] {
+			if len(cell.sequences) == 0 {
+				continue
+			}
+
+			if len(cell.sequences) > 1 || (owners[b] != -1 && owners[b] != cell.sequences[0]) {
+				owners[b] = blockShared
+				break
+			}
+
+			owners[b] = cell.sequences[0]
+		}
+
+		if owners[b] >= 0 {
+			seqBlocks[owners[b]] = append(seqBlocks[owners[b]], b)
+		}
+	}
+
+	// next is the offset in each block to look for a free cell from, so
+	// each cell is checked at most once per batch
+	next := make([]int, numBlocks)
+	freeCell := func(b int) int {
+		for ; next[b] < c.blockSize; next[b]++ {
+			if i := b*c.blockSize + next[b]; len(c.cells[i].sequences) == 0 {
+				next[b]++
+				return i
+			}
+		}
+		return -1
+	}
+
+	var freeBlock, anyBlock int
+	locs := make([]int32, c.curBatchSize)
+	for i, seq := range c.curSequences {
+		loc := -1
+		for blocks := seqBlocks[seq]; len(blocks) > 0; blocks = blocks[1:] {
+			if loc = freeCell(blocks[0]); loc >= 0 {
+				break
+			}
+			seqBlocks[seq] = blocks[1:]
+		}
+
+		if loc < 0 {
+			for freeBlock < numBlocks && owners[freeBlock] != -1 {
+				freeBlock++
+			}
+
+			if freeBlock < numBlocks {
+				owners[freeBlock] = seq
+				seqBlocks[seq] = append(seqBlocks[seq], freeBlock)
+				loc = freeCell(freeBlock)
+			}
+		}
+
+		for ; loc < 0 && anyBlock < numBlocks; anyBlock++ {
+			if loc = freeCell(anyBlock); loc >= 0 {
+				break
+			}
+		}
+
+		if loc < 0 {
+			return nil, fmt.Errorf("%w (cache: %v batch: %v)", ErrKvCacheFull, len(c.cells), c.curBatchSize)
+		}
+
+		locs[i] = int32(loc)
+	}
+
+	return locs, nil
+}
+
 func (c *Causal) updateSlidingWindow() {
 	c.curCellRange = newRange()
 
@@ -409,26 +656,50 @@ func (c *Causal) SetCausal(ctx ml.Context, opts CausalOptions) {
 }
 
 func (c *Causal) Get(ctx ml.Context) (ml.Tensor, ml.Tensor, ml.Tensor) {
-	key := c.keys[c.curLayer]
-	value := c.values[c.curLayer]
+	keys, values := c.keys[c.curLayer], c.values[c.curLayer]
+	hostCells := c.layerHostCells(c.curLayer)
+	start, size := c.curCellRange.min, c.curMask.Dim(0)
+
+	var key, value ml.Tensor
+	switch {
+	case start >= hostCells:
+		key, value = c.view(ctx, keys, values, start-hostCells, size)
+	case start+size <= hostCells:
+		key, value = c.view(ctx, c.hostKeys[c.curLayer], c.hostValues[c.curLayer], start, size)
+	default:
+		// older entries are streamed from system memory and joined with the rest
+		hostKey, hostValue := c.view(ctx, c.hostKeys[c.curLayer], c.hostValues[c.curLayer], start, hostCells-start)
+		key, value = c.view(ctx, keys, values, 0, start+size-hostCells)
+
+		key = hostKey.Concat(ctx, key, 2)
+		if c.config.PermutedV {
+			value = hostValue.Concat(ctx, value, 0)
+		} else {
+			value = hostValue.Concat(ctx, value, 2)
+		}
+	}
+
+	return key, value, c.curMask
+}
 
+// view returns size cells of key and value starting at start
+func (c *Causal) view(ctx ml.Context, key, value ml.Tensor, start, size int) (ml.Tensor, ml.Tensor) {
 	kHeadDim := key.Dim(0)
 	numKVHeads := key.Dim(1)
 	rowSize := key.Stride(2)
-	cachedSize := c.curMask.Dim(0)
 
-	key = key.View(ctx, rowSize*c.curCellRange.min,
+	key = key.View(ctx, rowSize*start,
 		kHeadDim, key.Stride(1),
 		numKVHeads, key.Stride(2),
-		cachedSize,
+		size,
 	)
 
 	if c.config.PermutedV {
 		vHeadDim := value.Dim(1)
 		elemSize := value.Stride(0)
 
-		value = value.View(ctx, elemSize*c.curCellRange.min,
-			cachedSize, value.Stride(1),
+		value = value.View(ctx, elemSize*start,
+			size, value.Stride(1),
 			vHeadDim, value.Stride(2),
 			numKVHeads,
 		)
@@ -436,14 +707,14 @@ func (c *Causal) Get(ctx ml.Context) (ml.Tensor, ml.Tensor, ml.Tensor) {
 		vHeadDim := value.Dim(0)
 		rowSize := value.Stride(2)
 
-		value = value.View(ctx, rowSize*c.curCellRange.min,
+		value = value.View(ctx, rowSize*start,
 			vHeadDim, value.Stride(1),
 			numKVHeads, value.Stride(2),
-			cachedSize,
+			size,
 		)
 	}
 
-	return key, value, c.curMask
+	return key, value
 }
 
 func (c *Causal) Put(ctx ml.Context, key, value ml.Tensor) {
@@ -456,44 +727,82 @@ func (c *Causal) Put(ctx ml.Context, key, value ml.Tensor) {
 		panic(fmt.Errorf("inconsistent batch sizes (layer: %v, batch size: %v layer batch size: %v)", c.curLayer, c.curBatchSize, batchSize))
 	}
 
+	hostCells := c.layerHostCells(c.curLayer)
+
 	if _, ok := c.ctxs[c.curLayer]; !ok {
-		c.ctxs[c.curLayer] = c.backend.NewContextSize(2).Layer(c.curLayer)
+		c.ctxs[c.curLayer] = c.backend.NewContextSize(4).Layer(c.curLayer)
 	}
 
 	if _, ok := c.keys[c.curLayer]; !ok {
-		c.keys[c.curLayer] = c.ctxs[c.curLayer].Zeros(c.DType, kHeadDim, numKVHeads, len(c.cells))
+		c.keys[c.curLayer] = c.newKeys(c.ctxs[c.curLayer], kHeadDim, numKVHeads, len(c.cells)-hostCells)
+		if hostCells > 0 {
+			c.hostKeys[c.curLayer] = c.newKeys(c.ctxs[c.curLayer].Host(), kHeadDim, numKVHeads, hostCells)
+		}
 	}
 
 	if _, ok := c.values[c.curLayer]; !ok {
-		if c.config.PermutedV {
-			c.values[c.curLayer] = c.ctxs[c.curLayer].Zeros(c.DType, len(c.cells), vHeadDim, numKVHeads)
-		} else {
-			c.values[c.curLayer] = c.ctxs[c.curLayer].Zeros(c.DType, vHeadDim, numKVHeads, len(c.cells))
+		c.values[c.curLayer] = c.newValues(c.ctxs[c.curLayer], vHeadDim, numKVHeads, len(c.cells)-hostCells)
+		if hostCells > 0 {
+			c.hostValues[c.curLayer] = c.newValues(c.ctxs[c.curLayer].Host(), vHeadDim, numKVHeads, hostCells)
 		}
 	}
 
 	key = key.Reshape(ctx, kHeadDim*numKVHeads, batchSize)
-	keyCache := c.keys[c.curLayer]
-	keyCache = keyCache.Reshape(ctx, kHeadDim*numKVHeads, len(c.cells))
-	ctx.Forward(keyCache.SetRows(ctx, key, c.curLoc))
+	value = value.Reshape(ctx, vHeadDim*numKVHeads, batchSize)
+
+	if hostCells == 0 {
+		c.putRows(ctx, c.keys[c.curLayer], c.values[c.curLayer], key, value, c.curLoc, nil)
+		return
+	}
+
+	if c.curHostLoc != nil {
+		c.putRows(ctx, c.hostKeys[c.curLayer], c.hostValues[c.curLayer], key, value, c.curHostLoc, c.curHostIdx)
+	}
+
+	if c.curDevLoc != nil {
+		c.putRows(ctx, c.keys[c.curLayer], c.values[c.curLayer], key, value, c.curDevLoc, c.curDevIdx)
+	}
+}
+
+func (c *Causal) newKeys(ctx ml.Context, kHeadDim, numKVHeads, cells int) ml.Tensor {
+	return ctx.Zeros(c.layerDType(c.curLayer), kHeadDim, numKVHeads, cells)
+}
 
+func (c *Causal) newValues(ctx ml.Context, vHeadDim, numKVHeads, cells int) ml.Tensor {
 	if c.config.PermutedV {
-		value = value.Reshape(ctx, vHeadDim*numKVHeads, 1, batchSize)
-		value = value.Permute(ctx, 2, 0, 1, 3)
+		return ctx.Zeros(c.layerDType(c.curLayer), cells, vHeadDim, numKVHeads)
+	}
+
+	return ctx.Zeros(c.layerDType(c.curLayer), vHeadDim, numKVHeads, cells)
+}
 
-		valueCache := c.values[c.curLayer]
-		valueCache = valueCache.Reshape(ctx, 1, len(c.cells), vHeadDim*numKVHeads)
+// putRows stores the rows of key and value in the cells of keyCache and
+// valueCache at locs. If idxs is not nil, only those rows are stored.
+func (c *Causal) putRows(ctx ml.Context, keyCache, valueCache, key, value, locs, idxs ml.Tensor) {
+	if idxs != nil {
+		key = key.Rows(ctx, idxs)
+		value = value.Rows(ctx, idxs)
+	}
 
-		ctx.Forward(valueCache.SetRows(ctx, value, c.curLoc))
-	} else {
-		value = value.Reshape(ctx, vHeadDim*numKVHeads, batchSize)
-		valueCache := c.values[c.curLayer]
-		valueCache = valueCache.Reshape(ctx, vHeadDim*numKVHeads, len(c.cells))
+	keyCache = keyCache.Reshape(ctx, key.Dim(0), keyCache.Dim(2))
+	ctx.Forward(keyCache.SetRows(ctx, key, locs))
 
-		ctx.Forward(valueCache.SetRows(ctx, value, c.curLoc))
+	if c.config.PermutedV {
+		rowSize := value.Dim(0)
+		value = value.Reshape(ctx, rowSize, 1, value.Dim(1))
+		value = value.Permute(ctx, 2, 0, 1, 3)
+
+		valueCache = valueCache.Reshape(ctx, 1, valueCache.Dim(0), rowSize)
+		ctx.Forward(valueCache.SetRows(ctx, value, locs))
+	} else {
+		valueCache = valueCache.Reshape(ctx, value.Dim(0), valueCache.Dim(2))
+		ctx.Forward(valueCache.SetRows(ctx, value, locs))
 	}
 }
 
+// CopyPrefix shares the cells of the prefix between the sequences rather than
+// copying them. With block allocation, neither sequence adds entries to the
+// blocks that are now shared.
 func (c *Causal) CopyPrefix(srcSeq, dstSeq int, len int32) {
 	seqRange := newRange()
 
@@ -553,8 +862,12 @@ func (c *Causal) shift(seq int, beginIndex, offset int32) error {
 
 	seqRange := c.cellRanges[seq]
 
-	for start := seqRange.min; start <= seqRange.max; start += c.maxBatch {
-		size := min(seqRange.max-start+1, c.maxBatch)
+	for start, size := seqRange.min, 0; start <= seqRange.max; start += size {
+		size = min(seqRange.max-start+1, c.maxBatch)
+		if start < c.hostCells {
+			// batches don't span the cells in system memory and on the device
+			size = min(size, c.hostCells-start)
+		}
 		offsets := make([]int32, size)
 
 		var batchFirst, batchLast int
@@ -586,11 +899,18 @@ func (c *Causal) shift(seq int, beginIndex, offset int32) error {
 				continue
 			}
 
+			cell := start + batchFirst
+			if hostCells := c.layerHostCells(i); cell < hostCells {
+				key = c.hostKeys[i]
+			} else {
+				cell -= hostCells
+			}
+
 			kHeadDim := key.Dim(0)
 			numKVHeads := key.Dim(1)
 			rowSize := key.Stride(2)
 
-			key = key.View(ctx, rowSize*(start+batchFirst),
+			key = key.View(ctx, rowSize*cell,
 				kHeadDim, key.Stride(1),
 				numKVHeads, key.Stride(2),
 				len(offsets),
@@ -1,6 +1,7 @@
 package kvcache
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"slices"
@@ -446,6 +447,252 @@ func TestCopy(t *testing.T) {
 	})
 }
 
+func TestBlockAllocation(t *testing.T) {
+	runPermutedVariants(t, func(t *testing.T, backend *testBackend) {
+		cache := NewCausalCache(nil)
+		defer cache.Close()
+
+		cache.SetBlockAllocation(8, 4)
+		cache.Init(backend, ml.DTypeF16, 4, 8, 4)
+
+		if len(cache.cells) != 8 {
+			t.Fatalf("expected a pool of 8 cells, got %v", len(cache.cells))
+		}
+
+		x := float32(math.Inf(-1))
+
+		tests := []testCase{
+			{
+				name:          "Interleaved",
+				in:            []float32{1, 2, 3, 4},
+				inShape:       []int{1, 1, 4},
+				seqs:          []int{0, 1, 0, 1},
+				pos:           []int32{0, 0, 1, 1},
+				expected:      []float32{1, 3, 0, 0, 2, 4},
+				expectedShape: []int{1, 1, 6},
+				expectedMask: []float32{
+					0, x, x, x, x, x,
+					x, x, x, x, 0, x,
+					0, 0, x, x, x, x,
+					x, x, x, x, 0, 0,
+				},
+			},
+		}
+
+		testCache(t, backend, cache, tests)
+
+		context := backend.NewContext()
+		defer context.Close()
+
+		err := cache.StartForward(context, input.Batch{
+			Positions: []int32{0, 1, 2, 3, 4},
+			Sequences: []int{2, 2, 2, 2, 2},
+		}, false)
+		if !errors.Is(err, ErrKvCacheFull) {
+			t.Fatalf("expected the pool to be full, got %v", err)
+		}
+	})
+}
+
+func TestBlockAllocationCopy(t *testing.T) {
+	runPermutedVariants(t, func(t *testing.T, backend *testBackend) {
+		cache := NewCausalCache(nil)
+		defer cache.Close()
+
+		cache.SetBlockAllocation(12, 4)
+		cache.Init(backend, ml.DTypeF16, 2, 8, 4)
+
+		x := float32(math.Inf(-1))
+
+		tests := []testCase{
+			{
+				name:          "FirstBatch",
+				in:            []float32{1, 2, 3},
+				inShape:       []int{1, 1, 3},
+				seqs:          []int{0, 0, 0},
+				pos:           []int32{0, 1, 2},
+				expected:      []float32{1, 2, 3},
+				expectedShape: []int{1, 1, 3},
+				expectedMask:  []float32{0, x, x, 0, 0, x, 0, 0, 0},
+			},
+		}
+
+		testCache(t, backend, cache, tests)
+
+		cache.CopyPrefix(0, 1, 2)
+
+		// the first block is now shared so both sequences continue in new blocks
+		tests = []testCase{
+			{
+				name:          "Copy",
+				in:            []float32{4, 5},
+				inShape:       []int{1, 1, 2},
+				seqs:          []int{1, 0},
+				pos:           []int32{2, 3},
+				expected:      []float32{1, 2, 3, 0, 4, 0, 0, 0, 5},
+				expectedShape: []int{1, 1, 9},
+				expectedMask: []float32{
+					0, 0, x, x, 0, x, x, x, x,
+					0, 0, 0, x, x, x, x, x, 0,
+				},
+			},
+		}
+
+		testCache(t, backend, cache, tests)
+	})
+}
+
+func TestBlockAllocationWrapperFull(t *testing.T) {
+	runPermutedVariants(t, func(t *testing.T, backend *testBackend) {
+		plain := NewCausalCache(nil)
+		shared := NewCausalCache(nil)
+		shared.SetBlockAllocation(8, 4)
+
+		cache := NewWrapperCache(plain, shared)
+		defer cache.Close()
+
+		cache.Init(backend, ml.DTypeF16, 4, 8, 4)
+
+		startForward := func(seq int) error {
+			context := backend.NewContext()
+			defer context.Close()
+
+			return cache.StartForward(context, input.Batch{
+				Positions: []int32{0, 1, 2, 3},
+				Sequences: []int{seq, seq, seq, seq},
+			}, false)
+		}
+
+		for seq := range 2 {
+			if err := startForward(seq); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := startForward(2); !errors.Is(err, ErrKvCacheFull) {
+			t.Fatalf("expected the pool to be full, got %v", err)
+		}
+
+		// the batch is undone in the cache that had space for it
+		if _, ok := plain.cellRanges[2]; ok {
+			t.Error("expected no cells for the sequence that didn't fit")
+		}
+
+		var used int
+		for _, cell := range plain.cells {
+			if len(cell.sequences) > 0 {
+				used++
+			}
+		}
+		if used != 8 {
+			t.Errorf("expected 8 cells in use, got %d", used)
+		}
+
+		if err := cache.Remove(0, 0, math.MaxInt32); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := startForward(2); err != nil {
+			t.Fatalf("expected the batch to fit after freeing space, got %v", err)
+		}
+	})
+}
+
+func TestLayerDTypes(t *testing.T) {
+	backend := &testBackend{}
+	cache := NewCausalCache(nil)
+	defer cache.Close()
+
+	cache.SetLayerDTypes(map[int]ml.DType{1: ml.DTypeQ80})
+	cache.Init(backend, ml.DTypeF16, 1, 16, 16)
+
+	context := backend.NewContext()
+	defer context.Close()
+
+	if err := cache.StartForward(context, input.Batch{Positions: []int32{0}, Sequences: []int{0}}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for layer := range 2 {
+		cache.SetLayer(layer)
+		tensor := context.FromFloats([]float32{1}, 1, 1, 1)
+		cache.Put(context, tensor, tensor)
+	}
+
+	if dtype := cache.keys[0].DType(); dtype != ml.DTypeF16 {
+		t.Errorf("layer 0: expected %v, got %v", ml.DTypeF16, dtype)
+	}
+
+	if dtype := cache.keys[1].DType(); dtype != ml.DTypeQ80 {
+		t.Errorf("layer 1: expected %v, got %v", ml.DTypeQ80, dtype)
+	}
+}
+
+func TestHostCache(t *testing.T) {
+	runPermutedVariants(t, func(t *testing.T, backend *testBackend) {
+		cache := NewCausalCache(nil)
+		defer cache.Close()
+
+		cache.SetHostCapacity(8)
+		cache.Init(backend, ml.DTypeF16, 1, 16, 4)
+
+		x := float32(math.Inf(-1))
+
+		tests := []testCase{
+			{
+				name:          "Host",
+				in:            []float32{1, 2, 3, 4},
+				inShape:       []int{1, 1, 4},
+				seqs:          []int{0, 0, 0, 0},
+				pos:           []int32{0, 1, 2, 3},
+				expected:      []float32{1, 2, 3, 4},
+				expectedShape: []int{1, 1, 4},
+				expectedMask: []float32{
+					0, x, x, x,
+					0, 0, x, x,
+					0, 0, 0, x,
+					0, 0, 0, 0,
+				},
+			},
+			{
+				name:          "MoreHost",
+				in:            []float32{5, 6, 7},
+				inShape:       []int{1, 1, 3},
+				seqs:          []int{0, 0, 0},
+				pos:           []int32{4, 5, 6},
+				expected:      []float32{1, 2, 3, 4, 5, 6, 7},
+				expectedShape: []int{1, 1, 7},
+				expectedMask: []float32{
+					0, 0, 0, 0, 0, x, x,
+					0, 0, 0, 0, 0, 0, x,
+					0, 0, 0, 0, 0, 0, 0,
+				},
+			},
+			{
+				name:          "Split",
+				in:            []float32{8, 9, 10, 11},
+				inShape:       []int{1, 1, 4},
+				seqs:          []int{0, 0, 0, 0},
+				pos:           []int32{7, 8, 9, 10},
+				expected:      []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+				expectedShape: []int{1, 1, 11},
+				expectedMask: []float32{
+					0, 0, 0, 0, 0, 0, 0, 0, x, x, x,
+					0, 0, 0, 0, 0, 0, 0, 0, 0, x, x,
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, x,
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				},
+			},
+		}
+
+		testCache(t, backend, cache, tests)
+
+		if cache.hostCells != 8 {
+			t.Errorf("expected 8 cells in host memory, got %v", cache.hostCells)
+		}
+	})
+}
+
 func testCache(t *testing.T, backend ml.Backend, cache Cache, tests []testCase) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -692,6 +939,8 @@ func (c *testContext) Arange(start, stop, step float32, dtype ml.DType) ml.Tenso
 func (c *testContext) Input() ml.Context    { return c }
 func (c *testContext) Layer(int) ml.Context { return c }
 
+func (c *testContext) Host() ml.Context { return c }
+
 func (c *testContext) Forward(...ml.Tensor) ml.Context { return c }
 
 func (c *testContext) Compute(...ml.Tensor) {}
@@ -967,6 +1216,30 @@ func (t *testTensor) SetRows(ctx ml.Context, src ml.Tensor, idxs ml.Tensor) ml.T
 	return dst
 }
 
+func (t *testTensor) Concat(ctx ml.Context, t2 ml.Tensor, dim int) ml.Tensor {
+	other := t2.(*testTensor)
+
+	shape := slices.Clone(t.shape)
+	shape[dim] += other.shape[dim]
+
+	// contiguous chunks of each tensor alternate for each index of the
+	// dimensions after dim
+	chunk, otherChunk := 1, 1
+	for i := 0; i <= dim; i++ {
+		chunk *= t.shape[i]
+		otherChunk *= other.shape[i]
+	}
+
+	out := (&testContext{}).Empty(t.dtype, shape...).(*testTensor)
+	out.data = out.data[:0]
+	for i := 0; i*chunk < len(t.data); i++ {
+		out.data = append(out.data, t.data[i*chunk:(i+1)*chunk]...)
+		out.data = append(out.data, other.data[i*otherChunk:(i+1)*otherChunk]...)
+	}
+
+	return out
+}
+
 func (t *testTensor) Copy(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
 	copy(t2.(*testTensor).data, t.data)
 	return nil
@@ -0,0 +1,498 @@
+package kvcache
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/input"
+)
+
+const (
+	// recurrentCheckpoints is the number of earlier states kept for each
+	// sequence in addition to its latest state
+	recurrentCheckpoints = 3
+
+	// recurrentCheckpointInterval is the minimum number of tokens between
+	// checkpoints of a sequence
+	recurrentCheckpointInterval = 256
+)
+
+// Recurrent cache stores the fixed size state of recurrent layers, such as
+// the convolution and scan states of Mamba, along with a causal cache for
+// the attention layers of hybrid models.
+//
+// A recurrent state only describes its sequence at the latest position so
+// the cache also keeps checkpoints of earlier states, which lets sequences
+// resume from (or share a prefix up to) one of those positions.
+//
+// The convolution state is of shape conv length, conv dim, sequences
+// The scan state is of shape state dim, slots and is selected with the ids
+// returned by SSMState
+type Recurrent struct {
+	kv *Causal
+
+	convLen, convDim, stateDim int
+
+	checkpoints        int
+	checkpointInterval int32
+
+	// ** current forward pass **
+
+	// the active layer for state access
+	curLayer int
+
+	// unique sequences in the batch, in order, and the number of tokens
+	// each of them has
+	curSeqs      []int
+	curSeqTokens int
+
+	// state slots of curSeqs
+	curSlots ml.Tensor
+
+	// ** cache metadata **
+
+	// slots hold the state of every recurrent layer for one position of a
+	// sequence. A slot can be shared by several sequences and checkpoints
+	// until it is written to.
+	refCount  []int
+	freeSlots []int
+
+	seqs map[int]*recurrentSeq
+
+	// state changed by the last call to StartForward, for undoing it. A nil
+	// sequence was added by the batch.
+	prevSeqs      map[int]*recurrentSeq
+	prevRefCount  []int
+	prevFreeSlots []int
+
+	// ** cache data storage **
+
+	backend   ml.Backend
+	ctxs      map[int]ml.Context
+	convState map[int]ml.Tensor
+	ssmState  map[int]ml.Tensor
+}
+
+type recurrentSeq struct {
+	// slot holds the state after pos tokens or is -1 if there is no state
+	slot int
+	pos  int32
+
+	// checkpoints in order of position
+	checkpoints []recurrentCheckpoint
+}
+
+type recurrentCheckpoint struct {
+	slot int
+	pos  int32
+}
+
+// NewRecurrentCache returns a cache for models with recurrent layers. convLen
+// and convDim are the shape of the convolution state and stateDim is the
+// number of elements in the scan state of a layer. Layers of hybrid models
+// that use attention store their keys and values in a causal cache with
+// the given shift function.
+func NewRecurrentCache(shift shiftFn, convLen, convDim, stateDim int) *Recurrent {
+	return &Recurrent{
+		kv:                 NewCausalCache(shift),
+		convLen:            convLen,
+		convDim:            convDim,
+		stateDim:           stateDim,
+		checkpoints:        recurrentCheckpoints,
+		checkpointInterval: recurrentCheckpointInterval,
+		seqs:               make(map[int]*recurrentSeq),
+		ctxs:               make(map[int]ml.Context),
+		convState:          make(map[int]ml.Tensor),
+		ssmState:           make(map[int]ml.Tensor),
+	}
+}
+
+func (c *Recurrent) Init(backend ml.Backend, dtype ml.DType, maxSequences, capacity, maxBatch int) {
+	c.backend = backend
+
+	// every sequence may hold its latest state and all of its checkpoints
+	// without sharing any of them
+	numSlots := maxSequences * (1 + c.checkpoints)
+	c.refCount = make([]int, numSlots)
+	c.freeSlots = make([]int, 0, numSlots)
+	for i := numSlots - 1; i >= 0; i-- {
+		c.freeSlots = append(c.freeSlots, i)
+	}
+
+	c.kv.Init(backend, dtype, maxSequences, capacity, maxBatch)
+}
+
+func (c *Recurrent) Close() {
+	for _, ctx := range c.ctxs {
+		ctx.Close()
+	}
+
+	c.kv.Close()
+}
+
+func (c *Recurrent) SetConfig(config ml.CacheConfig) {
+	c.kv.SetConfig(config)
+}
+
+func (c *Recurrent) SetLayer(layer int) {
+	c.curLayer = layer
+	c.kv.SetLayer(layer)
+}
+
+func (c *Recurrent) Get(ctx ml.Context) (ml.Tensor, ml.Tensor, ml.Tensor) {
+	return c.kv.Get(ctx)
+}
+
+func (c *Recurrent) Put(ctx ml.Context, key, value ml.Tensor) {
+	c.kv.Put(ctx, key, value)
+}
+
+func (c *Recurrent) StartForward(ctx ml.Context, batch input.Batch, reserve bool) error {
+	if err := c.kv.StartForward(ctx, batch, reserve); err != nil {
+		return err
+	}
+
+	if err := c.startForward(ctx, batch, reserve); err != nil {
+		// unwind so the batch can be retried, such as after freeing space
+		// in a full cache
+		c.undoForward()
+		return err
+	}
+
+	return nil
+}
+
+// undoForward restores the slots and sequences changed by the last call to
+// StartForward, for when a batch is abandoned before it is computed.
+func (c *Recurrent) undoForward() {
+	c.kv.undoForward()
+
+	if c.prevSeqs == nil {
+		return
+	}
+
+	for seq, s := range c.prevSeqs {
+		if s != nil {
+			c.seqs[seq] = s
+		} else {
+			delete(c.seqs, seq)
+		}
+	}
+
+	c.refCount, c.freeSlots = c.prevRefCount, c.prevFreeSlots
+	c.prevSeqs, c.prevRefCount, c.prevFreeSlots = nil, nil, nil
+}
+
+func (c *Recurrent) startForward(ctx ml.Context, batch input.Batch, reserve bool) error {
+	c.prevSeqs, c.prevRefCount, c.prevFreeSlots = nil, nil, nil
+
+	// recurrent layers process the batch as a grid of tokens by sequence so
+	// each sequence must have the same number of consecutive tokens
+	c.curSeqs = c.curSeqs[:0]
+	var firstPos []int32
+	for i, seq := range batch.Sequences {
+		if i == 0 || seq != batch.Sequences[i-1] {
+			if slices.Contains(c.curSeqs, seq) {
+				return ErrNotSupported
+			}
+
+			c.curSeqs = append(c.curSeqs, seq)
+			firstPos = append(firstPos, batch.Positions[i])
+		}
+	}
+
+	c.curSeqTokens = len(batch.Sequences) / len(c.curSeqs)
+	if c.curSeqTokens*len(c.curSeqs) != len(batch.Sequences) {
+		return ErrNotSupported
+	}
+
+	slots := make([]int32, len(c.curSeqs))
+	if reserve {
+		for i := range slots {
+			slots[i] = int32(i)
+		}
+
+		c.curSlots = ctx.Input().FromInts(slots, len(slots))
+		return nil
+	}
+
+	c.prevSeqs = make(map[int]*recurrentSeq)
+	c.prevRefCount = slices.Clone(c.refCount)
+	c.prevFreeSlots = slices.Clone(c.freeSlots)
+
+	var copySrc, copyDst, zero []int32
+	for i, seq := range c.curSeqs {
+		s, ok := c.seqs[seq]
+		if ok {
+			prev := *s
+			prev.checkpoints = slices.Clone(s.checkpoints)
+			c.prevSeqs[seq] = &prev
+		} else {
+			c.prevSeqs[seq] = nil
+			s = &recurrentSeq{slot: -1}
+			c.seqs[seq] = s
+		}
+
+		if firstPos[i] != s.pos {
+			return fmt.Errorf("recurrent state of sequence %d is at position %d, not %d", seq, s.pos, firstPos[i])
+		}
+
+		if s.slot >= 0 && c.checkpoints > 0 {
+			var last int32
+			if len(s.checkpoints) > 0 {
+				last = s.checkpoints[len(s.checkpoints)-1].pos
+			}
+
+			if s.pos-last >= c.checkpointInterval {
+				if len(s.checkpoints) == c.checkpoints {
+					c.release(s.checkpoints[0].slot)
+					s.checkpoints = s.checkpoints[1:]
+				}
+
+				// the checkpoint shares the slot and the state is copied
+				// below before it is updated
+				c.refCount[s.slot]++
+				s.checkpoints = append(s.checkpoints, recurrentCheckpoint{slot: s.slot, pos: s.pos})
+			}
+		}
+
+		switch {
+		case s.slot < 0:
+			slot, err := c.alloc()
+			if err != nil {
+				return err
+			}
+
+			s.slot = slot
+			zero = append(zero, int32(slot))
+		case c.refCount[s.slot] > 1:
+			slot, err := c.alloc()
+			if err != nil {
+				return err
+			}
+
+			copySrc = append(copySrc, int32(s.slot))
+			copyDst = append(copyDst, int32(slot))
+			c.release(s.slot)
+			s.slot = slot
+		}
+
+		s.pos += int32(c.curSeqTokens)
+		slots[i] = int32(s.slot)
+	}
+
+	c.curSlots = ctx.Input().FromInts(slots, len(slots))
+
+	// these are added to the graph before any layer reads its state
+	for layer := range c.ctxs {
+		for _, buf := range []ml.Tensor{c.convState[layer], c.ssmState[layer]} {
+			if len(zero) > 0 {
+				zeros := ctx.Input().Zeros(ml.DTypeF32, buf.Dim(0), len(zero))
+				ctx.Forward(buf.SetRows(ctx, zeros, ctx.Input().FromInts(zero, len(zero))))
+			}
+
+			if len(copySrc) > 0 {
+				src := buf.Rows(ctx, ctx.Input().FromInts(copySrc, len(copySrc)))
+				ctx.Forward(buf.SetRows(ctx, src, ctx.Input().FromInts(copyDst, len(copyDst))))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Recurrent) alloc() (int, error) {
+	if len(c.freeSlots) == 0 {
+		return 0, ErrKvCacheFull
+	}
+
+	slot := c.freeSlots[len(c.freeSlots)-1]
+	c.freeSlots = c.freeSlots[:len(c.freeSlots)-1]
+	c.refCount[slot] = 1
+	return slot, nil
+}
+
+func (c *Recurrent) release(slot int) {
+	c.refCount[slot]--
+	if c.refCount[slot] == 0 {
+		c.freeSlots = append(c.freeSlots, slot)
+	}
+}
+
+// clear releases all of the state held by seq
+func (c *Recurrent) clear(seq int) {
+	s, ok := c.seqs[seq]
+	if !ok {
+		return
+	}
+
+	if s.slot >= 0 {
+		c.release(s.slot)
+	}
+
+	for _, cp := range s.checkpoints {
+		c.release(cp.slot)
+	}
+
+	delete(c.seqs, seq)
+}
+
+func (c *Recurrent) CopyPrefix(srcSeq, dstSeq int, len int32) {
+	c.kv.CopyPrefix(srcSeq, dstSeq, len)
+	c.clear(dstSeq)
+
+	src, ok := c.seqs[srcSeq]
+	if !ok {
+		return
+	}
+
+	// states are shared with the source until one of the sequences
+	// continues from them
+	dst := &recurrentSeq{slot: -1}
+	if src.slot >= 0 && src.pos == len {
+		dst.slot, dst.pos = src.slot, src.pos
+		c.refCount[dst.slot]++
+	}
+
+	for _, cp := range src.checkpoints {
+		if cp.pos <= len {
+			dst.checkpoints = append(dst.checkpoints, cp)
+			c.refCount[cp.slot]++
+		}
+	}
+
+	c.seqs[dstSeq] = dst
+}
+
+func (c *Recurrent) CanResume(seq int, pos int32) bool {
+	if !c.kv.CanResume(seq, pos) {
+		return false
+	}
+
+	if pos == 0 {
+		return true
+	}
+
+	s, ok := c.seqs[seq]
+	if !ok {
+		return false
+	}
+
+	if s.slot >= 0 && s.pos == pos {
+		return true
+	}
+
+	return slices.ContainsFunc(s.checkpoints, func(cp recurrentCheckpoint) bool { return cp.pos == pos })
+}
+
+// Checkpoint returns the latest position no later than pos that seq can
+// resume from.
+func (c *Recurrent) Checkpoint(seq int, pos int32) int32 {
+	s, ok := c.seqs[seq]
+	if !ok {
+		return 0
+	}
+
+	if s.slot >= 0 && s.pos <= pos && c.kv.CanResume(seq, s.pos) {
+		return s.pos
+	}
+
+	for _, cp := range slices.Backward(s.checkpoints) {
+		if cp.pos <= pos && c.kv.CanResume(seq, cp.pos) {
+			return cp.pos
+		}
+	}
+
+	return 0
+}
+
+func (c *Recurrent) Remove(seq int, beginIndex, endIndex int32) error {
+	// the state of later tokens depends on the removed ones
+	if endIndex != math.MaxInt32 {
+		return ErrNotSupported
+	}
+
+	if beginIndex == 0 {
+		c.clear(seq)
+		return c.kv.Remove(seq, beginIndex, endIndex)
+	}
+
+	s, ok := c.seqs[seq]
+	if !ok {
+		return ErrNotSupported
+	}
+
+	if s.slot < 0 || s.pos != beginIndex {
+		i := slices.IndexFunc(s.checkpoints, func(cp recurrentCheckpoint) bool { return cp.pos == beginIndex })
+		if i < 0 {
+			return ErrNotSupported
+		}
+
+		for _, cp := range s.checkpoints[i+1:] {
+			c.release(cp.slot)
+		}
+		s.checkpoints = s.checkpoints[:i+1]
+
+		if s.slot >= 0 {
+			c.release(s.slot)
+		}
+
+		s.slot, s.pos = s.checkpoints[i].slot, beginIndex
+		c.refCount[s.slot]++
+	}
+
+	return c.kv.Remove(seq, beginIndex, endIndex)
+}
+
+// SeqTokens returns the number of tokens of each sequence in the batch.
+func (c *Recurrent) SeqTokens() int {
+	return c.curSeqTokens
+}
+
+// NumSeqs returns the number of sequences in the batch.
+func (c *Recurrent) NumSeqs() int {
+	return len(c.curSeqs)
+}
+
+func (c *Recurrent) buffers(layer int) (ml.Tensor, ml.Tensor) {
+	if _, ok := c.ctxs[layer]; !ok {
+		c.ctxs[layer] = c.backend.NewContextSize(2).Layer(layer)
+		c.convState[layer] = c.ctxs[layer].Zeros(ml.DTypeF32, c.convLen*c.convDim, len(c.refCount))
+		c.ssmState[layer] = c.ctxs[layer].Zeros(ml.DTypeF32, c.stateDim, len(c.refCount))
+	}
+
+	return c.convState[layer], c.ssmState[layer]
+}
+
+// ConvState returns the convolution state of the current layer for the
+// sequences in the batch with shape [convLen, convDim, sequences].
+func (c *Recurrent) ConvState(ctx ml.Context) ml.Tensor {
+	conv, _ := c.buffers(c.curLayer)
+	return conv.Rows(ctx, c.curSlots).Reshape(ctx, c.convLen, c.convDim, c.NumSeqs())
+}
+
+// UpdateConvState stores the convolution state of the current layer for the
+// sequences in the batch. state must have shape [convLen, convDim, sequences].
+func (c *Recurrent) UpdateConvState(ctx ml.Context, state ml.Tensor) {
+	conv, _ := c.buffers(c.curLayer)
+	state = state.Contiguous(ctx).Reshape(ctx, c.convLen*c.convDim, c.NumSeqs())
+	ctx.Forward(conv.SetRows(ctx, state, c.curSlots))
+}
+
+// SSMState returns the scan state of the current layer for every slot,
+// reshaped to the given shape followed by the number of slots, and the
+// slots of the sequences in the batch.
+func (c *Recurrent) SSMState(ctx ml.Context, shape ...int) (ml.Tensor, ml.Tensor) {
+	_, ssm := c.buffers(c.curLayer)
+	return ssm.Reshape(ctx, append(shape, ssm.Dim(1))...), c.curSlots
+}
+
+// UpdateSSMState stores the scan state of the current layer for the
+// sequences in the batch. state must have stateDim elements per sequence.
+func (c *Recurrent) UpdateSSMState(ctx ml.Context, state ml.Tensor) {
+	_, ssm := c.buffers(c.curLayer)
+	state = state.Reshape(ctx, c.stateDim, c.NumSeqs())
+	ctx.Forward(ssm.SetRows(ctx, state, c.curSlots))
+}
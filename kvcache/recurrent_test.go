@@ -0,0 +1,251 @@
+package kvcache
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/input"
+)
+
+// recurrentStep runs a batch through the cache, returning the convolution and
+// scan state of each sequence before storing the next states
+func recurrentStep(t *testing.T, backend ml.Backend, cache *Recurrent, seqs []int, pos []int32, next []float32) ([]float32, []float32) {
+	t.Helper()
+
+	ctx := backend.NewContext()
+	defer ctx.Close()
+
+	if err := cache.StartForward(ctx, input.Batch{Positions: pos, Sequences: seqs}, false); err != nil {
+		t.Fatalf("StartForward failed: %v", err)
+	}
+
+	cache.SetLayer(0)
+
+	conv := slices.Clone(cache.ConvState(ctx).Floats())
+
+	ssm, ids := cache.SSMState(ctx, 2)
+	state := slices.Clone(ssm.Reshape(ctx, 2, ssm.Dim(1)).Rows(ctx, ids).Floats())
+
+	cache.UpdateConvState(ctx, ctx.FromFloats(next, 1, 2, cache.NumSeqs()))
+	cache.UpdateSSMState(ctx, ctx.FromFloats(next, 2, cache.NumSeqs()))
+
+	return conv, state
+}
+
+func newTestRecurrentCache(backend ml.Backend) *Recurrent {
+	cache := NewRecurrentCache(nil, 1, 2, 2)
+	cache.checkpointInterval = 2
+	cache.Init(backend, ml.DTypeF16, 2, 16, 16)
+	return cache
+}
+
+func TestRecurrentState(t *testing.T) {
+	backend := &testBackend{}
+	cache := newTestRecurrentCache(backend)
+	defer cache.Close()
+
+	conv, ssm := recurrentStep(t, backend, cache, []int{0, 0, 1, 1}, []int32{0, 1, 0, 1}, []float32{1, 1, 2, 2})
+	if !slices.Equal(conv, []float32{0, 0, 0, 0}) || !slices.Equal(ssm, []float32{0, 0, 0, 0}) {
+		t.Errorf("new sequences should have empty state, got %v and %v", conv, ssm)
+	}
+
+	conv, ssm = recurrentStep(t, backend, cache, []int{1, 0}, []int32{2, 2}, []float32{3, 3, 4, 4})
+	if !slices.Equal(conv, []float32{2, 2, 1, 1}) || !slices.Equal(ssm, []float32{2, 2, 1, 1}) {
+		t.Errorf("unexpected state %v and %v", conv, ssm)
+	}
+
+	// removing a sequence resets its state
+	if err := cache.Remove(1, 0, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	conv, _ = recurrentStep(t, backend, cache, []int{1}, []int32{0}, []float32{5, 5})
+	if !slices.Equal(conv, []float32{0, 0}) {
+		t.Errorf("removed sequence should have empty state, got %v", conv)
+	}
+
+	ctx := backend.NewContext()
+	defer ctx.Close()
+
+	for _, batch := range []input.Batch{
+		{Sequences: []int{0, 1, 0, 1}, Positions: []int32{3, 1, 4, 2}},
+		{Sequences: []int{0, 0, 1}, Positions: []int32{3, 4, 1}},
+	} {
+		if err := cache.StartForward(ctx, batch, false); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("expected ErrNotSupported for sequences %v, got %v", batch.Sequences, err)
+		}
+	}
+
+	if err := cache.StartForward(ctx, input.Batch{Sequences: []int{0}, Positions: []int32{7}}, false); err == nil {
+		t.Error("expected an error when skipping positions")
+	}
+}
+
+func TestRecurrentCheckpoint(t *testing.T) {
+	backend := &testBackend{}
+	cache := newTestRecurrentCache(backend)
+	defer cache.Close()
+
+	recurrentStep(t, backend, cache, []int{0, 0}, []int32{0, 1}, []float32{1, 1})
+	recurrentStep(t, backend, cache, []int{0, 0}, []int32{2, 3}, []float32{2, 2})
+	conv, _ := recurrentStep(t, backend, cache, []int{0}, []int32{4}, []float32{3, 3})
+	if !slices.Equal(conv, []float32{2, 2}) {
+		t.Errorf("expected the latest state, got %v", conv)
+	}
+
+	for pos, want := range []bool{true, false, true, false, true, true, false} {
+		if got := cache.CanResume(0, int32(pos)); got != want {
+			t.Errorf("CanResume(0, %d) = %v, want %v", pos, got, want)
+		}
+	}
+
+	if pos := cache.Checkpoint(0, 3); pos != 2 {
+		t.Errorf("Checkpoint(0, 3) = %d, want 2", pos)
+	}
+
+	if pos := cache.Checkpoint(0, 6); pos != 5 {
+		t.Errorf("Checkpoint(0, 6) = %d, want 5", pos)
+	}
+
+	if err := cache.Remove(0, 3, math.MaxInt32); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported removing from a position without a checkpoint, got %v", err)
+	}
+
+	if err := cache.Remove(0, 2, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.CanResume(0, 4) {
+		t.Error("checkpoints after the removed position should be dropped")
+	}
+
+	conv, ssm := recurrentStep(t, backend, cache, []int{0}, []int32{2}, []float32{4, 4})
+	if !slices.Equal(conv, []float32{1, 1}) || !slices.Equal(ssm, []float32{1, 1}) {
+		t.Errorf("expected the state of the checkpoint, got %v and %v", conv, ssm)
+	}
+
+	// the checkpoint is not changed by continuing from it
+	if err := cache.Remove(0, 2, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	conv, _ = recurrentStep(t, backend, cache, []int{0}, []int32{2}, []float32{4, 4})
+	if !slices.Equal(conv, []float32{1, 1}) {
+		t.Errorf("expected the state of the checkpoint, got %v", conv)
+	}
+}
+
+func TestRecurrentCheckpointLimit(t *testing.T) {
+	backend := &testBackend{}
+	cache := newTestRecurrentCache(backend)
+	defer cache.Close()
+
+	for pos := int32(0); pos < 10; pos += 2 {
+		recurrentStep(t, backend, cache, []int{0, 0}, []int32{pos, pos + 1}, []float32{float32(pos), float32(pos)})
+	}
+
+	// checkpoints are taken at 2, 4, 6 and 8 but only the last three are kept
+	for pos, want := range map[int32]bool{2: false, 4: true, 6: true, 8: true, 10: true} {
+		if got := cache.CanResume(0, pos); got != want {
+			t.Errorf("CanResume(0, %d) = %v, want %v", pos, got, want)
+		}
+	}
+
+	if len(cache.freeSlots) != len(cache.refCount)-4 {
+		t.Errorf("expected 4 slots in use, got %d", len(cache.refCount)-len(cache.freeSlots))
+	}
+}
+
+func TestRecurrentCopyPrefix(t *testing.T) {
+	backend := &testBackend{}
+	cache := newTestRecurrentCache(backend)
+	defer cache.Close()
+
+	recurrentStep(t, backend, cache, []int{0, 0}, []int32{0, 1}, []float32{1, 1})
+	recurrentStep(t, backend, cache, []int{0, 0}, []int32{2, 3}, []float32{2, 2})
+
+	cache.CopyPrefix(0, 1, 4)
+	if !cache.CanResume(1, 4) || !cache.CanResume(1, 2) {
+		t.Error("copied sequence should resume from the state and checkpoints of the source")
+	}
+
+	conv, _ := recurrentStep(t, backend, cache, []int{1}, []int32{4}, []float32{5, 5})
+	if !slices.Equal(conv, []float32{2, 2}) {
+		t.Errorf("expected the state of the source, got %v", conv)
+	}
+
+	conv, _ = recurrentStep(t, backend, cache, []int{0}, []int32{4}, []float32{6, 6})
+	if !slices.Equal(conv, []float32{2, 2}) {
+		t.Errorf("source state should not change when the copy is updated, got %v", conv)
+	}
+
+	// a prefix that is not a checkpoint can only resume from an earlier one
+	cache.CopyPrefix(0, 1, 3)
+	if cache.CanResume(1, 3) {
+		t.Error("CanResume(1, 3) = true, want false")
+	}
+
+	if pos := cache.Checkpoint(1, 3); pos != 2 {
+		t.Errorf("Checkpoint(1, 3) = %d, want 2", pos)
+	}
+
+	if err := cache.Remove(1, 2, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	conv, _ = recurrentStep(t, backend, cache, []int{1}, []int32{2}, []float32{7, 7})
+	if !slices.Equal(conv, []float32{1, 1}) {
+		t.Errorf("expected the state of the checkpoint, got %v", conv)
+	}
+}
+
+func TestRecurrentUndoForward(t *testing.T) {
+	backend := &testBackend{}
+	cache := newTestRecurrentCache(backend)
+	defer cache.Close()
+
+	recurrentStep(t, backend, cache, []int{0, 0}, []int32{0, 1}, []float32{1, 1})
+	inUse := len(cache.refCount) - len(cache.freeSlots)
+
+	// sequence 0 takes a checkpoint and a new slot before sequence 1 fails
+	ctx := backend.NewContext()
+	err := cache.StartForward(ctx, input.Batch{Positions: []int32{2, 5}, Sequences: []int{0, 1}}, false)
+	ctx.Close()
+	if err == nil {
+		t.Fatal("expected an error for a sequence that doesn't start at its state")
+	}
+
+	if got := len(cache.refCount) - len(cache.freeSlots); got != inUse {
+		t.Errorf("expected %d slots in use, got %d", inUse, got)
+	}
+
+	if _, ok := cache.seqs[1]; ok {
+		t.Error("sequence 1 should not have been added")
+	}
+
+	conv, _ := recurrentStep(t, backend, cache, []int{0}, []int32{2}, []float32{2, 2})
+	if !slices.Equal(conv, []float32{1, 1}) {
+		t.Errorf("expected the state before the failed batch, got %v", conv)
+	}
+}
+
+func (t *testTensor) Contiguous(ctx ml.Context, shape ...int) ml.Tensor {
+	if len(shape) == 0 {
+		shape = t.shape
+	}
+
+	return t.Reshape(ctx, shape...)
+}
+
+func (t *testTensor) Rows(ctx ml.Context, idxs ml.Tensor) ml.Tensor {
+	rows := idxs.(*testTensor).data
+	out := (&testContext{}).Empty(t.dtype, t.shape[0], len(rows)).(*testTensor)
+	for i, row := range rows {
+		copy(out.data[i*t.shape[0]:(i+1)*t.shape[0]], t.data[int(row)*t.shape[0]:])
+	}
+
+	return out
+}
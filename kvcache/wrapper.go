@@ -29,6 +29,30 @@ func (c *WrapperCache) Init(backend ml.Backend, dtype ml.DType, maxSequences, ca
 	}
 }
 
+func (c *WrapperCache) SetBlockAllocation(poolSize, blockSize int) {
+	for _, cache := range c.caches {
+		if pc, ok := cache.(BlockCache); ok {
+			pc.SetBlockAllocation(poolSize, blockSize)
+		}
+	}
+}
+
+func (c *WrapperCache) SetLayerDTypes(dtypes map[int]ml.DType) {
+	for _, cache := range c.caches {
+		if lc, ok := cache.(LayerDTypeCache); ok {
+			lc.SetLayerDTypes(dtypes)
+		}
+	}
+}
+
+func (c *WrapperCache) SetHostCapacity(cells int) {
+	for _, cache := range c.caches {
+		if hc, ok := cache.(HostCache); ok {
+			hc.SetHostCapacity(cells)
+		}
+	}
+}
+
 func (c *WrapperCache) SetConfig(config ml.CacheConfig) {
 	for _, cache := range c.caches {
 		cache.SetConfig(config)
@@ -41,12 +65,25 @@ func (c *WrapperCache) Close() {
 	}
 }
 
+// forwardUndoer is implemented by caches that can free exactly what the last
+// call to StartForward allocated.
+type forwardUndoer interface {
+	undoForward()
+}
+
 func (c *WrapperCache) StartForward(ctx ml.Context, batch input.Batch, reserve bool) error {
 	for i, cache := range c.caches {
 		err := cache.StartForward(ctx, batch, reserve)
 		if err != nil {
-			// unwind on error - Remove with endIndex set to math.MaxInt32 does not fail
+			// unwind on error so the batch can be retried, such as after
+			// freeing space in a full cache - Remove with endIndex set to
+			// math.MaxInt32 does not fail
 			for j := i - 1; j >= 0; j-- {
+				if u, ok := c.caches[j].(forwardUndoer); ok {
+					u.undoForward()
+					continue
+				}
+
 				for k := range batch.Positions {
 					_ = c.caches[j].Remove(batch.Sequences[k], batch.Positions[k], math.MaxInt32)
 				}
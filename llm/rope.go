@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+)
+
+var ropeScalingTypes = []string{"none", "linear", "yarn", "longrope"}
+
+// ropeOptions validates the RoPE overrides in opts against the model and
+// returns the options to load it with. If linear or YaRN scaling is selected
+// without an explicit frequency scale, the scaling factor is derived from the
+// requested context length.
+func ropeOptions(kv ggml.KV, opts api.Options, m model.TextProcessor) (ml.RopeOptions, error) {
+	ropeOpts := ml.RopeOptions{
+		ScalingType:           opts.RopeScalingType,
+		FreqBase:              opts.RopeFrequencyBase,
+		OriginalContextLength: opts.YarnOrigCtx,
+		ExtrapolationFactor:   opts.YarnExtFactor,
+		AttentionFactor:       opts.YarnAttnFactor,
+		BetaFast:              opts.YarnBetaFast,
+		BetaSlow:              opts.YarnBetaSlow,
+	}
+
+	if opts.RopeFrequencyScale < 0 {
+		return ml.RopeOptions{}, fmt.Errorf("invalid rope_freq_scale %v", opts.RopeFrequencyScale)
+	} else if opts.RopeFrequencyScale > 0 {
+		ropeOpts.ScalingFactor = 1 / opts.RopeFrequencyScale
+		if ropeOpts.ScalingType == "" {
+			ropeOpts.ScalingType = "linear"
+		}
+	}
+
+	yarn := opts.YarnOrigCtx != 0 || opts.YarnExtFactor != 0 || opts.YarnAttnFactor != 0 || opts.YarnBetaFast != 0 || opts.YarnBetaSlow != 0
+	if yarn && ropeOpts.ScalingType == "" && kv.String("rope.scaling.type") == "yarn" {
+		ropeOpts.ScalingType = "yarn"
+	}
+
+	if ropeOpts.ScalingType == "" {
+		if yarn {
+			return ml.RopeOptions{}, errors.New("yarn_* options require rope_scaling_type yarn")
+		}
+		return ropeOpts, nil
+	}
+
+	if !slices.Contains(ropeScalingTypes, ropeOpts.ScalingType) {
+		return ml.RopeOptions{}, fmt.Errorf("unknown rope_scaling_type %q, expected one of %v", ropeOpts.ScalingType, ropeScalingTypes)
+	}
+
+	if yarn && ropeOpts.ScalingType != "yarn" {
+		return ml.RopeOptions{}, fmt.Errorf("yarn_* options require rope_scaling_type yarn, got %q", ropeOpts.ScalingType)
+	}
+
+	if s, ok := m.(model.RopeScaler); !ok || !s.SupportsRopeScaling(ropeOpts.ScalingType) {
+		return ml.RopeOptions{}, fmt.Errorf("rope_scaling_type %q is not supported by %s models", ropeOpts.ScalingType, kv.Architecture())
+	}
+
+	trainCtx := int(kv.ContextLength())
+	switch ropeOpts.ScalingType {
+	case "none":
+		ropeOpts.ScalingFactor = 1
+	case "linear", "yarn":
+		if ropeOpts.ScalingFactor == 0 && trainCtx > 0 && opts.NumCtx > trainCtx {
+			ropeOpts.ScalingFactor = float32(opts.NumCtx) / float32(trainCtx)
+		}
+
+		if ropeOpts.ScalingType == "yarn" && ropeOpts.OriginalContextLength == 0 &&
+			kv.Uint("rope.scaling.original_context_length") == 0 {
+			ropeOpts.OriginalContextLength = trainCtx
+		}
+	}
+
+	return ropeOpts, nil
+}
@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+)
+
+type ropeScalerModel struct {
+	model.TextProcessor
+	types []string
+}
+
+func (m ropeScalerModel) SupportsRopeScaling(scalingType string) bool {
+	return slices.Contains(m.types, scalingType)
+}
+
+func TestRopeOptions(t *testing.T) {
+	kv := ggml.KV{
+		"general.architecture": "test",
+		"test.context_length":  uint32(4096),
+	}
+
+	yarnKV := ggml.KV{
+		"general.architecture":                      "test",
+		"test.context_length":                       uint32(4096),
+		"test.rope.scaling.type":                    "yarn",
+		"test.rope.scaling.original_context_length": uint32(2048),
+	}
+
+	m := ropeScalerModel{types: []string{"none", "linear", "yarn"}}
+
+	cases := []struct {
+		name    string
+		kv      ggml.KV
+		opts    api.Runner
+		numCtx  int
+		model   model.TextProcessor
+		want    ml.RopeOptions
+		wantErr bool
+	}{
+		{
+			name:   "Unset",
+			kv:     kv,
+			numCtx: 8192,
+			model:  m,
+		},
+		{
+			name:   "FreqBase",
+			kv:     kv,
+			opts:   api.Runner{RopeFrequencyBase: 500000},
+			numCtx: 4096,
+			model:  m,
+			want:   ml.RopeOptions{FreqBase: 500000},
+		},
+		{
+			name:   "FreqScaleImpliesLinear",
+			kv:     kv,
+			opts:   api.Runner{RopeFrequencyScale: 0.25},
+			numCtx: 4096,
+			model:  m,
+			want:   ml.RopeOptions{ScalingType: "linear", ScalingFactor: 4},
+		},
+		{
+			name:   "LinearFromContext",
+			kv:     kv,
+			opts:   api.Runner{RopeScalingType: "linear"},
+			numCtx: 8192,
+			model:  m,
+			want:   ml.RopeOptions{ScalingType: "linear", ScalingFactor: 2},
+		},
+		{
+			name:   "YarnFromContext",
+			kv:     kv,
+			opts:   api.Runner{RopeScalingType: "yarn"},
+			numCtx: 16384,
+			model:  m,
+			want:   ml.RopeOptions{ScalingType: "yarn", ScalingFactor: 4, OriginalContextLength: 4096},
+		},
+		{
+			name:   "YarnParametersFromMetadata",
+			kv:     yarnKV,
+			opts:   api.Runner{YarnBetaFast: 16},
+			numCtx: 4096,
+			model:  m,
+			want:   ml.RopeOptions{ScalingType: "yarn", BetaFast: 16},
+		},
+		{
+			name:    "YarnParametersWithoutYarn",
+			kv:      kv,
+			opts:    api.Runner{YarnBetaFast: 16},
+			numCtx:  4096,
+			model:   m,
+			wantErr: true,
+		},
+		{
+			name:    "YarnParametersWithLinear",
+			kv:      kv,
+			opts:    api.Runner{RopeScalingType: "linear", YarnAttnFactor: 1.2},
+			numCtx:  4096,
+			model:   m,
+			wantErr: true,
+		},
+		{
+			name:    "UnknownType",
+			kv:      kv,
+			opts:    api.Runner{RopeScalingType: "ntk"},
+			numCtx:  4096,
+			model:   m,
+			wantErr: true,
+		},
+		{
+			name:    "UnsupportedByModel",
+			kv:      kv,
+			opts:    api.Runner{RopeScalingType: "longrope"},
+			numCtx:  4096,
+			model:   m,
+			wantErr: true,
+		},
+		{
+			name:    "NotRopeScaler",
+			kv:      kv,
+			opts:    api.Runner{RopeScalingType: "linear"},
+			numCtx:  4096,
+			wantErr: true,
+		},
+		{
+			name:    "NegativeFreqScale",
+			kv:      kv,
+			opts:    api.Runner{RopeFrequencyScale: -1},
+			numCtx:  4096,
+			model:   m,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := api.Options{Runner: tt.opts}
+			opts.NumCtx = tt.numCtx
+
+			got, err := ropeOptions(tt.kv, opts, tt.model)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected rope options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/internal/tracing"
 	"github.com/ollama/ollama/llama"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/ml"
@@ -69,7 +70,7 @@ type LlamaServer interface {
 	Ping(ctx context.Context) error
 	WaitUntilRunning(ctx context.Context) error
 	Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error
-	Embedding(ctx context.Context, input string) ([]float32, int, error)
+	Embedding(ctx context.Context, req EmbeddingRequest) ([]float32, int, error)
 	Tokenize(ctx context.Context, content string) ([]int, error)
 	Detokenize(ctx context.Context, tokens []int) (string, error)
 	Close() error
@@ -118,6 +119,17 @@ type ollamaServer struct {
 	textProcessor model.TextProcessor // textProcessor handles text encoding/decoding
 }
 
+// LoraSwapper is implemented by servers that apply the LoRA adapters given in
+// each CompletionRequest, so models that only differ by their adapters can
+// share a server.
+type LoraSwapper interface {
+	SwapsLoras() bool
+}
+
+func (s *ollamaServer) SwapsLoras() bool {
+	return true
+}
+
 // LoadModel will load a model from disk. The model must be in the GGML format.
 //
 // It collects array values for arrays with a size less than or equal to
@@ -139,7 +151,7 @@ func LoadModel(model string, maxArraySize int) (*ggml.GGML, error) {
 }
 
 // NewLlamaServer will run a server for the given GPUs
-func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath string, f *ggml.GGML, adapters, projectors []string, opts api.Options, numParallel int) (LlamaServer, error) {
+func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath string, f *ggml.GGML, adapters, controls, projectors []string, opts api.Options, numParallel int) (LlamaServer, error) {
 	var llamaModel *llama.Model
 	var textProcessor model.TextProcessor
 	var err error
@@ -161,8 +173,22 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 		}
 	}
 
-	// Verify the requested context size is <= the model training size
+	var rope ml.RopeOptions
+	if textProcessor != nil {
+		rope, err = ropeOptions(f.KV(), opts, textProcessor)
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.RopeScalingType != "" || opts.RopeFrequencyBase != 0 || opts.RopeFrequencyScale != 0 || opts.YarnOrigCtx != 0 {
+		slog.Warn("rope scaling options are only supported by the Ollama engine, ignoring")
+	}
+
+	// Verify the requested context size is <= the model training size,
+	// extended by any RoPE scaling that was requested
 	trainCtx := f.KV().ContextLength()
+	if rope.ScalingType != "none" && rope.ScalingFactor > 1 {
+		trainCtx = uint64(float32(trainCtx) * rope.ScalingFactor)
+	}
 	if opts.NumCtx > int(trainCtx) && trainCtx > 0 {
 		slog.Warn("requested context size too large for model", "num_ctx", opts.NumCtx, "n_ctx_train", trainCtx)
 		opts.NumCtx = int(trainCtx)
@@ -170,7 +196,20 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 
 	opts.NumBatch = min(opts.NumBatch, opts.NumCtx)
 
-	loadRequest := LoadRequest{LoraPath: adapters, KvSize: opts.NumCtx * numParallel, BatchSize: opts.NumBatch, Parallel: numParallel, MultiUserCache: envconfig.MultiUserCache()}
+	// The Ollama engine loads adapters with each request instead, up to a
+	// limit that it reserves room for when the model is loaded with them
+	maxAdapters := 0
+	if textProcessor != nil {
+		if len(adapters) > 0 || len(controls) > 0 {
+			maxAdapters = int(envconfig.MaxAdapters())
+		}
+		adapters = nil
+	}
+
+	loadRequest := LoadRequest{LoraPath: adapters, KvSize: opts.NumCtx * numParallel, BatchSize: opts.NumBatch, Parallel: numParallel, MultiUserCache: envconfig.MultiUserCache(), Rope: rope, MaxAdapters: maxAdapters}
+	if textProcessor != nil {
+		loadRequest.PrefillChunk = opts.NumPrefillChunk
+	}
 
 	defaultThreads := systemInfo.ThreadCount
 	if opts.NumThread > 0 {
@@ -209,8 +248,19 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 	}
 
 	kvct := strings.ToLower(envconfig.KvCacheType())
+	kvctDefault, kvctLayers, err := ggml.ParseKVCacheType(kvct)
+	if err != nil {
+		slog.Warn("invalid OLLAMA_KV_CACHE_TYPE", "type", kvct, "error", err)
+		kvct, kvctDefault, kvctLayers = "", "", nil
+	}
 
 	if textProcessor == nil {
+		// per layer cache types are only supported by the Ollama engine
+		if len(kvctLayers) > 0 {
+			slog.Warn("per layer OLLAMA_KV_CACHE_TYPE is not supported by this model, using the default type", "type", kvctDefault)
+		}
+		kvct = kvctDefault
+
 		flashAttention := ml.FlashAttentionAuto
 		if faUserSet {
 			if fa {
@@ -247,7 +297,12 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 
 			// Flash Attention also supports kv cache quantization
 			// Enable if the requested and kv cache type is supported by the model
-			if f.SupportsKVCacheType(kvct) {
+			supported := f.SupportsKVCacheType(kvctDefault)
+			for _, t := range kvctLayers {
+				supported = supported && f.SupportsKVCacheType(t)
+			}
+
+			if supported {
 				loadRequest.KvCacheType = kvct
 			} else {
 				slog.Warn("kv cache type not supported by model", "type", kvct)
@@ -255,6 +310,16 @@ func NewLlamaServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, modelPath st
 		} else if kvct != "" && kvct != "f16" {
 			slog.Warn("quantized kv cache requested but flash attention disabled", "type", kvct)
 		}
+
+		// parallel sequences share a pool of cache blocks rather than
+		// reserving the full context each
+		if kvSize := int(envconfig.KvCacheSize()); kvSize > 0 {
+			loadRequest.KvPoolSize = max(kvSize, opts.NumCtx)
+		}
+
+		// the oldest entries of long contexts can be kept in system memory
+		// rather than moving whole layers off of the GPU
+		loadRequest.KvHostSize = int(envconfig.KvCacheHost())
 	}
 
 	gpuLibs := ml.LibraryPaths(gpus)
@@ -475,9 +540,20 @@ type LoadRequest struct {
 	FlashAttention ml.FlashAttentionType
 	KvSize         int
 	KvCacheType    string
+	KvPoolSize     int
+	KvHostSize     int
 	NumThreads     int
 	GPULayers      ml.GPULayersList
 	MultiUserCache bool
+	Rope           ml.RopeOptions
+
+	// MaxAdapters is the number of LoRA adapters and control vectors that
+	// can be loaded with requests. 0 disables them.
+	MaxAdapters int
+
+	// PrefillChunk limits the number of prompt tokens in a batch that also
+	// generates tokens for other sequences. 0 is no limit.
+	PrefillChunk int
 
 	// Legacy fields - not used with the Ollama engine
 	ProjectorPath string
@@ -998,7 +1074,7 @@ func (s *llmServer) buildLayout(systemGPUs []ml.DeviceInfo, memory *ml.BackendMe
 // verifyLayout ensures that we don't exceed limits, such as requirements about partial offloading or system memory
 func (s *llmServer) verifyLayout(systemInfo ml.SystemInfo, systemGPUs []ml.DeviceInfo, memory *ml.BackendMemory, requireFull bool, gpuLayers ml.GPULayersList, layers []uint64) error {
 	// These sizes will only increase as we go through additional iterations and get additional information.
-	cpuSize := memory.InputWeights + memory.CPU.Graph
+	cpuSize := memory.InputWeights + memory.HostCache + memory.CPU.Graph
 	var vramSize uint64
 	for _, gl := range gpuLayers {
 		for _, gpu := range memory.GPUs {
@@ -1465,11 +1541,48 @@ type CompletionRequest struct {
 	// TopLogprobs specifies the number of most likely alternative tokens to return (0-20)
 	TopLogprobs int
 
+	// PromptLogprobs returns the log probability of each prompt token given
+	// the tokens before it instead of generating a response
+	PromptLogprobs bool
+
+	// Tokens is the prompt as token IDs, used instead of Prompt. Special
+	// tokens such as BOS are added in the same way as for Prompt.
+	Tokens []int
+
+	// Loras are the LoRA adapters to apply to this request. Servers that
+	// implement LoraSwapper load them as needed, others use the adapters
+	// they were started with.
+	Loras []Lora
+
+	// ControlVectors steer the output of each layer of the model. They
+	// are only supported by the Ollama engine.
+	ControlVectors []ControlVector
+
 	// Image generation fields
 	Width  int32 `json:"width,omitempty"`
 	Height int32 `json:"height,omitempty"`
 	Steps  int32 `json:"steps,omitempty"`
 	Seed   int64 `json:"seed,omitempty"`
+
+	// Image editing fields: Images[0] is used as the init image
+	Strength float32 `json:"strength,omitempty"`
+	Mask     []byte  `json:"mask,omitempty"`
+
+	// Preview requests a thumbnail of the in-progress image after each step
+	Preview bool `json:"preview,omitempty"`
+}
+
+// Lora is a LoRA adapter and the strength to apply it with
+type Lora struct {
+	Path  string
+	Scale float32
+}
+
+// ControlVector is a control vector to apply to a request and the strength
+// to apply it with
+type ControlVector struct {
+	Path     string
+	Strength float32
 }
 
 // DoneReason represents the reason why a completion response is done
@@ -1516,6 +1629,16 @@ type CompletionResponse struct {
 	EvalCount          int           `json:"eval_count"`
 	EvalDuration       time.Duration `json:"eval_duration"`
 
+	// PromptCachedCount is the part of PromptEvalCount reused from the
+	// runner's prompt cache instead of being evaluated
+	PromptCachedCount int `json:"prompt_cached_count,omitempty"`
+
+	// TimeToFirstToken is the time from the request reaching the runner to
+	// the first generated token, including any time spent waiting for other
+	// sequences. InterTokenLatency is the mean time between later tokens.
+	TimeToFirstToken  time.Duration `json:"time_to_first_token,omitempty"`
+	InterTokenLatency time.Duration `json:"inter_token_latency,omitempty"`
+
 	// Logprobs contains log probability information if requested
 	Logprobs []Logprob `json:"logprobs,omitempty"`
 
@@ -1527,9 +1650,12 @@ type CompletionResponse struct {
 
 	// TotalSteps is the total number of steps for image generation
 	TotalSteps int `json:"total_steps,omitempty"`
+
+	// Preview contains a base64-encoded thumbnail of the in-progress image
+	Preview string `json:"preview,omitempty"`
 }
 
-func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error {
+func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) (err error) {
 	slog.Debug("completion request", "images", len(req.Images), "prompt", len(req.Prompt), "format", string(req.Format))
 	logutil.Trace("completion request", "prompt", req.Prompt)
 
@@ -1592,12 +1718,19 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		return fmt.Errorf("failed to marshal data: %v", err)
 	}
 
+	ctx, span := tracing.Start(ctx, "runner completion", tracing.WithKind(tracing.KindClient))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	endpoint := fmt.Sprintf("http://127.0.0.1:%d/completion", s.port)
 	serverReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, buffer)
 	if err != nil {
 		return fmt.Errorf("error creating POST request: %v", err)
 	}
 	serverReq.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, serverReq.Header)
 
 	res, err := http.DefaultClient.Do(serverReq)
 	if err != nil && errors.Is(err, context.Canceled) {
@@ -1646,21 +1779,23 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 			if err := json.Unmarshal(evt, &c); err != nil {
 				return fmt.Errorf("error unmarshalling llm prediction response: %v", err)
 			}
-			switch {
-			case strings.TrimSpace(c.Content) == lastToken:
-				tokenRepeat++
-			default:
-				lastToken = strings.TrimSpace(c.Content)
-				tokenRepeat = 0
-			}
+			if c.Content != "" {
+				switch {
+				case strings.TrimSpace(c.Content) == lastToken:
+					tokenRepeat++
+				default:
+					lastToken = strings.TrimSpace(c.Content)
+					tokenRepeat = 0
+				}
 
-			// 30 picked as an arbitrary max token repeat limit, modify as needed
-			if tokenRepeat > 30 {
-				slog.Debug("prediction aborted, token repeat limit reached")
-				return ctx.Err()
+				// 30 picked as an arbitrary max token repeat limit, modify as needed
+				if tokenRepeat > 30 {
+					slog.Debug("prediction aborted, token repeat limit reached")
+					return ctx.Err()
+				}
 			}
 
-			if c.Content != "" {
+			if c.Content != "" || len(c.Logprobs) > 0 {
 				fn(CompletionResponse{
 					Content:  c.Content,
 					Logprobs: c.Logprobs,
@@ -1668,6 +1803,11 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 			}
 
 			if c.Done {
+				span.SetAttributes(
+					tracing.Int("prompt_tokens", c.PromptEvalCount),
+					tracing.Int("generated_tokens", c.EvalCount),
+					tracing.String("done_reason", c.DoneReason.String()),
+				)
 				fn(c)
 				return nil
 			}
@@ -1694,6 +1834,10 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 
 type EmbeddingRequest struct {
 	Content string `json:"content"`
+
+	// Tokens is embedded instead of Content when set. The runner adds the
+	// model's special tokens around it as it does when tokenizing Content.
+	Tokens []int `json:"tokens,omitempty"`
 }
 
 type EmbeddingResponse struct {
@@ -1701,8 +1845,8 @@ type EmbeddingResponse struct {
 	PromptEvalCount int       `json:"prompt_eval_count"`
 }
 
-func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, int, error) {
-	logutil.Trace("embedding request", "input", input)
+func (s *llmServer) Embedding(ctx context.Context, req EmbeddingRequest) ([]float32, int, error) {
+	logutil.Trace("embedding request", "input", req.Content, "tokens", len(req.Tokens))
 
 	if err := s.sem.Acquire(ctx, 1); err != nil {
 		if errors.Is(err, context.Canceled) {
@@ -1722,19 +1866,24 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, int
 		return nil, 0, fmt.Errorf("unexpected server status: %s", status)
 	}
 
-	data, err := json.Marshal(EmbeddingRequest{Content: input})
+	data, err := json.Marshal(req)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error marshaling embed data: %w", err)
 	}
 
+	ctx, span := tracing.Start(ctx, "runner embedding", tracing.WithKind(tracing.KindClient))
+	defer span.End()
+
 	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/embedding", s.port), bytes.NewBuffer(data))
 	if err != nil {
 		return nil, 0, fmt.Errorf("error creating embed request: %w", err)
 	}
 	r.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, r.Header)
 
 	resp, err := http.DefaultClient.Do(r)
 	if err != nil {
+		span.RecordError(err)
 		return nil, 0, fmt.Errorf("do embedding request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -1879,6 +2028,7 @@ func (s *llmServer) TotalSize() uint64 {
 	}
 
 	mem := s.mem.InputWeights
+	mem += s.mem.HostCache
 	mem += s.mem.CPU.Size()
 	for _, g := range s.mem.GPUs {
 		mem += g.Size()
@@ -2,13 +2,21 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/internal/tracing"
+	"github.com/ollama/ollama/internal/tracing/tracingtest"
 	"github.com/ollama/ollama/ml"
 	"golang.org/x/sync/semaphore"
 )
@@ -279,3 +287,59 @@ func TestLLMServerCompletionFormat(t *testing.T) {
 	}, nil)
 	checkValid(err)
 }
+
+func TestLLMServerCompletionTraceContext(t *testing.T) {
+	collector := tracingtest.Start(t)
+
+	var traceparent string
+	runner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			json.NewEncoder(w).Encode(ServerStatusResponse{Status: ServerStatusReady})
+		case "/completion":
+			traceparent = r.Header.Get("traceparent")
+			json.NewEncoder(w).Encode(CompletionResponse{Done: true, PromptEvalCount: 3, EvalCount: 5})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer runner.Close()
+
+	u, err := url.Parse(runner.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &llmServer{
+		port:    port,
+		cmd:     &exec.Cmd{},
+		sem:     semaphore.NewWeighted(1),
+		options: api.DefaultOptions(),
+	}
+
+	ctx, parent := tracing.Start(t.Context(), "parent")
+	if err := s.Completion(ctx, CompletionRequest{Prompt: "hi"}, func(CompletionResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := collector.Flush(t)
+	span, ok := tracingtest.Find(spans, "runner completion")
+	if !ok {
+		t.Fatal("runner completion span not exported")
+	}
+	if span.TraceID != parent.SpanContext().TraceID.String() || span.ParentSpanID != parent.SpanContext().SpanID.String() {
+		t.Errorf("expected runner completion to be a child of parent, got %+v", span)
+	}
+	if span.Attributes["prompt_tokens"] != "3" || span.Attributes["generated_tokens"] != "5" {
+		t.Errorf("unexpected attributes %v", span.Attributes)
+	}
+
+	if want := fmt.Sprintf("00-%s-%s-01", span.TraceID, span.SpanID); traceparent != want {
+		t.Errorf("expected runner request traceparent %q, got %q", want, traceparent)
+	}
+}
@@ -150,3 +150,67 @@ func AnthropicMessagesMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AnthropicCountTokensWriter wraps the response writer to transform token
+// counts to the Anthropic format
+type AnthropicCountTokensWriter struct {
+	AnthropicWriter
+}
+
+func (w *AnthropicCountTokensWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	var resp api.CountTokensResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return 0, err
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	return len(data), json.NewEncoder(w.ResponseWriter).Encode(anthropic.CountTokensResponse{InputTokens: resp.PromptEvalCount})
+}
+
+// AnthropicCountTokensMiddleware handles Anthropic Count Message Tokens API requests
+func AnthropicCountTokensMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req anthropic.CountTokensRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if req.Model == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, "model is required"))
+			return
+		}
+
+		if len(req.Messages) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, "messages is required"))
+			return
+		}
+
+		countReq, err := anthropic.FromCountTokensRequest(req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		// Count as the messages endpoint would send the request
+		c.Set("relax_thinking", true)
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(countReq); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, anthropic.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+		c.Writer = &AnthropicCountTokensWriter{
+			AnthropicWriter: AnthropicWriter{BaseWriter: BaseWriter{ResponseWriter: c.Writer}},
+		}
+
+		c.Next()
+	}
+}
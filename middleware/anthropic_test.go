@@ -605,3 +605,145 @@ func TestAnthropicMessagesMiddleware_SetsRelaxThinkingFlag(t *testing.T) {
 		t.Error("expected relax_thinking flag to be set in context")
 	}
 }
+
+func TestAnthropicCountTokensMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var captured api.CountTokensRequest
+	router := gin.New()
+	router.Use(AnthropicCountTokensMiddleware())
+	router.POST("/v1/messages/count_tokens", func(c *gin.Context) {
+		if err := c.ShouldBindJSON(&captured); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if captured.Model == "missing" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "model 'missing' not found"})
+			return
+		}
+		c.JSON(http.StatusOK, api.CountTokensResponse{Model: captured.Model, PromptEvalCount: 42})
+	})
+
+	t.Run("count", func(t *testing.T) {
+		body := `{
+			"model": "test-model",
+			"system": "You are helpful.",
+			"messages": [{"role": "user", "content": "Hi"}],
+			"tools": [{"name": "get_weather", "description": "Get weather", "input_schema": {"type": "object"}}],
+			"thinking": {"type": "enabled", "budget_tokens": 1000}
+		}`
+		req, _ := http.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body)
+		}
+
+		var result anthropic.CountTokensResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.InputTokens != 42 {
+			t.Errorf("expected input_tokens 42, got %d", result.InputTokens)
+		}
+
+		want := []api.Message{
+			{Role: "system", Content: "You are helpful."},
+			{Role: "user", Content: "Hi"},
+		}
+		if diff := cmp.Diff(want, captured.Messages); diff != "" {
+			t.Errorf("messages mismatch (-want +got):\n%s", diff)
+		}
+		if len(captured.Tools) != 1 || captured.Tools[0].Function.Name != "get_weather" {
+			t.Errorf("expected get_weather tool, got %v", captured.Tools)
+		}
+		if captured.Think == nil || !captured.Think.Bool() {
+			t.Errorf("expected think to be enabled, got %v", captured.Think)
+		}
+	})
+
+	t.Run("missing messages", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(`{"model": "test-model"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", resp.Code)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		body := `{"model": "missing", "messages": [{"role": "user", "content": "Hi"}]}`
+		req, _ := http.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", resp.Code)
+		}
+
+		var errResp anthropic.ErrorResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+			t.Fatal(err)
+		}
+		if errResp.Error.Type != "not_found_error" || errResp.Error.Message != "model 'missing' not found" {
+			t.Errorf("unexpected error %+v", errResp.Error)
+		}
+	})
+}
+
+func TestAnthropicMessagesMiddleware_CacheControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(AnthropicMessagesMiddleware())
+	router.POST("/v1/messages", func(c *gin.Context) {
+		resp := api.ChatResponse{
+			Model:      "test-model",
+			Message:    api.Message{Role: "assistant", Content: "Hello!"},
+			Done:       true,
+			DoneReason: "stop",
+			Metrics:    api.Metrics{PromptEvalCount: 100, PromptCachedCount: 60, EvalCount: 5},
+		}
+		data, _ := json.Marshal(resp)
+		c.Writer.WriteHeader(http.StatusOK)
+		_, _ = c.Writer.Write(data)
+	})
+
+	body := `{
+		"model": "test-model",
+		"max_tokens": 100,
+		"system": [{"type": "text", "text": "You are helpful.", "cache_control": {"type": "ephemeral"}}],
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Hi", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "assistant", "content": "Hello"},
+			{"role": "user", "content": "How are you?"}
+		]
+	}`
+	req, _ := http.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body)
+	}
+
+	var result anthropic.MessagesResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	want := anthropic.Usage{InputTokens: 40, CacheReadInputTokens: 60, OutputTokens: 5}
+	if diff := cmp.Diff(want, result.Usage); diff != "" {
+		t.Errorf("usage mismatch (-want +got):\n%s", diff)
+	}
+}
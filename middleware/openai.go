@@ -2,11 +2,17 @@ package middleware
 
 import (
 	"bytes"
+	"cmp"
+	crand "crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,6 +56,17 @@ type EmbedWriter struct {
 	encodingFormat string
 }
 
+type RerankWriter struct {
+	BaseWriter
+	model           string
+	returnDocuments bool
+}
+
+type TranscriptionWriter struct {
+	BaseWriter
+	responseFormat string
+}
+
 func (w *BaseWriter) writeError(data []byte) (int, error) {
 	var serr api.StatusError
 	err := json.Unmarshal(data, &serr)
@@ -274,6 +291,65 @@ func (w *EmbedWriter) Write(data []byte) (int, error) {
 	return w.writeResponse(data)
 }
 
+func (w *RerankWriter) writeResponse(data []byte) (int, error) {
+	var rerankResponse api.RerankResponse
+	err := json.Unmarshal(data, &rerankResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w.ResponseWriter).Encode(openai.ToRerankResponse(w.model, rerankResponse, w.returnDocuments))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *RerankWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	return w.writeResponse(data)
+}
+
+func (w *TranscriptionWriter) writeResponse(data []byte) (int, error) {
+	var transcribeResponse api.TranscribeResponse
+	err := json.Unmarshal(data, &transcribeResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	if w.responseFormat == "text" {
+		w.ResponseWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := io.WriteString(w.ResponseWriter, transcribeResponse.Text+"\n"); err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w.ResponseWriter).Encode(openai.ToTranscriptionResponse(transcribeResponse, w.responseFormat == "verbose_json"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *TranscriptionWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	return w.writeResponse(data)
+}
+
 func ListMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		w := &ListWriter{
@@ -393,6 +469,47 @@ func EmbeddingsMiddleware() gin.HandlerFunc {
 	}
 }
 
+func RerankMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req openai.RerankRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if req.Query == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "query is required"))
+			return
+		}
+
+		if len(req.Documents) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "documents are required"))
+			return
+		}
+
+		rerankReq := openai.FromRerankRequest(req)
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(rerankReq); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &RerankWriter{
+			BaseWriter:      BaseWriter{ResponseWriter: c.Writer},
+			model:           req.Model,
+			returnDocuments: rerankReq.ReturnDocuments,
+		}
+
+		c.Writer = w
+
+		c.Next()
+	}
+}
+
 func ChatMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req openai.ChatCompletionRequest
@@ -443,6 +560,37 @@ type ResponsesWriter struct {
 	responseID string
 	itemID     string
 	request    openai.ResponsesRequest
+
+	// store, if set, keeps the response once it completes for the API key
+	// owner. conversation is the conversation so far and output accumulates
+	// the generated message.
+	store        *ResponseStore
+	owner        string
+	conversation []api.Message
+	output       api.Message
+}
+
+// accumulate adds a chunk of the response to the generated message.
+func (w *ResponsesWriter) accumulate(r api.ChatResponse) {
+	w.output.Role = "assistant"
+	w.output.Content += r.Message.Content
+	w.output.Thinking += r.Message.Thinking
+	w.output.ToolCalls = append(w.output.ToolCalls, r.Message.ToolCalls...)
+}
+
+// save stores the completed response object.
+func (w *ResponsesWriter) save(response any) {
+	b, err := json.Marshal(response)
+	if err == nil {
+		err = w.store.Put(w.responseID, &StoredResponse{
+			Response: b,
+			Messages: append(w.conversation, w.output),
+			Owner:    w.owner,
+		})
+	}
+	if err != nil {
+		slog.Warn("failed to store response", "id", w.responseID, "error", err)
+	}
 }
 
 func (w *ResponsesWriter) writeEvent(eventType string, data any) error {
@@ -466,6 +614,10 @@ func (w *ResponsesWriter) writeResponse(data []byte) (int, error) {
 		return 0, err
 	}
 
+	if w.store != nil {
+		w.accumulate(chatResponse)
+	}
+
 	if w.stream {
 		w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
 
@@ -474,6 +626,9 @@ func (w *ResponsesWriter) writeResponse(data []byte) (int, error) {
 			if err := w.writeEvent(event.Event, event.Data); err != nil {
 				return 0, err
 			}
+			if event.Event == "response.completed" && w.store != nil {
+				w.save(event.Data.(map[string]any)["response"])
+			}
 		}
 		return len(data), nil
 	}
@@ -483,6 +638,9 @@ func (w *ResponsesWriter) writeResponse(data []byte) (int, error) {
 	response := openai.ToResponse(w.model, w.responseID, w.itemID, chatResponse, w.request)
 	completedAt := time.Now().Unix()
 	response.CompletedAt = &completedAt
+	if w.store != nil {
+		w.save(response)
+	}
 	return len(data), json.NewEncoder(w.ResponseWriter).Encode(response)
 }
 
@@ -494,7 +652,11 @@ func (w *ResponsesWriter) Write(data []byte) (int, error) {
 	return w.writeResponse(data)
 }
 
-func ResponsesMiddleware() gin.HandlerFunc {
+// ResponsesMiddleware translates Responses API requests into chat requests.
+// Responses are kept in store when the request sets store, and requests can
+// continue from a stored response with previous_response_id. If store is
+// nil, neither is supported.
+func ResponsesMiddleware(store *ResponseStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req openai.ResponsesRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -502,12 +664,40 @@ func ResponsesMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		var previous []api.Message
+		if req.PreviousResponseID != "" {
+			if store == nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "previous_response_id is not supported"))
+				return
+			}
+
+			r, err := store.Get(c.GetString(APIKeyIDKey), req.PreviousResponseID)
+			if errors.Is(err, errResponseNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, openai.NewError(http.StatusNotFound, fmt.Sprintf("Previous response with id '%s' not found.", req.PreviousResponseID)))
+				return
+			} else if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+				return
+			}
+			previous = r.Messages
+		}
+
 		chatReq, err := openai.FromResponsesRequest(req)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
 			return
 		}
 
+		// The previous conversation goes after the instructions, which
+		// FromResponsesRequest puts first, and before the new input
+		var instructions []api.Message
+		input := chatReq.Messages
+		if req.Instructions != "" {
+			instructions, input = input[:1], input[1:]
+		}
+		conversation := slices.Concat(previous, input)
+		chatReq.Messages = slices.Concat(instructions, conversation)
+
 		// Check if client requested streaming (defaults to false)
 		streamRequested := req.Stream != nil && *req.Stream
 
@@ -522,7 +712,8 @@ func ResponsesMiddleware() gin.HandlerFunc {
 
 		c.Request.Body = io.NopCloser(&b)
 
-		responseID := fmt.Sprintf("resp_%d", rand.Intn(999999))
+		// Stored responses are looked up by ID so it must be unique
+		responseID := "resp_" + crand.Text()
 		itemID := fmt.Sprintf("msg_%d", rand.Intn(999999))
 
 		w := &ResponsesWriter{
@@ -535,6 +726,12 @@ func ResponsesMiddleware() gin.HandlerFunc {
 			request:    req,
 		}
 
+		if req.Stored() && store != nil {
+			w.store = store
+			w.owner = c.GetString(APIKeyIDKey)
+			w.conversation = conversation
+		}
+
 		// Set headers based on streaming mode
 		if streamRequested {
 			c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -609,3 +806,169 @@ func ImageGenerationsMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// ImageEditsMiddleware converts a multipart OpenAI image edit request into a
+// GenerateRequest with an init image and optional inpainting mask.
+func ImageEditsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := openai.ImageEditRequest{
+			Model:          c.PostForm("model"),
+			Prompt:         c.PostForm("prompt"),
+			Size:           c.PostForm("size"),
+			ResponseFormat: c.PostForm("response_format"),
+		}
+
+		if n := c.PostForm("n"); n != "" {
+			v, err := strconv.Atoi(n)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "invalid n"))
+				return
+			}
+			req.N = v
+		}
+
+		if seed := c.PostForm("seed"); seed != "" {
+			v, err := strconv.ParseInt(seed, 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "invalid seed"))
+				return
+			}
+			req.Seed = &v
+		}
+
+		if strength := c.PostForm("strength"); strength != "" {
+			v, err := strconv.ParseFloat(strength, 32)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "invalid strength"))
+				return
+			}
+			s := float32(v)
+			req.Strength = &s
+		}
+
+		if req.Prompt == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "prompt is required"))
+			return
+		}
+
+		if req.Model == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "model is required"))
+			return
+		}
+
+		image, err := readFormFile(c, "image", "image[]")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if image == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "image is required"))
+			return
+		}
+		req.Image = image
+
+		req.Mask, err = readFormFile(c, "mask")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(openai.FromImageEditRequest(req)); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+		c.Request.ContentLength = int64(b.Len())
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		w := &ImageWriter{
+			BaseWriter: BaseWriter{ResponseWriter: c.Writer},
+		}
+
+		c.Writer = w
+		c.Next()
+	}
+}
+
+func TranscriptionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := openai.TranscriptionRequest{
+			Model:          c.PostForm("model"),
+			Language:       c.PostForm("language"),
+			Prompt:         c.PostForm("prompt"),
+			ResponseFormat: cmp.Or(c.PostForm("response_format"), "json"),
+		}
+
+		if !slices.Contains([]string{"json", "text", "verbose_json"}, req.ResponseFormat) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, fmt.Sprintf("response_format %q is not supported", req.ResponseFormat)))
+			return
+		}
+
+		if temperature := c.PostForm("temperature"); temperature != "" {
+			v, err := strconv.ParseFloat(temperature, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "invalid temperature"))
+				return
+			}
+			req.Temperature = &v
+		}
+
+		if req.Model == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "model is required"))
+			return
+		}
+
+		file, err := readFormFile(c, "file")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if file == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "file is required"))
+			return
+		}
+		req.File = file
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(openai.FromTranscriptionRequest(req)); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+		c.Request.ContentLength = int64(b.Len())
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		w := &TranscriptionWriter{
+			BaseWriter:     BaseWriter{ResponseWriter: c.Writer},
+			responseFormat: req.ResponseFormat,
+		}
+
+		c.Writer = w
+		c.Next()
+	}
+}
+
+// readFormFile returns the contents of the first multipart file found under
+// any of the given field names, or nil if none was uploaded.
+func readFormFile(c *gin.Context, names ...string) ([]byte, error) {
+	for _, name := range names {
+		fh, err := c.FormFile(name)
+		if errors.Is(err, http.ErrMissingFile) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return io.ReadAll(f)
+	}
+	return nil, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -824,6 +825,139 @@ func TestEmbeddingsMiddleware(t *testing.T) {
 	}
 }
 
+func TestRerankMiddleware(t *testing.T) {
+	type testCase struct {
+		name string
+		body string
+		req  api.RerankRequest
+		resp string
+		err  openai.ErrorResponse
+	}
+
+	var capturedRequest *api.RerankRequest
+
+	testCases := []testCase{
+		{
+			name: "string documents",
+			body: `{
+				"model": "test-model",
+				"query": "what is ollama",
+				"documents": ["pandas eat bamboo", "ollama runs models"],
+				"top_n": 1
+			}`,
+			req: api.RerankRequest{
+				Model:           "test-model",
+				Query:           "what is ollama",
+				Documents:       []string{"pandas eat bamboo", "ollama runs models"},
+				TopN:            1,
+				ReturnDocuments: true,
+			},
+			resp: `{
+				"model": "test-model",
+				"results": [{"index": 1, "document": {"text": "ollama runs models"}, "relevance_score": 0.9}],
+				"usage": {"prompt_tokens": 12, "total_tokens": 12}
+			}`,
+		},
+		{
+			name: "object documents without return documents",
+			body: `{
+				"model": "test-model",
+				"query": "what is ollama",
+				"documents": [{"text": "pandas eat bamboo"}, {"text": "ollama runs models"}],
+				"return_documents": false
+			}`,
+			req: api.RerankRequest{
+				Model:     "test-model",
+				Query:     "what is ollama",
+				Documents: []string{"pandas eat bamboo", "ollama runs models"},
+			},
+			resp: `{
+				"model": "test-model",
+				"results": [{"index": 1, "relevance_score": 0.9}],
+				"usage": {"prompt_tokens": 12, "total_tokens": 12}
+			}`,
+		},
+		{
+			name: "missing documents",
+			body: `{"model": "test-model", "query": "what is ollama"}`,
+			err: openai.ErrorResponse{
+				Error: openai.Error{
+					Message: "documents are required",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+		{
+			name: "invalid document",
+			body: `{"model": "test-model", "query": "what is ollama", "documents": [1]}`,
+			err: openai.ErrorResponse{
+				Error: openai.Error{
+					Message: "document must be a string or an object with a text field",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+	}
+
+	endpoint := func(c *gin.Context) {
+		var req api.RerankRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, api.RerankResponse{
+			Model:           req.Model,
+			Results:         []api.RerankResult{{Index: 1, Document: "ollama runs models", RelevanceScore: 0.9}},
+			PromptEvalCount: 12,
+		})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RerankMiddleware(), captureRequestMiddleware(&capturedRequest))
+	router.Handle(http.MethodPost, "/api/rerank", endpoint)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/api/rerank", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK {
+				var errResp openai.ErrorResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(tc.err, errResp); diff != "" {
+					t.Fatalf("errors did not match (-want +got):\n%s", diff)
+				}
+				return
+			}
+
+			if diff := cmp.Diff(tc.req, *capturedRequest); diff != "" {
+				t.Fatalf("requests did not match (-want +got):\n%s", diff)
+			}
+
+			var got, want any
+			if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.resp), &want); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("responses did not match (-want +got):\n%s", diff)
+			}
+
+			capturedRequest = nil
+		})
+	}
+}
+
 func TestListMiddleware(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -1065,6 +1199,130 @@ func TestImageGenerationsMiddleware(t *testing.T) {
 	}
 }
 
+func TestImageEditsMiddleware(t *testing.T) {
+	type testCase struct {
+		name   string
+		fields map[string]string
+		files  map[string][]byte
+		req    api.GenerateRequest
+		err    openai.ErrorResponse
+	}
+
+	var capturedRequest *api.GenerateRequest
+
+	strength := float32(0.5)
+	testCases := []testCase{
+		{
+			name:   "image edit basic",
+			fields: map[string]string{"model": "test-model", "prompt": "make it snowy"},
+			files:  map[string][]byte{"image": []byte("init")},
+			req: api.GenerateRequest{
+				Model:  "test-model",
+				Prompt: "make it snowy",
+				Images: []api.ImageData{[]byte("init")},
+			},
+		},
+		{
+			name: "image edit with mask, size, seed and strength",
+			fields: map[string]string{
+				"model":    "test-model",
+				"prompt":   "add a cat",
+				"size":     "512x512",
+				"seed":     "42",
+				"strength": "0.5",
+			},
+			files: map[string][]byte{"image[]": []byte("init"), "mask": []byte("mask")},
+			req: api.GenerateRequest{
+				Model:    "test-model",
+				Prompt:   "add a cat",
+				Width:    512,
+				Height:   512,
+				Images:   []api.ImageData{[]byte("init")},
+				Mask:     []byte("mask"),
+				Strength: strength,
+				Options:  map[string]any{"seed": float64(42)},
+			},
+		},
+		{
+			name:   "image edit missing image",
+			fields: map[string]string{"model": "test-model", "prompt": "make it snowy"},
+			err: openai.ErrorResponse{
+				Error: openai.Error{
+					Message: "image is required",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+		{
+			name:   "image edit invalid strength",
+			fields: map[string]string{"model": "test-model", "prompt": "make it snowy", "strength": "lots"},
+			files:  map[string][]byte{"image": []byte("init")},
+			err: openai.ErrorResponse{
+				Error: openai.Error{
+					Message: "invalid strength",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+	}
+
+	endpoint := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ImageEditsMiddleware(), captureRequestMiddleware(&capturedRequest))
+	router.Handle(http.MethodPost, "/api/generate", endpoint)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for k, v := range tc.fields {
+				if err := mw.WriteField(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for k, v := range tc.files {
+				fw, err := mw.CreateFormFile(k, k+".png")
+				if err != nil {
+					t.Fatal(err)
+				}
+				fw.Write(v)
+			}
+			mw.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/generate", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			defer func() { capturedRequest = nil }()
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if tc.err.Error.Message != "" {
+				var errResp openai.ErrorResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.err, errResp); diff != "" {
+					t.Fatalf("errors did not match:\n%s", diff)
+				}
+				return
+			}
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+			}
+
+			if diff := cmp.Diff(&tc.req, capturedRequest); diff != "" {
+				t.Fatalf("requests did not match:\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestImageWriterResponse(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -1112,3 +1370,192 @@ func TestImageWriterResponse(t *testing.T) {
 		t.Errorf("expected image data 'dGVzdC1pbWFnZS1kYXRh', got %s", imageResp.Data[0].B64JSON)
 	}
 }
+
+func TestTranscriptionMiddleware(t *testing.T) {
+	type testCase struct {
+		name   string
+		fields map[string]string
+		files  map[string][]byte
+		req    api.TranscribeRequest
+		err    openai.ErrorResponse
+	}
+
+	var capturedRequest *api.TranscribeRequest
+
+	testCases := []testCase{
+		{
+			name:   "transcription basic",
+			fields: map[string]string{"model": "whisper"},
+			files:  map[string][]byte{"file": []byte("audio")},
+			req: api.TranscribeRequest{
+				Model: "whisper",
+				Audio: []byte("audio"),
+			},
+		},
+		{
+			name: "transcription with language, prompt and temperature",
+			fields: map[string]string{
+				"model":           "whisper",
+				"language":        "de",
+				"prompt":          "Ollama",
+				"temperature":     "0.2",
+				"response_format": "verbose_json",
+			},
+			files: map[string][]byte{"file": []byte("audio")},
+			req: api.TranscribeRequest{
+				Model:    "whisper",
+				Audio:    []byte("audio"),
+				Language: "de",
+				Prompt:   "Ollama",
+				Options:  map[string]any{"temperature": 0.2},
+			},
+		},
+		{
+			name:   "transcription missing file",
+			fields: map[string]string{"model": "whisper"},
+			err: openai.ErrorResponse{
+				Error: openai.Error{
+					Message: "file is required",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+		{
+			name:   "transcription unsupported response format",
+			fields: map[string]string{"model": "whisper", "response_format": "srt"},
+			files:  map[string][]byte{"file": []byte("audio")},
+			err: openai.ErrorResponse{
+				Error: openai.Error{
+					Message: `response_format "srt" is not supported`,
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+	}
+
+	endpoint := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TranscriptionMiddleware(), captureRequestMiddleware(&capturedRequest))
+	router.Handle(http.MethodPost, "/api/transcribe", endpoint)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for k, v := range tc.fields {
+				if err := mw.WriteField(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for k, v := range tc.files {
+				fw, err := mw.CreateFormFile(k, k+".wav")
+				if err != nil {
+					t.Fatal(err)
+				}
+				fw.Write(v)
+			}
+			mw.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/transcribe", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			defer func() { capturedRequest = nil }()
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if tc.err.Error.Message != "" {
+				var errResp openai.ErrorResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.err, errResp); diff != "" {
+					t.Fatalf("errors did not match:\n%s", diff)
+				}
+				return
+			}
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+			}
+
+			if diff := cmp.Diff(&tc.req, capturedRequest); diff != "" {
+				t.Fatalf("requests did not match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTranscriptionWriterResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	endpoint := func(c *gin.Context) {
+		data, _ := json.Marshal(api.TranscribeResponse{
+			Model:    "whisper",
+			Text:     "Hello there. General Kenobi.",
+			Language: "en",
+			Duration: 42,
+			Segments: []api.TranscribeSegment{
+				{Start: 0, End: 30, Text: "Hello there."},
+				{Start: 30, End: 42, Text: "General Kenobi."},
+			},
+		})
+		c.Writer.Write(data)
+	}
+
+	router := gin.New()
+	router.Use(TranscriptionMiddleware())
+	router.Handle(http.MethodPost, "/api/transcribe", endpoint)
+
+	cases := []struct {
+		format      string
+		contentType string
+		want        string
+	}{
+		{"", "application/json", `{"text":"Hello there. General Kenobi."}` + "\n"},
+		{"text", "text/plain; charset=utf-8", "Hello there. General Kenobi.\n"},
+		{
+			"verbose_json",
+			"application/json",
+			`{"task":"transcribe","language":"en","duration":42,"text":"Hello there. General Kenobi.","segments":[` +
+				`{"id":0,"start":0,"end":30,"text":"Hello there."},{"id":1,"start":30,"end":42,"text":"General Kenobi."}]}` + "\n",
+		},
+	}
+
+	for _, tt := range cases {
+		name := tt.format
+		if name == "" {
+			name = "default"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			mw.WriteField("model", "whisper")
+			if tt.format != "" {
+				mw.WriteField("response_format", tt.format)
+			}
+			fw, _ := mw.CreateFormFile("file", "audio.wav")
+			fw.Write([]byte("audio"))
+			mw.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/transcribe", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if got := resp.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, got)
+			}
+
+			if diff := cmp.Diff(tt.want, resp.Body.String()); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
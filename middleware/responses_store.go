@@ -0,0 +1,243 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/openai"
+)
+
+// StoredResponse is a response kept so later requests can continue from it
+// with previous_response_id.
+type StoredResponse struct {
+	// Response is the response object as returned to the client
+	Response json.RawMessage `json:"response"`
+
+	// Messages is the conversation up to and including the response. As
+	// with OpenAI, instructions are not carried over to later responses so
+	// they are not included.
+	Messages []api.Message `json:"messages"`
+
+	// Owner is the ID of the API key that stored the response, or empty if
+	// API keys are not configured
+	Owner string `json:"owner,omitempty"`
+}
+
+// APIKeyIDKey is the gin context key for the ID of the API key that
+// authenticated the request, if any. Stored responses can only be used by
+// requests made with the key that stored them.
+const APIKeyIDKey = "auth.key_id"
+
+var responseIDPattern = regexp.MustCompile(`^resp_[A-Za-z0-9]+$`)
+
+var errResponseNotFound = errors.New("response not found")
+
+// ResponseStore keeps stored responses as files in a directory. Once it
+// holds more than a maximum number of responses, the least recently written
+// are removed.
+type ResponseStore struct {
+	dir string
+	max int
+
+	mu sync.Mutex
+}
+
+// NewResponseStore returns a store in dir holding up to max responses. The
+// directory is created when the first response is stored. If max is zero,
+// responses are not stored.
+func NewResponseStore(dir string, max int) *ResponseStore {
+	return &ResponseStore{dir: dir, max: max}
+}
+
+func (s *ResponseStore) path(id string) (string, error) {
+	if !responseIDPattern.MatchString(id) {
+		return "", errResponseNotFound
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Get returns the stored response with the given ID if it belongs to owner.
+func (s *ResponseStore) Get(owner, id string) (*StoredResponse, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.get(owner, p)
+}
+
+func (s *ResponseStore) get(owner, p string) (*StoredResponse, error) {
+
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errResponseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var r StoredResponse
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	// responses of other keys are indistinguishable from missing ones
+	if r.Owner != owner {
+		return nil, errResponseNotFound
+	}
+	return &r, nil
+}
+
+// Put stores r with the given ID, evicting the oldest responses if the store
+// is full.
+func (s *ResponseStore) Put(id string, r *StoredResponse) error {
+	if s.max <= 0 {
+		return nil
+	}
+
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial response
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return err
+	}
+
+	return s.evict()
+}
+
+// evict removes the oldest responses beyond the maximum. s.mu must be held.
+func (s *ResponseStore) evict() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		path    string
+		modTime time.Time
+	}
+
+	var files []file
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{filepath.Join(s.dir, e.Name()), info.ModTime()})
+	}
+
+	if len(files) <= s.max {
+		return nil
+	}
+
+	slices.SortFunc(files, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+	for _, f := range files[:len(files)-s.max] {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the stored response with the given ID if it belongs to
+// owner.
+func (s *ResponseStore) Delete(owner, id string) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.get(owner, p); err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); errors.Is(err, fs.ErrNotExist) {
+		return errResponseNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func responseNotFound(c *gin.Context, id string) {
+	c.AbortWithStatusJSON(http.StatusNotFound, openai.NewError(http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", id)))
+}
+
+// RetrieveResponseHandler returns a stored response.
+func RetrieveResponseHandler(store *ResponseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		r, err := store.Get(c.GetString(APIKeyIDKey), id)
+		if errors.Is(err, errResponseNotFound) {
+			responseNotFound(c, id)
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Data(http.StatusOK, "application/json", r.Response)
+	}
+}
+
+// DeleteResponseHandler deletes a stored response.
+func DeleteResponseHandler(store *ResponseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		err := store.Delete(c.GetString(APIKeyIDKey), id)
+		if errors.Is(err, errResponseNotFound) {
+			responseNotFound(c, id)
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"id": id, "object": "response.deleted", "deleted": true})
+	}
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/openai"
+)
+
+func TestResponseStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "responses")
+	store := NewResponseStore(dir, 2)
+
+	if _, err := store.Get("", "resp_missing"); err != errResponseNotFound {
+		t.Fatalf("expected errResponseNotFound, got %v", err)
+	}
+	if _, err := store.Get("", "../../etc/passwd"); err != errResponseNotFound {
+		t.Fatalf("expected invalid ID to be rejected, got %v", err)
+	}
+
+	for i, id := range []string{"resp_a", "resp_b", "resp_c"} {
+		if err := store.Put(id, &StoredResponse{
+			Response: json.RawMessage(fmt.Sprintf(`{"id":%q}`, id)),
+			Messages: []api.Message{{Role: "user", Content: id}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// make eviction order deterministic on filesystems with coarse timestamps
+		os.Chtimes(filepath.Join(dir, id+".json"), time.Time{}, time.Unix(int64(i), 0))
+	}
+
+	if _, err := store.Get("", "resp_a"); err != errResponseNotFound {
+		t.Errorf("expected oldest response to be evicted, got %v", err)
+	}
+
+	r, err := store.Get("", "resp_c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Response) != `{"id":"resp_c"}` || r.Messages[0].Content != "resp_c" {
+		t.Errorf("unexpected stored response %+v", r)
+	}
+
+	// responses are only visible to the key that stored them
+	if err := store.Put("resp_d", &StoredResponse{Response: json.RawMessage(`{}`), Owner: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("b", "resp_d"); err != errResponseNotFound {
+		t.Errorf("expected errResponseNotFound for another key, got %v", err)
+	}
+	if err := store.Delete("", "resp_d"); err != errResponseNotFound {
+		t.Errorf("expected errResponseNotFound without a key, got %v", err)
+	}
+	if _, err := store.Get("a", "resp_d"); err != nil {
+		t.Errorf("expected the owner to get the response, got %v", err)
+	}
+
+	if err := store.Delete("", "resp_c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("", "resp_c"); err != errResponseNotFound {
+		t.Errorf("expected errResponseNotFound, got %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected 1 file left, got %d", len(entries))
+	}
+}
+
+func TestResponsesMiddlewareStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := NewResponseStore(t.TempDir(), 10)
+
+	var captured api.ChatRequest
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// stand in for the server's API key authentication
+		if key := c.GetHeader("Authorization"); key != "" {
+			c.Set(APIKeyIDKey, key)
+		}
+	})
+	router.POST("/v1/responses", ResponsesMiddleware(store), captureRequestMiddleware(&captured), func(c *gin.Context) {
+		last := captured.Messages[len(captured.Messages)-1]
+		resp := api.ChatResponse{
+			Model:     captured.Model,
+			CreatedAt: time.Now(),
+			Done:      true,
+		}
+		if captured.Stream != nil && *captured.Stream {
+			for _, word := range []string{"re: ", last.Content} {
+				c.JSON(http.StatusOK, api.ChatResponse{Message: api.Message{Role: "assistant", Content: word}})
+			}
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		resp.Message = api.Message{Role: "assistant", Content: "re: " + last.Content}
+		c.JSON(http.StatusOK, resp)
+	})
+	router.GET("/v1/responses/:id", RetrieveResponseHandler(store))
+	router.DELETE("/v1/responses/:id", DeleteResponseHandler(store))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body)))
+		return w
+	}
+
+	// Responses are not stored unless requested
+	w := post(`{"model":"test","input":"one"}`)
+	var unstored openai.ResponsesResponse
+	if err := json.NewDecoder(w.Body).Decode(&unstored); err != nil {
+		t.Fatal(err)
+	}
+	if unstored.Store {
+		t.Error("expected store to be false")
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/responses/"+unstored.ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected unstored response to be missing, got %d", w.Code)
+	}
+
+	w = post(`{"model":"test","instructions":"be brief","input":"hello","store":true}`)
+	var first openai.ResponsesResponse
+	if err := json.NewDecoder(w.Body).Decode(&first); err != nil {
+		t.Fatal(err)
+	}
+	if !first.Store || !strings.HasPrefix(first.ID, "resp_") {
+		t.Fatalf("unexpected response %+v", first)
+	}
+
+	// Streamed responses are stored from the completed event
+	w = post(fmt.Sprintf(`{"model":"test","instructions":"be kind","input":"again","store":true,"stream":true,"previous_response_id":%q}`, first.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	// Instructions from the previous response are not carried over
+	want := []api.Message{
+		{Role: "system", Content: "be kind"},
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "re: hello"},
+		{Role: "user", Content: "again"},
+	}
+	if diff := cmp.Diff(want, captured.Messages); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+
+	var second map[string]any
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok && strings.Contains(data, `"response.completed"`) {
+			var event struct {
+				Response map[string]any `json:"response"`
+			}
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			second = event.Response
+		}
+	}
+	if second == nil || second["previous_response_id"] != first.ID || second["store"] != true {
+		t.Fatalf("unexpected completed response %v", second)
+	}
+
+	w = post(fmt.Sprintf(`{"model":"test","input":"third","previous_response_id":%q}`, second["id"]))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	want = []api.Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "re: hello"},
+		{Role: "user", Content: "again"},
+		{Role: "assistant", Content: "re: again"},
+		{Role: "user", Content: "third"},
+	}
+	if diff := cmp.Diff(want, captured.Messages); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/responses/"+first.ID, nil))
+	var retrieved openai.ResponsesResponse
+	if err := json.NewDecoder(w.Body).Decode(&retrieved); err != nil {
+		t.Fatal(err)
+	}
+	if retrieved.ID != first.ID || retrieved.Output[0].Content[0].Text != "re: hello" {
+		t.Errorf("unexpected retrieved response %+v", retrieved)
+	}
+
+	// other API keys cannot see, continue from or delete the response
+	r := httptest.NewRequest(http.MethodGet, "/v1/responses/"+first.ID, nil)
+	r.Header.Set("Authorization", "other")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for another key, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(fmt.Sprintf(`{"model":"test","input":"steal","previous_response_id":%q}`, first.ID)))
+	r.Header.Set("Authorization", "other")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for another key, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/v1/responses/"+first.ID, nil)
+	r.Header.Set("Authorization", "other")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for another key, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/responses/"+first.ID, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":true`) {
+		t.Errorf("unexpected delete response %d: %s", w.Code, w.Body)
+	}
+
+	w = post(fmt.Sprintf(`{"model":"test","input":"gone","previous_response_id":%q}`, first.ID))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+	var errResp openai.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(errResp.Error.Message, first.ID) {
+		t.Errorf("unexpected error %+v", errResp)
+	}
+}
@@ -38,6 +38,56 @@ type BackendCacheConfig interface {
 	CacheConfig() CacheConfig
 }
 
+// BackendLoras is implemented by backends that can add LoRA adapters to a
+// model after it has been loaded.
+type BackendLoras interface {
+	// LoadLora loads the LoRA adapter at path and returns an index for
+	// selecting it with Context.SetLoras
+	LoadLora(path string) (int, error)
+}
+
+// Lora applies a LoRA adapter to matrix multiplications with the weights it
+// modifies.
+type Lora struct {
+	// Adapter is the index returned by LoadLora
+	Adapter int
+
+	// Scale is the strength of the adapter
+	Scale float32
+
+	// Mask and OutputMask optionally have shape [1, batch] and [1, outputs]
+	// and scale the adapter for each input in the batch, or for each output
+	// once the model has only the outputs left, so that inputs with
+	// different adapters can be processed together. Inputs that don't use
+	// the adapter are 0.
+	Mask, OutputMask Tensor
+}
+
+// BackendControlVectors is implemented by backends that can steer a model
+// with control vectors after it has been loaded.
+type BackendControlVectors interface {
+	// LoadControlVector loads the control vector at path and returns an
+	// index for selecting it with Context.SetControlVectors
+	LoadControlVector(path string) (int, error)
+}
+
+// ControlVector adds a direction to the output of each layer that the
+// control vector has one for.
+type ControlVector struct {
+	// Vector is the index returned by LoadControlVector
+	Vector int
+
+	// Strength scales the directions, with negative values steering away
+	// from them
+	Strength float32
+
+	// Mask and OutputMask optionally have shape [1, batch] and [1, outputs]
+	// and scale the vector for each input in the batch, or for each output
+	// once the layer has only the outputs left, so that inputs with
+	// different vectors can be processed together.
+	Mask, OutputMask Tensor
+}
+
 // CacheConfig controls optimizations (mostly backend-specific) that may transform
 // the output the cache to work better with specific kernels.
 type CacheConfig struct {
@@ -71,6 +121,26 @@ type BackendParams struct {
 
 	// FlashAttention indicates that we should use a fused flash attention kernel
 	FlashAttention FlashAttentionType
+
+	// Rope overrides the RoPE parameters in the model's metadata
+	Rope RopeOptions
+
+	// MaxAdapters is the number of LoRA adapters and control vectors that
+	// can be loaded after the model. Graphs are sized to have room for them.
+	MaxAdapters int
+}
+
+// RopeOptions are RoPE parameters that override those in the model's
+// metadata. Zero values leave the metadata unchanged.
+type RopeOptions struct {
+	ScalingType           string
+	FreqBase              float32
+	ScalingFactor         float32
+	OriginalContextLength int
+	ExtrapolationFactor   float32
+	AttentionFactor       float32
+	BetaFast              float32
+	BetaSlow              float32
 }
 
 var backends = make(map[string]func(string, BackendParams) (Backend, error))
@@ -107,6 +177,16 @@ type Context interface {
 	// Uses heuristics if not set
 	SetBatchSize(int)
 
+	// SetLoras sets the LoRA adapters that apply to the batch
+	SetLoras([]Lora)
+
+	// SetControlVectors sets the control vectors that apply to the batch
+	SetControlVectors([]ControlVector)
+
+	// ApplyControlVectors adds the directions of the control vectors for
+	// layer to t, which is the output of that layer
+	ApplyControlVectors(layer int, t Tensor) Tensor
+
 	Compute(...Tensor)
 	ComputeWithNotify(func(), ...Tensor) // notify callback once compute has begun
 
@@ -125,6 +205,10 @@ type Context interface {
 
 	// Layer returns a context appropriate for creating intermediate tensors
 	Layer(int) Context
+
+	// Host returns a context for creating tensors that are kept in system
+	// memory regardless of where layers are located
+	Host() Context
 }
 
 type Tensor interface {
@@ -160,9 +244,11 @@ type Tensor interface {
 	SumRows(ctx Context) Tensor
 
 	AvgPool2D(ctx Context, k, s int, p float32) Tensor
+	Conv1D(ctx Context, weight Tensor, s0, p0, d0 int) Tensor
 	Conv2D(ctx Context, weight Tensor, s0, s1, p0, p1, d0, d1 int) Tensor
 	Conv3D(ctx Context, weight Tensor, c, s0, s1, s2, p0, p1, p2, d0, d1, d2 int) Tensor
 	SSMConv(ctx Context, kernel Tensor) Tensor
+	SSMScan(ctx Context, x, dt, a, b, c, ids Tensor) Tensor
 
 	IM2Col(ctx Context, weight Tensor, s0, s1, p0, p1, d0, d1 int) Tensor
 
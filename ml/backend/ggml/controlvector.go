@@ -0,0 +1,151 @@
+package ggml
+
+// #include "ggml.h"
+// #include "ggml-backend.h"
+import "C"
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+)
+
+// controlVector holds the directions of a loaded control vector and the
+// memory for them
+type controlVector struct {
+	path string
+
+	// directions maps from a layer to the direction added to its output
+	directions map[int]*C.struct_ggml_tensor
+	buffers    map[*C.struct_ggml_context]C.ggml_backend_buffer_t
+}
+
+// LoadControlVector loads a control vector in the GGUF format used by
+// llama.cpp, which has a direction.N tensor for each layer N that it steers.
+// Each direction is placed on the same device as its layer.
+//
+// LoadControlVector must not be called while graphs are being built.
+func (b *Backend) LoadControlVector(path string) (int, error) {
+	if err := b.checkAdapters(); err != nil {
+		return 0, err
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	meta, err := fsggml.Decode(r, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	kv := meta.KV()
+	if kv.Architecture() != "controlvector" {
+		return 0, fmt.Errorf("%s is not a control vector", path)
+	}
+
+	arch := b.meta.KV().Architecture()
+	if hint := kv.String("model_hint"); hint != "" && hint != arch {
+		return 0, fmt.Errorf("control vector is for %s but the model is %s", hint, arch)
+	}
+
+	index := len(b.controlVectors)
+	embd := uint64(b.meta.KV().EmbeddingLength())
+
+	layers := make(map[*fsggml.Tensor]int)
+	bufts := make(map[*fsggml.Tensor]C.ggml_backend_buffer_type_t)
+	for _, t := range meta.Tensors().Items() {
+		s, ok := strings.CutPrefix(t.Name, "direction.")
+		if !ok {
+			return 0, fmt.Errorf("unexpected tensor in control vector: %s", t.Name)
+		}
+
+		layer, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected tensor in control vector: %s", t.Name)
+		}
+
+		d, ok := b.layers[layer]
+		if !ok {
+			return 0, fmt.Errorf("control vector steers layer %d but the model has %d layers", layer, len(b.layers))
+		}
+
+		if t.Kind != uint32(fsggml.TensorTypeF32) || len(t.Shape) != 1 || t.Shape[0] != embd {
+			return 0, fmt.Errorf("control vector direction %s must be F32 with %d elements, got %s %v", t.Name, embd, fsggml.TensorType(t.Kind), t.Shape)
+		}
+
+		layers[t] = layer
+		bufts[t] = d.bt
+	}
+
+	tensors, buffers, err := loadTensors(r, meta, bufts, fmt.Sprintf("cvec.%d.", index))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load control vector %s: %w", path, err)
+	}
+
+	cv := controlVector{
+		path:       path,
+		directions: make(map[int]*C.struct_ggml_tensor),
+		buffers:    buffers,
+	}
+
+	for t, tt := range tensors {
+		cv.directions[layers[t]] = tt
+	}
+
+	b.controlVectors = append(b.controlVectors, cv)
+
+	slog.Info("loaded control vector", "path", path, "index", index, "layers", len(cv.directions))
+	return index, nil
+}
+
+// SetControlVectors selects the control vectors to apply when building the
+// graph
+func (c *Context) SetControlVectors(cvs []ml.ControlVector) {
+	c.controlVectors = cvs
+}
+
+// ApplyControlVectors adds the directions of the selected control vectors for
+// layer to t
+func (c *Context) ApplyControlVectors(layer int, t ml.Tensor) ml.Tensor {
+	out := t.(*Tensor).t
+	for _, cv := range c.controlVectors {
+		direction, ok := c.b.controlVectors[cv.Vector].directions[layer]
+		if !ok {
+			continue
+		}
+
+		delta := C.ggml_scale(c.ctx, direction, C.float(cv.Strength))
+
+		if cv.Mask != nil {
+			// the hidden state either has every input in the batch or, in
+			// the last layer, only the outputs
+			n := out.ne[1] * out.ne[2] * out.ne[3]
+
+			var mask *C.struct_ggml_tensor
+			if m := cv.Mask.(*Tensor).t; m.ne[1] == n {
+				mask = m
+			} else if cv.OutputMask != nil && cv.OutputMask.(*Tensor).t.ne[1] == n {
+				mask = cv.OutputMask.(*Tensor).t
+			} else {
+				panic(fmt.Errorf("control vector mask has %v inputs but layer %v has %v", m.ne[1], layer, n))
+			}
+
+			// the outer product of the direction and the mask gives each
+			// input its own strength
+			delta = C.ggml_mul_mat(c.ctx, C.ggml_reshape_2d(c.ctx, delta, 1, delta.ne[0]), mask)
+			delta = C.ggml_reshape_4d(c.ctx, delta, out.ne[0], out.ne[1], out.ne[2], out.ne[3])
+		}
+
+		out = C.ggml_add(c.ctx, out, delta)
+	}
+
+	return &Tensor{b: c.b, t: out}
+}
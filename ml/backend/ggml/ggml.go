@@ -114,8 +114,20 @@ type Backend struct {
 	// maxGraphNodes is the maximum allowed number of graph nodes in this scheduler
 	maxGraphNodes int
 
+	// maxAdapters is the number of LoRA adapters and control vectors that
+	// maxGraphNodes has room for
+	maxAdapters int
+
 	// weightBuffers are the GGML contexts and buffers for allocating weights
 	weightBuffers map[*C.struct_ggml_context]C.ggml_backend_buffer_t
+
+	// loraAdapters are the LoRA adapters loaded with LoadLora, and loraWeights
+	// maps from a model weight to the adapter weights that modify it
+	loraAdapters []loraAdapter
+	loraWeights  map[*C.struct_ggml_tensor][]loraWeight
+
+	// controlVectors are the control vectors loaded with LoadControlVector
+	controlVectors []controlVector
 }
 
 var once sync.Once
@@ -132,6 +144,8 @@ func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
 		return nil, err
 	}
 
+	applyRopeOptions(meta.KV(), params.Rope)
+
 	once.Do(func() {
 		slog.Info(
 			"",
@@ -379,6 +393,17 @@ func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
 	}
 
 	maxGraphNodes := max(1024, len(meta.Tensors().Items())*8)
+	if params.MaxAdapters > 0 {
+		// leave room for the nodes that adapters add to each matrix
+		var matrices int
+		for _, t := range meta.Tensors().Items() {
+			if len(t.Shape) == 2 {
+				matrices++
+			}
+		}
+
+		maxGraphNodes += params.MaxAdapters * matrices * adapterGraphNodes
+	}
 
 	sched := C.ggml_backend_sched_new_ext(
 		(*C.ggml_backend_t)(unsafe.Pointer(&schedBackends[0])),
@@ -444,7 +469,9 @@ func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
 		requiredMemory: &requiredMemory,
 		btDeviceMemory: btDeviceMemory,
 		maxGraphNodes:  maxGraphNodes,
+		maxAdapters:    params.MaxAdapters,
 		weightBuffers:  bbs,
+		loraWeights:    make(map[*C.struct_ggml_tensor][]loraWeight),
 	}, nil
 }
 
@@ -462,6 +489,20 @@ func (b *Backend) Close() {
 		C.ggml_free(ctx)
 	}
 
+	for _, adapter := range b.loraAdapters {
+		for ctx, b := range adapter.buffers {
+			C.ggml_backend_buffer_free(b)
+			C.ggml_free(ctx)
+		}
+	}
+
+	for _, cv := range b.controlVectors {
+		for ctx, b := range cv.buffers {
+			C.ggml_backend_buffer_free(b)
+			C.ggml_free(ctx)
+		}
+	}
+
 	C.ggml_backend_sched_free(b.sched)
 }
 
@@ -648,6 +689,46 @@ func (b *Backend) BackendMemory() ml.BackendMemory {
 	return *b.requiredMemory
 }
 
+// applyRopeOptions overrides the RoPE parameters in the model's metadata so
+// that models pick them up as if they had been converted with them
+func applyRopeOptions(kv fsggml.KV, opts ml.RopeOptions) {
+	set := func(key string, value any) {
+		kv[kv.Architecture()+"."+key] = value
+	}
+
+	if opts.ScalingType != "" {
+		set("rope.scaling.type", opts.ScalingType)
+	}
+
+	if opts.FreqBase != 0 {
+		set("rope.freq_base", opts.FreqBase)
+	}
+
+	if opts.ScalingFactor != 0 {
+		set("rope.scaling.factor", opts.ScalingFactor)
+	}
+
+	if opts.OriginalContextLength != 0 {
+		set("rope.scaling.original_context_length", uint32(opts.OriginalContextLength))
+	}
+
+	if opts.ExtrapolationFactor != 0 {
+		set("rope.scaling.extrapolation_factor", opts.ExtrapolationFactor)
+	}
+
+	if opts.AttentionFactor != 0 {
+		set("rope.scaling.attn_factor", opts.AttentionFactor)
+	}
+
+	if opts.BetaFast != 0 {
+		set("rope.scaling.beta_fast", opts.BetaFast)
+	}
+
+	if opts.BetaSlow != 0 {
+		set("rope.scaling.beta_slow", opts.BetaSlow)
+	}
+}
+
 func (b *Backend) Config() fs.Config {
 	return b.meta.KV()
 }
@@ -759,6 +840,16 @@ type Context struct {
 
 	// layer is the graph layer that this context is allocating for - assumed to be cache
 	layer int
+
+	// host is set if this context is allocating cache in system memory
+	host bool
+
+	// loras are the LoRA adapters applied to weights in this graph
+	loras []ml.Lora
+
+	// controlVectors are the control vectors applied to layer outputs in
+	// this graph
+	controlVectors []ml.ControlVector
 }
 
 func (c *Context) Input() ml.Context {
@@ -770,6 +861,26 @@ func (c *Context) Input() ml.Context {
 			allocatedBuffers: c.allocatedBuffers,
 			maxGraphNodes:    c.maxGraphNodes,
 			layer:            -1,
+			loras:            c.loras,
+			controlVectors:   c.controlVectors,
+		}
+	}
+
+	return c
+}
+
+func (c *Context) Host() ml.Context {
+	if c.b.input != nil {
+		return &Context{
+			b:                c.b,
+			ctx:              c.ctx,
+			buft:             c.b.input,
+			allocatedBuffers: c.allocatedBuffers,
+			maxGraphNodes:    c.maxGraphNodes,
+			layer:            -1,
+			host:             true,
+			loras:            c.loras,
+			controlVectors:   c.controlVectors,
 		}
 	}
 
@@ -785,6 +896,8 @@ func (c *Context) Layer(i int) ml.Context {
 			allocatedBuffers: c.allocatedBuffers,
 			maxGraphNodes:    c.maxGraphNodes,
 			layer:            i,
+			loras:            c.loras,
+			controlVectors:   c.controlVectors,
 		}
 	}
 
@@ -910,7 +1023,9 @@ func (c *Context) newTensor(dtype ml.DType, shape []int) *Tensor {
 	size := pad(C.ggml_backend_buft_get_alloc_size(c.buft, t), C.ggml_backend_buft_get_alignment(c.buft))
 
 	b := C.ggml_backend_buft_alloc_buffer(c.buft, size)
-	if c.layer >= 0 {
+	if c.host {
+		c.b.requiredMemory.HostCache += uint64(size)
+	} else if c.layer >= 0 {
 		c.b.btDeviceMemory[c.buft].Cache[c.layer] += uint64(size)
 	}
 
@@ -1242,9 +1357,15 @@ func (t *Tensor) Div(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
 //
 // Note: this is similar to matmul(t2, t.tranpose(-1, -2)) in other libraries.
 func (t *Tensor) Mulmat(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
+	c := ctx.(*Context)
+	mul := C.ggml_mul_mat(c.ctx, t.t, t2.(*Tensor).t)
+	if len(c.loras) > 0 {
+		mul = t.b.applyLoras(c, t.t, t2.(*Tensor).t, mul)
+	}
+
 	return &Tensor{
 		b: t.b,
-		t: C.ggml_mul_mat(ctx.(*Context).ctx, t.t, t2.(*Tensor).t),
+		t: mul,
 	}
 }
 
@@ -1624,6 +1745,13 @@ func (t *Tensor) SILUAlphaLimit(ctx ml.Context, up ml.Tensor, alpha, limit float
 	}
 }
 
+func (t *Tensor) Conv1D(ctx ml.Context, t2 ml.Tensor, s0, p0, d0 int) ml.Tensor {
+	return &Tensor{
+		b: t.b,
+		t: C.ggml_conv_1d(ctx.(*Context).ctx, t.t, t2.(*Tensor).t, C.int(s0), C.int(p0), C.int(d0)),
+	}
+}
+
 func (t *Tensor) Conv2D(ctx ml.Context, t2 ml.Tensor, s0, s1, p0, p1, d0, d1 int) ml.Tensor {
 	return &Tensor{
 		b: t.b,
@@ -1648,6 +1776,16 @@ func (t *Tensor) SSMConv(ctx ml.Context, kernel ml.Tensor) ml.Tensor {
 	}
 }
 
+// SSMScan runs the selective scan of Mamba over x using the states in t
+// selected by ids. The result is the output of the scan followed by the
+// final state of each sequence.
+func (t *Tensor) SSMScan(ctx ml.Context, x, dt, a, b, c, ids ml.Tensor) ml.Tensor {
+	return &Tensor{
+		b: t.b,
+		t: C.ggml_ssm_scan(ctx.(*Context).ctx, t.t, x.(*Tensor).t, dt.(*Tensor).t, a.(*Tensor).t, b.(*Tensor).t, c.(*Tensor).t, ids.(*Tensor).t),
+	}
+}
+
 func (t *Tensor) AvgPool2D(ctx ml.Context, k, s int, p float32) ml.Tensor {
 	return &Tensor{
 		b: t.b,
@@ -1,6 +1,8 @@
 package ggml
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -1080,3 +1082,330 @@ func TestChunk(t *testing.T) {
 		})
 	}
 }
+
+func TestHostMemory(t *testing.T) {
+	ctx := setup(t)
+	ctx.Host().Zeros(ml.DTypeF16, 64, 4, 8)
+
+	memory := ctx.(*Context).b.requiredMemory
+	if memory.HostCache < 64*4*8*2 {
+		t.Errorf("expected at least %d bytes of host cache, got %d", 64*4*8*2, memory.HostCache)
+	}
+
+	for i, size := range memory.CPU.Cache {
+		if size != 0 {
+			t.Errorf("expected no cache for layer %d, got %d", i, size)
+		}
+	}
+}
+
+func TestLora(t *testing.T) {
+	writeGGUF := func(kv ggml.KV, tensors map[string][]float32, shapes map[string][]uint64) string {
+		f, err := os.CreateTemp(t.TempDir(), "*.gguf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var ts []*ggml.Tensor
+		for name, data := range tensors {
+			var b bytes.Buffer
+			if err := binary.Write(&b, binary.LittleEndian, data); err != nil {
+				t.Fatal(err)
+			}
+
+			ts = append(ts, &ggml.Tensor{Name: name, Kind: 0, Shape: shapes[name], WriterTo: &b})
+		}
+
+		if err := ggml.WriteGGUF(f, kv, ts); err != nil {
+			t.Fatal(err)
+		}
+
+		return f.Name()
+	}
+
+	model := writeGGUF(ggml.KV{
+		"general.architecture": "test",
+		"test.block_count":     uint32(1),
+	}, map[string][]float32{
+		"blk.0.attn_q.weight": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	}, map[string][]uint64{
+		"blk.0.attn_q.weight": {4, 3},
+	})
+
+	// a sums the inputs into the first rank and b copies it to every output,
+	// with alpha / rank = 1
+	adapter := writeGGUF(ggml.KV{
+		"general.architecture": "test",
+		"general.type":         "adapter",
+		"adapter.type":         "lora",
+		"adapter.lora.alpha":   float32(2),
+	}, map[string][]float32{
+		"blk.0.attn_q.weight.lora_a": {1, 1, 1, 1, 0, 0, 0, 0},
+		"blk.0.attn_q.weight.lora_b": {1, 0, 1, 0, 1, 0},
+	}, map[string][]uint64{
+		"blk.0.attn_q.weight.lora_a": {4, 2},
+		"blk.0.attn_q.weight.lora_b": {2, 3},
+	})
+
+	b, err := ml.NewBackend(model, ml.BackendParams{AllocMemory: true, MaxAdapters: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := b.Load(t.Context(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := b.(ml.BackendLoras).LoadLora(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.(ml.BackendLoras).LoadLora(model); err == nil {
+		t.Error("expected an error loading a model as an adapter")
+	}
+
+	if _, err := b.(ml.BackendLoras).LoadLora(adapter); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.(ml.BackendLoras).LoadLora(adapter); err == nil {
+		t.Error("expected an error loading more than MaxAdapters adapters")
+	}
+
+	cases := []struct {
+		name  string
+		loras func(ml.Context) []ml.Lora
+		want  []float32
+	}{
+		{
+			name:  "None",
+			loras: func(ml.Context) []ml.Lora { return nil },
+			want:  []float32{6, 22, 38, 14, 38, 62},
+		},
+		{
+			name: "Scale",
+			loras: func(ml.Context) []ml.Lora {
+				return []ml.Lora{{Adapter: index, Scale: 0.5}}
+			},
+			want: []float32{8, 24, 40, 17, 41, 65},
+		},
+		{
+			name: "Mask",
+			loras: func(ctx ml.Context) []ml.Lora {
+				return []ml.Lora{{Adapter: index, Scale: 0.5, Mask: ctx.Input().FromFloats([]float32{1, 0}, 1, 2)}}
+			},
+			want: []float32{8, 24, 40, 14, 38, 62},
+		},
+		{
+			name: "OutputMask",
+			loras: func(ctx ml.Context) []ml.Lora {
+				return []ml.Lora{{
+					Adapter:    index,
+					Scale:      0.5,
+					Mask:       ctx.Input().FromFloats([]float32{0, 1, 0}, 1, 3),
+					OutputMask: ctx.Input().FromFloats([]float32{1, 0}, 1, 2),
+				}}
+			},
+			want: []float32{8, 24, 40, 14, 38, 62},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := b.NewContext()
+			defer ctx.Close()
+
+			ctx.SetLoras(tt.loras(ctx))
+			x := ctx.Input().FromFloats([]float32{1, 1, 1, 1, 0, 1, 2, 3}, 4, 2)
+			out := b.Get("blk.0.attn_q.weight").Mulmat(ctx.Layer(0), x)
+			ctx.Forward(out).Compute(out)
+
+			if diff := cmp.Diff(tt.want, out.Floats()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("MismatchedMask", func(t *testing.T) {
+		ctx := b.NewContext()
+		defer ctx.Close()
+
+		ctx.SetLoras([]ml.Lora{{Adapter: index, Scale: 0.5, Mask: ctx.Input().FromFloats([]float32{1, 0, 1}, 1, 3)}})
+		x := ctx.Input().FromFloats([]float32{1, 1, 1, 1, 0, 1, 2, 3}, 4, 2)
+
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic for a mask that matches neither the batch nor the outputs")
+			}
+		}()
+
+		b.Get("blk.0.attn_q.weight").Mulmat(ctx.Layer(0), x)
+	})
+}
+
+func TestControlVector(t *testing.T) {
+	writeGGUF := func(kv ggml.KV, tensors map[string][]float32, shapes map[string][]uint64) string {
+		f, err := os.CreateTemp(t.TempDir(), "*.gguf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var ts []*ggml.Tensor
+		for name, data := range tensors {
+			var b bytes.Buffer
+			if err := binary.Write(&b, binary.LittleEndian, data); err != nil {
+				t.Fatal(err)
+			}
+
+			ts = append(ts, &ggml.Tensor{Name: name, Kind: 0, Shape: shapes[name], WriterTo: &b})
+		}
+
+		if err := ggml.WriteGGUF(f, kv, ts); err != nil {
+			t.Fatal(err)
+		}
+
+		return f.Name()
+	}
+
+	model := writeGGUF(ggml.KV{
+		"general.architecture":  "test",
+		"test.block_count":      uint32(2),
+		"test.embedding_length": uint32(2),
+	}, map[string][]float32{
+		"blk.0.attn_q.weight": {1, 0, 0, 1},
+		"blk.1.attn_q.weight": {1, 0, 0, 1},
+	}, map[string][]uint64{
+		"blk.0.attn_q.weight": {2, 2},
+		"blk.1.attn_q.weight": {2, 2},
+	})
+
+	vector := writeGGUF(ggml.KV{
+		"general.architecture":      "controlvector",
+		"controlvector.model_hint":  "test",
+		"controlvector.layer_count": uint32(1),
+	}, map[string][]float32{
+		"direction.1": {1, 2},
+	}, map[string][]uint64{
+		"direction.1": {2},
+	})
+
+	wrongSize := writeGGUF(ggml.KV{
+		"general.architecture": "controlvector",
+	}, map[string][]float32{
+		"direction.1": {1, 2, 3},
+	}, map[string][]uint64{
+		"direction.1": {3},
+	})
+
+	b, err := ml.NewBackend(model, ml.BackendParams{AllocMemory: true, MaxAdapters: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := b.Load(t.Context(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := b.(ml.BackendControlVectors).LoadControlVector(vector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{model, wrongSize} {
+		if _, err := b.(ml.BackendControlVectors).LoadControlVector(path); err == nil {
+			t.Errorf("expected an error loading %s as a control vector", path)
+		}
+	}
+
+	// control vectors share the limit with LoRA adapters
+	if _, err := b.(ml.BackendControlVectors).LoadControlVector(vector); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.(ml.BackendControlVectors).LoadControlVector(vector); err == nil {
+		t.Error("expected an error loading more than MaxAdapters control vectors")
+	}
+
+	cases := []struct {
+		name    string
+		layer   int
+		inputs  int
+		vectors func(ml.Context) []ml.ControlVector
+		want    []float32
+	}{
+		{
+			name:    "None",
+			layer:   1,
+			inputs:  2,
+			vectors: func(ml.Context) []ml.ControlVector { return nil },
+			want:    []float32{0, 1, 2, 3},
+		},
+		{
+			name:   "Strength",
+			layer:  1,
+			inputs: 2,
+			vectors: func(ml.Context) []ml.ControlVector {
+				return []ml.ControlVector{{Vector: index, Strength: -0.5}}
+			},
+			want: []float32{-0.5, 0, 1.5, 2},
+		},
+		{
+			name:   "OtherLayer",
+			layer:  0,
+			inputs: 2,
+			vectors: func(ml.Context) []ml.ControlVector {
+				return []ml.ControlVector{{Vector: index, Strength: 1}}
+			},
+			want: []float32{0, 1, 2, 3},
+		},
+		{
+			name:   "Mask",
+			layer:  1,
+			inputs: 2,
+			vectors: func(ctx ml.Context) []ml.ControlVector {
+				return []ml.ControlVector{{
+					Vector:     index,
+					Strength:   1,
+					Mask:       ctx.Input().FromFloats([]float32{0, 2}, 1, 2),
+					OutputMask: ctx.Input().FromFloats([]float32{2}, 1, 1),
+				}}
+			},
+			want: []float32{0, 1, 4, 7},
+		},
+		{
+			name:   "OutputMask",
+			layer:  1,
+			inputs: 1,
+			vectors: func(ctx ml.Context) []ml.ControlVector {
+				return []ml.ControlVector{{
+					Vector:     index,
+					Strength:   1,
+					Mask:       ctx.Input().FromFloats([]float32{0, 2}, 1, 2),
+					OutputMask: ctx.Input().FromFloats([]float32{2}, 1, 1),
+				}}
+			},
+			want: []float32{2, 5},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := b.NewContext()
+			defer ctx.Close()
+
+			ctx.SetControlVectors(tt.vectors(ctx))
+			x := ctx.Input().FromFloats([]float32{0, 1, 2, 3}[:2*tt.inputs], 2, tt.inputs)
+			out := ctx.ApplyControlVectors(tt.layer, b.Get("blk.0.attn_q.weight").Mulmat(ctx, x))
+			ctx.Forward(out).Compute(out)
+
+			if diff := cmp.Diff(tt.want, out.Floats()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
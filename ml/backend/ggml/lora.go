@@ -0,0 +1,268 @@
+package ggml
+
+// #include <stdlib.h>
+// #include "ggml.h"
+// #include "ggml-backend.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"unsafe"
+
+	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+)
+
+// loraWeight is the pair of low rank matrices that an adapter adds to a weight
+type loraWeight struct {
+	adapter int
+	a, b    *C.struct_ggml_tensor
+
+	// scale is alpha / rank, or 1 if the adapter doesn't specify alpha
+	scale float32
+}
+
+// adapterGraphNodes is the most graph nodes that a LoRA adapter adds for a
+// weight, or a control vector adds for a layer
+const adapterGraphNodes = 7
+
+// loraAdapter holds the memory for a loaded adapter's weights
+type loraAdapter struct {
+	path    string
+	buffers map[*C.struct_ggml_context]C.ggml_backend_buffer_t
+}
+
+// LoadLora loads a LoRA adapter created by converting a safetensors adapter
+// for this model's architecture. Each pair of adapter weights is placed on
+// the same device as the weight it modifies.
+//
+// LoadLora must not be called while graphs are being built.
+func (b *Backend) LoadLora(path string) (int, error) {
+	if err := b.checkAdapters(); err != nil {
+		return 0, err
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	meta, err := fsggml.Decode(r, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	kv := meta.KV()
+	if kv.String("general.type") != "adapter" || kv["adapter.type"] != "lora" {
+		return 0, fmt.Errorf("%s is not a LoRA adapter", path)
+	}
+
+	if arch := kv.Architecture(); arch != b.meta.KV().Architecture() {
+		return 0, fmt.Errorf("LoRA adapter is for %s but the model is %s", arch, b.meta.KV().Architecture())
+	}
+
+	alpha, _ := kv["adapter.lora.alpha"].(float32)
+	index := len(b.loraAdapters)
+
+	type pair struct{ a, b *fsggml.Tensor }
+	pairs := make(map[string]*pair)
+	for _, t := range meta.Tensors().Items() {
+		name, ok := strings.CutSuffix(t.Name, ".lora_a")
+		if !ok {
+			name, ok = strings.CutSuffix(t.Name, ".lora_b")
+			if !ok {
+				return 0, fmt.Errorf("unexpected tensor in LoRA adapter: %s", t.Name)
+			}
+		}
+
+		p, ok := pairs[name]
+		if !ok {
+			p = &pair{}
+			pairs[name] = p
+		}
+
+		if strings.HasSuffix(t.Name, ".lora_a") {
+			p.a = t
+		} else {
+			p.b = t
+		}
+	}
+
+	weights := make(map[*C.struct_ggml_tensor]*pair)
+	bufts := make(map[*fsggml.Tensor]C.ggml_backend_buffer_type_t)
+	for name, p := range pairs {
+		if p.a == nil || p.b == nil {
+			return 0, fmt.Errorf("LoRA adapter is missing half of %s", name)
+		}
+
+		w, ok := b.tensors[name]
+		if !ok {
+			return 0, fmt.Errorf("LoRA adapter modifies %s which is not in the model", name)
+		}
+
+		// the delta to the output is b * (a * x), so a is [in, rank] and b
+		// is [rank, out] for a weight that is [in, out]
+		if len(p.a.Shape) != 2 || len(p.b.Shape) != 2 ||
+			p.a.Shape[0] != uint64(w.ne[0]) || p.b.Shape[1] != uint64(w.ne[1]) || p.a.Shape[1] != p.b.Shape[0] {
+			return 0, fmt.Errorf("LoRA adapter shapes %v and %v don't match %s %v", p.a.Shape, p.b.Shape, name, []int64{int64(w.ne[0]), int64(w.ne[1])})
+		}
+
+		// weights may be in a buffer type specific to their format so use
+		// the default for the device instead
+		bt := C.ggml_backend_buffer_get_type(w.buffer)
+		if d := C.ggml_backend_buft_get_device(bt); d != nil {
+			bt = C.ggml_backend_dev_buffer_type(d)
+		}
+
+		weights[w] = p
+		bufts[p.a] = bt
+		bufts[p.b] = bt
+	}
+
+	tensors, buffers, err := loadTensors(r, meta, bufts, fmt.Sprintf("lora.%d.", index))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load LoRA adapter %s: %w", path, err)
+	}
+
+	for w, p := range weights {
+		lw := loraWeight{
+			adapter: index,
+			a:       tensors[p.a],
+			b:       tensors[p.b],
+			scale:   1,
+		}
+
+		if alpha != 0 {
+			lw.scale = alpha / float32(p.a.Shape[1])
+		}
+
+		b.loraWeights[w] = append(b.loraWeights[w], lw)
+	}
+	b.loraAdapters = append(b.loraAdapters, loraAdapter{path: path, buffers: buffers})
+
+	slog.Info("loaded LoRA adapter", "path", path, "index", index, "weights", len(weights), "alpha", alpha)
+	return index, nil
+}
+
+// checkAdapters returns an error if graphs don't have room for another LoRA
+// adapter or control vector
+func (b *Backend) checkAdapters() error {
+	if len(b.loraAdapters)+len(b.controlVectors) >= b.maxAdapters {
+		return fmt.Errorf("no more than %d LoRA adapters and control vectors can be loaded into a model", b.maxAdapters)
+	}
+
+	return nil
+}
+
+// loadTensors allocates the tensors of an adapter in the given buffer types
+// and reads their data from r. Tensor names are prefixed with prefix to
+// identify them in graphs.
+func loadTensors(r io.ReaderAt, meta *fsggml.GGML, bufts map[*fsggml.Tensor]C.ggml_backend_buffer_type_t, prefix string) (map[*fsggml.Tensor]*C.struct_ggml_tensor, map[*C.struct_ggml_context]C.ggml_backend_buffer_t, error) {
+	ctxs := make(map[C.ggml_backend_buffer_type_t]*C.struct_ggml_context)
+	buffers := make(map[*C.struct_ggml_context]C.ggml_backend_buffer_t)
+	free := func() {
+		for _, buf := range buffers {
+			C.ggml_backend_buffer_free(buf)
+		}
+
+		for _, c := range ctxs {
+			C.ggml_free(c)
+		}
+	}
+
+	tensors := make(map[*fsggml.Tensor]*C.struct_ggml_tensor)
+	for t, bt := range bufts {
+		if _, ok := ctxs[bt]; !ok {
+			ctxs[bt] = C.ggml_init(C.struct_ggml_init_params{
+				mem_size: C.ggml_tensor_overhead() * C.size_t(len(bufts)),
+				no_alloc: true,
+			})
+		}
+
+		tt := C.ggml_new_tensor(ctxs[bt], t.Kind, C.int(len(t.Shape)), (*C.int64_t)(unsafe.Pointer(&t.Shape[0])))
+		cname := C.CString(prefix + t.Name)
+		C.ggml_set_name(tt, cname)
+		C.free(unsafe.Pointer(cname))
+		tensors[t] = tt
+	}
+
+	for bt, c := range ctxs {
+		buf := C.ggml_backend_alloc_ctx_tensors_from_buft(c, bt)
+		if buf == nil {
+			free()
+			return nil, nil, errors.New("failed to allocate memory")
+		}
+
+		C.ggml_backend_buffer_set_usage(buf, C.GGML_BACKEND_BUFFER_USAGE_WEIGHTS)
+		buffers[c] = buf
+	}
+
+	for t, tt := range tensors {
+		sr := io.NewSectionReader(r, int64(meta.Tensors().Offset+t.Offset), int64(t.Size()))
+		bts := make([]byte, t.Size())
+		if _, err := io.ReadFull(sr, bts); err != nil {
+			free()
+			return nil, nil, err
+		}
+
+		C.ggml_backend_tensor_set(tt, unsafe.Pointer(&bts[0]), 0, C.size_t(len(bts)))
+	}
+
+	return tensors, buffers, nil
+}
+
+// applyLoras adds the output of the LoRA adapters selected in ctx for weight
+// w to out, which is the product of w and x
+func (b *Backend) applyLoras(ctx *Context, w, x, out *C.struct_ggml_tensor) *C.struct_ggml_tensor {
+	weights := b.loraWeights[w]
+	if len(weights) == 0 {
+		return out
+	}
+
+	for _, l := range ctx.loras {
+		for _, lw := range weights {
+			if lw.adapter != l.Adapter {
+				continue
+			}
+
+			delta := C.ggml_mul_mat(ctx.ctx, lw.b, C.ggml_mul_mat(ctx.ctx, lw.a, x))
+			delta = C.ggml_scale(ctx.ctx, delta, C.float(lw.scale*l.Scale))
+
+			if l.Mask != nil {
+				// the inputs either line up with the batch or, after the
+				// model has dropped the inputs that aren't outputs, with
+				// the outputs
+				n := x.ne[1] * x.ne[2] * x.ne[3]
+
+				var mask *C.struct_ggml_tensor
+				if m := l.Mask.(*Tensor).t; m.ne[1] == n {
+					mask = m
+				} else if l.OutputMask != nil && l.OutputMask.(*Tensor).t.ne[1] == n {
+					mask = l.OutputMask.(*Tensor).t
+				} else {
+					// skipping the adapter would silently apply it to none
+					// of the inputs
+					panic(fmt.Errorf("LoRA adapter mask has %v inputs but the weight has %v", m.ne[1], n))
+				}
+
+				masked := C.ggml_mul(ctx.ctx, C.ggml_reshape_2d(ctx.ctx, delta, delta.ne[0], n), mask)
+				delta = C.ggml_reshape_4d(ctx.ctx, masked, delta.ne[0], delta.ne[1], delta.ne[2], delta.ne[3])
+			}
+
+			out = C.ggml_add(ctx.ctx, out, delta)
+		}
+	}
+
+	return out
+}
+
+// SetLoras selects the LoRA adapters to apply when building the graph
+func (c *Context) SetLoras(loras []ml.Lora) {
+	c.loras = loras
+}
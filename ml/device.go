@@ -209,6 +209,10 @@ type BackendMemory struct {
 	// InputWeights are always located on the CPU and cannot be moved
 	InputWeights uint64
 
+	// HostCache is the part of the KV cache that is kept in system memory
+	// regardless of where its layers are located
+	HostCache uint64
+
 	// CPU model components are located in system memory. This does not
 	// include unified memory allocated through the GPU.
 	CPU DeviceMemory
@@ -223,6 +227,10 @@ func (m BackendMemory) LogValue() slog.Value {
 		attrs = append(attrs, slog.Any("InputWeights", m.InputWeights))
 	}
 
+	if m.HostCache != 0 {
+		attrs = append(attrs, slog.Any("HostCache", m.HostCache))
+	}
+
 	attrs = append(attrs, slog.Any(m.CPU.Name, m.CPU))
 	for _, g := range m.GPUs {
 		attrs = append(attrs, slog.Any(g.Name, g))
@@ -252,7 +260,7 @@ func (m BackendMemory) Log(level slog.Level) {
 			total += sum
 		}
 	}
-	if sum := sumMemory(m.CPU.Cache); sum > 0 {
+	if sum := m.HostCache + sumMemory(m.CPU.Cache); sum > 0 {
 		slog.Log(context.TODO(), level, "kv cache", "device", m.CPU.Name, "size", format.HumanBytes2(sum))
 		total += sum
 	}
@@ -2,6 +2,20 @@ package nn
 
 import "github.com/ollama/ollama/ml"
 
+type Conv1D struct {
+	Weight ml.Tensor `gguf:"weight"`
+	Bias   ml.Tensor `gguf:"bias"`
+}
+
+func (m *Conv1D) Forward(ctx ml.Context, t ml.Tensor, s0, p0, d0 int) ml.Tensor {
+	t = m.Weight.Conv1D(ctx, t, s0, p0, d0)
+	if m.Bias != nil {
+		// Bias shape is (out_channels,) while t shape is (length, out_channels, batch)
+		t = t.Add(ctx, m.Bias.Reshape(ctx, 1, -1))
+	}
+	return t
+}
+
 type Conv2D struct {
 	Weight ml.Tensor `gguf:"weight"`
 	Bias   ml.Tensor `gguf:"bias"`
@@ -11,6 +11,7 @@ const (
 	TypeMean
 	TypeCLS
 	TypeLast
+	TypeRank
 )
 
 func (t Type) String() string {
@@ -21,6 +22,8 @@ func (t Type) String() string {
 		return "CLS"
 	case TypeLast:
 		return "Last"
+	case TypeRank:
+		return "Rank"
 	default:
 		return "Unknown"
 	}
@@ -31,7 +34,7 @@ func (t Type) Forward(ctx ml.Context, hiddenStates ml.Tensor) ml.Tensor {
 	case TypeMean:
 		hiddenStates = hiddenStates.Permute(ctx, 1, 0, 2, 3).Contiguous(ctx).Mean(ctx)
 		return hiddenStates.Permute(ctx, 1, 0, 2, 3).Contiguous(ctx)
-	case TypeCLS:
+	case TypeCLS, TypeRank:
 		return hiddenStates.Slice(ctx, 1, 0, 1, 1)
 	case TypeLast:
 		return hiddenStates.Slice(ctx, 1, hiddenStates.Dim(1)-1, hiddenStates.Dim(1), 1)
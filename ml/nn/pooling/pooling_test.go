@@ -43,6 +43,7 @@ func TestForward(t *testing.T) {
 		pooling.TypeMean: {4, 5, 6, 7, 8, 9, 10, 11},
 		pooling.TypeCLS:  {0, 1, 2, 3, 4, 5, 6, 7},
 		pooling.TypeLast: {8, 9, 10, 11, 12, 13, 14, 15},
+		pooling.TypeRank: {0, 1, 2, 3, 4, 5, 6, 7},
 	}
 	for typ, want := range cases {
 		t.Run(typ.String(), func(t *testing.T) {
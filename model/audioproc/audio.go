@@ -0,0 +1,162 @@
+// Package audioproc decodes audio attachments to mono samples for audio
+// models.
+package audioproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrUnsupportedFormat is returned for audio that is not WAV or FLAC.
+var ErrUnsupportedFormat = errors.New("unsupported audio format, expected WAV or FLAC")
+
+const (
+	// MinSampleRate and MaxSampleRate bound the sample rates Decode accepts.
+	MinSampleRate = 8000
+	MaxSampleRate = 192000
+
+	// MaxDuration is the longest audio Decode accepts.
+	MaxDuration = time.Hour
+
+	// maxSamples bounds the decoded samples across all channels, so a
+	// small compressed file can't expand to fill memory.
+	maxSamples = 1 << 28
+)
+
+// checkSize returns an error if audio with the given format and length is
+// outside the limits Decode accepts. It is called before samples are
+// allocated.
+func checkSize(sampleRate, channels, frames int) error {
+	if sampleRate < MinSampleRate || sampleRate > MaxSampleRate {
+		return fmt.Errorf("unsupported sample rate %d Hz, expected %d to %d Hz", sampleRate, MinSampleRate, MaxSampleRate)
+	}
+
+	if frames > int(MaxDuration.Seconds())*sampleRate || frames*channels > maxSamples {
+		return fmt.Errorf("audio is longer than %v", MaxDuration)
+	}
+
+	return nil
+}
+
+// Decode decodes WAV or FLAC audio, mixing multiple channels down to mono.
+// Samples are between -1 and 1.
+func Decode(data []byte) (samples []float32, sampleRate int, err error) {
+	var channels [][]float32
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		channels, sampleRate, err = decodeWAV(data)
+	case len(data) >= 4 && string(data[:4]) == "fLaC":
+		channels, sampleRate, err = decodeFLAC(data)
+	default:
+		return nil, 0, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return mix(channels), sampleRate, nil
+}
+
+// mix averages channels into a single channel.
+func mix(channels [][]float32) []float32 {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+
+	samples := make([]float32, len(channels[0]))
+	for _, c := range channels {
+		for i, s := range c {
+			samples[i] += s
+		}
+	}
+
+	scale := 1 / float32(len(channels))
+	for i := range samples {
+		samples[i] *= scale
+	}
+	return samples
+}
+
+// Resample converts samples from one sample rate to another with a windowed
+// sinc filter, removing frequencies above the Nyquist frequency of the lower
+// rate. Rates are expected to be between MinSampleRate and MaxSampleRate, as
+// returned by Decode.
+func Resample(samples []float32, from, to int) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+
+	// zero crossings on each side of the filter
+	const width = 16
+
+	ratio := float64(to) / float64(from)
+	cutoff := min(1, ratio)
+	radius := width / cutoff
+
+	out := make([]float32, int(math.Ceil(float64(len(samples))*ratio)))
+	for i := range out {
+		center := float64(i) / ratio
+		lo := max(int(math.Ceil(center-radius)), 0)
+		hi := min(int(math.Floor(center+radius)), len(samples)-1)
+
+		var sum, weights float64
+		for j := lo; j <= hi; j++ {
+			x := float64(j) - center
+			w := cutoff * sinc(cutoff*x) * hann(x/radius)
+			sum += w * float64(samples[j])
+			weights += w
+		}
+
+		if weights != 0 {
+			out[i] = float32(sum / weights)
+		}
+	}
+
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// hann is a Hann window over [-1, 1].
+func hann(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.5 + 0.5*math.Cos(math.Pi*x)
+}
+
+// EncodeWAV encodes mono samples as a 32-bit float WAV file.
+func EncodeWAV(samples []float32, sampleRate int) []byte {
+	var b bytes.Buffer
+	size := 4 * len(samples)
+
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+size))
+	b.WriteString("WAVE")
+
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, struct {
+		Size          uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{16, wavFormatFloat, 1, uint32(sampleRate), uint32(4 * sampleRate), 4, 32})
+
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(size))
+	binary.Write(&b, binary.LittleEndian, samples)
+
+	return b.Bytes()
+}
@@ -0,0 +1,380 @@
+package audioproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func wav(format, channels, sampleRate, bitsPerSample int, samples any) []byte {
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+data.Len()))
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, struct {
+		Size          uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{
+		16, uint16(format), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * bitsPerSample / 8), uint16(channels * bitsPerSample / 8), uint16(bitsPerSample),
+	})
+	// chunks that aren't needed are skipped
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	b.Write([]byte{1, 2, 3, 0})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(data.Len()))
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestDecodeWAV(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want []float32
+	}{
+		{
+			name: "8 bit",
+			data: wav(wavFormatPCM, 1, 8000, 8, []uint8{128, 192, 0}),
+			want: []float32{0, 0.5, -1},
+		},
+		{
+			name: "16 bit stereo",
+			data: wav(wavFormatPCM, 2, 8000, 16, []int16{16384, 0, -32768, -16384}),
+			want: []float32{0.25, -0.75},
+		},
+		{
+			name: "24 bit",
+			data: wav(wavFormatPCM, 1, 8000, 24, []uint8{0, 0, 0x40, 0, 0, 0xc0}),
+			want: []float32{0.5, -0.5},
+		},
+		{
+			name: "32 bit float",
+			data: EncodeWAV([]float32{0.125, -1}, 8000),
+			want: []float32{0.125, -1},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, sampleRate, err := Decode(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sampleRate != 8000 {
+				t.Errorf("expected sample rate 8000, got %d", sampleRate)
+			}
+			if diff := cmp.Diff(tt.want, samples); diff != "" {
+				t.Errorf("samples mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, _, err := Decode(wav(wavFormatPCM, 1, 8000, 12, []uint8{0, 0})); err == nil {
+		t.Error("expected error for unsupported bit depth")
+	}
+
+	if _, _, err := Decode([]byte("ID3 not audio")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected unsupported format, got %v", err)
+	}
+
+	if _, _, err := Decode(EncodeWAV(make([]float32, 16), 1)); err == nil || !strings.Contains(err.Error(), "sample rate") {
+		t.Errorf("expected sample rate error, got %v", err)
+	}
+
+	if _, _, err := Decode(wav(wavFormatPCM, 1, MaxSampleRate+1, 8, []uint8{128})); err == nil || !strings.Contains(err.Error(), "sample rate") {
+		t.Errorf("expected sample rate error, got %v", err)
+	}
+}
+
+// bitWriter writes big endian bit fields for building FLAC streams.
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) write(v uint64, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, bits int) {
+	w.write(uint64(v)&(1<<bits-1), bits)
+}
+
+func (w *bitWriter) writeUnary(n int) {
+	for range n {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *bitWriter) align() {
+	w.n = (w.n + 7) / 8 * 8
+}
+
+// writeResidual rice codes residuals with a parameter for each partition, or
+// escapes the partition with raw samples if the parameter is 15.
+func (w *bitWriter) writeResidual(residual []int64, order int, params ...int) {
+	w.write(0, 2)
+	w.write(uint64(math.Log2(float64(len(params)))), 4)
+
+	n := (len(residual) + order) / len(params)
+	for p, k := range params {
+		part := residual[max(p*n-order, 0) : (p+1)*n-order]
+
+		w.write(uint64(k), 4)
+		if k == 15 {
+			w.write(20, 5)
+			for _, v := range part {
+				w.writeSigned(v, 20)
+			}
+			continue
+		}
+
+		for _, v := range part {
+			u := uint64(v<<1 ^ v>>63)
+			w.writeUnary(int(u >> k))
+			w.write(u&(1<<k-1), k)
+		}
+	}
+}
+
+func (w *bitWriter) writePrediction(samples []int64, bps int, coefficients []int64, shift int, params ...int) {
+	order := len(coefficients)
+	residual := make([]int64, 0, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, c := range coefficients {
+			prediction += c * samples[i-1-j]
+		}
+		residual = append(residual, samples[i]-prediction>>shift)
+	}
+
+	w.writeResidual(residual, order, params...)
+}
+
+func (w *bitWriter) writeFixed(samples []int64, bps, order int, params ...int) {
+	w.write(uint64(8+order)<<1, 8)
+	for _, s := range samples[:order] {
+		w.writeSigned(s, bps)
+	}
+
+	w.writePrediction(samples, bps, fixedCoefficients[order], 0, params...)
+}
+
+func (w *bitWriter) writeLPC(samples []int64, bps int, coefficients []int64, shift int, params ...int) {
+	order := len(coefficients)
+	w.write(uint64(31+order)<<1, 8)
+	for _, s := range samples[:order] {
+		w.writeSigned(s, bps)
+	}
+
+	// 4 bit coefficients
+	w.write(3, 4)
+	w.writeSigned(int64(shift), 5)
+	for _, c := range coefficients {
+		w.writeSigned(c, 4)
+	}
+
+	w.writePrediction(samples, bps, coefficients, shift, params...)
+}
+
+func (w *bitWriter) frameHeader(frame int, blockSize int, channelCode int) {
+	w.write(0x7ffc, 15)
+	w.write(0, 1)
+	w.write(7, 4)
+	w.write(0, 4)
+	w.write(uint64(channelCode), 4)
+	w.write(0, 3)
+	w.write(0, 1)
+	w.write(uint64(frame), 8)
+	w.write(uint64(blockSize-1), 16)
+	w.write(0, 8)
+}
+
+func (w *bitWriter) frameFooter() {
+	w.align()
+	w.write(0, 16)
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	const blockSize = 32
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	var left, right []int64
+	for i := range 3 * blockSize {
+		l := int64(8000*math.Sin(float64(i)/5)) + rng.Int64N(64)
+		r := int64(6000*math.Cos(float64(i)/7)) + rng.Int64N(64)
+		left = append(left, l)
+		right = append(right, r&^1|l&1) // so the side channel has a wasted bit
+	}
+	for i := range blockSize {
+		left[i] = 100
+	}
+
+	w := &bitWriter{}
+	w.write(0x664c6143, 32) // fLaC
+
+	// stream info, with fewer samples than the frames hold
+	w.write(1<<7, 8)
+	w.write(34, 24)
+	w.write(blockSize, 16)
+	w.write(blockSize, 16)
+	w.write(0, 48)
+	w.write(44100, 20)
+	w.write(1, 3)
+	w.write(15, 5)
+	w.write(3*blockSize-2, 36)
+	w.write(0, 128)
+
+	// independent channels: constant and verbatim
+	w.frameHeader(0, blockSize, 1)
+	w.write(0, 8)
+	w.writeSigned(100, 16)
+	w.write(1<<1, 8)
+	for _, s := range right[:blockSize] {
+		w.writeSigned(s, 16)
+	}
+	w.frameFooter()
+
+	// left/side: fixed predictors, partitions and an escaped partition
+	l, r := left[blockSize:2*blockSize], right[blockSize:2*blockSize]
+	side := make([]int64, blockSize)
+	for i := range side {
+		side[i] = l[i] - r[i]
+	}
+	w.frameHeader(1, blockSize, 8)
+	w.writeFixed(l, 16, 2, 9, 8)
+	w.writeFixed(side, 17, 1, 15, 12)
+	w.frameFooter()
+
+	// mid/side: LPC and wasted bits
+	l, r = left[2*blockSize:], right[2*blockSize:]
+	mid := make([]int64, blockSize)
+	for i := range mid {
+		mid[i] = (l[i] + r[i]) >> 1
+		side[i] = l[i] - r[i]
+	}
+	w.frameHeader(2, blockSize, 10)
+	w.writeLPC(mid, 16, []int64{7, -3}, 2, 12)
+	w.write(1<<1|1, 8)
+	w.writeUnary(0)
+	halved := make([]int64, blockSize)
+	for i := range side {
+		halved[i] = side[i] >> 1
+	}
+	for _, s := range halved {
+		w.writeSigned(s, 16)
+	}
+	w.frameFooter()
+
+	channels, sampleRate, err := decodeFLAC(w.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sampleRate != 44100 {
+		t.Errorf("expected sample rate 44100, got %d", sampleRate)
+	}
+
+	for c, want := range [][]int64{left, right} {
+		got := make([]int64, len(channels[c]))
+		for i, s := range channels[c] {
+			got[i] = int64(s * 32768)
+		}
+		if diff := cmp.Diff(want[:3*blockSize-2], got); diff != "" {
+			t.Errorf("channel %d mismatch (-want +got):\n%s", c, diff)
+		}
+	}
+
+	// trailing tags are ignored but truncated streams are not
+	if _, _, err := decodeFLAC(append(w.data, "TAG"...)); err != nil {
+		t.Errorf("unexpected error with trailing data: %v", err)
+	}
+	if _, _, err := decodeFLAC(w.data[:50]); err == nil {
+		t.Error("expected error for truncated stream")
+	}
+
+	// limits are checked against the stream info before decoding frames
+	for _, tt := range []struct {
+		sampleRate, totalSamples int
+		want                     string
+	}{
+		{1, 0, "sample rate"},
+		{44100, 2 * 3600 * 44100, "longer than"},
+	} {
+		w := &bitWriter{}
+		w.write(0x664c6143, 32)
+		w.write(1<<7, 8)
+		w.write(34, 24)
+		w.write(blockSize, 16)
+		w.write(blockSize, 16)
+		w.write(0, 48)
+		w.write(uint64(tt.sampleRate), 20)
+		w.write(0, 3)
+		w.write(15, 5)
+		w.write(uint64(tt.totalSamples), 36)
+		w.write(0, 128)
+
+		if _, _, err := decodeFLAC(w.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected error containing %q, got %v", tt.want, err)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	tone := func(freq float64, sampleRate, n int) []float32 {
+		samples := make([]float32, n)
+		for i := range samples {
+			samples[i] = float32(math.Sin(2 * math.Pi * freq * float64(i) / float64(sampleRate)))
+		}
+		return samples
+	}
+
+	for _, from := range []int{8000, 22050, 44100, 48000} {
+		samples := Resample(tone(440, from, from/2), from, 16000)
+		if len(samples) != 8000 {
+			t.Errorf("%d: expected 8000 samples, got %d", from, len(samples))
+		}
+
+		want := tone(440, 16000, 8000)
+		// skip the edges where the filter is truncated
+		for i := 100; i < len(samples)-100; i++ {
+			if math.Abs(float64(samples[i]-want[i])) > 0.01 {
+				t.Errorf("%d: sample %d: expected %v, got %v", from, i, want[i], samples[i])
+				break
+			}
+		}
+	}
+
+	// frequencies above the new Nyquist frequency are removed
+	samples := Resample(tone(12000, 48000, 48000), 48000, 16000)
+	var sum float64
+	for _, s := range samples[100 : len(samples)-100] {
+		sum += float64(s * s)
+	}
+	if rms := math.Sqrt(sum / float64(len(samples)-200)); rms > 0.02 {
+		t.Errorf("expected the tone to be filtered, got rms %v", rms)
+	}
+}
@@ -0,0 +1,559 @@
+package audioproc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// bitReader reads big endian bit fields from a byte slice.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+var (
+	errUnexpectedEOF = errors.New("flac: unexpected end of data")
+	errFrameSync     = errors.New("flac: invalid frame sync code")
+)
+
+func (r *bitReader) read(n int) (uint64, error) {
+	if r.pos+n > 8*len(r.data) {
+		return 0, errUnexpectedEOF
+	}
+
+	var v uint64
+	for n > 0 {
+		b := r.data[r.pos/8]
+		offset := r.pos % 8
+		take := min(8-offset, n)
+
+		v = v<<take | uint64(b>>(8-offset-take))&(1<<take-1)
+		r.pos += take
+		n -= take
+	}
+	return v, nil
+}
+
+// readSigned reads an n bit two's complement integer.
+func (r *bitReader) readSigned(n int) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+
+	v, err := r.read(n)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// readUnary counts the zero bits before the next one bit.
+func (r *bitReader) readUnary() (int, error) {
+	var n int
+	for {
+		if r.pos >= 8*len(r.data) {
+			return 0, errUnexpectedEOF
+		}
+
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		r.pos++
+		if bit == 1 {
+			return n, nil
+		}
+		n++
+	}
+}
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) / 8 * 8
+}
+
+type flacStreamInfo struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  int
+}
+
+// decodeFLAC decodes a FLAC stream. Checksums are not verified.
+func decodeFLAC(data []byte) ([][]float32, int, error) {
+	r := &bitReader{data: data, pos: 32}
+
+	var info *flacStreamInfo
+	for {
+		last, err := r.read(1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		blockType, err := r.read(7)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		size, err := r.read(24)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		start := r.pos
+		if blockType == 0 {
+			info = &flacStreamInfo{}
+			// block sizes and frame sizes
+			if _, err := r.read(80); err != nil {
+				return nil, 0, err
+			}
+
+			fields := []*int{&info.sampleRate, &info.channels, &info.bitsPerSample, &info.totalSamples}
+			for i, n := range []int{20, 3, 5, 36} {
+				v, err := r.read(n)
+				if err != nil {
+					return nil, 0, err
+				}
+				*fields[i] = int(v)
+			}
+			info.channels++
+			info.bitsPerSample++
+		}
+
+		r.pos = start + 8*int(size)
+		if last == 1 {
+			break
+		}
+	}
+
+	if info == nil {
+		return nil, 0, errors.New("flac: missing stream info")
+	}
+
+	// the total is optional, so decoded frames are also checked as they
+	// are added
+	if err := checkSize(info.sampleRate, info.channels, info.totalSamples); err != nil {
+		return nil, 0, err
+	}
+
+	channels := make([][]float32, info.channels)
+	scale := 1 / float32(int64(1)<<(info.bitsPerSample-1))
+	for r.pos < 8*len(r.data) {
+		samples, err := decodeFLACFrame(r, info)
+		if (errors.Is(err, errUnexpectedEOF) || errors.Is(err, errFrameSync)) && len(channels[0]) > 0 {
+			// ignore a truncated final frame or trailing tags
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		if len(samples) != info.channels {
+			return nil, 0, errors.New("flac: channel count changed between frames")
+		}
+
+		if err := checkSize(info.sampleRate, info.channels, len(channels[0])+len(samples[0])); err != nil {
+			return nil, 0, err
+		}
+
+		for c := range channels {
+			for _, s := range samples[c] {
+				channels[c] = append(channels[c], float32(s)*scale)
+			}
+		}
+	}
+
+	if len(channels[0]) == 0 {
+		return nil, 0, errors.New("flac: no audio frames")
+	}
+
+	if info.totalSamples > 0 && info.totalSamples < len(channels[0]) {
+		for c := range channels {
+			channels[c] = channels[c][:info.totalSamples]
+		}
+	}
+
+	return channels, info.sampleRate, nil
+}
+
+const (
+	flacIndependent = iota
+	flacLeftSide
+	flacSideRight
+	flacMidSide
+)
+
+func decodeFLACFrame(r *bitReader, info *flacStreamInfo) ([][]int64, error) {
+	sync, err := r.read(15)
+	if err != nil {
+		return nil, err
+	}
+	if sync != 0x7ffc {
+		return nil, errFrameSync
+	}
+
+	// blocking strategy
+	if _, err := r.read(1); err != nil {
+		return nil, err
+	}
+
+	var header [4]uint64
+	for i, n := range []int{4, 4, 4, 3} {
+		if header[i], err = r.read(n); err != nil {
+			return nil, err
+		}
+	}
+	blockSizeCode, sampleRateCode, channelCode, sampleSizeCode := header[0], header[1], header[2], header[3]
+
+	// reserved bit
+	if _, err := r.read(1); err != nil {
+		return nil, err
+	}
+
+	// the frame or sample number is UTF-8 coded
+	first, err := r.read(8)
+	if err != nil {
+		return nil, err
+	}
+	var length int
+	for mask := uint64(0x80); first&mask != 0 && mask > 0; mask >>= 1 {
+		length++
+	}
+	for range max(length-1, 0) {
+		if _, err := r.read(8); err != nil {
+			return nil, err
+		}
+	}
+
+	var blockSize int
+	switch {
+	case blockSizeCode == 1:
+		blockSize = 192
+	case blockSizeCode >= 2 && blockSizeCode <= 5:
+		blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		v, err := r.read(8)
+		if err != nil {
+			return nil, err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode == 7:
+		v, err := r.read(16)
+		if err != nil {
+			return nil, err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode >= 8:
+		blockSize = 256 << (blockSizeCode - 8)
+	default:
+		return nil, errors.New("flac: invalid block size")
+	}
+
+	switch sampleRateCode {
+	case 12:
+		_, err = r.read(8)
+	case 13, 14:
+		_, err = r.read(16)
+	case 15:
+		err = errors.New("flac: invalid sample rate")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bitsPerSample := info.bitsPerSample
+	switch sampleSizeCode {
+	case 0:
+	case 1:
+		bitsPerSample = 8
+	case 2:
+		bitsPerSample = 12
+	case 4:
+		bitsPerSample = 16
+	case 5:
+		bitsPerSample = 20
+	case 6:
+		bitsPerSample = 24
+	case 7:
+		bitsPerSample = 32
+	default:
+		return nil, errors.New("flac: invalid sample size")
+	}
+
+	numChannels, assignment := int(channelCode)+1, flacIndependent
+	switch {
+	case channelCode <= 7:
+	case channelCode <= 10:
+		numChannels, assignment = 2, int(channelCode-7)
+	default:
+		return nil, errors.New("flac: invalid channel assignment")
+	}
+
+	// crc-8
+	if _, err := r.read(8); err != nil {
+		return nil, err
+	}
+
+	samples := make([][]int64, numChannels)
+	for c := range samples {
+		bps := bitsPerSample
+		// the side channel has an extra bit
+		if (assignment == flacLeftSide && c == 1) ||
+			(assignment == flacSideRight && c == 0) ||
+			(assignment == flacMidSide && c == 1) {
+			bps++
+		}
+
+		if samples[c], err = decodeFLACSubframe(r, blockSize, bps); err != nil {
+			return nil, err
+		}
+	}
+
+	r.align()
+
+	// crc-16
+	if _, err := r.read(16); err != nil {
+		return nil, err
+	}
+
+	switch assignment {
+	case flacLeftSide:
+		for i, side := range samples[1] {
+			samples[1][i] = samples[0][i] - side
+		}
+	case flacSideRight:
+		for i, right := range samples[1] {
+			samples[0][i] += right
+		}
+	case flacMidSide:
+		for i, side := range samples[1] {
+			mid := samples[0][i]<<1 | side&1
+			samples[0][i] = (mid + side) >> 1
+			samples[1][i] = (mid - side) >> 1
+		}
+	}
+
+	// scale samples to the bit depth of the stream
+	if shift := info.bitsPerSample - bitsPerSample; shift != 0 {
+		for c := range samples {
+			for i := range samples[c] {
+				if shift > 0 {
+					samples[c][i] <<= shift
+				} else {
+					samples[c][i] >>= -shift
+				}
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// fixedCoefficients are the predictors of fixed subframes by order.
+var fixedCoefficients = [][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+func decodeFLACSubframe(r *bitReader, blockSize, bitsPerSample int) ([]int64, error) {
+	header, err := r.read(8)
+	if err != nil {
+		return nil, err
+	}
+	if header&0x80 != 0 {
+		return nil, errors.New("flac: invalid subframe header")
+	}
+
+	var wasted int
+	if header&1 == 1 {
+		n, err := r.readUnary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = n + 1
+		bitsPerSample -= wasted
+	}
+
+	samples := make([]int64, blockSize)
+	switch kind := int(header >> 1 & 0x3f); {
+	case kind == 0:
+		v, err := r.readSigned(bitsPerSample)
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+	case kind == 1:
+		for i := range samples {
+			if samples[i], err = r.readSigned(bitsPerSample); err != nil {
+				return nil, err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		order := kind - 8
+		if err := readWarmup(r, samples, order, bitsPerSample); err != nil {
+			return nil, err
+		}
+
+		if err := decodeFLACPrediction(r, samples, order, fixedCoefficients[order], 0); err != nil {
+			return nil, err
+		}
+	case kind >= 32:
+		order := kind - 31
+		if err := readWarmup(r, samples, order, bitsPerSample); err != nil {
+			return nil, err
+		}
+
+		coefficients, shift, err := readLPCCoefficients(r, order)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := decodeFLACPrediction(r, samples, order, coefficients, shift); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("flac: reserved subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+
+	return samples, nil
+}
+
+// readWarmup reads the unpredicted samples at the start of a subframe.
+func readWarmup(r *bitReader, samples []int64, order, bitsPerSample int) error {
+	if order > len(samples) {
+		return errors.New("flac: predictor order exceeds block size")
+	}
+
+	var err error
+	for i := range order {
+		if samples[i], err = r.readSigned(bitsPerSample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readLPCCoefficients(r *bitReader, order int) ([]int64, int, error) {
+	precision, err := r.read(4)
+	if err != nil {
+		return nil, 0, err
+	}
+	if precision == 15 {
+		return nil, 0, errors.New("flac: invalid coefficient precision")
+	}
+
+	shift, err := r.readSigned(5)
+	if err != nil {
+		return nil, 0, err
+	}
+	if shift < 0 {
+		return nil, 0, errors.New("flac: negative prediction shift")
+	}
+
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		if coefficients[i], err = r.readSigned(int(precision) + 1); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return coefficients, int(shift), nil
+}
+
+// decodeFLACPrediction reads the residuals following the warm up samples
+// and adds them to the prediction from the previous samples.
+func decodeFLACPrediction(r *bitReader, samples []int64, order int, coefficients []int64, shift int) error {
+	if err := decodeFLACResidual(r, samples, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, c := range coefficients {
+			prediction += c * samples[i-1-j]
+		}
+		samples[i] += prediction >> shift
+	}
+
+	return nil
+}
+
+// decodeFLACResidual reads rice coded residuals into samples[order:].
+func decodeFLACResidual(r *bitReader, samples []int64, order int) error {
+	method, err := r.read(2)
+	if err != nil {
+		return err
+	}
+
+	paramBits := 4
+	switch method {
+	case 0:
+	case 1:
+		paramBits = 5
+	default:
+		return errors.New("flac: reserved residual coding method")
+	}
+	escape := uint64(1)<<paramBits - 1
+
+	partitionOrder, err := r.read(4)
+	if err != nil {
+		return err
+	}
+
+	partitions := 1 << partitionOrder
+	if len(samples)%partitions != 0 || len(samples)/partitions < order {
+		return errors.New("flac: invalid residual partition order")
+	}
+
+	i := order
+	for p := range partitions {
+		n := len(samples) / partitions
+		if p == 0 {
+			n -= order
+		}
+
+		param, err := r.read(paramBits)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			bits, err := r.read(5)
+			if err != nil {
+				return err
+			}
+
+			for range n {
+				if samples[i], err = r.readSigned(int(bits)); err != nil {
+					return err
+				}
+				i++
+			}
+			continue
+		}
+
+		for range n {
+			q, err := r.readUnary()
+			if err != nil {
+				return err
+			}
+
+			low, err := r.read(int(param))
+			if err != nil {
+				return err
+			}
+
+			v := uint64(q)<<param | low
+			samples[i] = int64(v>>1) ^ -int64(v&1)
+			i++
+		}
+	}
+
+	return nil
+}
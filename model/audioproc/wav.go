@@ -0,0 +1,105 @@
+package audioproc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// decodeWAV decodes PCM and floating point WAV files.
+func decodeWAV(data []byte) ([][]float32, int, error) {
+	var format, numChannels, bitsPerSample int
+	var sampleRate int
+	var samples []byte
+
+	for b := data[12:]; len(b) >= 8; {
+		id := string(b[:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size > len(b) {
+			// tolerate files written without the final size
+			if id != "data" {
+				return nil, 0, errors.New("wav: truncated chunk")
+			}
+			size = len(b)
+		}
+
+		chunk := b[:size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, errors.New("wav: invalid fmt chunk")
+			}
+
+			format = int(binary.LittleEndian.Uint16(chunk[0:2]))
+			numChannels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+
+			// the sub format of extensible files starts with the format code
+			if format == wavFormatExtensible && size >= 26 {
+				format = int(binary.LittleEndian.Uint16(chunk[24:26]))
+			}
+		case "data":
+			samples = chunk
+		}
+
+		// chunks are padded to an even size
+		b = b[min(size+size%2, len(b)):]
+	}
+
+	if numChannels == 0 {
+		return nil, 0, errors.New("wav: missing fmt chunk")
+	}
+
+	if samples == nil {
+		return nil, 0, errors.New("wav: missing data chunk")
+	}
+
+	var sample func([]byte) float32
+	switch {
+	case format == wavFormatPCM && bitsPerSample == 8:
+		sample = func(b []byte) float32 { return float32(int(b[0])-128) / (1 << 7) }
+	case format == wavFormatPCM && bitsPerSample == 16:
+		sample = func(b []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case format == wavFormatPCM && bitsPerSample == 24:
+		sample = func(b []byte) float32 {
+			return float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		}
+	case format == wavFormatPCM && bitsPerSample == 32:
+		sample = func(b []byte) float32 { return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case format == wavFormatFloat && bitsPerSample == 32:
+		sample = func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }
+	case format == wavFormatFloat && bitsPerSample == 64:
+		sample = func(b []byte) float32 { return float32(math.Float64frombits(binary.LittleEndian.Uint64(b))) }
+	default:
+		return nil, 0, fmt.Errorf("wav: unsupported format %d with %d bits per sample", format, bitsPerSample)
+	}
+
+	bytesPerSample := bitsPerSample / 8
+	frames := len(samples) / (bytesPerSample * numChannels)
+	if err := checkSize(sampleRate, numChannels, frames); err != nil {
+		return nil, 0, err
+	}
+
+	channels := make([][]float32, numChannels)
+	for c := range channels {
+		channels[c] = make([]float32, frames)
+	}
+
+	for i := range frames {
+		for c := range channels {
+			offset := (i*numChannels + c) * bytesPerSample
+			channels[c][i] = sample(samples[offset : offset+bytesPerSample])
+		}
+	}
+
+	return channels, sampleRate, nil
+}
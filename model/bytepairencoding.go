@@ -236,7 +236,7 @@ func (bpe BytePairEncoding) Encode(s string, addSpecial bool) ([]int32, error) {
 	}
 
 	if addSpecial {
-		ids = bpe.vocab.addSpecials(ids)
+		ids = bpe.vocab.AddSpecials(ids)
 	}
 
 	logutil.Trace("encoded", "string", s, "ids", ids)
@@ -71,6 +71,22 @@ type MultimodalProcessor interface {
 	PostTokenize([]*input.Input) ([]*input.Input, error)
 }
 
+// RopeScaler is implemented by models whose type of RoPE scaling can be
+// overridden when they are loaded, such as to extend their context length.
+type RopeScaler interface {
+	// SupportsRopeScaling reports whether the model can use the given type
+	// of RoPE scaling, such as "linear" or "yarn"
+	SupportsRopeScaling(scalingType string) bool
+}
+
+// ControlVectorApplier is implemented by models that add control vectors to
+// the output of each layer with ml.Context.ApplyControlVectors.
+type ControlVectorApplier interface {
+	// SupportsControlVectors reports whether the model applies control
+	// vectors
+	SupportsControlVectors() bool
+}
+
 // Base implements the common fields and methods for all models
 type Base struct {
 	b ml.Backend
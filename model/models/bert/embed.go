@@ -2,6 +2,7 @@ package bert
 
 import (
 	"cmp"
+	"errors"
 	"math"
 
 	"github.com/ollama/ollama/fs"
@@ -23,13 +24,18 @@ type Model struct {
 
 	Layers []EncoderLayer `gguf:"blk"`
 
+	// Classifier and ClassifierOutput score the pooled output of
+	// cross-encoders used for reranking
+	Classifier       *nn.Linear `gguf:"cls"`
+	ClassifierOutput *nn.Linear `gguf:"cls.output"`
+
 	Options
 }
 
 // Forward implements model.Model.
 func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	hiddenStates := m.TokenEmbedding.Forward(ctx, batch.Inputs)
-	hiddenStates = hiddenStates.Add(ctx, m.TypeEmbedding.Weight.Slice(ctx, 1, 0, 1, 1))
+	hiddenStates = hiddenStates.Add(ctx, m.tokenTypes(ctx, batch))
 	hiddenStates = hiddenStates.Add(ctx, m.PositionEmbedding.Forward(ctx, ctx.Input().FromInts(batch.Positions, len(batch.Positions))))
 	hiddenStates = m.TokenEmbeddingNorm.Forward(ctx, hiddenStates, m.eps)
 
@@ -38,6 +44,10 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	}
 
 	hiddenStates = m.poolingType.Forward(ctx, hiddenStates)
+	if m.poolingType == pooling.TypeRank {
+		return m.classify(ctx, hiddenStates)
+	}
+
 	if m.normalize {
 		hiddenStates = hiddenStates.L2Norm(ctx, 1e-12)
 	}
@@ -45,6 +55,58 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	return hiddenStates, nil
 }
 
+// tokenTypes returns the token type embeddings of the batch. Cross-encoders
+// score a query and document joined by a separator so tokens up to and
+// including the first separator of each sequence are type 0 and the rest are
+// type 1. Other inputs are all type 0.
+func (m *Model) tokenTypes(ctx ml.Context, batch input.Batch) ml.Tensor {
+	types := m.TypeEmbedding.Weight.Slice(ctx, 1, 0, 1, 1)
+	if m.poolingType != pooling.TypeRank || m.TypeEmbedding.Weight.Dim(1) < 2 {
+		return types
+	}
+
+	vocab := m.Vocabulary()
+	separators := make([]float32, len(vocab.Values))
+	for _, id := range vocab.EOS {
+		separators[id] = 1
+	}
+
+	// isSeparator is 1 for separator tokens and 0 otherwise
+	isSeparator := ctx.Input().FromFloats(separators, 1, len(separators)).Rows(ctx, batch.Inputs)
+
+	// before selects the earlier tokens of the same sequence for each token
+	n := len(batch.Positions)
+	before := make([]float32, n*n)
+	for i := range n {
+		for j := range n {
+			if batch.Sequences[j] == batch.Sequences[i] && batch.Positions[j] < batch.Positions[i] {
+				before[i*n+j] = 1
+			}
+		}
+	}
+
+	// second is the number of separators preceding each token which is 1 for
+	// the tokens after the first separator
+	second := ctx.Input().FromFloats(before, n, n).Mulmat(ctx, isSeparator.Reshape(ctx, n, 1))
+
+	difference := m.TypeEmbedding.Weight.Slice(ctx, 1, 1, 2, 1).Sub(ctx, types)
+	return difference.Reshape(ctx, 1, difference.Dim(0)).Mulmat(ctx, second.Reshape(ctx, 1, n)).Add(ctx, types)
+}
+
+// classify returns the relevance logits of the pooled output of a cross-encoder.
+func (m *Model) classify(ctx ml.Context, hiddenStates ml.Tensor) (ml.Tensor, error) {
+	if m.Classifier == nil {
+		return nil, errors.New("bert: rank pooling requires a classification head")
+	}
+
+	hiddenStates = m.Classifier.Forward(ctx, hiddenStates).Tanh(ctx)
+	if m.ClassifierOutput != nil {
+		hiddenStates = m.ClassifierOutput.Forward(ctx, hiddenStates)
+	}
+
+	return hiddenStates, nil
+}
+
 type EncoderLayer struct {
 	*Attention
 	AttentionNorm *nn.LayerNorm `gguf:"attn_output_norm"`
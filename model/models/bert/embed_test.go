@@ -0,0 +1,67 @@
+package bert
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+	_ "github.com/ollama/ollama/ml/backend"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/ml/nn/pooling"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+)
+
+func TestTokenTypes(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "*.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := ggml.WriteGGUF(f, ggml.KV{"general.architecture": "test"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ml.NewBackend(f.Name(), ml.BackendParams{AllocMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx := b.NewContext()
+	defer ctx.Close()
+
+	m := Model{
+		TextProcessor: model.NewWordPiece(&model.Vocabulary{
+			Values: []string{"[UNK]", "[CLS]", "[SEP]", "▁hello", "▁world"},
+			Types:  []int32{model.TOKEN_TYPE_CONTROL, model.TOKEN_TYPE_CONTROL, model.TOKEN_TYPE_CONTROL, model.TOKEN_TYPE_NORMAL, model.TOKEN_TYPE_NORMAL},
+			BOS:    []int32{1},
+			EOS:    []int32{2},
+		}, true),
+		TypeEmbedding: &nn.Embedding{Weight: ctx.Input().FromFloats([]float32{1, 2, 10, 20}, 2, 2)},
+		Options:       Options{poolingType: pooling.TypeRank},
+	}
+
+	// two sequences: [CLS] hello [SEP] world [SEP] and [CLS] world [SEP] hello [SEP]
+	inputs := []int32{1, 3, 2, 4, 2, 1, 4, 2, 3, 2}
+	batch := input.Batch{
+		Inputs:    ctx.Input().FromInts(inputs, len(inputs)),
+		Positions: []int32{0, 1, 2, 3, 4, 0, 1, 2, 3, 4},
+		Sequences: []int{0, 0, 0, 0, 0, 1, 1, 1, 1, 1},
+	}
+
+	types := m.tokenTypes(ctx, batch)
+	ctx.Forward(types).Compute(types)
+
+	want := []float32{
+		1, 2, 1, 2, 1, 2, 10, 20, 10, 20,
+		1, 2, 1, 2, 1, 2, 10, 20, 10, 20,
+	}
+	if diff := cmp.Diff(want, types.Floats()); diff != "" {
+		t.Errorf("unexpected token types (-want +got):\n%s", diff)
+	}
+}
@@ -177,6 +177,11 @@ func (l *Layer) Forward(ctx ml.Context, hiddenState, positionIDs, outputs ml.Ten
 	return hiddenState.Add(ctx, residual)
 }
 
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
 func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
 
@@ -199,6 +204,7 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		}
 
 		hiddenState = layer.Forward(ctx, hiddenState, positions, lastLayerOutputs, m.Cache, m.Options)
+		hiddenState = ctx.ApplyControlVectors(i, hiddenState)
 	}
 
 	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
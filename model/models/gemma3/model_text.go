@@ -1,6 +1,7 @@
 package gemma3
 
 import (
+	"cmp"
 	"math"
 
 	"github.com/ollama/ollama/fs"
@@ -25,13 +26,14 @@ type TextConfig struct {
 	ropeExtrapolation                               float32
 	ropeBetaFast                                    float32
 	ropeBetaSlow                                    float32
+	ropeAttnFactor                                  float32
 	finalLogitSoftcap                               float32
 }
 
 func (o TextConfig) applyRotaryPositionEmbeddings(ctx ml.Context, states, positions ml.Tensor, base, scale float32) ml.Tensor {
 	ropeOpts := []func(*rope.Options){rope.WithTypeNeoX()}
 	if o.ropeType == "yarn" {
-		attnFactor := float32(1.0 / (1.0 + 0.1*math.Log(float64(scale))))
+		attnFactor := cmp.Or(o.ropeAttnFactor, float32(1.0/(1.0+0.1*math.Log(float64(scale)))))
 		ropeOpts = append(ropeOpts,
 			rope.WithOriginalContextLength(o.ropeOriginalContext),
 			rope.WithExtrapolationFactor(o.ropeExtrapolation),
@@ -88,6 +90,7 @@ func newTextModel(c fs.Config) *TextModel {
 			ropeExtrapolation:    c.Float("rope.scaling.extrapolation_factor", 1.0),
 			ropeBetaFast:         c.Float("rope.scaling.beta_fast", 64.0),
 			ropeBetaSlow:         c.Float("rope.scaling.beta_slow", 1.0),
+			ropeAttnFactor:       c.Float("rope.scaling.attn_factor"),
 			ropeScale:            c.Float("rope.scaling.factor", 1.0),
 			finalLogitSoftcap:    c.Float("final_logit_softcapping", 0.0),
 		},
@@ -260,6 +263,7 @@ func (m *TextModel) Forward(ctx ml.Context, batch input.Batch, cache kvcache.Cac
 		}
 
 		hiddenState = layer.Forward(ctx, i, hiddenState, positions, lastLayerOutputs, cache, m.TextConfig)
+		hiddenState = ctx.ApplyControlVectors(i, hiddenState)
 	}
 
 	return m.OutputNorm.Forward(ctx, hiddenState, m.eps)
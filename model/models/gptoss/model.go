@@ -26,6 +26,11 @@ type Transformer struct {
 	Options
 }
 
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Transformer) SupportsControlVectors() bool {
+	return true
+}
+
 // Forward implements model.Model.
 func (m *Transformer) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	hiddenStates := m.TokenEmbedding.Forward(ctx, batch.Inputs)
@@ -44,6 +49,7 @@ func (m *Transformer) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, err
 		}
 
 		hiddenStates = block.Forward(ctx, hiddenStates, positions, outputs, m.Cache, &m.Options)
+		hiddenStates = ctx.ApplyControlVectors(i, hiddenStates)
 	}
 
 	hiddenStates = m.OutputNorm.Forward(ctx, hiddenStates, m.eps)
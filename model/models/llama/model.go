@@ -140,6 +140,16 @@ func (m *Model) Shift(ctx ml.Context, layer int, key, shift ml.Tensor) (ml.Tenso
 	return m.applyRotaryPositionEmbeddings(ctx, key, shift, m.Layers[layer].SelfAttention.RopeFactors), nil
 }
 
+// SupportsRopeScaling implements model.RopeScaler
+func (m *Model) SupportsRopeScaling(scalingType string) bool {
+	return scalingType == "none" || scalingType == "linear"
+}
+
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
 type MLP struct {
 	Up   *nn.Linear `gguf:"ffn_up"`
 	Down *nn.Linear `gguf:"ffn_down"`
@@ -193,6 +203,7 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		}
 
 		hiddenState = layer.Forward(ctx, hiddenState, positions, outputs, m.Cache, &m.Options)
+		hiddenState = ctx.ApplyControlVectors(i, hiddenState)
 	}
 
 	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
@@ -169,6 +169,11 @@ func (m *Model) PostTokenize(inputs []*input.Input) ([]*input.Input, error) {
 	return result, nil
 }
 
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
 func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
 	return m.TextModel.Forward(ctx, batch.Inputs, positions, batch.Outputs, batch, m.Cache), nil
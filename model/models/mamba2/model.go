@@ -0,0 +1,291 @@
+package mamba2
+
+import (
+	"cmp"
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+)
+
+type Options struct {
+	hiddenSize int
+	eps        float32
+
+	// mamba2 layers
+	ssmConvLen, ssmInnerSize, ssmStateSize int
+	ssmNumHeads, ssmNumGroups              int
+
+	// attention layers of hybrid models
+	numHeads, headDim   int
+	numKVHeadsByLayer   []int
+	ropeBase, ropeScale float32
+	useRope             bool
+
+	numExperts, numExpertsUsed int
+
+	// granite scales the embeddings, residual connections, attention
+	// and logits by constant factors
+	embeddingScale, residualScale, attentionScale, logitScale float32
+}
+
+func (o Options) applyRotaryPositionEmbeddings(ctx ml.Context, states, positions ml.Tensor) ml.Tensor {
+	return nn.RoPE(ctx, states, positions, o.headDim, o.ropeBase, 1./o.ropeScale)
+}
+
+type Model struct {
+	model.Base
+	model.TextProcessor
+
+	TokenEmbedding *nn.Embedding `gguf:"token_embd"`
+	Layers         []Layer       `gguf:"blk"`
+	OutputNorm     *nn.RMSNorm   `gguf:"output_norm"`
+	Output         *nn.Linear    `gguf:"output,alt:token_embd"`
+
+	Options
+}
+
+func New(c fs.Config) (model.Model, error) {
+	if c.String("tokenizer.ggml.model") != "gpt2" {
+		return nil, model.ErrUnsupportedTokenizer
+	}
+
+	vocabulary := model.Vocabulary{
+		Values: c.Strings("tokenizer.ggml.tokens"),
+		Scores: c.Floats("tokenizer.ggml.scores"),
+		Types:  c.Ints("tokenizer.ggml.token_type"),
+		Merges: c.Strings("tokenizer.ggml.merges"),
+		AddBOS: c.Bool("tokenizer.ggml.add_bos_token", false),
+		BOS:    []int32{int32(c.Uint("tokenizer.ggml.bos_token_id"))},
+		AddEOS: c.Bool("tokenizer.ggml.add_eos_token", false),
+		EOS: append(
+			[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
+			c.Ints("tokenizer.ggml.eos_token_ids")...,
+		),
+	}
+
+	var pretokenizers []string
+	switch c.String("tokenizer.ggml.pre") {
+	case "default":
+		// use the default bpe pretokenizer
+	default:
+		pretokenizers = []string{
+			`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+		}
+	}
+
+	m := Model{
+		TextProcessor: model.NewBytePairEncoding(&vocabulary, pretokenizers...),
+		Layers:        make([]Layer, c.Uint("block_count")),
+		Options: Options{
+			hiddenSize:     int(c.Uint("embedding_length")),
+			eps:            c.Float("attention.layer_norm_rms_epsilon", 1e-5),
+			ssmConvLen:     max(0, int(c.Uint("ssm.conv_kernel"))-1),
+			ssmInnerSize:   int(c.Uint("ssm.inner_size")),
+			ssmStateSize:   int(c.Uint("ssm.state_size")),
+			ssmNumHeads:    int(c.Uint("ssm.time_step_rank")),
+			ssmNumGroups:   int(c.Uint("ssm.group_count", 1)),
+			numHeads:       int(c.Uint("attention.head_count")),
+			headDim:        int(c.Uint("attention.key_length")),
+			ropeBase:       c.Float("rope.freq_base", 1e4),
+			ropeScale:      c.Float("rope.scaling.factor", 1),
+			useRope:        c.Bool("rope.scaling.finetuned"),
+			numExperts:     int(c.Uint("expert_count")),
+			numExpertsUsed: int(c.Uint("expert_used_count")),
+			embeddingScale: c.Float("embedding_scale", 1),
+			residualScale:  c.Float("residual_scale", 1),
+			attentionScale: c.Float("attention.scale"),
+			logitScale:     c.Float("logit_scale", 1),
+		},
+	}
+
+	if m.numHeads > 0 {
+		m.headDim = cmp.Or(m.headDim, m.hiddenSize/m.numHeads)
+	}
+
+	type headCounts interface {
+		HeadCountKV() []uint64
+	}
+	hc, ok := c.(headCounts)
+	if !ok {
+		return nil, model.ErrUnsupportedModel
+	}
+
+	// layers without kv heads are mamba2 layers
+	m.numKVHeadsByLayer = make([]int, len(m.Layers))
+	for i, n := range hc.HeadCountKV() {
+		m.numKVHeadsByLayer[i] = int(n)
+		if n == 0 {
+			m.Layers[i].Operator = &SSM{}
+		} else {
+			m.Layers[i].Operator = &Attention{}
+		}
+
+		switch {
+		case m.numExperts > 0:
+			m.Layers[i].MLP = &sparse{}
+		case c.Uint("feed_forward_length") > 0:
+			m.Layers[i].MLP = &dense{}
+		}
+	}
+
+	m.Cache = kvcache.NewRecurrentCache(m.Shift, m.ssmConvLen, m.ssmInnerSize+2*m.ssmNumGroups*m.ssmStateSize, m.ssmStateSize*m.ssmInnerSize)
+	return &m, nil
+}
+
+type Operator interface {
+	Forward(ctx ml.Context, hiddenStates, positions ml.Tensor, cache *kvcache.Recurrent, layer int, opts *Options) ml.Tensor
+}
+
+type Attention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_output"`
+}
+
+func (sa *Attention) Forward(ctx ml.Context, hiddenStates, positions ml.Tensor, cache *kvcache.Recurrent, layer int, opts *Options) ml.Tensor {
+	batchSize := hiddenStates.Dim(1)
+	numKVHeads := opts.numKVHeadsByLayer[layer]
+
+	query := sa.Query.Forward(ctx, hiddenStates)
+	query = query.Reshape(ctx, opts.headDim, opts.numHeads, batchSize)
+
+	key := sa.Key.Forward(ctx, hiddenStates)
+	key = key.Reshape(ctx, opts.headDim, numKVHeads, batchSize)
+
+	value := sa.Value.Forward(ctx, hiddenStates)
+	value = value.Reshape(ctx, opts.headDim, numKVHeads, batchSize)
+
+	if opts.useRope {
+		query = opts.applyRotaryPositionEmbeddings(ctx, query, positions)
+		key = opts.applyRotaryPositionEmbeddings(ctx, key, positions)
+	}
+
+	scale := float64(opts.attentionScale)
+	if scale == 0 {
+		scale = 1 / math.Sqrt(float64(opts.headDim))
+	}
+
+	attention := nn.Attention(ctx, query, key, value, scale, cache)
+	attention = attention.Reshape(ctx, attention.Dim(0)*attention.Dim(1), batchSize)
+	return sa.Output.Forward(ctx, attention)
+}
+
+type MLP interface {
+	Forward(ml.Context, ml.Tensor, *Options) ml.Tensor
+}
+
+type dense struct {
+	Gate *nn.Linear `gguf:"ffn_gate"`
+	Up   *nn.Linear `gguf:"ffn_up"`
+	Down *nn.Linear `gguf:"ffn_down"`
+}
+
+func (mlp *dense) Forward(ctx ml.Context, hiddenStates ml.Tensor, _ *Options) ml.Tensor {
+	hiddenStates = mlp.Gate.Forward(ctx, hiddenStates).SILU(ctx, mlp.Up.Forward(ctx, hiddenStates))
+	return mlp.Down.Forward(ctx, hiddenStates)
+}
+
+type sparse struct {
+	Router *nn.Linear      `gguf:"ffn_gate_inp"`
+	Gate   *nn.LinearBatch `gguf:"ffn_gate_exps"`
+	Up     *nn.LinearBatch `gguf:"ffn_up_exps"`
+	Down   *nn.LinearBatch `gguf:"ffn_down_exps"`
+
+	SharedExpert *dense `gguf:",suf:_shexp"`
+}
+
+func (mlp *sparse) Forward(ctx ml.Context, hiddenStates ml.Tensor, opts *Options) ml.Tensor {
+	routingWeights := mlp.Router.Forward(ctx, hiddenStates).Softmax(ctx)
+	selectedExperts := routingWeights.TopK(ctx, opts.numExpertsUsed)
+	routingWeights = routingWeights.Reshape(ctx, 1, opts.numExperts, hiddenStates.Dim(1)).Rows(ctx, selectedExperts)
+	routingWeights = routingWeights.Reshape(ctx, opts.numExpertsUsed, hiddenStates.Dim(1))
+	routingWeights = routingWeights.Div(ctx, routingWeights.SumRows(ctx))
+	routingWeights = routingWeights.Reshape(ctx, 1, opts.numExpertsUsed, hiddenStates.Dim(1))
+
+	experts := hiddenStates.Reshape(ctx, hiddenStates.Dim(0), 1, hiddenStates.Dim(1))
+	experts = mlp.Gate.Forward(ctx, experts, selectedExperts).SILU(ctx, mlp.Up.Forward(ctx, experts, selectedExperts))
+	experts = mlp.Down.Forward(ctx, experts, selectedExperts)
+	experts = experts.Mul(ctx, routingWeights)
+
+	nextStates := experts.View(ctx, 0, experts.Dim(0), experts.Stride(2), experts.Dim(2))
+	for i := 1; i < opts.numExpertsUsed; i++ {
+		nextStates = nextStates.Add(ctx, experts.View(ctx, i*experts.Stride(1), experts.Dim(0), experts.Stride(2), experts.Dim(2)))
+	}
+
+	if mlp.SharedExpert != nil {
+		nextStates = nextStates.Add(ctx, mlp.SharedExpert.Forward(ctx, hiddenStates, opts))
+	}
+
+	return nextStates
+}
+
+type Layer struct {
+	AttentionNorm *nn.RMSNorm `gguf:"attn_norm"`
+	Operator      Operator
+	MLPNorm       *nn.RMSNorm `gguf:"ffn_norm"`
+	MLP           MLP
+}
+
+func (l *Layer) Forward(ctx ml.Context, layer int, hiddenState, positions, outputs ml.Tensor, cache *kvcache.Recurrent, opts *Options) ml.Tensor {
+	residual := hiddenState
+
+	hiddenState = l.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = l.Operator.Forward(ctx, hiddenState, positions, cache, layer, opts)
+
+	if outputs != nil {
+		hiddenState = hiddenState.Rows(ctx, outputs)
+		residual = residual.Rows(ctx, outputs)
+	}
+
+	hiddenState = hiddenState.Scale(ctx, float64(opts.residualScale)).Add(ctx, residual)
+
+	// pure mamba2 models have no feed forward network
+	if l.MLP == nil {
+		return hiddenState
+	}
+
+	residual = hiddenState
+
+	hiddenState = l.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = l.MLP.Forward(ctx, hiddenState, opts)
+	return hiddenState.Scale(ctx, float64(opts.residualScale)).Add(ctx, residual)
+}
+
+func (m *Model) Shift(ctx ml.Context, layer int, key, shift ml.Tensor) (ml.Tensor, error) {
+	if !m.useRope {
+		return key, nil
+	}
+
+	return m.applyRotaryPositionEmbeddings(ctx, key, shift), nil
+}
+
+func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
+
+	hiddenState := m.TokenEmbedding.Forward(ctx, batch.Inputs).Scale(ctx, float64(m.embeddingScale))
+
+	for i, layer := range m.Layers {
+		m.Cache.SetLayer(i)
+
+		var outputs ml.Tensor
+		if i == len(m.Layers)-1 {
+			outputs = batch.Outputs
+		}
+
+		hiddenState = layer.Forward(ctx, i, hiddenState, positions, outputs, m.Cache.(*kvcache.Recurrent), &m.Options)
+	}
+
+	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
+	return m.Output.Forward(ctx, hiddenState).Scale(ctx, 1/float64(m.logitScale)), nil
+}
+
+func init() {
+	model.Register("mamba2", New)
+	model.Register("granitehybrid", New)
+}
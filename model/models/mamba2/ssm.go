@@ -0,0 +1,72 @@
+package mamba2
+
+import (
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+)
+
+type convKernel struct {
+	Weight ml.Tensor `gguf:"weight"`
+	Bias   ml.Tensor `gguf:"bias"`
+}
+
+// SSM implements the Mamba2 selective state space mixer. Its convolution and
+// scan states are stored in the recurrent cache.
+type SSM struct {
+	In     *nn.Linear  `gguf:"ssm_in"`
+	Conv   *convKernel `gguf:"ssm_conv1d"`
+	DTBias ml.Tensor   `gguf:"ssm_dt.bias"`
+	A      ml.Tensor   `gguf:"ssm_a"`
+	D      ml.Tensor   `gguf:"ssm_d"`
+	Norm   *nn.RMSNorm `gguf:"ssm_norm"`
+	Out    *nn.Linear  `gguf:"ssm_out"`
+}
+
+func (s *SSM) Forward(ctx ml.Context, hiddenStates, _ ml.Tensor, cache *kvcache.Recurrent, _ int, opts *Options) ml.Tensor {
+	nSeqs, seqTokens := cache.NumSeqs(), cache.SeqTokens()
+	innerSize, numHeads, numGroups, stateSize := opts.ssmInnerSize, opts.ssmNumHeads, opts.ssmNumGroups, opts.ssmStateSize
+	headDim := innerSize / numHeads
+	convDim := innerSize + 2*numGroups*stateSize
+
+	zxbcdt := s.In.Forward(ctx, hiddenStates)
+	zxbcdt = zxbcdt.Reshape(ctx, zxbcdt.Dim(0), seqTokens, nSeqs)
+
+	elementSize := zxbcdt.Stride(0)
+	z := zxbcdt.View(ctx, 0, innerSize, zxbcdt.Stride(1), seqTokens, zxbcdt.Stride(2), nSeqs)
+	xbc := zxbcdt.View(ctx, innerSize*elementSize, convDim, zxbcdt.Stride(1), seqTokens, zxbcdt.Stride(2), nSeqs)
+	dt := zxbcdt.View(ctx, (innerSize+convDim)*elementSize, numHeads, zxbcdt.Stride(1), seqTokens, zxbcdt.Stride(2), nSeqs)
+
+	// causal convolution over the previous tokens of each sequence
+	sx := cache.ConvState(ctx).Concat(ctx, xbc.Permute(ctx, 1, 0, 2, 3), 0)
+	cache.UpdateConvState(ctx, sx.Slice(ctx, 0, sx.Dim(0)-opts.ssmConvLen, sx.Dim(0), 1))
+
+	xbc = sx.SSMConv(ctx, s.Conv.Weight)
+	xbc = xbc.Add(ctx, s.Conv.Bias).SILU(ctx)
+
+	elementSize = xbc.Stride(0)
+	x := xbc.View(ctx, 0, headDim, headDim*elementSize, numHeads, xbc.Stride(1), seqTokens, xbc.Stride(2), nSeqs)
+	b := xbc.View(ctx, innerSize*elementSize, stateSize, stateSize*elementSize, numGroups, xbc.Stride(1), seqTokens, xbc.Stride(2), nSeqs)
+	c := xbc.View(ctx, (innerSize+numGroups*stateSize)*elementSize, stateSize, stateSize*elementSize, numGroups, xbc.Stride(1), seqTokens, xbc.Stride(2), nSeqs)
+
+	dt = dt.Add(ctx, s.DTBias)
+
+	state, ids := cache.SSMState(ctx, stateSize, headDim, numHeads)
+	y := state.SSMScan(ctx, x, dt, s.A, b, c, ids)
+
+	// the scan output is followed by the final state of each sequence
+	ySize := innerSize * seqTokens * nSeqs
+	cache.UpdateSSMState(ctx, y.View(ctx, ySize*y.Stride(0), stateSize*headDim*numHeads*nSeqs))
+
+	y = y.View(ctx, 0, ySize).Reshape(ctx, headDim, numHeads, seqTokens, nSeqs)
+	y = y.Add(ctx, x.Mul(ctx, s.D))
+	y = y.Reshape(ctx, innerSize, seqTokens, nSeqs)
+	y = z.Contiguous(ctx).SILU(ctx, y)
+
+	// grouped RMS norm
+	y = y.Reshape(ctx, innerSize/numGroups, numGroups, seqTokens*nSeqs)
+	y = s.Norm.Forward(ctx, y, opts.eps)
+	y = y.Reshape(ctx, innerSize, seqTokens*nSeqs)
+
+	return s.Out.Forward(ctx, y)
+}
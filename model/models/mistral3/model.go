@@ -99,6 +99,21 @@ func newMultiModalProjector(c fs.Config) *MultiModalProjector {
 	}
 }
 
+// SupportsRopeScaling implements model.RopeScaler
+func (m *Model) SupportsRopeScaling(scalingType string) bool {
+	switch scalingType {
+	case "none", "linear", "yarn":
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
 func (m *Model) EncodeMultimodal(ctx ml.Context, multimodalData []byte) ([]input.Multimodal, error) {
 	if len(m.VisionModel.Layers) == 0 {
 		return nil, model.ErrNoVisionModel
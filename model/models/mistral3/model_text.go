@@ -24,12 +24,15 @@ type TextOptions struct {
 	ropeBetaSlow                     float32
 	ropeMscale                       float32
 	ropeMscaleAllDim                 float32
+	ropeAttnFactor                   float32
 }
 
 func (o TextOptions) applyRotaryPositionEmbeddings(ctx ml.Context, states, positions ml.Tensor) ml.Tensor {
 	var ropeOpts []func(*rope.Options)
 	if o.ropeType == "yarn" {
-		if o.ropeMscale != 0 && o.ropeMscaleAllDim != 0 {
+		if o.ropeAttnFactor != 0 {
+			ropeOpts = append(ropeOpts, rope.WithAttentionFactor(o.ropeAttnFactor))
+		} else if o.ropeMscale != 0 && o.ropeMscaleAllDim != 0 {
 			ropeOpts = append(ropeOpts, rope.WithAttentionFactor(1.0/float32(0.1*math.Log(float64(o.ropeScale))+1.0)))
 		}
 
@@ -145,6 +148,7 @@ func (m *TextModel) Forward(ctx ml.Context, inputs, positions, positionsScale, o
 		}
 
 		hiddenState = layer.Forward(ctx, hiddenState, positions, positionsScale, lastLayerOutputs, cache, m.TextOptions)
+		hiddenState = ctx.ApplyControlVectors(i, hiddenState)
 	}
 
 	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
@@ -180,6 +184,7 @@ func newTextModel(c fs.Config) *TextModel {
 			ropeMscale:            c.Float("rope.scaling.mscale"),
 			ropeMscaleAllDim:      c.Float("rope.scaling.mscale_all_dim"),
 			ropeExtrapolation:     c.Float("rope.scaling.extrapolation_factor", 1),
+			ropeAttnFactor:        c.Float("rope.scaling.attn_factor"),
 		},
 	}
 }
@@ -186,6 +186,11 @@ func (m *Model) isSWALayer(layerIdx int) bool {
 	return m.Options.slidingWindowPattern[layerIdx]
 }
 
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
 func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
 
@@ -212,6 +217,7 @@ func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		}
 
 		hiddenState = layer.Forward(ctx, hiddenState, positions, outputs, m.Cache, m, isSWA)
+		hiddenState = ctx.ApplyControlVectors(i, hiddenState)
 	}
 
 	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
@@ -0,0 +1,212 @@
+package phi4
+
+import (
+	"bytes"
+	"image"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+)
+
+// imageToken is the placeholder token for image features, <|endoftext10|>
+const imageToken int32 = 200010
+
+type Model struct {
+	model.Base
+	model.BytePairEncoding
+
+	*TextModel
+	*VisionModel         `gguf:"v"`
+	*MultiModalProjector `gguf:"mm"`
+
+	ImageProcessor
+}
+
+var _ model.MultimodalProcessor = (*Model)(nil)
+
+type MultiModalProjector struct {
+	GlobalSeparator ml.Tensor  `gguf:"glb_gn"`
+	RowSeparator    ml.Tensor  `gguf:"sub_gn"`
+	Linear1         *nn.Linear `gguf:"linear_1"`
+	Linear2         *nn.Linear `gguf:"linear_2"`
+}
+
+// pool reduces the patches of a crop by averaging 2x2 windows, returning a
+// tensor of shape [hidden size, width, height]
+func (p *MultiModalProjector) pool(ctx ml.Context, visionOutputs ml.Tensor, patchesPerSide int) ml.Tensor {
+	hiddenSize := visionOutputs.Dim(0)
+
+	visionOutputs = visionOutputs.Permute(ctx, 1, 0, 2, 3).Contiguous(ctx)
+	visionOutputs = visionOutputs.Reshape(ctx, patchesPerSide, patchesPerSide, hiddenSize)
+	visionOutputs = visionOutputs.AvgPool2D(ctx, 2, 2, 0)
+	return visionOutputs.Permute(ctx, 1, 2, 0, 3).Contiguous(ctx)
+}
+
+// separateRows appends the row separator to each row of features and
+// flattens them into a sequence
+func (p *MultiModalProjector) separateRows(ctx ml.Context, features ml.Tensor) ml.Tensor {
+	separator := p.RowSeparator.Reshape(ctx, features.Dim(0), 1, 1).Repeat(ctx, 2, features.Dim(2))
+	features = features.Concat(ctx, separator, 1)
+	return features.Reshape(ctx, features.Dim(0), features.Dim(1)*features.Dim(2))
+}
+
+// Forward arranges the features of the crops in the image grid, drops the
+// features of padding and projects the sub image features followed by the
+// global image features into the text embedding space
+func (p *MultiModalProjector) Forward(ctx ml.Context, global ml.Tensor, crops []ml.Tensor, grid, size image.Point) ml.Tensor {
+	var sub ml.Tensor
+	for y := range grid.Y {
+		row := crops[y*grid.X]
+		for x := 1; x < grid.X; x++ {
+			row = row.Concat(ctx, crops[y*grid.X+x], 1)
+		}
+
+		if sub == nil {
+			sub = row
+		} else {
+			sub = sub.Concat(ctx, row, 2)
+		}
+	}
+
+	sub = sub.Slice(ctx, 1, 0, size.X, 1).Slice(ctx, 2, 0, size.Y, 1).Contiguous(ctx)
+
+	features := p.separateRows(ctx, sub)
+	features = features.Concat(ctx, p.GlobalSeparator.Reshape(ctx, features.Dim(0), 1), 1)
+	features = features.Concat(ctx, p.separateRows(ctx, global), 1)
+
+	features = p.Linear1.Forward(ctx, features).GELU(ctx)
+	return p.Linear2.Forward(ctx, features)
+}
+
+func New(c fs.Config) (model.Model, error) {
+	vocabulary := model.Vocabulary{
+		Values: c.Strings("tokenizer.ggml.tokens"),
+		Types:  c.Ints("tokenizer.ggml.token_type"),
+		Merges: c.Strings("tokenizer.ggml.merges"),
+		AddBOS: c.Bool("tokenizer.ggml.add_bos_token", false),
+		BOS:    []int32{int32(c.Uint("tokenizer.ggml.bos_token_id"))},
+		AddEOS: c.Bool("tokenizer.ggml.add_eos_token", false),
+		EOS: append(
+			[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
+			c.Ints("tokenizer.ggml.eos_token_ids")...,
+		),
+	}
+
+	var pretokenizers []string
+	switch c.String("tokenizer.ggml.pre") {
+	case "default":
+		// no-op use the default bpe pretokenizer
+	case "gpt-4o":
+		// Phi-4-mini and Phi-4-multimodal use the o200k tokenizer
+		pretokenizers = []string{
+			strings.Join([]string{
+				`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+				`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+				`\p{N}{1,3}`,
+				` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+				`\s*[\r\n]+`,
+				`\s+(?!\S)`,
+				`\s+`,
+			}, "|"),
+		}
+	default:
+		// Phi-4 uses the cl100k tokenizer
+		pretokenizers = []string{
+			`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+		}
+	}
+
+	m := Model{
+		BytePairEncoding:    model.NewBytePairEncoding(&vocabulary, pretokenizers...),
+		TextModel:           newTextModel(c),
+		VisionModel:         newVisionModel(c),
+		MultiModalProjector: &MultiModalProjector{},
+		ImageProcessor:      newImageProcessor(c),
+	}
+
+	m.Cache = &ropeCache{Causal: kvcache.NewCausalCache(m.Shift)}
+	return &m, nil
+}
+
+func (m *Model) Shift(ctx ml.Context, layer int, key, shift ml.Tensor) (ml.Tensor, error) {
+	return m.applyRotaryPositionEmbeddings(ctx, key, shift, m.ropeFactors(m.Cache)), nil
+}
+
+// SupportsRopeScaling implements model.RopeScaler. longrope uses the long
+// factors regardless of the context length.
+func (m *Model) SupportsRopeScaling(scalingType string) bool {
+	return scalingType == "linear" || scalingType == "longrope"
+}
+
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
+func (m *Model) EncodeMultimodal(ctx ml.Context, multimodalData []byte) ([]input.Multimodal, error) {
+	if len(m.VisionModel.Layers) == 0 {
+		return nil, model.ErrNoVisionModel
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(multimodalData))
+	if err != nil {
+		return nil, err
+	}
+
+	pixelValues, grid, size := m.ImageProcessor.ProcessImage(img)
+
+	// crops are encoded separately to bound the size of the attention
+	features := make([]ml.Tensor, len(pixelValues))
+	for i := range pixelValues {
+		crop := ctx.Input().FromFloats(pixelValues[i],
+			m.ImageProcessor.imageSize,
+			m.ImageProcessor.imageSize,
+			m.ImageProcessor.numChannels,
+		)
+
+		visionOutputs := m.VisionModel.Forward(ctx, crop)
+		features[i] = m.MultiModalProjector.pool(ctx, visionOutputs, m.ImageProcessor.imageSize/m.ImageProcessor.patchSize)
+	}
+
+	visionOutputs := m.MultiModalProjector.Forward(ctx, features[0], features[1:], grid, size)
+	return []input.Multimodal{{Tensor: visionOutputs}}, nil
+}
+
+func (m *Model) PostTokenize(inputs []*input.Input) ([]*input.Input, error) {
+	var result []*input.Input
+	for _, inp := range inputs {
+		if len(inp.Multimodal) == 0 {
+			result = append(result, inp)
+			continue
+		}
+
+		inputMultimodal := inp.Multimodal[0].Tensor
+
+		// image data is on the first placeholder
+		result = append(result, &input.Input{
+			Token:          imageToken,
+			Multimodal:     inp.Multimodal,
+			MultimodalHash: inp.MultimodalHash,
+			SameBatch:      inputMultimodal.Dim(1),
+		})
+
+		result = append(result, slices.Repeat([]*input.Input{{Token: imageToken}}, inputMultimodal.Dim(1)-1)...)
+	}
+
+	return result, nil
+}
+
+func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	return m.TextModel.Forward(ctx, batch, m.Cache), nil
+}
+
+func init() {
+	model.Register("phi3", New)
+	model.Register("phi4mm", New)
+}
@@ -0,0 +1,188 @@
+package phi4
+
+import (
+	"cmp"
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+	"github.com/ollama/ollama/ml/nn/rope"
+	"github.com/ollama/ollama/model/input"
+)
+
+type TextOptions struct {
+	hiddenSize, numHeads, numKVHeads int
+	headDim, ropeDim                 int
+	eps, ropeBase, ropeScale         float32
+
+	// longrope uses a different set of factors once the context is longer
+	// than the original context length, or always if ropeType is longrope
+	ropeType              string
+	originalContextLength int
+	ropeAttentionFactor   float32
+}
+
+type TextModel struct {
+	TokenEmbedding *nn.Embedding `gguf:"token_embd"`
+	Layers         []TextLayer   `gguf:"blk"`
+	OutputNorm     *nn.RMSNorm   `gguf:"output_norm"`
+	Output         *nn.Linear    `gguf:"output,alt:token_embd"`
+
+	RopeFactorsLong  ml.Tensor `gguf:"rope_factors_long.weight"`
+	RopeFactorsShort ml.Tensor `gguf:"rope_factors_short.weight"`
+
+	*TextOptions
+}
+
+func newTextModel(c fs.Config) *TextModel {
+	hiddenSize, numHeads := int(c.Uint("embedding_length")), int(c.Uint("attention.head_count"))
+	headDim := cmp.Or(int(c.Uint("attention.key_length")), hiddenSize/numHeads)
+	return &TextModel{
+		Layers: make([]TextLayer, c.Uint("block_count")),
+		TextOptions: &TextOptions{
+			hiddenSize:            hiddenSize,
+			numHeads:              numHeads,
+			numKVHeads:            int(c.Uint("attention.head_count_kv")),
+			headDim:               headDim,
+			ropeDim:               cmp.Or(int(c.Uint("rope.dimension_count")), headDim),
+			eps:                   c.Float("attention.layer_norm_rms_epsilon", 1e-5),
+			ropeBase:              c.Float("rope.freq_base", 1e4),
+			ropeScale:             c.Float("rope.scaling.factor", 1),
+			ropeType:              c.String("rope.scaling.type"),
+			originalContextLength: int(c.Uint("rope.scaling.original_context_length")),
+			ropeAttentionFactor:   c.Float("rope.scaling.attn_factor", 1),
+		},
+	}
+}
+
+// ropeCache is a causal cache which records the context length of each
+// sequence to choose between the long and short rope factors
+type ropeCache struct {
+	*kvcache.Causal
+	contextLength int
+}
+
+func (c *ropeCache) Init(backend ml.Backend, dtype ml.DType, maxSequences, capacity, maxBatch int) {
+	// capacity is shared by all sequences
+	c.contextLength = capacity / max(maxSequences, 1)
+	c.Causal.Init(backend, dtype, maxSequences, capacity, maxBatch)
+}
+
+func (m *TextModel) ropeFactors(cache kvcache.Cache) ml.Tensor {
+	if m.ropeType == "longrope" {
+		return m.RopeFactorsLong
+	}
+
+	if c, ok := cache.(*ropeCache); ok && m.originalContextLength > 0 && c.contextLength > m.originalContextLength {
+		return m.RopeFactorsLong
+	}
+
+	return m.RopeFactorsShort
+}
+
+func (o TextOptions) applyRotaryPositionEmbeddings(ctx ml.Context, states, positions, factors ml.Tensor) ml.Tensor {
+	return nn.RoPE(ctx, states, positions, o.ropeDim, o.ropeBase, 1./o.ropeScale,
+		rope.WithTypeNeoX(),
+		rope.WithFactors(factors),
+		rope.WithAttentionFactor(o.ropeAttentionFactor),
+	)
+}
+
+type TextAttention struct {
+	QKV    *nn.Linear `gguf:"attn_qkv"`
+	Output *nn.Linear `gguf:"attn_output"`
+}
+
+func (sa *TextAttention) Forward(ctx ml.Context, hiddenState, positions, ropeFactors ml.Tensor, cache kvcache.Cache, opts *TextOptions) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+
+	qkv := sa.QKV.Forward(ctx, hiddenState)
+
+	elementSize := qkv.Stride(0)
+	query := qkv.View(ctx, 0, opts.headDim, opts.headDim*elementSize, opts.numHeads, qkv.Stride(1), batchSize)
+	key := qkv.View(ctx, opts.headDim*opts.numHeads*elementSize, opts.headDim, opts.headDim*elementSize, opts.numKVHeads, qkv.Stride(1), batchSize)
+	value := qkv.View(ctx, opts.headDim*(opts.numHeads+opts.numKVHeads)*elementSize, opts.headDim, opts.headDim*elementSize, opts.numKVHeads, qkv.Stride(1), batchSize)
+
+	query = opts.applyRotaryPositionEmbeddings(ctx, query, positions, ropeFactors)
+	key = opts.applyRotaryPositionEmbeddings(ctx, key, positions, ropeFactors)
+
+	attention := nn.Attention(ctx, query, key, value.Contiguous(ctx), 1.0/math.Sqrt(float64(opts.headDim)), cache)
+	attention = attention.Reshape(ctx, opts.headDim*opts.numHeads, batchSize)
+	return sa.Output.Forward(ctx, attention)
+}
+
+// TextMLP is the feed forward network of Phi models where the gate and up
+// projections are fused
+type TextMLP struct {
+	Up   *nn.Linear `gguf:"ffn_up"`
+	Down *nn.Linear `gguf:"ffn_down"`
+}
+
+func (mlp *TextMLP) Forward(ctx ml.Context, hiddenState ml.Tensor) ml.Tensor {
+	hiddenState = mlp.Up.Forward(ctx, hiddenState)
+
+	size := hiddenState.Dim(0) / 2
+	gate := hiddenState.View(ctx, 0, size, hiddenState.Stride(1), hiddenState.Dim(1))
+	up := hiddenState.View(ctx, size*hiddenState.Stride(0), size, hiddenState.Stride(1), hiddenState.Dim(1))
+
+	hiddenState = gate.Contiguous(ctx).SILU(ctx, up.Contiguous(ctx))
+	return mlp.Down.Forward(ctx, hiddenState)
+}
+
+type TextLayer struct {
+	AttentionNorm *nn.RMSNorm `gguf:"attn_norm"`
+	SelfAttention *TextAttention
+	MLPNorm       *nn.RMSNorm `gguf:"ffn_norm"`
+	MLP           *TextMLP
+}
+
+func (l *TextLayer) Forward(ctx ml.Context, hiddenState, positions, ropeFactors, outputs ml.Tensor, cache kvcache.Cache, opts *TextOptions) ml.Tensor {
+	residual := hiddenState
+
+	hiddenState = l.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = l.SelfAttention.Forward(ctx, hiddenState, positions, ropeFactors, cache, opts)
+
+	// In the final layer (outputs != nil), optimize by pruning to just the token positions
+	// we need logits for.
+	if outputs != nil {
+		hiddenState = hiddenState.Rows(ctx, outputs)
+		residual = residual.Rows(ctx, outputs)
+	}
+
+	hiddenState = hiddenState.Add(ctx, residual)
+	residual = hiddenState
+
+	hiddenState = l.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = l.MLP.Forward(ctx, hiddenState)
+	return hiddenState.Add(ctx, residual)
+}
+
+func (m *TextModel) Forward(ctx ml.Context, batch input.Batch, cache kvcache.Cache) ml.Tensor {
+	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
+
+	hiddenState := m.TokenEmbedding.Forward(ctx, batch.Inputs).Duplicate(ctx)
+
+	// set image embeddings
+	for _, image := range batch.Multimodal {
+		visionOutputs := image.Multimodal[0].Tensor
+		ctx.Forward(visionOutputs.Copy(ctx, hiddenState.View(ctx, image.Index*hiddenState.Stride(1), visionOutputs.Dim(0)*visionOutputs.Dim(1))))
+	}
+
+	ropeFactors := m.ropeFactors(cache)
+	for i, layer := range m.Layers {
+		cache.SetLayer(i)
+
+		var outputs ml.Tensor
+		if i == len(m.Layers)-1 {
+			outputs = batch.Outputs
+		}
+
+		hiddenState = layer.Forward(ctx, hiddenState, positions, ropeFactors, outputs, cache, m.TextOptions)
+		hiddenState = ctx.ApplyControlVectors(i, hiddenState)
+	}
+
+	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
+	return m.Output.Forward(ctx, hiddenState)
+}
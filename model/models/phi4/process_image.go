@@ -0,0 +1,111 @@
+package phi4
+
+import (
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	"golang.org/x/image/draw"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/model/imageproc"
+)
+
+type ImageProcessor struct {
+	imageSize, patchSize, numChannels int
+	maxCrops                          int
+}
+
+func newImageProcessor(c fs.Config) ImageProcessor {
+	return ImageProcessor{
+		imageSize:   int(c.Uint("vision.image_size", 448)),
+		patchSize:   int(c.Uint("vision.patch_size", 14)),
+		numChannels: int(c.Uint("vision.num_channels", 3)),
+		maxCrops:    int(c.Uint("vision.max_crops", 36)),
+	}
+}
+
+// cropGrid returns the number of crops in each direction for an image of the
+// given size. Images which need more than the maximum number of crops are
+// fit to the grid with the closest aspect ratio.
+func (p *ImageProcessor) cropGrid(size image.Point) image.Point {
+	grid := image.Point{
+		(size.X + p.imageSize - 1) / p.imageSize,
+		(size.Y + p.imageSize - 1) / p.imageSize,
+	}
+
+	if grid.X*grid.Y <= p.maxCrops {
+		return grid
+	}
+
+	aspectRatio := float64(size.X) / float64(size.Y)
+	area := float64(size.X * size.Y)
+
+	best, bestDiff := image.Point{1, 1}, math.Inf(1)
+	for n := 1; n <= p.maxCrops; n++ {
+		for x := 1; x <= n; x++ {
+			if n%x != 0 {
+				continue
+			}
+
+			y := n / x
+			switch diff := math.Abs(aspectRatio - float64(x)/float64(y)); {
+			case diff < bestDiff:
+				best, bestDiff = image.Point{x, y}, diff
+			case diff == bestDiff && area > 0.5*float64(p.imageSize*p.imageSize*n):
+				best = image.Point{x, y}
+			}
+		}
+	}
+
+	return best
+}
+
+// ProcessImage resizes an image to fit a grid of crops, padding it on the
+// right and bottom. It returns the pixel values of a global view of the image
+// followed by each crop and the grid size. The size of the image without
+// padding is returned in units of pooled patches, i.e. two patches.
+func (p *ImageProcessor) ProcessImage(img image.Image) ([][]float32, image.Point, image.Point) {
+	img = imageproc.Composite(img)
+
+	size := img.Bounds().Size()
+	grid := p.cropGrid(size)
+	target := grid.Mul(p.imageSize)
+
+	// resize preserving the aspect ratio
+	resized := target
+	if ratioX, ratioY := float64(target.X)/float64(size.X), float64(target.Y)/float64(size.Y); ratioX < ratioY {
+		resized.Y = int(float64(size.Y) * ratioX)
+	} else {
+		resized.X = int(float64(size.X) * ratioY)
+	}
+
+	dst := image.NewRGBA(image.Rectangle{Max: target})
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	draw.BiLinear.Scale(dst, image.Rectangle{Max: resized}, img, img.Bounds(), draw.Over, nil)
+
+	pixelValues := [][]float32{
+		p.normalize(imageproc.Resize(dst, image.Point{p.imageSize, p.imageSize}, imageproc.ResizeCatmullrom)),
+	}
+
+	for y := range grid.Y {
+		for x := range grid.X {
+			crop := image.Rectangle{image.Point{x, y}.Mul(p.imageSize), image.Point{x + 1, y + 1}.Mul(p.imageSize)}
+			pixelValues = append(pixelValues, p.normalize(dst.SubImage(crop)))
+		}
+	}
+
+	// patches which are only padding are masked
+	patches := image.Point{
+		grid.X*p.imageSize/p.patchSize - (target.X-resized.X)/p.patchSize,
+		grid.Y*p.imageSize/p.patchSize - (target.Y-resized.Y)/p.patchSize,
+	}
+
+	return pixelValues, grid, image.Point{(patches.X + 1) / 2, (patches.Y + 1) / 2}
+}
+
+func (p *ImageProcessor) normalize(img image.Image) []float32 {
+	return imageproc.Normalize(img, imageproc.ImageNetStandardMean, imageproc.ImageNetStandardSTD, true, true)
+}
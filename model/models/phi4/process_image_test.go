@@ -0,0 +1,65 @@
+package phi4
+
+import (
+	"image"
+	"testing"
+)
+
+func TestProcessImage(t *testing.T) {
+	p := ImageProcessor{imageSize: 448, patchSize: 14, numChannels: 3, maxCrops: 36}
+
+	tests := []struct {
+		name   string
+		size   image.Point
+		grid   image.Point
+		useful image.Point
+	}{
+		{
+			name:   "single crop",
+			size:   image.Point{448, 448},
+			grid:   image.Point{1, 1},
+			useful: image.Point{16, 16},
+		},
+		{
+			name:   "wide",
+			size:   image.Point{1000, 500},
+			grid:   image.Point{3, 2},
+			useful: image.Point{48, 24},
+		},
+		{
+			name:   "small",
+			size:   image.Point{100, 50},
+			grid:   image.Point{1, 1},
+			useful: image.Point{16, 8},
+		},
+		{
+			name:   "too many crops",
+			size:   image.Point{5000, 5000},
+			grid:   image.Point{6, 6},
+			useful: image.Point{96, 96},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixelValues, grid, useful := p.ProcessImage(image.NewRGBA(image.Rectangle{Max: tt.size}))
+			if grid != tt.grid {
+				t.Errorf("grid = %v; want %v", grid, tt.grid)
+			}
+
+			if useful != tt.useful {
+				t.Errorf("useful = %v; want %v", useful, tt.useful)
+			}
+
+			if want := 1 + tt.grid.X*tt.grid.Y; len(pixelValues) != want {
+				t.Errorf("len(pixelValues) = %d; want %d", len(pixelValues), want)
+			}
+
+			for i := range pixelValues {
+				if len(pixelValues[i]) != 448*448*3 {
+					t.Errorf("len(pixelValues[%d]) = %d; want %d", i, len(pixelValues[i]), 448*448*3)
+				}
+			}
+		})
+	}
+}
@@ -102,6 +102,11 @@ type Model struct {
 	Options
 }
 
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m Model) SupportsControlVectors() bool {
+	return true
+}
+
 // Forward implements model.Model.
 func (m Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
@@ -117,6 +122,7 @@ func (m Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		}
 
 		hiddenStates = layer.Forward(ctx, hiddenStates, positions, outputs, m.Cache, &m.Options)
+		hiddenStates = ctx.ApplyControlVectors(i, hiddenStates)
 	}
 
 	hiddenStates = m.OutputNorm.Forward(ctx, hiddenStates, m.eps)
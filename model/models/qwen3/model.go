@@ -27,6 +27,10 @@ type Options struct {
 	ropeType              string
 	originalContextLength int
 
+	// YaRN parameters, 0 for the defaults
+	ropeExtrapolation, ropeAttnFactor float32
+	ropeBetaFast, ropeBetaSlow        float32
+
 	numExperts, numExpertsUsed int
 	normTopKProb               bool
 }
@@ -38,11 +42,13 @@ func (o Options) headDim() int {
 func (o Options) applyRotaryPositionEmbeddings(ctx ml.Context, states, positions ml.Tensor) ml.Tensor {
 	opts := []func(*rope.Options){rope.WithTypeNeoX()}
 	if o.ropeType == "yarn" {
-		attnFactor := float32(1.0 / (1.0 + 0.1*math.Log(float64(o.ropeScale))))
+		attnFactor := cmp.Or(o.ropeAttnFactor, float32(1.0/(1.0+0.1*math.Log(float64(o.ropeScale)))))
 		opts = append(opts,
 			rope.WithOriginalContextLength(o.originalContextLength),
-			rope.WithExtrapolationFactor(1.),
+			rope.WithExtrapolationFactor(cmp.Or(o.ropeExtrapolation, 1)),
 			rope.WithAttentionFactor(attnFactor),
+			rope.WithBetaFast(o.ropeBetaFast),
+			rope.WithBetaSlow(o.ropeBetaSlow),
 		)
 	}
 	return nn.RoPE(ctx, states, positions, o.headDim(), o.ropeBase, 1./o.ropeScale, opts...)
@@ -196,6 +202,7 @@ func (m *Model) forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
 		}
 
 		hiddenStates = layer.Forward(ctx, hiddenStates, positions, outputs, m.Cache, m.Options)
+		hiddenStates = ctx.ApplyControlVectors(i, hiddenStates)
 	}
 
 	return m.OutputNorm.Forward(ctx, hiddenStates, m.eps), nil
@@ -205,6 +212,21 @@ func (m *Model) Shift(ctx ml.Context, layer int, key, shift ml.Tensor) (ml.Tenso
 	return m.Options.applyRotaryPositionEmbeddings(ctx, key, shift), nil
 }
 
+// SupportsRopeScaling implements model.RopeScaler
+func (m *Model) SupportsRopeScaling(scalingType string) bool {
+	switch scalingType {
+	case "none", "linear", "yarn":
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsControlVectors implements model.ControlVectorApplier
+func (m *Model) SupportsControlVectors() bool {
+	return true
+}
+
 var _ model.Model = (*Model)(nil)
 
 func New(c fs.Config) (model.Model, error) {
@@ -245,6 +267,10 @@ func New(c fs.Config) (model.Model, error) {
 			ropeBase:              c.Float("rope.freq_base"),
 			ropeScale:             c.Float("rope.scaling.factor", 1),
 			originalContextLength: int(c.Uint("rope.scaling.original_context_length")),
+			ropeExtrapolation:     c.Float("rope.scaling.extrapolation_factor"),
+			ropeAttnFactor:        c.Float("rope.scaling.attn_factor"),
+			ropeBetaFast:          c.Float("rope.scaling.beta_fast"),
+			ropeBetaSlow:          c.Float("rope.scaling.beta_slow"),
 			numExperts:            int(c.Uint("expert_count")),
 			numExpertsUsed:        int(c.Uint("expert_used_count")),
 			normTopKProb:          c.Bool("norm_top_k_prob", true),
@@ -0,0 +1,110 @@
+package whisper
+
+import (
+	"fmt"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/audioproc"
+	"github.com/ollama/ollama/model/input"
+)
+
+type Model struct {
+	model.Base
+	model.BytePairEncoding
+
+	*AudioModel `gguf:"a"`
+	*TextModel
+
+	AudioProcessor
+
+	// startOfTranscript is the token the decoder starts from. It takes the
+	// place of the audio in the input.
+	startOfTranscript int32
+}
+
+var _ model.MultimodalProcessor = (*Model)(nil)
+
+const (
+	crossAttentionLayer = iota
+	selfAttentionLayer
+)
+
+func New(c fs.Config) (model.Model, error) {
+	vocabulary := &model.Vocabulary{
+		Values: c.Strings("tokenizer.ggml.tokens"),
+		Types:  c.Ints("tokenizer.ggml.token_type"),
+		Merges: c.Strings("tokenizer.ggml.merges"),
+		AddBOS: c.Bool("tokenizer.ggml.add_bos_token", false),
+		BOS:    []int32{int32(c.Uint("tokenizer.ggml.bos_token_id"))},
+		AddEOS: c.Bool("tokenizer.ggml.add_eos_token", false),
+		EOS: append(
+			[]int32{int32(c.Uint("tokenizer.ggml.eos_token_id"))},
+			c.Ints("tokenizer.ggml.eos_token_ids")...,
+		),
+	}
+
+	m := Model{
+		BytePairEncoding: model.NewBytePairEncoding(
+			vocabulary,
+			`'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
+		),
+		AudioModel:        newAudioModel(c),
+		TextModel:         newTextModel(c),
+		AudioProcessor:    newAudioProcessor(c),
+		startOfTranscript: vocabulary.Encode("<|startoftranscript|>"),
+	}
+
+	if m.startOfTranscript < 0 {
+		return nil, fmt.Errorf("whisper: vocabulary is missing %q", "<|startoftranscript|>")
+	}
+
+	encoderCache := kvcache.NewEncoderCache()
+	encoderCache.SetConfig(ml.CacheConfig{})
+	m.Cache = kvcache.NewWrapperCache(encoderCache, kvcache.NewCausalCache(nil))
+
+	return &m, nil
+}
+
+func (m *Model) EncodeMultimodal(ctx ml.Context, multimodalData []byte) ([]input.Multimodal, error) {
+	samples, rate, err := audioproc.Decode(multimodalData)
+	if err != nil {
+		return nil, err
+	}
+
+	samples = audioproc.Resample(samples, rate, sampleRate)
+	if len(samples) > chunkSamples {
+		return nil, fmt.Errorf("whisper: audio is longer than %d seconds", chunkSamples/sampleRate)
+	}
+
+	mel := ctx.Input().FromFloats(m.LogMelSpectrogram(samples), numFrames, m.numMels)
+	return []input.Multimodal{{Tensor: m.AudioModel.Forward(ctx, mel)}}, nil
+}
+
+// PostTokenize starts the decoder from the audio, which stands in for the
+// start of transcript token.
+func (m *Model) PostTokenize(inputs []*input.Input) ([]*input.Input, error) {
+	for i := range inputs {
+		if inputs[i].Multimodal != nil {
+			inputs[i].Token = m.startOfTranscript
+		}
+	}
+
+	return inputs, nil
+}
+
+func (m *Model) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	var encoderStates ml.Tensor
+	if len(batch.Multimodal) > 0 {
+		encoderStates = batch.Multimodal[len(batch.Multimodal)-1].Multimodal[0].Tensor
+	}
+
+	positions := ctx.Input().FromInts(batch.Positions, len(batch.Positions))
+	return m.TextModel.Forward(ctx, batch.Inputs, positions, batch.Outputs, encoderStates, m.Cache.(*kvcache.WrapperCache)), nil
+}
+
+func init() {
+	model.Register("whisper", New)
+}
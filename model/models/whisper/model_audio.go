@@ -0,0 +1,108 @@
+package whisper
+
+import (
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+)
+
+type AudioSelfAttention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_output"`
+}
+
+func (sa *AudioSelfAttention) Forward(ctx ml.Context, hiddenState ml.Tensor, opts *AudioModelOptions) ml.Tensor {
+	headDim := opts.hiddenSize / opts.numHeads
+	seqLength := hiddenState.Dim(1)
+
+	query := sa.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, headDim, opts.numHeads, seqLength)
+
+	key := sa.Key.Forward(ctx, hiddenState)
+	key = key.Reshape(ctx, headDim, opts.numHeads, seqLength)
+
+	value := sa.Value.Forward(ctx, hiddenState)
+	value = value.Reshape(ctx, headDim, opts.numHeads, seqLength)
+
+	attention := nn.Attention(ctx, query, key, value, 1/math.Sqrt(float64(headDim)), nil)
+	attention = attention.Reshape(ctx, opts.hiddenSize, seqLength)
+
+	return sa.Output.Forward(ctx, attention)
+}
+
+type MLP struct {
+	Up   *nn.Linear `gguf:"ffn_up"`
+	Down *nn.Linear `gguf:"ffn_down"`
+}
+
+func (mlp *MLP) Forward(ctx ml.Context, hiddenState ml.Tensor) ml.Tensor {
+	return mlp.Down.Forward(ctx, mlp.Up.Forward(ctx, hiddenState).GELU(ctx))
+}
+
+type AudioEncoderLayer struct {
+	AttentionNorm *nn.LayerNorm `gguf:"attn_norm"`
+	SelfAttention *AudioSelfAttention
+
+	MLPNorm *nn.LayerNorm `gguf:"ffn_norm"`
+	MLP     *MLP
+}
+
+func (e *AudioEncoderLayer) Forward(ctx ml.Context, hiddenState ml.Tensor, opts *AudioModelOptions) ml.Tensor {
+	residual := hiddenState
+
+	hiddenState = e.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = e.SelfAttention.Forward(ctx, hiddenState, opts)
+	hiddenState = hiddenState.Add(ctx, residual)
+	residual = hiddenState
+
+	hiddenState = e.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = e.MLP.Forward(ctx, hiddenState)
+	return hiddenState.Add(ctx, residual)
+}
+
+type AudioModelOptions struct {
+	hiddenSize, numHeads int
+	eps                  float32
+}
+
+type AudioModel struct {
+	Conv1             *nn.Conv1D    `gguf:"conv1"`
+	Conv2             *nn.Conv1D    `gguf:"conv2"`
+	PositionEmbedding ml.Tensor     `gguf:"position_embd.weight"`
+	PostNorm          *nn.LayerNorm `gguf:"post_norm"`
+
+	Layers []AudioEncoderLayer `gguf:"blk"`
+
+	*AudioModelOptions
+}
+
+// Forward encodes a log mel spectrogram with shape [frames, mels] into
+// hidden states with shape [hiddenSize, frames/2].
+func (m *AudioModel) Forward(ctx ml.Context, mel ml.Tensor) ml.Tensor {
+	hiddenState := m.Conv1.Forward(ctx, mel, 1, 1, 1).GELU(ctx)
+	hiddenState = m.Conv2.Forward(ctx, hiddenState, 2, 1, 1).GELU(ctx)
+	hiddenState = hiddenState.Permute(ctx, 1, 0, 2, 3).Contiguous(ctx)
+	hiddenState = hiddenState.Reshape(ctx, hiddenState.Dim(0), hiddenState.Dim(1))
+	hiddenState = hiddenState.Add(ctx, m.PositionEmbedding)
+
+	for _, layer := range m.Layers {
+		hiddenState = layer.Forward(ctx, hiddenState, m.AudioModelOptions)
+	}
+
+	return m.PostNorm.Forward(ctx, hiddenState, m.eps)
+}
+
+func newAudioModel(c fs.Config) *AudioModel {
+	return &AudioModel{
+		Layers: make([]AudioEncoderLayer, c.Uint("audio.block_count")),
+		AudioModelOptions: &AudioModelOptions{
+			hiddenSize: int(c.Uint("audio.embedding_length")),
+			numHeads:   int(c.Uint("audio.attention.head_count")),
+			eps:        c.Float("audio.attention.layer_norm_epsilon", 1e-5),
+		},
+	}
+}
@@ -0,0 +1,160 @@
+package whisper
+
+import (
+	"math"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/ml/nn"
+)
+
+type TextSelfAttention struct {
+	Query  *nn.Linear `gguf:"attn_q"`
+	Key    *nn.Linear `gguf:"attn_k"`
+	Value  *nn.Linear `gguf:"attn_v"`
+	Output *nn.Linear `gguf:"attn_output"`
+}
+
+func (sa *TextSelfAttention) Forward(ctx ml.Context, hiddenState ml.Tensor, cache *kvcache.WrapperCache, opts *TextModelOptions) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+	headDim := opts.hiddenSize / opts.numHeads
+
+	query := sa.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	key := sa.Key.Forward(ctx, hiddenState)
+	key = key.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	value := sa.Value.Forward(ctx, hiddenState)
+	value = value.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	attention := nn.Attention(ctx, query, key, value, 1/math.Sqrt(float64(headDim)), cache)
+	attention = attention.Reshape(ctx, opts.hiddenSize, batchSize)
+
+	return sa.Output.Forward(ctx, attention)
+}
+
+type TextCrossAttention struct {
+	Query  *nn.Linear `gguf:"cross_attn_q"`
+	Key    *nn.Linear `gguf:"cross_attn_k"`
+	Value  *nn.Linear `gguf:"cross_attn_v"`
+	Output *nn.Linear `gguf:"cross_attn_output"`
+}
+
+func (ca *TextCrossAttention) Forward(ctx ml.Context, hiddenState, encoderStates ml.Tensor, cache *kvcache.WrapperCache, opts *TextModelOptions) ml.Tensor {
+	batchSize := hiddenState.Dim(1)
+	headDim := opts.hiddenSize / opts.numHeads
+
+	query := ca.Query.Forward(ctx, hiddenState)
+	query = query.Reshape(ctx, headDim, opts.numHeads, batchSize)
+
+	// keys and values only depend on the audio so they are computed once
+	// and read from the encoder cache for later batches
+	if encoderStates != nil {
+		numFrames := encoderStates.Dim(1)
+
+		key := ca.Key.Forward(ctx, encoderStates)
+		key = key.Reshape(ctx, headDim, opts.numHeads, numFrames)
+
+		value := ca.Value.Forward(ctx, encoderStates)
+		value = value.Reshape(ctx, headDim, opts.numHeads, numFrames)
+
+		cache.Put(ctx, key, value)
+	}
+
+	key, value, _ := cache.Get(ctx)
+
+	attention := nn.Attention(ctx, query, key, value, 1/math.Sqrt(float64(headDim)), nil)
+	attention = attention.Reshape(ctx, opts.hiddenSize, batchSize)
+
+	return ca.Output.Forward(ctx, attention)
+}
+
+type TextDecoderLayer struct {
+	AttentionNorm *nn.LayerNorm `gguf:"attn_norm"`
+	SelfAttention *TextSelfAttention
+
+	CrossAttentionNorm *nn.LayerNorm `gguf:"cross_attn_norm"`
+	CrossAttention     *TextCrossAttention
+
+	MLPNorm *nn.LayerNorm `gguf:"ffn_norm"`
+	MLP     *MLP
+}
+
+func (d *TextDecoderLayer) Forward(ctx ml.Context, hiddenState, outputs, encoderStates ml.Tensor, cache *kvcache.WrapperCache, opts *TextModelOptions) ml.Tensor {
+	residual := hiddenState
+
+	cache.SetLayerType(selfAttentionLayer)
+	hiddenState = d.AttentionNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = d.SelfAttention.Forward(ctx, hiddenState, cache, opts)
+
+	// In the final layer (outputs != nil), optimize by pruning to just the token positions
+	// we need logits for.
+	if outputs != nil {
+		hiddenState = hiddenState.Rows(ctx, outputs)
+		residual = residual.Rows(ctx, outputs)
+	}
+
+	hiddenState = hiddenState.Add(ctx, residual)
+
+	cache.SetLayerType(crossAttentionLayer)
+	if encoderStates != nil || cache.UnderlyingCache().(*kvcache.EncoderCache).EncoderCached() {
+		residual = hiddenState
+		hiddenState = d.CrossAttentionNorm.Forward(ctx, hiddenState, opts.eps)
+		hiddenState = d.CrossAttention.Forward(ctx, hiddenState, encoderStates, cache, opts)
+		hiddenState = hiddenState.Add(ctx, residual)
+	}
+
+	residual = hiddenState
+	hiddenState = d.MLPNorm.Forward(ctx, hiddenState, opts.eps)
+	hiddenState = d.MLP.Forward(ctx, hiddenState)
+	return hiddenState.Add(ctx, residual)
+}
+
+type TextModelOptions struct {
+	hiddenSize, numHeads int
+	eps                  float32
+}
+
+type TextModel struct {
+	TokenEmbedding    *nn.Embedding `gguf:"token_embd"`
+	PositionEmbedding *nn.Embedding `gguf:"position_embd"`
+
+	Layers []TextDecoderLayer `gguf:"blk"`
+
+	OutputNorm *nn.LayerNorm `gguf:"output_norm"`
+	Output     *nn.Linear    `gguf:"output,alt:token_embd"`
+
+	*TextModelOptions
+}
+
+func (m *TextModel) Forward(ctx ml.Context, inputIDs, positions, outputs, encoderStates ml.Tensor, cache *kvcache.WrapperCache) ml.Tensor {
+	hiddenState := m.TokenEmbedding.Forward(ctx, inputIDs)
+	hiddenState = hiddenState.Add(ctx, m.PositionEmbedding.Forward(ctx, positions))
+
+	for i, layer := range m.Layers {
+		cache.SetLayer(i)
+
+		var lastLayerOutputs ml.Tensor
+		if i == len(m.Layers)-1 {
+			lastLayerOutputs = outputs
+		}
+
+		hiddenState = layer.Forward(ctx, hiddenState, lastLayerOutputs, encoderStates, cache, m.TextModelOptions)
+	}
+
+	hiddenState = m.OutputNorm.Forward(ctx, hiddenState, m.eps)
+	return m.Output.Forward(ctx, hiddenState)
+}
+
+func newTextModel(c fs.Config) *TextModel {
+	return &TextModel{
+		Layers: make([]TextDecoderLayer, c.Uint("block_count")),
+		TextModelOptions: &TextModelOptions{
+			hiddenSize: int(c.Uint("embedding_length")),
+			numHeads:   int(c.Uint("attention.head_count")),
+			eps:        c.Float("attention.layer_norm_epsilon", 1e-5),
+		},
+	}
+}
@@ -0,0 +1,144 @@
+package whisper
+
+import (
+	"math"
+
+	"github.com/ollama/ollama/fs"
+)
+
+const (
+	sampleRate = 16000
+
+	// chunkSamples is the number of samples in the 30 second window the
+	// encoder expects. Shorter audio is padded with silence.
+	chunkSamples = 30 * sampleRate
+
+	nFFT      = 400
+	hopLength = 160
+	numFrames = chunkSamples / hopLength
+	numBins   = nFFT/2 + 1
+)
+
+type AudioProcessor struct {
+	numMels int
+
+	window  []float64
+	cos     []float64
+	sin     []float64
+	filters [][]float64
+}
+
+func newAudioProcessor(c fs.Config) AudioProcessor {
+	p := AudioProcessor{
+		numMels: int(c.Uint("audio.num_mel_bins", 80)),
+		window:  make([]float64, nFFT),
+		cos:     make([]float64, nFFT),
+		sin:     make([]float64, nFFT),
+	}
+
+	for i := range nFFT {
+		// periodic Hann window
+		p.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/nFFT)
+		p.cos[i] = math.Cos(2 * math.Pi * float64(i) / nFFT)
+		p.sin[i] = math.Sin(2 * math.Pi * float64(i) / nFFT)
+	}
+
+	p.filters = melFilters(p.numMels)
+	return p
+}
+
+// hzToMel and melToHz use the Slaney mel scale, which is linear below 1 kHz
+// and logarithmic above it.
+func hzToMel(hz float64) float64 {
+	if hz < 1000 {
+		return 3 * hz / 200
+	}
+	return 15 + math.Log(hz/1000)/(math.Log(6.4)/27)
+}
+
+func melToHz(mel float64) float64 {
+	if mel < 15 {
+		return 200 * mel / 3
+	}
+	return 1000 * math.Exp((mel-15)*math.Log(6.4)/27)
+}
+
+// melFilters builds Slaney normalized triangular filters over the FFT bins.
+func melFilters(numMels int) [][]float64 {
+	maxMel := hzToMel(sampleRate / 2)
+
+	points := make([]float64, numMels+2)
+	for i := range points {
+		points[i] = melToHz(maxMel * float64(i) / float64(numMels+1))
+	}
+
+	filters := make([][]float64, numMels)
+	for m := range filters {
+		filters[m] = make([]float64, numBins)
+		lo, center, hi := points[m], points[m+1], points[m+2]
+		norm := 2 / (hi - lo)
+		for k := range numBins {
+			hz := float64(k) * sampleRate / nFFT
+			w := min((hz-lo)/(center-lo), (hi-hz)/(hi-center))
+			filters[m][k] = max(0, w) * norm
+		}
+	}
+
+	return filters
+}
+
+// LogMelSpectrogram computes the normalized log mel spectrogram of 16 kHz
+// samples, padded or trimmed to 30 seconds. The result is laid out as
+// numMels rows of numFrames values.
+func (p *AudioProcessor) LogMelSpectrogram(samples []float32) []float32 {
+	// reflect pad by half a window so frames are centered on each hop
+	padded := make([]float64, chunkSamples+nFFT)
+	for i := range chunkSamples {
+		if i < len(samples) {
+			padded[nFFT/2+i] = float64(samples[i])
+		}
+	}
+	for i := range nFFT / 2 {
+		padded[nFFT/2-1-i] = padded[nFFT/2+1+i]
+		padded[nFFT/2+chunkSamples+i] = padded[nFFT/2+chunkSamples-2-i]
+	}
+
+	mel := make([]float64, p.numMels*numFrames)
+	frame := make([]float64, nFFT)
+	power := make([]float64, numBins)
+	for t := range numFrames {
+		for i := range frame {
+			frame[i] = padded[t*hopLength+i] * p.window[i]
+		}
+
+		for k := range power {
+			var re, im float64
+			for i, v := range frame {
+				j := k * i % nFFT
+				re += v * p.cos[j]
+				im -= v * p.sin[j]
+			}
+			power[k] = re*re + im*im
+		}
+
+		for m, filter := range p.filters {
+			var sum float64
+			for k, w := range filter {
+				sum += w * power[k]
+			}
+			mel[m*numFrames+t] = math.Log10(max(sum, 1e-10))
+		}
+	}
+
+	maxValue := math.Inf(-1)
+	for _, v := range mel {
+		maxValue = max(maxValue, v)
+	}
+
+	out := make([]float32, len(mel))
+	for i, v := range mel {
+		out[i] = float32((max(v, maxValue-8) + 4) / 4)
+	}
+
+	return out
+}
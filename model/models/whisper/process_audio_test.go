@@ -0,0 +1,79 @@
+package whisper
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+func TestMelScale(t *testing.T) {
+	for _, hz := range []float64{0, 200, 999, 1000, 4000, 8000} {
+		if got := melToHz(hzToMel(hz)); math.Abs(got-hz) > 1e-6 {
+			t.Errorf("expected %v, got %v", hz, got)
+		}
+	}
+
+	if mel := hzToMel(1000); mel != 15 {
+		t.Errorf("expected 1 kHz to be mel 15, got %v", mel)
+	}
+}
+
+func TestLogMelSpectrogram(t *testing.T) {
+	p := newAudioProcessor(ggml.KV{"general.architecture": "whisper"})
+
+	t.Run("silence", func(t *testing.T) {
+		mel := p.LogMelSpectrogram(nil)
+		if len(mel) != 80*numFrames {
+			t.Fatalf("expected %d values, got %d", 80*numFrames, len(mel))
+		}
+
+		for i, v := range mel {
+			if v != -1.5 {
+				t.Fatalf("value %d: expected -1.5, got %v", i, v)
+			}
+		}
+	})
+
+	t.Run("tone", func(t *testing.T) {
+		// one second of a 1 kHz tone followed by silence
+		samples := make([]float32, sampleRate)
+		for i := range samples {
+			samples[i] = float32(math.Sin(2 * math.Pi * 1000 * float64(i) / sampleRate))
+		}
+
+		mel := p.LogMelSpectrogram(samples)
+
+		// the loudest bin is the filter centered closest to 1 kHz
+		want, best := 0, math.Inf(1)
+		for m := range p.numMels {
+			center := melToHz(hzToMel(sampleRate/2) * float64(m+1) / float64(p.numMels+1))
+			if d := math.Abs(center - 1000); d < best {
+				want, best = m, d
+			}
+		}
+
+		frame := 50
+		got := 0
+		for m := range p.numMels {
+			if mel[m*numFrames+frame] > mel[got*numFrames+frame] {
+				got = m
+			}
+		}
+
+		if got != want {
+			t.Errorf("expected loudest mel bin %d, got %d", want, got)
+		}
+
+		// silence after the tone is clamped to 8 below the maximum, which
+		// is 2 after scaling
+		loudest := mel[0]
+		for _, v := range mel {
+			loudest = max(loudest, v)
+		}
+
+		if v := mel[numFrames-1]; math.Abs(float64(loudest-2-v)) > 1e-5 {
+			t.Errorf("expected silence to be %v, got %v", loudest-2, v)
+		}
+	})
+}
@@ -74,6 +74,8 @@ func ParserForName(name string) Parser {
 		return &LFM2Parser{hasThinkingSupport: false}
 	case "lfm2-thinking":
 		return &LFM2Parser{hasThinkingSupport: true}
+	case "phi-4-mini":
+		return &Phi4MiniParser{}
 	default:
 		return nil
 	}
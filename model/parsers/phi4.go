@@ -0,0 +1,90 @@
+package parsers
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/ollama/ollama/api"
+)
+
+const phi4ToolCallPrefix = "functools["
+
+// Phi4MiniParser parses the output of Phi-4-mini and Phi-4-multimodal where
+// tool calls are a JSON array following "functools", e.g.
+// functools[{"name": "get_weather", "arguments": {"location": "Paris"}}]
+type Phi4MiniParser struct {
+	buffer             strings.Builder
+	collectingToolCall bool
+}
+
+func (p *Phi4MiniParser) HasToolSupport() bool {
+	return true
+}
+
+func (p *Phi4MiniParser) HasThinkingSupport() bool {
+	return false
+}
+
+func (p *Phi4MiniParser) Init(tools []api.Tool, lastMessage *api.Message, thinkValue *api.ThinkValue) []api.Tool {
+	return tools
+}
+
+func (p *Phi4MiniParser) Add(s string, done bool) (content string, thinking string, calls []api.ToolCall, err error) {
+	p.buffer.WriteString(s)
+	bufStr := p.buffer.String()
+
+	if !p.collectingToolCall {
+		if before, after, ok := strings.Cut(bufStr, phi4ToolCallPrefix); ok {
+			content = strings.TrimRightFunc(before, unicode.IsSpace)
+			p.collectingToolCall = true
+			bufStr = "[" + after
+		} else {
+			// hold back a partial prefix and the whitespace before it until
+			// they can be disambiguated
+			n := len(bufStr)
+			if !done {
+				n -= overlap(bufStr, phi4ToolCallPrefix)
+				n -= trailingWhitespaceLen(bufStr[:n])
+			}
+
+			p.buffer.Reset()
+			p.buffer.WriteString(bufStr[n:])
+			return bufStr[:n], "", nil, nil
+		}
+	}
+
+	var toolCalls []struct {
+		Name      string                        `json:"name"`
+		Arguments api.ToolCallFunctionArguments `json:"arguments"`
+	}
+
+	dec := json.NewDecoder(strings.NewReader(bufStr))
+	if err := dec.Decode(&toolCalls); err != nil {
+		if done {
+			// the tool call never completed so return it as is
+			p.buffer.Reset()
+			return content + strings.Replace(bufStr, "[", phi4ToolCallPrefix, 1), "", nil, nil
+		}
+
+		p.buffer.Reset()
+		p.buffer.WriteString(bufStr)
+		return content, "", nil, nil
+	}
+
+	// text after the tool calls is content
+	p.buffer.Reset()
+	p.buffer.WriteString(strings.TrimLeftFunc(bufStr[dec.InputOffset():], unicode.IsSpace))
+	p.collectingToolCall = false
+	for _, call := range toolCalls {
+		calls = append(calls, api.ToolCall{
+			Function: api.ToolCallFunction{
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			},
+		})
+	}
+
+	more, _, moreCalls, err := p.Add("", done)
+	return content + more, "", append(calls, moreCalls...), err
+}
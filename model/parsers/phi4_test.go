@@ -0,0 +1,96 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestPhi4MiniParser(t *testing.T) {
+	tests := []struct {
+		name            string
+		chunks          []string
+		expectedContent string
+		expectedCalls   []api.ToolCall
+	}{
+		{
+			name:            "content",
+			chunks:          []string{"Hello, ", "how are you?"},
+			expectedContent: "Hello, how are you?",
+		},
+		{
+			name:            "content resembling prefix",
+			chunks:          []string{"use the func", "tion"},
+			expectedContent: "use the function",
+		},
+		{
+			name:   "tool call",
+			chunks: []string{`functools[{"name": "get_weather", "arguments": {"location": "Paris"}}]`},
+			expectedCalls: []api.ToolCall{
+				{
+					Function: api.ToolCallFunction{
+						Name:      "get_weather",
+						Arguments: testArgs(map[string]any{"location": "Paris"}),
+					},
+				},
+			},
+		},
+		{
+			name: "streamed tool calls",
+			chunks: []string{
+				"Let me check. func", "tools[{\"name\": \"get_weather\", ",
+				`"arguments": {"location": "Paris"}}, {"name": "get_weather", `,
+				`"arguments": {"location": "London"}}]`,
+			},
+			expectedContent: "Let me check.",
+			expectedCalls: []api.ToolCall{
+				{
+					Function: api.ToolCallFunction{
+						Name:      "get_weather",
+						Arguments: testArgs(map[string]any{"location": "Paris"}),
+					},
+				},
+				{
+					Function: api.ToolCallFunction{
+						Name:      "get_weather",
+						Arguments: testArgs(map[string]any{"location": "London"}),
+					},
+				},
+			},
+		},
+		{
+			name:            "incomplete tool call",
+			chunks:          []string{`functools[{"name": "get_weather"`},
+			expectedContent: `functools[{"name": "get_weather"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := ParserForName("phi-4-mini")
+			parser.Init(nil, nil, nil)
+
+			var content string
+			var calls []api.ToolCall
+			for i, chunk := range tt.chunks {
+				c, _, tc, err := parser.Add(chunk, i == len(tt.chunks)-1)
+				if err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+
+				content += c
+				calls = append(calls, tc...)
+			}
+
+			if diff := cmp.Diff(tt.expectedContent, content); diff != "" {
+				t.Errorf("Content mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.expectedCalls, calls, argsComparer); diff != "" {
+				t.Errorf("Tool calls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package renderers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Phi4MiniRenderer renders prompts for Phi-4-mini and Phi-4-multimodal.
+// Tools are listed in the system turn and past tool calls are rendered in
+// the functools[...] format the models generate.
+type Phi4MiniRenderer struct{}
+
+func (r *Phi4MiniRenderer) Render(messages []api.Message, tools []api.Tool, _ *api.ThinkValue) (string, error) {
+	var sb strings.Builder
+
+	var system string
+	if len(messages) > 0 && messages[0].Role == "system" {
+		system = messages[0].Content
+		messages = messages[1:]
+	}
+
+	if system != "" || len(tools) > 0 {
+		sb.WriteString("<|system|>")
+		sb.WriteString(system)
+		if len(tools) > 0 {
+			functions := make([]api.ToolFunction, len(tools))
+			for i, tool := range tools {
+				functions[i] = tool.Function
+			}
+
+			bts, err := json.Marshal(functions)
+			if err != nil {
+				return "", err
+			}
+
+			sb.WriteString("<|tool|>")
+			sb.Write(bts)
+			sb.WriteString("<|/tool|>")
+		}
+		sb.WriteString("<|end|>")
+	}
+
+	for i, message := range messages {
+		sb.WriteString("<|" + message.Role + "|>")
+		sb.WriteString(message.Content)
+
+		if message.Role == "assistant" && len(message.ToolCalls) > 0 {
+			calls := make([]map[string]any, len(message.ToolCalls))
+			for j, call := range message.ToolCalls {
+				calls[j] = map[string]any{
+					"name":      call.Function.Name,
+					"arguments": call.Function.Arguments,
+				}
+			}
+
+			bts, err := json.Marshal(calls)
+			if err != nil {
+				return "", err
+			}
+
+			sb.WriteString("functools")
+			sb.Write(bts)
+		}
+
+		// the last assistant message is left open for prefill
+		if message.Role == "assistant" && i == len(messages)-1 {
+			return sb.String(), nil
+		}
+
+		sb.WriteString("<|end|>")
+	}
+
+	sb.WriteString("<|assistant|>")
+	return sb.String(), nil
+}
@@ -0,0 +1,91 @@
+package renderers
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestPhi4MiniRenderer(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []api.Message
+		tools    []api.Tool
+		expected string
+	}{
+		{
+			name: "user",
+			messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			expected: "<|user|>Hello!<|end|><|assistant|>",
+		},
+		{
+			name: "system user assistant user",
+			messages: []api.Message{
+				{Role: "system", Content: "You are helpful."},
+				{Role: "user", Content: "What is 2+2?"},
+				{Role: "assistant", Content: "4"},
+				{Role: "user", Content: "Thanks!"},
+			},
+			expected: "<|system|>You are helpful.<|end|><|user|>What is 2+2?<|end|><|assistant|>4<|end|><|user|>Thanks!<|end|><|assistant|>",
+		},
+		{
+			name: "tools",
+			messages: []api.Message{
+				{Role: "user", Content: "What's the weather in Paris?"},
+				{Role: "assistant", ToolCalls: []api.ToolCall{
+					{
+						Function: api.ToolCallFunction{
+							Name:      "get_weather",
+							Arguments: testArgs(map[string]any{"location": "Paris"}),
+						},
+					},
+				}},
+				{Role: "tool", Content: "Sunny"},
+			},
+			tools: []api.Tool{
+				{
+					Type: "function",
+					Function: api.ToolFunction{
+						Name:        "get_weather",
+						Description: "Get current weather",
+						Parameters: api.ToolFunctionParameters{
+							Type: "object",
+							Properties: testPropsMap(map[string]api.ToolProperty{
+								"location": {Type: api.PropertyType{"string"}},
+							}),
+							Required: []string{"location"},
+						},
+					},
+				},
+			},
+			expected: `<|system|><|tool|>[{"name":"get_weather","description":"Get current weather","parameters":{"type":"object","required":["location"],"properties":{"location":{"type":"string"}}}}]<|/tool|><|end|>` +
+				`<|user|>What's the weather in Paris?<|end|>` +
+				`<|assistant|>functools[{"arguments":{"location":"Paris"},"name":"get_weather"}]<|end|>` +
+				`<|tool|>Sunny<|end|><|assistant|>`,
+		},
+		{
+			name: "prefill",
+			messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+				{Role: "assistant", Content: "Hi"},
+			},
+			expected: "<|user|>Hello!<|end|><|assistant|>Hi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := RenderWithRenderer("phi-4-mini", tt.messages, tt.tools, nil)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, rendered); diff != "" {
+				t.Errorf("Render() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
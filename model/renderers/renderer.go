@@ -86,6 +86,8 @@ func rendererForName(name string) Renderer {
 		return &LFM2Renderer{IsThinking: false}
 	case "lfm2-thinking":
 		return &LFM2Renderer{IsThinking: true}
+	case "phi-4-mini":
+		return &Phi4MiniRenderer{}
 	default:
 		return nil
 	}
@@ -182,7 +182,7 @@ func (spm SentencePiece) Encode(s string, addSpecial bool) ([]int32, error) {
 	}
 
 	if addSpecial {
-		ids = spm.vocab.addSpecials(ids)
+		ids = spm.vocab.AddSpecials(ids)
 	}
 
 	logutil.Trace("encoded", "string", s, "ids", ids)
@@ -43,7 +43,9 @@ func (v *Vocabulary) Is(id int32, special Special) bool {
 	}
 }
 
-func (v *Vocabulary) addSpecials(ids []int32) []int32 {
+// AddSpecials adds the special tokens, such as BOS, that the model expects
+// around a prompt to ids
+func (v *Vocabulary) AddSpecials(ids []int32) []int32 {
 	if v.AddBOS && len(v.BOS) > 0 {
 		if len(ids) > 0 && slices.Contains(v.BOS, ids[0]) {
 			slog.Warn("adding bos token to prompt which already has it", "id", v.BOS)
@@ -86,7 +88,7 @@ func (v *Vocabulary) Decode(id int32) string {
 
 func (v *Vocabulary) SpecialVocabulary() []string {
 	v.specialOnce.Do(func() {
-		for i := range v.Values {
+		for i := range v.Types {
 			if v.Types[i] == TOKEN_TYPE_CONTROL || v.Types[i] == TOKEN_TYPE_USER_DEFINED {
 				v.special = append(v.special, v.Values[i])
 			}
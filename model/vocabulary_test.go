@@ -98,7 +98,7 @@ func TestAddSpecialVocabulary(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			got := tt.vocab.addSpecials(tt.input)
+			got := tt.vocab.AddSpecials(tt.input)
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				t.Errorf("no match (-want +got):\n%s", diff)
 			}
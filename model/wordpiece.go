@@ -144,7 +144,7 @@ func (wpm WordPiece) Encode(s string, addSpecial bool) ([]int32, error) {
 	}
 
 	if addSpecial {
-		ids = wpm.vocab.addSpecials(ids)
+		ids = wpm.vocab.AddSpecials(ids)
 	}
 
 	logutil.Trace("encoded", "string", s, "ids", ids)
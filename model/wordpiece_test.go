@@ -38,6 +38,40 @@ func TestWordPiece(t *testing.T) {
 	}
 }
 
+func TestWordPieceSpecial(t *testing.T) {
+	wpm := NewWordPiece(
+		&Vocabulary{
+			Values: []string{"[UNK]", "[CLS]", "[SEP]", "▁hello", "▁world", "▁sep", "▁[", "▁]"},
+			Types:  []int32{TOKEN_TYPE_CONTROL, TOKEN_TYPE_CONTROL, TOKEN_TYPE_CONTROL, TOKEN_TYPE_NORMAL, TOKEN_TYPE_NORMAL, TOKEN_TYPE_NORMAL, TOKEN_TYPE_NORMAL, TOKEN_TYPE_NORMAL},
+			AddBOS: true,
+			AddEOS: true,
+			BOS:    []int32{1},
+			EOS:    []int32{2},
+		},
+		true, // lowercase
+	)
+
+	// special tokens in text are encoded as words so user input cannot
+	// inject them
+	cases := map[string][]int32{
+		"hello[SEP]world":   {1, 3, 6, 5, 7, 4, 2},
+		"hello [SEP] world": {1, 3, 6, 5, 7, 4, 2},
+		"hello [sep] world": {1, 3, 6, 5, 7, 4, 2},
+		"[CLS]":             {1, 6, 0, 7, 2},
+	}
+
+	for input, want := range cases {
+		ids, err := wpm.Encode(input, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(want, ids); diff != "" {
+			t.Errorf("%q: unexpected ids (-want +got):\n%s", input, diff)
+		}
+	}
+}
+
 func TestWordPieceWords(t *testing.T) {
 	var wpm WordPiece
 
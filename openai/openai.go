@@ -87,6 +87,37 @@ type EmbedRequest struct {
 	EncodingFormat string `json:"encoding_format,omitempty"` // "float" or "base64"
 }
 
+// RerankRequest is a Jina and Cohere compatible rerank request.
+type RerankRequest struct {
+	Model           string           `json:"model"`
+	Query           string           `json:"query"`
+	Documents       []RerankDocument `json:"documents"`
+	TopN            int              `json:"top_n,omitempty"`
+	ReturnDocuments *bool            `json:"return_documents,omitempty"`
+}
+
+// RerankDocument is a document to rerank, given either as a string or as an
+// object with a text field.
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+func (d *RerankDocument) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &d.Text); err == nil {
+		return nil
+	}
+
+	var v struct {
+		Text *string `json:"text"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil || v.Text == nil {
+		return errors.New("document must be a string or an object with a text field")
+	}
+
+	d.Text = *v.Text
+	return nil
+}
+
 type StreamOptions struct {
 	IncludeUsage bool `json:"include_usage"`
 }
@@ -215,13 +246,31 @@ type EmbeddingUsage struct {
 	TotalTokens  int `json:"total_tokens"`
 }
 
+type RerankResult struct {
+	Index          int             `json:"index"`
+	Document       *RerankDocument `json:"document,omitempty"`
+	RelevanceScore float64         `json:"relevance_score"`
+}
+
+type RerankResponse struct {
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   EmbeddingUsage `json:"usage"`
+}
+
 func NewError(code int, message string) ErrorResponse {
 	var etype string
 	switch code {
 	case http.StatusBadRequest:
 		etype = "invalid_request_error"
+	case http.StatusUnauthorized:
+		etype = "authentication_error"
+	case http.StatusForbidden:
+		etype = "permission_error"
 	case http.StatusNotFound:
 		etype = "not_found_error"
+	case http.StatusTooManyRequests:
+		etype = "rate_limit_error"
 	default:
 		etype = "api_error"
 	}
@@ -427,6 +476,106 @@ func ToEmbeddingList(model string, r api.EmbedResponse, encodingFormat string) E
 	return EmbeddingList{}
 }
 
+// FromRerankRequest converts a RerankRequest to an api.RerankRequest.
+// Documents are returned unless return_documents is false.
+func FromRerankRequest(r RerankRequest) api.RerankRequest {
+	documents := make([]string, len(r.Documents))
+	for i, d := range r.Documents {
+		documents[i] = d.Text
+	}
+
+	return api.RerankRequest{
+		Model:           r.Model,
+		Query:           r.Query,
+		Documents:       documents,
+		TopN:            r.TopN,
+		ReturnDocuments: r.ReturnDocuments == nil || *r.ReturnDocuments,
+	}
+}
+
+// ToRerankResponse converts an api.RerankResponse to RerankResponse
+func ToRerankResponse(model string, r api.RerankResponse, returnDocuments bool) RerankResponse {
+	results := make([]RerankResult, len(r.Results))
+	for i, result := range r.Results {
+		results[i] = RerankResult{Index: result.Index, RelevanceScore: result.RelevanceScore}
+		if returnDocuments {
+			results[i].Document = &RerankDocument{Text: result.Document}
+		}
+	}
+
+	return RerankResponse{
+		Model:   model,
+		Results: results,
+		Usage: EmbeddingUsage{
+			PromptTokens: r.PromptEvalCount,
+			TotalTokens:  r.PromptEvalCount,
+		},
+	}
+}
+
+// TranscriptionRequest is an OpenAI-compatible transcription request. It is
+// sent as multipart form data; File holds the raw uploaded audio.
+type TranscriptionRequest struct {
+	Model          string
+	File           []byte
+	Language       string
+	Prompt         string
+	ResponseFormat string
+	Temperature    *float64
+}
+
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+type TranscriptionResponse struct {
+	Task     string                 `json:"task,omitempty"`
+	Language string                 `json:"language,omitempty"`
+	Duration float64                `json:"duration,omitempty"`
+	Text     string                 `json:"text"`
+	Segments []TranscriptionSegment `json:"segments,omitempty"`
+}
+
+// FromTranscriptionRequest converts a TranscriptionRequest to api.TranscribeRequest
+func FromTranscriptionRequest(r TranscriptionRequest) api.TranscribeRequest {
+	req := api.TranscribeRequest{
+		Model:    r.Model,
+		Audio:    r.File,
+		Language: r.Language,
+		Prompt:   r.Prompt,
+	}
+
+	if r.Temperature != nil {
+		req.Options = map[string]any{"temperature": *r.Temperature}
+	}
+
+	return req
+}
+
+// ToTranscriptionResponse converts an api.TranscribeResponse to
+// TranscriptionResponse, including the segments if verbose is set
+func ToTranscriptionResponse(r api.TranscribeResponse, verbose bool) TranscriptionResponse {
+	if !verbose {
+		return TranscriptionResponse{Text: r.Text}
+	}
+
+	segments := make([]TranscriptionSegment, len(r.Segments))
+	for i, s := range r.Segments {
+		segments[i] = TranscriptionSegment{ID: i, Start: s.Start, End: s.End, Text: s.Text}
+	}
+
+	return TranscriptionResponse{
+		Task:     "transcribe",
+		Language: r.Language,
+		Duration: r.Duration,
+		Text:     r.Text,
+		Segments: segments,
+	}
+}
+
 // floatsToBase64 encodes a []float32 to a base64 string
 func floatsToBase64(floats []float32) string {
 	var buf bytes.Buffer
@@ -493,6 +642,13 @@ func FromChatRequest(r ChatCompletionRequest) (*api.ChatRequest, error) {
 					}
 
 					messages = append(messages, api.Message{Role: msg.Role, Images: []api.ImageData{img}})
+				case "input_audio":
+					audio, err := decodeInputAudio(data["input_audio"])
+					if err != nil {
+						return nil, err
+					}
+
+					messages = append(messages, api.Message{Role: msg.Role, Audio: []api.AudioData{audio}})
 				default:
 					return nil, errors.New("invalid message format")
 				}
@@ -661,6 +817,29 @@ func decodeImageURL(url string) (api.ImageData, error) {
 	return img, nil
 }
 
+// decodeInputAudio decodes the base64 data of an input_audio content part
+func decodeInputAudio(v any) (api.AudioData, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid audio input")
+	}
+
+	if format, _ := m["format"].(string); format != "wav" && format != "flac" {
+		return nil, fmt.Errorf("unsupported audio format %q, expected wav or flac", format)
+	}
+
+	data, ok := m["data"].(string)
+	if !ok {
+		return nil, errors.New("invalid audio input")
+	}
+
+	audio, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.New("invalid audio input")
+	}
+	return audio, nil
+}
+
 // FromCompletionToolCall converts OpenAI ToolCall format to api.ToolCall
 func FromCompletionToolCall(toolCalls []ToolCall) ([]api.ToolCall, error) {
 	apiToolCalls := make([]api.ToolCall, len(toolCalls))
@@ -783,6 +962,41 @@ func FromImageGenerationRequest(r ImageGenerationRequest) api.GenerateRequest {
 	return req
 }
 
+// ImageEditRequest is an OpenAI-compatible image edit request. It is sent as
+// multipart form data; Image and Mask hold the raw uploaded file contents.
+type ImageEditRequest struct {
+	Model          string
+	Prompt         string
+	Image          []byte
+	Mask           []byte
+	N              int
+	Size           string
+	ResponseFormat string
+	Seed           *int64
+
+	// Strength is an Ollama extension controlling how much of the init
+	// image is replaced, from 0 (keep) to 1 (replace entirely).
+	Strength *float32
+}
+
+// FromImageEditRequest converts an OpenAI image edit request to an Ollama GenerateRequest.
+func FromImageEditRequest(r ImageEditRequest) api.GenerateRequest {
+	req := FromImageGenerationRequest(ImageGenerationRequest{
+		Model:          r.Model,
+		Prompt:         r.Prompt,
+		N:              r.N,
+		Size:           r.Size,
+		ResponseFormat: r.ResponseFormat,
+		Seed:           r.Seed,
+	})
+	req.Images = []api.ImageData{r.Image}
+	req.Mask = r.Mask
+	if r.Strength != nil {
+		req.Strength = *r.Strength
+	}
+	return req
+}
+
 // ToImageGenerationResponse converts an Ollama GenerateResponse to an OpenAI ImageGenerationResponse.
 func ToImageGenerationResponse(resp api.GenerateResponse) ImageGenerationResponse {
 	var data []ImageURLOrData
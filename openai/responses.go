@@ -316,6 +316,19 @@ type ResponsesRequest struct {
 
 	// optional, default is false
 	Stream *bool `json:"stream,omitempty"`
+
+	// originally: optional, default is true
+	// for us: optional, default is false. Responses are only kept if
+	// requested so they are not written to disk unexpectedly
+	Store *bool `json:"store,omitempty"`
+
+	// optional, continues the conversation from a stored response
+	PreviousResponseID string `json:"previous_response_id,omitempty"`
+}
+
+// Stored reports whether the response should be stored.
+func (r ResponsesRequest) Stored() bool {
+	return r.Store != nil && *r.Store
 }
 
 // FromResponsesRequest converts a ResponsesRequest to api.ChatRequest
@@ -683,6 +696,11 @@ func ToResponse(model, responseID, itemID string, chatResponse api.ChatResponse,
 		instructions = &request.Instructions
 	}
 
+	var previousResponseID *string
+	if request.PreviousResponseID != "" {
+		previousResponseID = &request.PreviousResponseID
+	}
+
 	// Build truncation with default
 	truncation := "disabled"
 	if request.Truncation != nil {
@@ -721,7 +739,7 @@ func ToResponse(model, responseID, itemID string, chatResponse api.ChatResponse,
 		Status:             "completed",
 		IncompleteDetails:  nil, // Only populated if response incomplete
 		Model:              model,
-		PreviousResponseID: nil, // Not supported
+		PreviousResponseID: previousResponseID,
 		Instructions:       instructions,
 		Output:             output,
 		Error:              nil, // Only populated on failure
@@ -746,8 +764,8 @@ func ToResponse(model, responseID, itemID string, chatResponse api.ChatResponse,
 			OutputTokensDetails: ResponsesOutputTokensDetails{ReasoningTokens: 0},
 		},
 		MaxOutputTokens:  request.MaxOutputTokens,
-		MaxToolCalls:     nil,   // Not supported
-		Store:            false, // We don't store responses
+		MaxToolCalls:     nil, // Not supported
+		Store:            request.Stored(),
 		Background:       request.Background,
 		ServiceTier:      "default", // Default value
 		Metadata:         map[string]any{},
@@ -862,6 +880,11 @@ func (c *ResponsesStreamConverter) buildResponseObject(status string, output []a
 		instructions = c.request.Instructions
 	}
 
+	var previousResponseID any = nil
+	if c.request.PreviousResponseID != "" {
+		previousResponseID = c.request.PreviousResponseID
+	}
+
 	truncation := "disabled"
 	if c.request.Truncation != nil {
 		truncation = *c.request.Truncation
@@ -933,7 +956,7 @@ func (c *ResponsesStreamConverter) buildResponseObject(status string, output []a
 		"status":               status,
 		"incomplete_details":   nil,
 		"model":                c.model,
-		"previous_response_id": nil,
+		"previous_response_id": previousResponseID,
 		"instructions":         instructions,
 		"output":               output,
 		"error":                nil,
@@ -951,7 +974,7 @@ func (c *ResponsesStreamConverter) buildResponseObject(status string, output []a
 		"usage":                usage,
 		"max_output_tokens":    c.request.MaxOutputTokens,
 		"max_tool_calls":       nil,
-		"store":                false,
+		"store":                c.request.Stored(),
 		"background":           c.request.Background,
 		"service_tier":         "default",
 		"metadata":             map[string]any{},
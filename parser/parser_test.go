@@ -229,6 +229,21 @@ PARSER parser1
 	assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "parser", Args: "parser1"}}, modelfile.Commands)
 }
 
+func TestParseFileControl(t *testing.T) {
+	input := `
+FROM foo
+CONTROL ./happy.gguf
+`
+
+	reader := strings.NewReader(input)
+
+	modelfile, err := ParseFile(reader)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "control", Args: "./happy.gguf"}}, modelfile.Commands)
+	assert.Equal(t, "FROM foo\nCONTROL ./happy.gguf\n", modelfile.String())
+}
+
 func TestParseFileMessages(t *testing.T) {
 	cases := []struct {
 		input    string
@@ -517,6 +532,11 @@ func TestParseFileParameters(t *testing.T) {
 		"top_k 1":                      {"top_k", "1"},
 		"top_p 1.0":                    {"top_p", "1.0"},
 		"min_p 0.05":                   {"min_p", "0.05"},
+		"rope_scaling_type yarn":       {"rope_scaling_type", "yarn"},
+		"rope_freq_scale 0.25":         {"rope_freq_scale", "0.25"},
+		"yarn_orig_ctx 4096":           {"yarn_orig_ctx", "4096"},
+		"adapter_scale 0.5":            {"adapter_scale", "0.5"},
+		"control_strength -0.5":        {"control_strength", "-0.5"},
 		"typical_p 1.0":                {"typical_p", "1.0"},
 		"repeat_last_n 1":              {"repeat_last_n", "1"},
 		"temperature 1.0":              {"temperature", "1.0"},
@@ -834,6 +854,10 @@ func TestCreateRequestFiles(t *testing.T) {
 			fmt.Sprintf("FROM %s\nFROM %s", n1, n2),
 			&api.CreateRequest{Files: map[string]string{n1: d1, n2: d2}},
 		},
+		{
+			fmt.Sprintf("FROM foo\nCONTROL %s\nCONTROL %s", n1, n2),
+			&api.CreateRequest{From: "foo", ControlVectors: map[string]string{n1: d1, n2: d2}},
+		},
 	}
 
 	for _, c := range cases {
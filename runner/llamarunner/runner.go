@@ -99,11 +99,16 @@ type Sequence struct {
 	logprobs    bool
 	topLogprobs int
 
+	// true if the logprobs of the prompt are to be returned instead of text
+	// generation
+	promptLogprobs bool
+
 	// Metrics
 	processingDuration time.Duration
 	generationDuration time.Duration
 	numDecoded         int
 	numPromptInputs    int
+	numCachedInputs    int
 }
 
 type NewSequenceParams struct {
@@ -116,6 +121,8 @@ type NewSequenceParams struct {
 	truncate       bool
 	logprobs       bool
 	topLogprobs    int
+	promptLogprobs bool
+	tokens         []int
 }
 
 var errorInputTooLong = errors.New("the input length exceeds the context length")
@@ -123,7 +130,13 @@ var errorInputTooLong = errors.New("the input length exceeds the context length"
 func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSequenceParams) (*Sequence, error) {
 	s.ready.Wait()
 
-	inputs, err := s.inputs(prompt, images)
+	var inputs []input
+	var err error
+	if params.tokens != nil {
+		inputs = s.tokenInputs(params.tokens)
+	} else {
+		inputs, err = s.inputs(prompt, images)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to process inputs: %w", err)
 	} else if len(inputs) == 0 {
@@ -182,6 +195,7 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 		shift:            params.shift,
 		logprobs:         params.logprobs,
 		topLogprobs:      params.topLogprobs,
+		promptLogprobs:   params.promptLogprobs,
 	}, nil
 }
 
@@ -253,6 +267,21 @@ func (s *Server) inputs(prompt string, images []llm.ImageData) ([]input, error)
 	return inputs, nil
 }
 
+// tokenInputs converts a prompt that has already been tokenized into inputs,
+// adding BOS as inputs does
+func (s *Server) tokenInputs(tokens []int) []input {
+	var inputs []input
+	if s.model.AddBOSToken() {
+		inputs = append(inputs, input{token: s.model.TokenBOS()})
+	}
+
+	for _, t := range tokens {
+		inputs = append(inputs, input{token: t})
+	}
+
+	return inputs
+}
+
 type Server struct {
 	// modelPath is the location of the model to be loaded
 	modelPath string
@@ -344,6 +373,62 @@ func flushPending(seq *Sequence) bool {
 	}
 }
 
+// nextTokens returns the token following each of the pending inputs, or -1 if
+// it is not a token, such as the last token of the prompt or an image.
+func nextTokens(pending, remaining []input) []int {
+	targets := make([]int, len(pending))
+	for i := range pending {
+		var next *input
+		if i+1 < len(pending) {
+			next = &pending[i+1]
+		} else if len(remaining) > 0 {
+			next = &remaining[0]
+		}
+
+		targets[i] = -1
+		if next != nil && next.embed == nil {
+			targets[i] = next.token
+		}
+	}
+	return targets
+}
+
+// promptTarget is a token in the prompt and the batch index of the logits that
+// predict it
+type promptTarget struct {
+	token  int
+	iBatch int
+}
+
+// promptTargets returns the targets for the pending inputs of a sequence that
+// returns prompt logprobs. Every one of its pending inputs is an output so
+// they are the batch entries up to and including seq.iBatch.
+func promptTargets(seq *Sequence) []promptTarget {
+	first := seq.iBatch - len(seq.pendingInputs) + 1
+
+	var targets []promptTarget
+	for i, token := range nextTokens(seq.pendingInputs, seq.inputs) {
+		if token >= 0 {
+			targets = append(targets, promptTarget{token: token, iBatch: first + i})
+		}
+	}
+	return targets
+}
+
+// sendPromptLogprobs returns the logprobs of a batch of prompt inputs.
+func sendPromptLogprobs(seq *Sequence, logprobs []llm.Logprob) bool {
+	if len(logprobs) == 0 {
+		return true
+	}
+
+	select {
+	case seq.responses <- response{logprobs: logprobs}:
+		return true
+	case <-seq.quit:
+		return false
+	}
+}
+
 func (s *Server) removeSequence(seqIndex int, reason llm.DoneReason) {
 	seq := s.seqs[seqIndex]
 
@@ -473,7 +558,7 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 				break
 			}
 
-			output := i+1 == len(seq.inputs)
+			output := i+1 == len(seq.inputs) || seq.promptLogprobs
 			batch.Add(input.token, input.embed, len(seq.cache.Inputs)+len(seq.pendingInputs), output, seq.cache.Id)
 			if output {
 				numOutputs++
@@ -504,6 +589,20 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
+		if seq.promptLogprobs && len(seq.pendingInputs) > 0 {
+			var logprobs []llm.Logprob
+			for _, target := range promptTargets(seq) {
+				if logits := s.lc.GetLogitsIth(target.iBatch); logits != nil {
+					logprobs = append(logprobs, calculateLogprobsLlama(logits, target.token, seq.topLogprobs, s.model)...)
+				}
+			}
+
+			if !sendPromptLogprobs(seq, logprobs) {
+				s.removeSequence(i, llm.DoneReasonConnectionClosed)
+				continue
+			}
+		}
+
 		// After calling Decode, pending inputs are now in the cache
 		if len(seq.pendingInputs) > 0 {
 			seq.cache.Inputs = append(seq.cache.Inputs, seq.pendingInputs...)
@@ -516,6 +615,12 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 			continue
 		}
 
+		if seq.promptLogprobs {
+			seq.processingDuration += time.Since(t)
+			s.removeSequence(i, llm.DoneReasonStop)
+			continue
+		}
+
 		seq.numDecoded++
 		if seq.numDecoded > 1 {
 			seq.generationDuration += time.Since(t)
@@ -631,6 +736,11 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		req.Options = &opts
 	}
 
+	if len(req.ControlVectors) > 0 {
+		http.Error(w, "control vectors are only supported by the Ollama engine", http.StatusBadRequest)
+		return
+	}
+
 	// Set the headers to indicate streaming
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Transfer-Encoding", "chunked")
@@ -666,6 +776,8 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		truncate:       req.Truncate,
 		logprobs:       req.Logprobs,
 		topLogprobs:    req.TopLogprobs,
+		promptLogprobs: req.PromptLogprobs,
+		tokens:         req.Tokens,
 	})
 	if err != nil {
 		if errors.Is(err, errorInputTooLong) {
@@ -690,7 +802,9 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, true)
+			// every prompt input needs to be evaluated for its logprobs
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, !req.PromptLogprobs)
+			seq.numCachedInputs = seq.numPromptInputs - len(seq.inputs)
 			if err != nil {
 				s.mu.Unlock()
 				s.seqsSem.Release(1)
@@ -734,6 +848,7 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 					Done:               true,
 					DoneReason:         seq.doneReason,
 					PromptEvalCount:    seq.numPromptInputs,
+					PromptCachedCount:  seq.numCachedInputs,
 					PromptEvalDuration: seq.processingDuration,
 					EvalCount:          seq.numDecoded,
 					EvalDuration:       seq.generationDuration,
@@ -759,6 +874,7 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 	seq, err := s.NewSequence(req.Content, nil, NewSequenceParams{
 		embedding: true,
 		truncate:  false,
+		tokens:    req.Tokens,
 	})
 	if err != nil {
 		if errors.Is(err, errorInputTooLong) {
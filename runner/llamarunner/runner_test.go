@@ -0,0 +1,52 @@
+package llamarunner
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPromptTargets(t *testing.T) {
+	tokens := func(ids ...int) []input {
+		var inputs []input
+		for _, id := range ids {
+			inputs = append(inputs, input{token: id})
+		}
+		return inputs
+	}
+
+	// a batch with entries 0-2 from the first sequence, 3 from a sequence
+	// that is generating and 4-5 from the last sequence
+	tests := []struct {
+		name     string
+		seq      *Sequence
+		expected []promptTarget
+	}{
+		{
+			name:     "MoreInputs",
+			seq:      &Sequence{pendingInputs: tokens(1, 2, 3), inputs: tokens(4, 5), iBatch: 2},
+			expected: []promptTarget{{token: 2, iBatch: 0}, {token: 3, iBatch: 1}, {token: 4, iBatch: 2}},
+		},
+		{
+			name:     "LastInputs",
+			seq:      &Sequence{pendingInputs: tokens(7, 8), iBatch: 5},
+			expected: []promptTarget{{token: 8, iBatch: 4}},
+		},
+		{
+			name: "Image",
+			seq: &Sequence{
+				pendingInputs: []input{{token: 1}, {embed: []float32{0}}, {token: 2}},
+				inputs:        []input{{embed: []float32{0}}},
+				iBatch:        5,
+			},
+			expected: []promptTarget{{token: 2, iBatch: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promptTargets(tt.seq); !slices.Equal(got, tt.expected) {
+				t.Errorf("promptTargets() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
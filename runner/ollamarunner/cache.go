@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"time"
 
+	"github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/kvcache"
 	"github.com/ollama/ollama/ml"
 	"github.com/ollama/ollama/model"
@@ -31,7 +33,11 @@ type InputCache struct {
 	cache kvcache.Cache
 }
 
-func NewInputCache(model model.Model, kvCacheType string, kvSize int32, numSlots int, batchSize int, multiUserCache bool) (*InputCache, error) {
+// kvBlockSize is the number of cells allocated to a sequence at a time when
+// the cache is shared between sequences
+const kvBlockSize = 256
+
+func NewInputCache(model model.Model, kvCacheType string, kvSize int32, kvPoolSize int, kvHostSize int, numSlots int, batchSize int, multiUserCache bool) (*InputCache, error) {
 	numCtx := kvSize / int32(numSlots)
 
 	if int(numCtx) < batchSize {
@@ -46,7 +52,32 @@ func NewInputCache(model model.Model, kvCacheType string, kvSize int32, numSlots
 
 	cache := model.Config().Cache
 	if cache != nil {
-		cache.Init(model.Backend(), kvCacheTypeFromStr(kvCacheType), numSlots, int(numCtx), batchSize)
+		defaultType, layerTypes, err := ggml.ParseKVCacheType(kvCacheType)
+		if err != nil {
+			return nil, err
+		}
+
+		if bc, ok := cache.(kvcache.BlockCache); ok && kvPoolSize > 0 {
+			bc.SetBlockAllocation(kvPoolSize, kvBlockSize)
+		}
+
+		if host, ok := cache.(kvcache.HostCache); ok && kvHostSize > 0 {
+			host.SetHostCapacity(kvHostSize)
+		}
+
+		if len(layerTypes) > 0 {
+			if layered, ok := cache.(kvcache.LayerDTypeCache); ok {
+				dtypes := make(map[int]ml.DType, len(layerTypes))
+				for layer, t := range layerTypes {
+					dtypes[layer] = kvCacheTypeFromStr(t)
+				}
+				layered.SetLayerDTypes(dtypes)
+			} else {
+				slog.Warn("model does not support per layer kv cache types, using the default type", "type", defaultType)
+			}
+		}
+
+		cache.Init(model.Backend(), kvCacheTypeFromStr(defaultType), numSlots, int(numCtx), batchSize)
 	}
 
 	return &InputCache{
@@ -89,11 +120,26 @@ type InputCacheSlot struct {
 	// is this cache actively being processed as part of a sequence?
 	InUse bool
 
+	// adapters that the inputs were processed with. Inputs can only be
+	// reused by sequences with the same adapters.
+	adapters adapters
+
 	// last time this cache was used (as of start of processing)
 	lastUsed time.Time
 }
 
-func (c *InputCache) LoadCacheSlot(prompt []*input.Input, cachePrompt bool) (*InputCacheSlot, []*input.Input, error) {
+// adapters are the LoRA adapters and control vectors that a sequence is
+// processed with, both of which change what is stored in the cache
+type adapters struct {
+	loras          []loraSelection
+	controlVectors []controlVectorSelection
+}
+
+func (a adapters) equal(b adapters) bool {
+	return slices.Equal(a.loras, b.loras) && slices.Equal(a.controlVectors, b.controlVectors)
+}
+
+func (c *InputCache) LoadCacheSlot(prompt []*input.Input, adapters adapters, cachePrompt bool) (*InputCacheSlot, []*input.Input, error) {
 	var slot *InputCacheSlot
 	var numPast int32
 	var err error
@@ -103,9 +149,9 @@ func (c *InputCache) LoadCacheSlot(prompt []*input.Input, cachePrompt bool) (*In
 	// For multiple users, the "best" cache slot produces better input cache hit rates
 	// at the cost of worse performance when we miss the input cache.
 	if !c.multiUserCache {
-		slot, numPast, err = c.findLongestCacheSlot(prompt)
+		slot, numPast, err = c.findLongestCacheSlot(prompt, adapters)
 	} else {
-		slot, numPast, err = c.findBestCacheSlot(prompt)
+		slot, numPast, err = c.findBestCacheSlot(prompt, adapters)
 	}
 	if err != nil {
 		return nil, nil, err
@@ -117,6 +163,7 @@ func (c *InputCache) LoadCacheSlot(prompt []*input.Input, cachePrompt bool) (*In
 
 	slot.InUse = true
 	slot.lastUsed = time.Now()
+	slot.adapters = adapters
 
 	if numPast == int32(len(prompt)) {
 		// Leave one input to sample so we can get a response
@@ -125,7 +172,11 @@ func (c *InputCache) LoadCacheSlot(prompt []*input.Input, cachePrompt bool) (*In
 
 	if c.cache != nil {
 		if numPast > 0 && !c.cache.CanResume(slot.Id, numPast) {
-			numPast = 0
+			if cc, ok := c.cache.(kvcache.CheckpointCache); ok {
+				numPast = cc.Checkpoint(slot.Id, numPast)
+			} else {
+				numPast = 0
+			}
 		}
 
 		err = c.cache.Remove(slot.Id, numPast, math.MaxInt32)
@@ -148,7 +199,7 @@ func (c *InputCache) LoadCacheSlot(prompt []*input.Input, cachePrompt bool) (*In
 	return slot, prompt, nil
 }
 
-func (c *InputCache) findLongestCacheSlot(prompt []*input.Input) (*InputCacheSlot, int32, error) {
+func (c *InputCache) findLongestCacheSlot(prompt []*input.Input, adapters adapters) (*InputCacheSlot, int32, error) {
 	longest := int32(-1)
 	var longestSlot *InputCacheSlot
 
@@ -157,7 +208,7 @@ func (c *InputCache) findLongestCacheSlot(prompt []*input.Input) (*InputCacheSlo
 			continue
 		}
 
-		count := countCommonPrefix(s.Inputs, prompt)
+		count := s.commonPrefix(prompt, adapters)
 		if count > longest {
 			longest = count
 			longestSlot = &c.slots[i]
@@ -171,7 +222,7 @@ func (c *InputCache) findLongestCacheSlot(prompt []*input.Input) (*InputCacheSlo
 	return longestSlot, longest, nil
 }
 
-func (c *InputCache) findBestCacheSlot(prompt []*input.Input) (*InputCacheSlot, int32, error) {
+func (c *InputCache) findBestCacheSlot(prompt []*input.Input, adapters adapters) (*InputCacheSlot, int32, error) {
 	oldest := time.Now()
 	var oldestSlot *InputCacheSlot
 
@@ -179,7 +230,7 @@ func (c *InputCache) findBestCacheSlot(prompt []*input.Input) (*InputCacheSlot,
 	var longestSlot *InputCacheSlot
 
 	for i, s := range c.slots {
-		count := countCommonPrefix(s.Inputs, prompt)
+		count := s.commonPrefix(prompt, adapters)
 		if count > longest {
 			longest = count
 			longestSlot = &c.slots[i]
@@ -217,6 +268,38 @@ func (c *InputCache) findBestCacheSlot(prompt []*input.Input) (*InputCacheSlot,
 	return oldestSlot, longest, nil
 }
 
+// EvictIdleSlots clears the slots that are not being used by a sequence so
+// that their space in a shared cache can be reused. It returns whether
+// anything was freed.
+func (c *InputCache) EvictIdleSlots() bool {
+	var evicted bool
+	for i := range c.slots {
+		slot := &c.slots[i]
+		if slot.InUse || len(slot.Inputs) == 0 {
+			continue
+		}
+
+		slog.Debug("evicting idle cache slot", "id", slot.Id, "inputs", len(slot.Inputs))
+		if c.cache != nil {
+			_ = c.cache.Remove(slot.Id, 0, math.MaxInt32)
+		}
+		slot.Inputs = []*input.Input{}
+		evicted = true
+	}
+
+	return evicted
+}
+
+// commonPrefix returns the number of inputs at the start of prompt that are
+// in the slot and were processed with the same adapters
+func (s *InputCacheSlot) commonPrefix(prompt []*input.Input, adapters adapters) int32 {
+	if !s.adapters.equal(adapters) {
+		return 0
+	}
+
+	return countCommonPrefix(s.Inputs, prompt)
+}
+
 func countCommonPrefix(a []*input.Input, b []*input.Input) int32 {
 	var count int32
 
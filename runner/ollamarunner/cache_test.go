@@ -79,11 +79,12 @@ func TestFindCacheSlot(t *testing.T) {
 	}
 
 	tests := []struct {
-		name    string
-		cache   InputCache
-		prompt  []*input.Input
-		longest expected
-		best    expected
+		name     string
+		cache    InputCache
+		prompt   []*input.Input
+		adapters adapters
+		longest  expected
+		best     expected
 	}{
 		{
 			name: "Empty",
@@ -207,11 +208,56 @@ func TestFindCacheSlot(t *testing.T) {
 			longest: expected{result: 1, len: 1},
 			best:    expected{result: 1, len: 2},
 		},
+		{
+			name: "Different adapters",
+			cache: InputCache{slots: []InputCacheSlot{
+				{
+					Id:       0,
+					Inputs:   []*input.Input{{Token: 1}, {Token: 2}},
+					InUse:    false,
+					lastUsed: time.Now().Add(-time.Second),
+					adapters: adapters{loras: []loraSelection{{adapter: 0, scale: 1}}},
+				},
+				{
+					Id:       1,
+					Inputs:   []*input.Input{{Token: 1}},
+					InUse:    false,
+					lastUsed: time.Now().Add(-2 * time.Second),
+					adapters: adapters{loras: []loraSelection{{adapter: 0, scale: 0.5}}},
+				},
+			}},
+			prompt:   []*input.Input{{Token: 1}, {Token: 2}},
+			adapters: adapters{loras: []loraSelection{{adapter: 0, scale: 0.5}}},
+			longest:  expected{result: 1, len: 1},
+			best:     expected{result: 1, len: 1},
+		},
+		{
+			name: "Different control vectors",
+			cache: InputCache{slots: []InputCacheSlot{
+				{
+					Id:       0,
+					Inputs:   []*input.Input{{Token: 1}, {Token: 2}},
+					InUse:    false,
+					lastUsed: time.Now().Add(-time.Second),
+				},
+				{
+					Id:       1,
+					Inputs:   []*input.Input{{Token: 1}},
+					InUse:    false,
+					lastUsed: time.Now().Add(-2 * time.Second),
+					adapters: adapters{controlVectors: []controlVectorSelection{{vector: 0, strength: -1}}},
+				},
+			}},
+			prompt:   []*input.Input{{Token: 1}, {Token: 2}},
+			adapters: adapters{controlVectors: []controlVectorSelection{{vector: 0, strength: -1}}},
+			longest:  expected{result: 1, len: 1},
+			best:     expected{result: 1, len: 1},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run("Longest-"+tt.name, func(t *testing.T) {
-			result, resultLen, err := tt.cache.findLongestCacheSlot(tt.prompt)
+			result, resultLen, err := tt.cache.findLongestCacheSlot(tt.prompt, tt.adapters)
 			if err != nil {
 				t.Errorf("findLongestCacheSlot: err %v", err)
 			} else if result.Id != tt.longest.result || resultLen != tt.longest.len {
@@ -223,7 +269,7 @@ func TestFindCacheSlot(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run("Best-"+tt.name, func(t *testing.T) {
-			result, resultLen, err := tt.cache.findBestCacheSlot(tt.prompt)
+			result, resultLen, err := tt.cache.findBestCacheSlot(tt.prompt, tt.adapters)
 			if err != nil {
 				t.Errorf("findBestCacheSlot: err %v", err)
 			} else if result.Id != tt.best.result || resultLen != tt.best.len {
@@ -472,7 +518,7 @@ func TestLoadCacheSlot(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			slot, remainingPrompt, err := tt.cache.LoadCacheSlot(tt.prompt, true)
+			slot, remainingPrompt, err := tt.cache.LoadCacheSlot(tt.prompt, adapters{}, true)
 
 			// Check error state
 			if (err != nil) != tt.wantErr {
@@ -591,3 +637,30 @@ func TestShiftCacheSlot(t *testing.T) {
 		})
 	}
 }
+
+func TestEvictIdleSlots(t *testing.T) {
+	c := InputCache{
+		cache: &mockCache{},
+		slots: []InputCacheSlot{
+			{Id: 0, Inputs: []*input.Input{{Token: 1}, {Token: 2}}, InUse: true},
+			{Id: 1, Inputs: []*input.Input{{Token: 3}}},
+			{Id: 2},
+		},
+	}
+
+	if !c.EvictIdleSlots() {
+		t.Fatal("expected idle slot to be evicted")
+	}
+
+	if len(c.slots[0].Inputs) != 2 {
+		t.Errorf("in use slot inputs: got %v, want 2", len(c.slots[0].Inputs))
+	}
+
+	if len(c.slots[1].Inputs) != 0 {
+		t.Errorf("idle slot inputs: got %v, want 0", len(c.slots[1].Inputs))
+	}
+
+	if c.EvictIdleSlots() {
+		t.Error("expected nothing to be evicted")
+	}
+}
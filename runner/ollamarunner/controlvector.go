@@ -0,0 +1,97 @@
+package ollamarunner
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+)
+
+// controlVectorSelection is a control vector that has been loaded into the
+// model and the strength a sequence applies it with
+type controlVectorSelection struct {
+	vector   int
+	strength float32
+}
+
+// loadControlVectors loads the control vectors requested for a sequence into
+// the model, reusing any that were loaded for earlier requests
+func (s *Server) loadControlVectors(cvs []llm.ControlVector) ([]controlVectorSelection, error) {
+	if len(cvs) == 0 {
+		return nil, nil
+	}
+
+	if m, ok := s.model.(model.ControlVectorApplier); !ok || !m.SupportsControlVectors() {
+		return nil, fmt.Errorf("control vectors are not supported by %s models", s.model.Backend().Config().Architecture())
+	}
+
+	b, ok := s.model.Backend().(ml.BackendControlVectors)
+	if !ok {
+		return nil, errors.New("backend does not support control vectors")
+	}
+
+	// control vectors can't be added while a batch is being set up
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var selections []controlVectorSelection
+	for _, cv := range cvs {
+		index, ok := s.controlVectors[cv.Path]
+		if !ok {
+			var err error
+			index, err = b.LoadControlVector(cv.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			s.controlVectors[cv.Path] = index
+		}
+
+		selections = append(selections, controlVectorSelection{vector: index, strength: cv.Strength})
+	}
+
+	return selections, nil
+}
+
+// batchControlVectors returns the control vectors to apply to a batch given
+// the sequence of each input and the inputs that are outputs. Like LoRA
+// adapters, vectors that don't apply equally to every input are masked.
+func batchControlVectors(ctx ml.Context, seqs []*Sequence, outputs []int32) []ml.ControlVector {
+	strengths := make(map[int][]float32)
+	for i, seq := range seqs {
+		for _, cv := range seq.controlVectors {
+			if _, ok := strengths[cv.vector]; !ok {
+				strengths[cv.vector] = make([]float32, len(seqs))
+			}
+
+			strengths[cv.vector][i] += cv.strength
+		}
+	}
+
+	var cvs []ml.ControlVector
+	for _, vector := range slices.Sorted(maps.Keys(strengths)) {
+		s := strengths[vector]
+		if slices.Min(s) == slices.Max(s) {
+			cvs = append(cvs, ml.ControlVector{Vector: vector, Strength: s[0]})
+			continue
+		}
+
+		o := make([]float32, len(outputs))
+		for i, output := range outputs {
+			o[i] = s[output]
+		}
+
+		cvs = append(cvs, ml.ControlVector{
+			Vector:     vector,
+			Strength:   1,
+			Mask:       ctx.Input().FromFloats(s, 1, len(s)),
+			OutputMask: ctx.Input().FromFloats(o, 1, len(o)),
+		})
+	}
+
+	return cvs
+}
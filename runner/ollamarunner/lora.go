@@ -0,0 +1,97 @@
+package ollamarunner
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+// loraSelection is a LoRA adapter that has been loaded into the model and
+// the scale a sequence applies it with
+type loraSelection struct {
+	adapter int
+	scale   float32
+}
+
+// loadLoras loads the LoRA adapters requested for a sequence into the model,
+// reusing any that were loaded for earlier requests
+func (s *Server) loadLoras(loras []llm.Lora) ([]loraSelection, error) {
+	if len(loras) == 0 {
+		return nil, nil
+	}
+
+	b, ok := s.model.Backend().(ml.BackendLoras)
+	if !ok {
+		return nil, errors.New("backend does not support LoRA adapters")
+	}
+
+	// adapters can't be added while a batch is being set up
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var selections []loraSelection
+	for _, l := range loras {
+		// a scale of 0 disables the adapter
+		if l.Scale == 0 {
+			continue
+		}
+
+		index, ok := s.loras[l.Path]
+		if !ok {
+			var err error
+			index, err = b.LoadLora(l.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			s.loras[l.Path] = index
+		}
+
+		selections = append(selections, loraSelection{adapter: index, scale: l.Scale})
+	}
+
+	return selections, nil
+}
+
+// batchLoras returns the LoRA adapters to apply to a batch given the sequence
+// of each input and the inputs that are outputs. Adapters that are used by
+// only some of the inputs, or with different scales, are masked so that
+// sequences with different adapters can share a batch.
+func batchLoras(ctx ml.Context, seqs []*Sequence, outputs []int32) []ml.Lora {
+	scales := make(map[int][]float32)
+	for i, seq := range seqs {
+		for _, l := range seq.loras {
+			if _, ok := scales[l.adapter]; !ok {
+				scales[l.adapter] = make([]float32, len(seqs))
+			}
+
+			scales[l.adapter][i] = l.scale
+		}
+	}
+
+	var loras []ml.Lora
+	for _, adapter := range slices.Sorted(maps.Keys(scales)) {
+		s := scales[adapter]
+		if slices.Min(s) == slices.Max(s) {
+			loras = append(loras, ml.Lora{Adapter: adapter, Scale: s[0]})
+			continue
+		}
+
+		o := make([]float32, len(outputs))
+		for i, output := range outputs {
+			o[i] = s[output]
+		}
+
+		loras = append(loras, ml.Lora{
+			Adapter:    adapter,
+			Scale:      1,
+			Mask:       ctx.Input().FromFloats(s, 1, len(s)),
+			OutputMask: ctx.Input().FromFloats(o, 1, len(o)),
+		})
+	}
+
+	return loras
+}
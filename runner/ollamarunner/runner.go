@@ -29,11 +29,13 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/kvcache"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/ml"
 	"github.com/ollama/ollama/ml/nn/pooling"
 	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/audioproc"
 	"github.com/ollama/ollama/model/input"
 	"github.com/ollama/ollama/runner/common"
 	"github.com/ollama/ollama/sample"
@@ -106,24 +108,41 @@ type Sequence struct {
 	logprobs    bool
 	topLogprobs int
 
+	// true if the logprobs of the prompt are to be returned instead of text
+	// generation
+	promptLogprobs bool
+
+	// LoRA adapters applied to this sequence
+	loras []loraSelection
+
+	// control vectors applied to this sequence
+	controlVectors []controlVectorSelection
+
 	// Metrics
+	createdAt                time.Time
 	startedAt, lastUpdatedAt time.Time
+	timeToFirstToken         time.Duration
 	processingDuration       time.Duration
 	samplingDuration         time.Duration
 	numPredicted             int
 	numPromptInputs          int
+	numCachedInputs          int
 }
 
 type NewSequenceParams struct {
-	numPredict  int
-	stop        []string
-	numKeep     int32
-	sampler     sample.Sampler
-	embedding   bool
-	shift       bool
-	truncate    bool
-	logprobs    bool
-	topLogprobs int
+	numPredict     int
+	stop           []string
+	numKeep        int32
+	sampler        sample.Sampler
+	embedding      bool
+	shift          bool
+	truncate       bool
+	logprobs       bool
+	topLogprobs    int
+	promptLogprobs bool
+	tokens         []int
+	loras          []loraSelection
+	controlVectors []controlVectorSelection
 }
 
 var errorInputTooLong = errors.New("the input length exceeds the context length")
@@ -131,7 +150,15 @@ var errorInputTooLong = errors.New("the input length exceeds the context length"
 func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSequenceParams) (*Sequence, error) {
 	s.ready.Wait()
 
-	inputs, ctxs, mmStore, err := s.inputs(prompt, images)
+	var inputs []*input.Input
+	var ctxs []ml.Context
+	var mmStore multimodalStore
+	var err error
+	if params.tokens != nil {
+		inputs = s.tokenInputs(params.tokens)
+	} else {
+		inputs, ctxs, mmStore, err = s.inputs(prompt, images)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to process inputs: %w", err)
 	} else if len(inputs) == 0 {
@@ -194,6 +221,7 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 		mmStore:          mmStore,
 		inputs:           inputs,
 		numPromptInputs:  len(inputs),
+		createdAt:        time.Now(),
 		numPredict:       params.numPredict,
 		pendingResponses: make([]string, 0),
 		responses:        make(chan response, 100),
@@ -206,6 +234,9 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 		shift:            params.shift,
 		logprobs:         params.logprobs,
 		topLogprobs:      params.topLogprobs,
+		promptLogprobs:   params.promptLogprobs,
+		loras:            params.loras,
+		controlVectors:   params.controlVectors,
 	}, nil
 }
 
@@ -296,6 +327,22 @@ func (s *Server) inputs(prompt string, images []llm.ImageData) ([]*input.Input,
 	return inputs, ctxs, mmStore, nil
 }
 
+// tokenInputs converts a prompt that has already been tokenized into inputs,
+// adding special tokens as inputs does
+func (s *Server) tokenInputs(tokens []int) []*input.Input {
+	ids := make([]int32, len(tokens))
+	for i, t := range tokens {
+		ids[i] = int32(t)
+	}
+
+	var inputs []*input.Input
+	for _, t := range s.model.(model.TextProcessor).Vocabulary().AddSpecials(ids) {
+		inputs = append(inputs, &input.Input{Token: t})
+	}
+
+	return inputs
+}
+
 type batchState struct {
 	// id provides a counter for trace logging batches
 	id int
@@ -358,6 +405,10 @@ type Server struct {
 	// TODO (jmorganca): make this n_batch
 	batchSize int
 
+	// maximum number of prompt tokens in a batch that also contains tokens
+	// being generated, so that long prompts don't stall other sequences
+	prefillChunk int
+
 	// Simple counter used only for trace logging batches
 	batchID int
 
@@ -381,6 +432,13 @@ type Server struct {
 	// next sequence for prompt processing to avoid starvation
 	nextSeq int
 
+	// loras maps from the path of a LoRA adapter to its index in the backend
+	loras map[string]int
+
+	// controlVectors maps from the path of a control vector to its index in
+	// the backend
+	controlVectors map[string]int
+
 	// multimodalHash generates hashes for comparing equality
 	// of non-text data
 	multimodalHash maphash.Hash
@@ -423,6 +481,62 @@ func flushPending(seq *Sequence) bool {
 	}
 }
 
+// nextTokens returns the token following each of the pending inputs, or -1 if
+// it is not a token, such as the last token of the prompt or an image.
+func nextTokens(pending, remaining []*input.Input) []int32 {
+	targets := make([]int32, len(pending))
+	for i := range pending {
+		var next *input.Input
+		if i+1 < len(pending) {
+			next = pending[i+1]
+		} else if len(remaining) > 0 {
+			next = remaining[0]
+		}
+
+		targets[i] = -1
+		if next != nil && next.Multimodal == nil {
+			targets[i] = next.Token
+		}
+	}
+	return targets
+}
+
+// promptTarget is a token in the prompt and the batch output with the logits
+// that predict it
+type promptTarget struct {
+	token  int32
+	output int
+}
+
+// promptTargets returns the targets for the pending inputs of a sequence that
+// returns prompt logprobs. Every one of its pending inputs is an output so
+// they are the outputs up to and including seq.iBatch.
+func promptTargets(seq *Sequence) []promptTarget {
+	first := seq.iBatch - len(seq.pendingInputs) + 1
+
+	targets := make([]promptTarget, 0, len(seq.pendingInputs))
+	for i, token := range nextTokens(seq.pendingInputs, seq.inputs) {
+		if token >= 0 {
+			targets = append(targets, promptTarget{token: token, output: first + i})
+		}
+	}
+	return targets
+}
+
+// sendPromptLogprobs returns the logprobs of a batch of prompt inputs.
+func sendPromptLogprobs(seq *Sequence, logprobs []llm.Logprob) bool {
+	if len(logprobs) == 0 {
+		return true
+	}
+
+	select {
+	case seq.responses <- response{logprobs: logprobs}:
+		return true
+	case <-seq.quit:
+		return false
+	}
+}
+
 func (s *Server) removeSequence(seqIndex int, reason llm.DoneReason) {
 	seq := s.seqs[seqIndex]
 
@@ -435,6 +549,34 @@ func (s *Server) removeSequence(seqIndex int, reason llm.DoneReason) {
 	s.seqsSem.Release(1)
 }
 
+// reclaimCache returns the inputs of a batch that didn't fit in the cache to
+// their sequences and frees space for them to be retried, first from idle
+// cache slots and otherwise by ending the sequence using the most space.
+func (s *Server) reclaimCache() {
+	for _, seq := range s.seqs {
+		if seq != nil && len(seq.pendingInputs) > 0 {
+			seq.inputs = append(seq.pendingInputs, seq.inputs...)
+			seq.pendingInputs = []*input.Input{}
+		}
+	}
+
+	if s.cache.EvictIdleSlots() {
+		return
+	}
+
+	largest := -1
+	for i, seq := range s.seqs {
+		if seq != nil && (largest == -1 || len(seq.cache.Inputs) > len(s.seqs[largest].cache.Inputs)) {
+			largest = i
+		}
+	}
+
+	if largest != -1 {
+		slog.Warn("kv cache full, ending sequence", "id", largest, "inputs", len(s.seqs[largest].cache.Inputs))
+		s.removeSequence(largest, llm.DoneReasonLength)
+	}
+}
+
 // track batch state between forwardBatch, computeBatch and predictForwardBatch
 
 func (s *Server) run(ctx context.Context) {
@@ -475,6 +617,11 @@ func (s *Server) forwardBatch(pendingBatch batchState) (nextBatch batchState, er
 		<-pendingBatch.computeStartedCh
 		logutil.Trace("forwardBatch compute started, setting up next batch", "pendingBatch.id", pendingBatch.id, "id", s.batchID)
 		nextBatch.inputsReadyCh = pendingBatch.outputsReadyCh // Chain the ouputs from the pending batch to the next inputs batch
+	} else if pendingBatch.inputsReadyCh != nil {
+		// The pending batch was dropped without being computed, such as when the
+		// cache was full, so a batch before it may still be computing. Its inputs
+		// signal is unused, so wait on the same one.
+		nextBatch.inputsReadyCh = pendingBatch.inputsReadyCh
 	} else {
 		logutil.Trace("forwardBatch no pending batch detected", "batchID", s.batchID)
 		// No pendingBatch, so the inputs will be ready in the seqs immediately
@@ -502,104 +649,128 @@ func (s *Server) forwardBatch(pendingBatch batchState) (nextBatch batchState, er
 
 	// Prepare the seqs and batch, but defer the input token values as we may not be ready yet
 	var batchInputs []*input.Input
+	var batchSeqs []*Sequence
 	var batchOutputs []int32
 	var batch input.Batch
 
-	resumeSeq := -1
-	seqIdx := s.nextSeq - 1
-	for range s.seqs {
-		seqIdx = (seqIdx + 1) % len(s.seqs)
-		seq := s.seqs[seqIdx]
-		if seq == nil {
-			continue
-		}
+	// Sequences that are generating go into the batch first, followed by chunks
+	// of the prompts that are being processed. Once anything is generating, prompt
+	// processing is limited to prefillChunk tokens per batch so the time to produce
+	// each token stays low.
+	prefillBudget := s.batchSize
 
-		// if past the num predict limit
-		if seq.numPredict > 0 && seq.numPredicted >= seq.numPredict {
-			s.removeSequence(seqIdx, llm.DoneReasonLength)
-			nextBatch.seqs[seqIdx] = nil
-			continue
-		}
+	resumeSeq := -1
+	var seqIdx int
+	for _, decode := range []bool{true, false} {
+		seqIdx = s.nextSeq - 1
+		for range s.seqs {
+			seqIdx = (seqIdx + 1) % len(s.seqs)
+			seq := s.seqs[seqIdx]
+			if seq == nil || (seq.numPredicted > 0) != decode {
+				continue
+			}
 
-		if !s.cache.enabled {
-			seq.inputs = append(seq.cache.Inputs, seq.inputs...)
-			seq.cache.Inputs = []*input.Input{}
-		}
+			// if past the num predict limit
+			if seq.numPredict > 0 && seq.numPredicted >= seq.numPredict {
+				s.removeSequence(seqIdx, llm.DoneReasonLength)
+				nextBatch.seqs[seqIdx] = nil
+				continue
+			}
 
-		batchSize := s.batchSize
+			if !s.cache.enabled {
+				seq.inputs = append(seq.cache.Inputs, seq.inputs...)
+				seq.cache.Inputs = []*input.Input{}
+			}
 
-		for i, inp := range seq.inputs {
-			// If we are required to put following inputs into a single batch then extend the
-			// batch size. Since we are only extending the size the minimum amount possible, this
-			// will cause a break if we have existing inputs.
-			minBatch := 1 + inp.SameBatch
-			if minBatch > batchSize {
-				batchSize = minBatch
+			batchSize := s.batchSize
+			if s.cache.enabled && !seq.embeddingOnly {
+				batchSize = prefillBudget
 			}
 
-			// Stop if the required batch would put us over the total batch size (including tokens
-			// added by other sequences). If we haven't been able to add anything yet then pick up
-			// here again for the next batch to avoid starvation, though we can opportunistically
-			// check if other sequences can still squeeze something in.
-			if len(batchInputs)+minBatch > batchSize {
-				if len(seq.pendingInputs) == 0 && resumeSeq == -1 {
-					resumeSeq = seqIdx
+			for i, inp := range seq.inputs {
+				// If we are required to put following inputs into a single batch then extend the
+				// batch size. Since we are only extending the size the minimum amount possible, this
+				// will cause a break if we have existing inputs.
+				minBatch := 1 + inp.SameBatch
+				if minBatch > batchSize {
+					batchSize = minBatch
 				}
-				break
-			}
 
-			// If the sum of our working set (already processed tokens, tokens we added to this
-			// batch, required following tokens) exceeds the context size, then trigger a shift
-			// now so we don't have to do one later when we can't break the batch.
-			if int32(len(seq.cache.Inputs)+len(seq.pendingInputs)+minBatch) > s.cache.numCtx {
-				if len(seq.pendingInputs) != 0 {
-					break
+				// Inputs that can't be split may go over the prefill budget, otherwise they
+				// would never be scheduled while other sequences are generating
+				if minBatch > s.prefillChunk && len(seq.pendingInputs) == 0 {
+					batchSize = max(batchSize, min(s.batchSize, len(batchInputs)+minBatch))
 				}
 
-				if !seq.shift {
-					s.removeSequence(seqIdx, llm.DoneReasonLength)
-					nextBatch.seqs[seqIdx] = nil
+				// Stop if the required batch would put us over the total batch size (including tokens
+				// added by other sequences). If we haven't been able to add anything yet then pick up
+				// here again for the next batch to avoid starvation, though we can opportunistically
+				// check if other sequences can still squeeze something in.
+				if len(batchInputs)+minBatch > batchSize {
+					if len(seq.pendingInputs) == 0 && resumeSeq == -1 {
+						resumeSeq = seqIdx
+					}
 					break
 				}
 
-				err = s.cache.ShiftCacheSlot(seq.cache, seq.numKeep)
-				if err != nil {
-					var reprocess *ErrReprocessInputs
-					if errors.As(err, &reprocess) {
-						// Prepend these inputs to the sequence's inputs queue for reprocessing
-						seq.inputs = append(reprocess.Inputs, seq.inputs...)
-						// Skip this sequence but continue processing the rest
-						nextBatch.seqs[seqIdx] = nil // clear this sequence for this batch
-						err = nil
-						continue
-					} else {
-						return
+				// If the sum of our working set (already processed tokens, tokens we added to this
+				// batch, required following tokens) exceeds the context size, then trigger a shift
+				// now so we don't have to do one later when we can't break the batch.
+				if int32(len(seq.cache.Inputs)+len(seq.pendingInputs)+minBatch) > s.cache.numCtx {
+					if len(seq.pendingInputs) != 0 {
+						break
+					}
+
+					if !seq.shift {
+						s.removeSequence(seqIdx, llm.DoneReasonLength)
+						nextBatch.seqs[seqIdx] = nil
+						break
+					}
+
+					err = s.cache.ShiftCacheSlot(seq.cache, seq.numKeep)
+					if err != nil {
+						var reprocess *ErrReprocessInputs
+						if errors.As(err, &reprocess) {
+							// Prepend these inputs to the sequence's inputs queue for reprocessing
+							seq.inputs = append(reprocess.Inputs, seq.inputs...)
+							// Skip this sequence but continue processing the rest
+							nextBatch.seqs[seqIdx] = nil // clear this sequence for this batch
+							err = nil
+							continue
+						} else {
+							return
+						}
 					}
 				}
-			}
 
-			batchInputs = append(batchInputs, seq.inputs[i])
-			if inp.Multimodal != nil {
-				var mm []input.Multimodal
-				mm, err = seq.mmStore.getMultimodal(s.model.Backend(), nextBatch.ctx, inp.Multimodal, false)
-				if err != nil {
-					return
+				batchInputs = append(batchInputs, seq.inputs[i])
+				batchSeqs = append(batchSeqs, seq)
+				if inp.Multimodal != nil {
+					var mm []input.Multimodal
+					mm, err = seq.mmStore.getMultimodal(s.model.Backend(), nextBatch.ctx, inp.Multimodal, false)
+					if err != nil {
+						return
+					}
+					batch.Multimodal = append(batch.Multimodal, input.MultimodalIndex{Index: len(batchInputs) - 1, Multimodal: mm})
 				}
-				batch.Multimodal = append(batch.Multimodal, input.MultimodalIndex{Index: len(batchInputs) - 1, Multimodal: mm})
-			}
 
-			batch.Positions = append(batch.Positions, int32(len(seq.cache.Inputs)+len(seq.pendingInputs)))
-			batch.Sequences = append(batch.Sequences, seq.cache.Id)
+				batch.Positions = append(batch.Positions, int32(len(seq.cache.Inputs)+len(seq.pendingInputs)))
+				batch.Sequences = append(batch.Sequences, seq.cache.Id)
 
-			seq.iBatch = len(batchOutputs)
-			if i+1 == len(seq.inputs) || seq.embeddingOnly {
-				batchOutputs = append(batchOutputs, int32(len(batchInputs)-1))
+				seq.iBatch = len(batchOutputs)
+				if i+1 == len(seq.inputs) || seq.embeddingOnly || seq.promptLogprobs {
+					batchOutputs = append(batchOutputs, int32(len(batchInputs)-1))
+				}
+				logutil.Trace("forwardBatch iBatch", "batchID", s.batchID, "seqIdx", seqIdx, "seq.iBatch", seq.iBatch, "i+1", i+1, "len(seq.inputs)", len(seq.inputs))
+				seq.pendingInputs = append(seq.pendingInputs, inp)
 			}
-			logutil.Trace("forwardBatch iBatch", "batchID", s.batchID, "seqIdx", seqIdx, "seq.iBatch", seq.iBatch, "i+1", i+1, "len(seq.inputs)", len(seq.inputs))
-			seq.pendingInputs = append(seq.pendingInputs, inp)
+
+			seq.inputs = seq.inputs[len(seq.pendingInputs):]
 		}
 
-		seq.inputs = seq.inputs[len(seq.pendingInputs):]
+		if decode && len(batchInputs) > 0 && s.prefillChunk > 0 {
+			prefillBudget = min(prefillBudget, len(batchInputs)+s.prefillChunk)
+		}
 	}
 
 	startedAt := time.Now()
@@ -627,8 +798,18 @@ func (s *Server) forwardBatch(pendingBatch batchState) (nextBatch batchState, er
 	batch.Inputs = nextBatch.ctx.Input().Empty(ml.DTypeI32, len(batchInputs))
 	batch.Outputs = nextBatch.ctx.Input().FromInts(batchOutputs, len(batchOutputs))
 	nextBatch.ctx.SetBatchSize(len(batchInputs))
+	nextBatch.ctx.SetLoras(batchLoras(nextBatch.ctx, batchSeqs, batchOutputs))
+	nextBatch.ctx.SetControlVectors(batchControlVectors(nextBatch.ctx, batchSeqs, batchOutputs))
 	nextBatch.modelOutput, err = model.Forward(nextBatch.ctx, s.model, batch)
-	if err != nil {
+	if errors.Is(err, kvcache.ErrKvCacheFull) {
+		// A cache with block allocation is shared by all sequences so it can run out of space
+		// before any one of them reaches its context limit
+		s.reclaimCache()
+		nextBatch.ctx.Close()
+		nextBatch.ctx = nil
+		err = nil
+		return
+	} else if err != nil {
 		err = fmt.Errorf("failed to build graph: %w", err)
 		return
 	}
@@ -671,6 +852,7 @@ func (s *Server) computeBatch(activeBatch batchState) {
 	// decoded tokens.
 	nextBatchTokens := make([]*input.Input, len(s.seqs))
 	iBatches := make([]int, len(s.seqs)) // Record the iBatch values before releasing the lock
+	targets := make([][]promptTarget, len(s.seqs))
 	for i, seq := range s.seqs {
 		iBatches[i] = -1
 		if seq == nil {
@@ -688,6 +870,13 @@ func (s *Server) computeBatch(activeBatch batchState) {
 			continue
 		}
 
+		// Record the token following each input so we can look up its logprob
+		// once the logits are ready. The next batch may take more inputs from
+		// the sequence before then.
+		if seq.promptLogprobs && len(seq.pendingInputs) > 0 {
+			targets[i] = promptTargets(seq)
+		}
+
 		// Pending inputs will actually be in the cache after we call Compute.
 		// However, we have already resolved any placeholder tokens.
 		//
@@ -709,6 +898,10 @@ func (s *Server) computeBatch(activeBatch batchState) {
 			continue
 		}
 
+		if seq.promptLogprobs {
+			continue
+		}
+
 		seq.numPredicted++
 		nextToken := &input.Input{Token: 0} // placeholder we'll fill in after Compute/Floats
 		seq.inputs = []*input.Input{nextToken}
@@ -737,12 +930,39 @@ func (s *Server) computeBatch(activeBatch batchState) {
 
 	logutil.Trace("computeBatch: decoding", "batchID", activeBatch.id)
 	for i, seq := range s.seqs {
-		if seq == nil || nextBatchTokens[i] == nil {
+		if seq == nil {
+			continue
+		}
+
+		if targets[i] != nil {
+			vocabSize := len(outputs) / activeBatch.batch.Outputs.Dim(0)
+
+			var logprobs []llm.Logprob
+			for _, target := range targets[i] {
+				logits := outputs[target.output*vocabSize : (target.output+1)*vocabSize]
+				logprobs = append(logprobs, calculateLogprobs(logits, target.token, seq.topLogprobs, s.model.(model.TextProcessor))...)
+			}
+
+			if !sendPromptLogprobs(seq, logprobs) {
+				s.removeSequence(i, llm.DoneReasonConnectionClosed)
+				continue
+			}
+
+			if len(seq.inputs) == 0 {
+				seq.lastUpdatedAt = t
+				seq.processingDuration = t.Sub(seq.startedAt)
+				s.removeSequence(i, llm.DoneReasonStop)
+			}
+			continue
+		}
+
+		if nextBatchTokens[i] == nil {
 			continue
 		}
 
 		seq.lastUpdatedAt = t
 		if seq.numPredicted == 1 {
+			seq.timeToFirstToken = seq.lastUpdatedAt.Sub(seq.createdAt)
 			seq.processingDuration = seq.lastUpdatedAt.Sub(seq.startedAt)
 			seq.startedAt = seq.lastUpdatedAt
 		}
@@ -890,16 +1110,32 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		grammar,
 	)
 
+	loras, err := s.loadLoras(req.Loras)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load LoRA adapters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	controlVectors, err := s.loadControlVectors(req.ControlVectors)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load control vectors: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	seq, err := s.NewSequence(req.Prompt, req.Images, NewSequenceParams{
-		numPredict:  req.Options.NumPredict,
-		stop:        req.Options.Stop,
-		numKeep:     int32(req.Options.NumKeep),
-		sampler:     sampler,
-		embedding:   false,
-		shift:       req.Shift,
-		truncate:    req.Truncate,
-		logprobs:    req.Logprobs,
-		topLogprobs: req.TopLogprobs,
+		numPredict:     req.Options.NumPredict,
+		stop:           req.Options.Stop,
+		numKeep:        int32(req.Options.NumKeep),
+		sampler:        sampler,
+		embedding:      false,
+		shift:          req.Shift,
+		truncate:       req.Truncate,
+		logprobs:       req.Logprobs,
+		topLogprobs:    req.TopLogprobs,
+		promptLogprobs: req.PromptLogprobs,
+		tokens:         req.Tokens,
+		loras:          loras,
+		controlVectors: controlVectors,
 	})
 	if err != nil {
 		if errors.Is(err, errorInputTooLong) {
@@ -924,7 +1160,9 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, true)
+			// every prompt input needs to be evaluated for its logprobs
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, adapters{loras: seq.loras, controlVectors: seq.controlVectors}, !req.PromptLogprobs)
+			seq.numCachedInputs = seq.numPromptInputs - len(seq.inputs)
 			if err != nil {
 				s.mu.Unlock()
 				s.seqsSem.Release(1)
@@ -964,13 +1202,21 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 
 				flusher.Flush()
 			} else {
+				var interTokenLatency time.Duration
+				if seq.numPredicted > 1 {
+					interTokenLatency = seq.lastUpdatedAt.Sub(seq.startedAt) / time.Duration(seq.numPredicted-1)
+				}
+
 				if err := json.NewEncoder(w).Encode(&llm.CompletionResponse{
 					Done:               true,
 					DoneReason:         seq.doneReason,
 					PromptEvalCount:    seq.numPromptInputs,
+					PromptCachedCount:  seq.numCachedInputs,
 					PromptEvalDuration: seq.processingDuration,
 					EvalCount:          seq.numPredicted,
 					EvalDuration:       seq.lastUpdatedAt.Sub(seq.startedAt) - seq.samplingDuration,
+					TimeToFirstToken:   seq.timeToFirstToken,
+					InterTokenLatency:  interTokenLatency,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode final response: %v", err), http.StatusInternalServerError)
 				}
@@ -997,6 +1243,7 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 	seq, err := s.NewSequence(req.Content, nil, NewSequenceParams{
 		embedding: true,
 		truncate:  false,
+		tokens:    req.Tokens,
 	})
 	if err != nil {
 		if errors.Is(err, errorInputTooLong) {
@@ -1020,7 +1267,7 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 	found := false
 	for i, sq := range s.seqs {
 		if sq == nil {
-			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, false)
+			seq.cache, seq.inputs, err = s.cache.LoadCacheSlot(seq.inputs, adapters{}, false)
 			if err != nil {
 				s.mu.Unlock()
 				s.seqsSem.Release(1)
@@ -1095,7 +1342,13 @@ func (s *Server) reserveWorstCaseGraph(prompt bool) error {
 		var buf bytes.Buffer
 		bmp.Encode(&buf, img)
 
-		if inputs[0].Multimodal, err = multimodalProcessor.EncodeMultimodal(mmCtx, buf.Bytes()); err == nil {
+		inputs[0].Multimodal, err = multimodalProcessor.EncodeMultimodal(mmCtx, buf.Bytes())
+		if err != nil {
+			// audio models reject images so reserve for 30 seconds of audio instead
+			inputs[0].Multimodal, err = multimodalProcessor.EncodeMultimodal(mmCtx, audioproc.EncodeWAV(make([]float32, 30*16000), 16000))
+		}
+
+		if err == nil {
 			mmStore.addMultimodal(inputs[0].Multimodal)
 
 			inputs, err = multimodalProcessor.PostTokenize(inputs)
@@ -1174,6 +1427,8 @@ func (s *Server) allocModel(
 	parallel int,
 	kvCacheType string,
 	kvSize int,
+	kvPoolSize int,
+	kvHostSize int,
 	multiUserCache bool,
 ) (panicErr error) {
 	// Convert memory allocation panics to errors
@@ -1198,9 +1453,9 @@ func (s *Server) allocModel(
 		return err
 	}
 
-	// TODO(jessegross): LoRA loading
+	// LoRA adapters are loaded as requests use them
 	if len(loraPath) > 0 {
-		return errors.New("loras are not yet implemented")
+		return errors.New("loras must be selected per request")
 	}
 
 	if s.model.Config().Cache == nil {
@@ -1214,13 +1469,15 @@ func (s *Server) allocModel(
 		}
 	}
 
-	s.cache, err = NewInputCache(s.model, kvCacheType, int32(kvSize), parallel, s.batchSize, multiUserCache)
+	s.cache, err = NewInputCache(s.model, kvCacheType, int32(kvSize), kvPoolSize, kvHostSize, parallel, s.batchSize, multiUserCache)
 	if err != nil {
 		return err
 	}
 
 	s.parallel = parallel
 	s.seqs = make([]*Sequence, s.parallel)
+	s.loras = make(map[string]int)
+	s.controlVectors = make(map[string]int)
 	s.seqsSem = semaphore.NewWeighted(int64(s.parallel))
 
 	err = s.reserveWorstCaseGraph(true)
@@ -1298,11 +1555,14 @@ func (s *Server) load(w http.ResponseWriter, r *http.Request) {
 			NumThreads:     req.NumThreads,
 			GPULayers:      req.GPULayers,
 			FlashAttention: req.FlashAttention,
+			Rope:           req.Rope,
+			MaxAdapters:    req.MaxAdapters,
 		}
 
 		s.batchSize = req.BatchSize
+		s.prefillChunk = req.PrefillChunk
 
-		err := s.allocModel(s.modelPath, params, req.LoraPath, req.Parallel, req.KvCacheType, req.KvSize, req.MultiUserCache)
+		err := s.allocModel(s.modelPath, params, req.LoraPath, req.Parallel, req.KvCacheType, req.KvSize, req.KvPoolSize, req.KvHostSize, req.MultiUserCache)
 		if err != nil {
 			s.closeModel()
 
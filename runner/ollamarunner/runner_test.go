@@ -0,0 +1,185 @@
+package ollamarunner
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ollama/ollama/fs"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+)
+
+func TestPromptTargets(t *testing.T) {
+	tokens := func(ids ...int32) []*input.Input {
+		var inputs []*input.Input
+		for _, id := range ids {
+			inputs = append(inputs, &input.Input{Token: id})
+		}
+		return inputs
+	}
+
+	// a batch with outputs 0-2 from the first sequence, 3 from a sequence
+	// that is generating and 4-5 from the last sequence
+	tests := []struct {
+		name     string
+		seq      *Sequence
+		expected []promptTarget
+	}{
+		{
+			name:     "MoreInputs",
+			seq:      &Sequence{pendingInputs: tokens(1, 2, 3), inputs: tokens(4, 5), iBatch: 2},
+			expected: []promptTarget{{token: 2, output: 0}, {token: 3, output: 1}, {token: 4, output: 2}},
+		},
+		{
+			name:     "LastInputs",
+			seq:      &Sequence{pendingInputs: tokens(7, 8), iBatch: 5},
+			expected: []promptTarget{{token: 8, output: 4}},
+		},
+		{
+			name: "Image",
+			seq: &Sequence{
+				pendingInputs: []*input.Input{{Token: 1}, {Multimodal: []input.Multimodal{{}}}, {Token: 2}},
+				inputs:        []*input.Input{{Multimodal: []input.Multimodal{{}}}},
+				iBatch:        5,
+			},
+			expected: []promptTarget{{token: 2, output: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := promptTargets(tt.seq)
+			if got == nil || !slices.Equal(got, tt.expected) {
+				t.Errorf("promptTargets() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// batchModel is a model that only passes its outputs through, for checking
+// how inputs are put into batches
+type batchModel struct {
+	model.Base
+}
+
+func (m *batchModel) Forward(ctx ml.Context, batch input.Batch) (ml.Tensor, error) {
+	return batch.Outputs, nil
+}
+
+func init() {
+	model.Register("batchtest", func(fs.Config) (model.Model, error) {
+		return &batchModel{}, nil
+	})
+}
+
+func newBatchServer(t *testing.T, batchSize, prefillChunk int) *Server {
+	t.Helper()
+
+	f, err := os.CreateTemp(t.TempDir(), "*.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := ggml.WriteGGUF(f, ggml.KV{"general.architecture": "batchtest"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := model.New(f.Name(), ml.BackendParams{AllocMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Backend().Close)
+
+	s := &Server{
+		model:        m,
+		batchSize:    batchSize,
+		prefillChunk: prefillChunk,
+		cache:        &InputCache{numCtx: 1024, enabled: true},
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// newBatchSequence returns a sequence in cache slot id with n inputs left to
+// process, which is generating if it has predicted tokens
+func newBatchSequence(id, n, numPredicted int) *Sequence {
+	inputs := make([]*input.Input, n)
+	for i := range inputs {
+		inputs[i] = &input.Input{Token: int32(i)}
+	}
+
+	return &Sequence{
+		inputs:       inputs,
+		numPredicted: numPredicted,
+		cache:        &InputCacheSlot{Id: id},
+	}
+}
+
+func TestForwardBatchPrefillChunk(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefillChunk int
+		seqs         []*Sequence
+
+		// expected is the number of inputs in the batch from each cache slot
+		expected map[int]int
+	}{
+		{
+			name:     "Prefill",
+			seqs:     []*Sequence{newBatchSequence(0, 100, 0)},
+			expected: map[int]int{0: 32},
+		},
+		{
+			name:         "PrefillAlone",
+			prefillChunk: 8,
+			seqs:         []*Sequence{newBatchSequence(0, 100, 0)},
+			expected:     map[int]int{0: 32},
+		},
+		{
+			name:     "DecodeFirst",
+			seqs:     []*Sequence{newBatchSequence(0, 100, 0), newBatchSequence(1, 1, 1)},
+			expected: map[int]int{0: 31, 1: 1},
+		},
+		{
+			name:         "Chunked",
+			prefillChunk: 8,
+			seqs:         []*Sequence{newBatchSequence(0, 100, 0), newBatchSequence(1, 1, 1), newBatchSequence(2, 1, 3)},
+			expected:     map[int]int{0: 8, 1: 1, 2: 1},
+		},
+		{
+			name:         "ChunkShared",
+			prefillChunk: 8,
+			seqs:         []*Sequence{newBatchSequence(0, 100, 0), newBatchSequence(1, 1, 1), newBatchSequence(2, 100, 0)},
+			expected:     map[int]int{0: 8, 1: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBatchServer(t, 32, tt.prefillChunk)
+			s.seqs = tt.seqs
+			s.parallel = len(tt.seqs)
+
+			batch, err := s.forwardBatch(batchState{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer batch.ctx.Close()
+
+			got := make(map[int]int)
+			for _, id := range batch.batch.Sequences {
+				got[id]++
+			}
+
+			if !maps.Equal(got, tt.expected) {
+				t.Errorf("inputs per sequence = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/anthropic"
+	"github.com/ollama/ollama/middleware"
+	"github.com/ollama/ollama/openai"
+)
+
+// API key scopes. Each route requires one scope; a key with the admin scope
+// may call any route.
+const (
+	scopeInference = "inference"
+	scopeModels    = "models"
+	scopeAdmin     = "admin"
+)
+
+// apiKeyContextKey is the gin context key for the *apiKey that authenticated
+// the request.
+const apiKeyContextKey = "auth.key"
+
+// publicRoutes can be called without a key so health checks keep working.
+var publicRoutes = []string{"/", "/api/version"}
+
+// routeScopes maps route patterns to the scope they require. Routes that are
+// not listed require the admin scope.
+var routeScopes = map[string]string{
+	"/api/generate":   scopeInference,
+	"/api/chat":       scopeInference,
+	"/api/embed":      scopeInference,
+	"/api/embeddings": scopeInference,
+	"/api/rerank":     scopeInference,
+	"/api/transcribe": scopeInference,
+	"/api/ps":         scopeInference,
+	"/api/tags":       scopeInference,
+	"/api/show":       scopeInference,
+	"/api/tokenize":   scopeInference,
+	"/api/detokenize": scopeInference,
+	"/api/chat/count": scopeInference,
+	"/api/perplexity": scopeInference,
+
+	"/api/pull":          scopeModels,
+	"/api/push":          scopeModels,
+	"/api/delete":        scopeModels,
+	"/api/create":        scopeModels,
+	"/api/blobs/:digest": scopeModels,
+	"/api/copy":          scopeModels,
+	"/api/export":        scopeModels,
+	"/api/import":        scopeModels,
+
+	"/v2/":                                    scopeModels,
+	"/v2/:namespace/:model/manifests/:tag":    scopeModels,
+	"/v2/:namespace/:model/blobs/:digest":     scopeModels,
+	"/v2/:namespace/:model/chunksums/:digest": scopeModels,
+}
+
+func requiredScope(route string) string {
+	if scope, ok := routeScopes[route]; ok {
+		return scope
+	}
+	if strings.HasPrefix(route, "/v1/") {
+		return scopeInference
+	}
+	return scopeAdmin
+}
+
+// apiKey is an entry in the API keys file.
+type apiKey struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+
+	// RequestsPerMinute limits the request rate, allowing bursts of up to
+	// a minute's worth of requests. Zero means no limit.
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+
+	// TokensPerDay limits prompt and generated tokens per UTC day. Zero
+	// means no limit.
+	TokensPerDay int `json:"tokens_per_day,omitempty"`
+
+	mu sync.Mutex
+
+	// allowance and lastRequest implement a token bucket for requests
+	allowance   float64
+	lastRequest time.Time
+
+	// day is the UTC day tokensUsed was counted in
+	day        string
+	tokensUsed int
+}
+
+// id identifies the key without revealing it. Unlike the name it is unique
+// and does not change when other keys are added or removed.
+func (k *apiKey) id() string {
+	sum := sha256.Sum256([]byte(k.Key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (k *apiKey) hasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, scopeAdmin)
+}
+
+// allow reports whether another request fits in the key's rate limit and,
+// if not, how long until it does.
+func (k *apiKey) allow(now time.Time) (bool, time.Duration) {
+	if k.RequestsPerMinute <= 0 {
+		return true, 0
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	limit := float64(k.RequestsPerMinute)
+	rate := limit / time.Minute.Seconds()
+	if k.lastRequest.IsZero() {
+		k.allowance = limit
+	} else {
+		k.allowance = min(limit, k.allowance+now.Sub(k.lastRequest).Seconds()*rate)
+	}
+	k.lastRequest = now
+
+	if k.allowance < 1 {
+		return false, time.Duration((1 - k.allowance) / rate * float64(time.Second))
+	}
+
+	k.allowance--
+	return true, 0
+}
+
+// withinQuota reports whether the key has tokens left today.
+func (k *apiKey) withinQuota(now time.Time) bool {
+	if k.TokensPerDay <= 0 {
+		return true
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.resetDay(now)
+	return k.tokensUsed < k.TokensPerDay
+}
+
+func (k *apiKey) charge(now time.Time, tokens int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.resetDay(now)
+	k.tokensUsed += tokens
+}
+
+func (k *apiKey) resetDay(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); day != k.day {
+		k.day = day
+		k.tokensUsed = 0
+	}
+}
+
+// apiKeys holds the keys allowed to call the server. Usage is kept in memory
+// and resets when the server restarts.
+type apiKeys struct {
+	keys []*apiKey
+}
+
+// loadAPIKeys reads an API keys file:
+//
+//	{
+//	  "keys": [
+//	    {"name": "alice", "key": "...", "scopes": ["inference"], "requests_per_minute": 60, "tokens_per_day": 1000000},
+//	    {"name": "ops", "key": "...", "scopes": ["admin"]}
+//	  ]
+//	}
+func loadAPIKeys(path string) (*apiKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file struct {
+		Keys []*apiKey `json:"keys"`
+	}
+	if err := json.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(file.Keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys defined", path)
+	}
+
+	seen := make(map[string]bool)
+	for i, k := range file.Keys {
+		if k.Name == "" {
+			k.Name = strconv.Itoa(i)
+		}
+		if k.Key == "" {
+			return nil, fmt.Errorf("%s: key %q is empty", path, k.Name)
+		}
+		if seen[k.Key] {
+			return nil, fmt.Errorf("%s: key %q is a duplicate", path, k.Name)
+		}
+		seen[k.Key] = true
+
+		if len(k.Scopes) == 0 {
+			return nil, fmt.Errorf("%s: key %q has no scopes", path, k.Name)
+		}
+		for _, scope := range k.Scopes {
+			if !slices.Contains([]string{scopeInference, scopeModels, scopeAdmin}, scope) {
+				return nil, fmt.Errorf("%s: key %q has unknown scope %q", path, k.Name, scope)
+			}
+		}
+	}
+
+	return &apiKeys{keys: file.Keys}, nil
+}
+
+func (ks *apiKeys) lookup(key string) *apiKey {
+	var found *apiKey
+	for _, k := range ks.keys {
+		// compare every key so the time taken does not reveal a match
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+var errMissingAPIKey = errors.New("missing API key")
+
+// requestAPIKey returns the key sent in the Authorization header as a bearer
+// token or basic auth password, or in the x-api-key header used by Anthropic
+// clients.
+func requestAPIKey(r *http.Request) (string, error) {
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return key, nil
+	}
+
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, nil
+	}
+
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), nil
+	}
+
+	return "", errMissingAPIKey
+}
+
+// authMiddleware rejects requests without a key allowed to call the route
+// when API keys are configured.
+func (s *Server) authMiddleware(c *gin.Context) {
+	if s.apiKeys == nil || slices.Contains(publicRoutes, c.FullPath()) {
+		c.Next()
+		return
+	}
+
+	key, err := requestAPIKey(c.Request)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer realm="ollama"`)
+		abortAuth(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	k := s.apiKeys.lookup(key)
+	if k == nil {
+		c.Header("WWW-Authenticate", `Bearer realm="ollama", error="invalid_token"`)
+		abortAuth(c, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+
+	if scope := requiredScope(c.FullPath()); !k.hasScope(scope) {
+		abortAuth(c, http.StatusForbidden, fmt.Sprintf("API key %q does not have the %q scope", k.Name, scope))
+		return
+	}
+
+	now := time.Now()
+	if ok, wait := k.allow(now); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		abortAuth(c, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	if !k.withinQuota(now) {
+		abortAuth(c, http.StatusTooManyRequests, "daily token quota exceeded")
+		return
+	}
+
+	c.Set(apiKeyContextKey, k)
+	c.Set(middleware.APIKeyIDKey, k.id())
+	c.Next()
+}
+
+// abortAuth writes an authentication error in the format clients of the
+// route expect.
+func abortAuth(c *gin.Context, status int, message string) {
+	switch path := c.Request.URL.Path; {
+	case strings.HasPrefix(path, "/v1/messages"):
+		c.AbortWithStatusJSON(status, anthropic.NewError(status, message))
+	case strings.HasPrefix(path, "/v1/"):
+		c.AbortWithStatusJSON(status, openai.NewError(status, message))
+	default:
+		c.AbortWithStatusJSON(status, gin.H{"error": message})
+	}
+}
+
+// chargeTokens counts tokens against the quota of the key that made the
+// request, if any.
+func chargeTokens(c *gin.Context, tokens int) {
+	if k, ok := c.Get(apiKeyContextKey); ok {
+		k.(*apiKey).charge(time.Now(), tokens)
+	}
+}
@@ -183,6 +183,16 @@ func (s *Server) CreateHandler(c *gin.Context) {
 			baseLayers = append(baseLayers, adapterLayers...)
 		}
 
+		if !remote && r.ControlVectors != nil {
+			controlLayers, err := convertControlVectorsFromFiles(r.ControlVectors, baseLayers, fn)
+			if err != nil {
+				ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
+				return
+			}
+
+			baseLayers = append(baseLayers, controlLayers...)
+		}
+
 		// Info is not currently exposed by Modelfiles, but allows overriding various
 		// config values
 		if r.Info != nil {
@@ -335,6 +345,91 @@ func convertModelFromFiles(files map[string]string, baseLayers []*layerGGML, isA
 	}
 }
 
+// convertControlVectorsFromFiles creates a layer for each GGUF control vector
+// in files, or converts safetensors files to one control vector. Control
+// vectors are checked against the base model since they are only loaded when
+// a request uses them.
+func convertControlVectorsFromFiles(files map[string]string, baseLayers []*layerGGML, fn func(resp api.ProgressResponse)) ([]*layerGGML, error) {
+	kv, err := kvFromLayers(baseLayers)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []*layerGGML
+	switch detectModelTypeFromFiles(files) {
+	case "safetensors":
+		tmpDir, err := os.MkdirTemp(envconfig.Models(), "ollama-safetensors")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if err := linkBlobs(tmpDir, files); err != nil {
+			return nil, err
+		}
+
+		t, err := os.CreateTemp(tmpDir, "fp32")
+		if err != nil {
+			return nil, err
+		}
+		defer t.Close()
+
+		fn(api.ProgressResponse{Status: "converting control vector"})
+		if err := convert.ConvertControlVector(os.DirFS(tmpDir), t, kv); err != nil {
+			return nil, err
+		}
+
+		if _, err := t.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		layer, err := manifest.NewLayer(t, "application/vnd.ollama.image.control")
+		if err != nil {
+			return nil, err
+		}
+
+		bin, err := layer.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer bin.Close()
+
+		f, err := ggml.Decode(bin, -1)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, &layerGGML{layer, f})
+	case "gguf":
+		for _, digest := range files {
+			ls, err := ggufLayers(digest, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, l := range ls {
+				if l.GGML == nil {
+					continue
+				}
+
+				if l.MediaType != "application/vnd.ollama.image.control" {
+					return nil, fmt.Errorf("%s is not a control vector", digest)
+				}
+
+				if hint := l.KV().String("model_hint"); hint != "" && hint != kv.Architecture() {
+					return nil, fmt.Errorf("control vector is for %s but the model is %s", hint, kv.Architecture())
+				}
+
+				layers = append(layers, l)
+			}
+		}
+	default:
+		return nil, errUnknownType
+	}
+
+	return layers, nil
+}
+
 func detectModelTypeFromFiles(files map[string]string) string {
 	for fn := range files {
 		if strings.HasSuffix(fn, ".safetensors") {
@@ -379,29 +474,9 @@ func convertFromSafetensors(files map[string]string, baseLayers []*layerGGML, is
 		return nil, err
 	}
 	defer os.RemoveAll(tmpDir)
-	// Set up a root to validate paths
-	root, err := os.OpenRoot(tmpDir)
-	if err != nil {
-		return nil, err
-	}
-	defer root.Close()
 
-	for fp, digest := range files {
-		if !fs.ValidPath(fp) {
-			return nil, fmt.Errorf("%w: %s", errFilePath, fp)
-		}
-		if _, err := root.Stat(fp); err != nil && !errors.Is(err, fs.ErrNotExist) {
-			// Path is likely outside the root
-			return nil, fmt.Errorf("%w: %s: %s", errFilePath, err, fp)
-		}
-
-		blobPath, err := manifest.BlobsPath(digest)
-		if err != nil {
-			return nil, err
-		}
-		if err := createLink(blobPath, filepath.Join(tmpDir, fp)); err != nil {
-			return nil, err
-		}
+	if err := linkBlobs(tmpDir, files); err != nil {
+		return nil, err
 	}
 
 	t, err := os.CreateTemp(tmpDir, "fp16")
@@ -456,6 +531,36 @@ func convertFromSafetensors(files map[string]string, baseLayers []*layerGGML, is
 	return layers, nil
 }
 
+// linkBlobs links the blobs for files into dir using their file names
+func linkBlobs(dir string, files map[string]string) error {
+	// Set up a root to validate paths
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	for fp, digest := range files {
+		if !fs.ValidPath(fp) {
+			return fmt.Errorf("%w: %s", errFilePath, fp)
+		}
+		if _, err := root.Stat(fp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// Path is likely outside the root
+			return fmt.Errorf("%w: %s: %s", errFilePath, err, fp)
+		}
+
+		blobPath, err := manifest.BlobsPath(digest)
+		if err != nil {
+			return err
+		}
+		if err := createLink(blobPath, filepath.Join(dir, fp)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func kvFromLayers(baseLayers []*layerGGML) (ofs.Config, error) {
 	for _, l := range baseLayers {
 		if l.GGML != nil {
@@ -650,6 +755,8 @@ func ggufLayers(digest string, fn func(resp api.ProgressResponse)) ([]*layerGGML
 	mediatype := "application/vnd.ollama.image.model"
 	if f.KV().Kind() == "adapter" {
 		mediatype = "application/vnd.ollama.image.adapter"
+	} else if f.KV().Architecture() == "controlvector" {
+		mediatype = "application/vnd.ollama.image.control"
 	} else if (f.KV().Uint("block_count") == 0 && f.KV().Uint("vision.block_count") > 0) || f.KV().Kind() == "projector" {
 		// if a model has vision.block_count but not block_count, it is a standalone vision model
 		mediatype = "application/vnd.ollama.image.projector"
@@ -119,6 +119,7 @@ func (p *blobDownloadPart) StopsAt() int64 {
 func (p *blobDownloadPart) Write(b []byte) (n int, err error) {
 	n = len(b)
 	p.blobDownload.Completed.Add(int64(n))
+	downloadBytesTotal.With().Add(float64(n))
 	p.lastUpdatedMu.Lock()
 	p.lastUpdated = time.Now()
 	p.lastUpdatedMu.Unlock()
@@ -265,6 +266,11 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 			if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusOK {
 				return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
 			}
+			if resp.StatusCode == http.StatusOK {
+				// Mirrors serve blobs directly rather than
+				// redirecting to a CDN
+				return requestURL, nil
+			}
 			return resp.Location()
 		}
 	}()
@@ -494,7 +500,7 @@ func downloadBlob(ctx context.Context, opts downloadOpts) (cacheHit bool, _ erro
 	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest})
 	download := data.(*blobDownload)
 	if !ok {
-		requestURL := opts.n.BaseURL()
+		requestURL := opts.regOpts.base(opts.n)
 		requestURL = requestURL.JoinPath("v2", opts.n.DisplayNamespaceModel(), "blobs", opts.digest)
 		if err := download.Prepare(ctx, requestURL, opts.regOpts); err != nil {
 			blobDownloadManager.Delete(opts.digest)
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/types/model"
+)
+
+// Model archives are tar files holding a model's manifest followed by every
+// blob it references:
+//
+//	manifests/{host}/{namespace}/{model}/{tag}
+//	blobs/sha256-{hex}
+//
+// The manifest comes first so an importer knows which blobs to expect, and
+// their sizes, before reading them.
+const (
+	archiveManifests = "manifests"
+	archiveBlobs     = "blobs"
+
+	maxArchiveManifestSize = 4 << 20
+)
+
+var errInvalidArchive = errors.New("invalid model archive")
+
+// modelArchive is a seekable, read-only view of a model's export archive. It
+// is assembled from the manifest and blob files without copying them, which
+// lets interrupted exports resume with HTTP range requests.
+type modelArchive struct {
+	// digest is the sha256 of the manifest and identifies the archive contents
+	digest  string
+	modTime time.Time
+
+	parts []archivePart
+	size  int64
+	files []*os.File
+
+	offset int64
+}
+
+type archivePart struct {
+	io.ReaderAt
+	offset, size int64
+}
+
+// newModelArchive opens the manifest and blobs of the named model. The caller
+// must Close the archive.
+func newModelArchive(n model.Name) (_ *modelArchive, err error) {
+	mf, err := manifest.ParseNamedManifest(n)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := manifest.PathForName(n)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	if digest := hex.EncodeToString(sum[:]); digest != mf.Digest() {
+		return nil, fmt.Errorf("manifest for %s changed during export", n.DisplayShortest())
+	}
+
+	a := &modelArchive{
+		digest:  mf.Digest(),
+		modTime: mf.FileInfo().ModTime().Truncate(time.Second),
+	}
+	defer func() {
+		if err != nil {
+			a.Close()
+		}
+	}()
+
+	if err := a.addFile(path.Join(archiveManifests, filepath.ToSlash(n.Filepath())), bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, layer := range append([]manifest.Layer{mf.Config}, mf.Layers...) {
+		if layer.Digest == "" || seen[layer.Digest] {
+			continue
+		}
+		seen[layer.Digest] = true
+
+		blob, err := manifest.BlobsPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(blob)
+		if err != nil {
+			return nil, err
+		}
+		a.files = append(a.files, f)
+
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() != layer.Size {
+			return nil, fmt.Errorf("blob %s has size %d, expected %d", layer.Digest, fi.Size(), layer.Size)
+		}
+
+		if err := a.addFile(path.Join(archiveBlobs, filepath.Base(blob)), f, fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+
+	// A tar archive ends with two zero blocks
+	a.add(zeros{}, 2*512)
+	return a, nil
+}
+
+// addFile appends a tar entry for a file of the given size read from r.
+func (a *modelArchive) addFile(name string, r io.ReaderAt, size int64) error {
+	var hdr bytes.Buffer
+	if err := tar.NewWriter(&hdr).WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  a.modTime,
+	}); err != nil {
+		return err
+	}
+
+	a.add(bytes.NewReader(hdr.Bytes()), int64(hdr.Len()))
+	a.add(r, size)
+
+	// Entries are padded to a multiple of the block size
+	if pad := (512 - size%512) % 512; pad > 0 {
+		a.add(zeros{}, pad)
+	}
+	return nil
+}
+
+func (a *modelArchive) add(r io.ReaderAt, size int64) {
+	a.parts = append(a.parts, archivePart{ReaderAt: r, offset: a.size, size: size})
+	a.size += size
+}
+
+// Size returns the total size of the archive in bytes.
+func (a *modelArchive) Size() int64 {
+	return a.size
+}
+
+func (a *modelArchive) ReadAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		i := sort.Search(len(a.parts), func(i int) bool {
+			return a.parts[i].offset+a.parts[i].size > off
+		})
+		if i == len(a.parts) {
+			return n, io.EOF
+		}
+
+		part := a.parts[i]
+		end := min(len(p), n+int(part.offset+part.size-off))
+		m, err := part.ReadAt(p[n:end], off-part.offset)
+		n += m
+		off += int64(m)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		if m == 0 {
+			// A blob was truncated after the archive was assembled
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	return n, nil
+}
+
+func (a *modelArchive) Read(p []byte) (int, error) {
+	n, err := a.ReadAt(p, a.offset)
+	a.offset += int64(n)
+	return n, err
+}
+
+func (a *modelArchive) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += a.offset
+	case io.SeekEnd:
+		offset += a.size
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+
+	a.offset = offset
+	return offset, nil
+}
+
+func (a *modelArchive) Close() error {
+	var errs []error
+	for _, f := range a.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type zeros struct{}
+
+func (zeros) ReadAt(p []byte, _ int64) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// importModels reads a model archive from r. Blobs that are not already
+// present are written and verified as they are read; blobs that are present
+// are skipped. Manifests are written only once every blob they reference is
+// in place, so an interrupted import leaves no partial models behind and can
+// be retried without rewriting the blobs it already committed.
+func importModels(r io.Reader) ([]model.Name, error) {
+	type pending struct {
+		name model.Name
+		data []byte
+	}
+
+	var manifests []pending
+	expected := make(map[string]int64)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		} else if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: unexpected entry %q", errInvalidArchive, hdr.Name)
+		}
+
+		dir, rest, _ := strings.Cut(hdr.Name, "/")
+		switch dir {
+		case archiveManifests:
+			n := model.ParseNameFromFilepath(filepath.FromSlash(rest))
+			if !n.IsFullyQualified() {
+				return nil, fmt.Errorf("%w: invalid model name %q", errInvalidArchive, rest)
+			}
+			if hdr.Size > maxArchiveManifestSize {
+				return nil, fmt.Errorf("%w: manifest for %s is too large", errInvalidArchive, n.DisplayShortest())
+			}
+
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+
+			var mf manifest.Manifest
+			if err := json.Unmarshal(data, &mf); err != nil {
+				return nil, fmt.Errorf("%w: manifest for %s: %v", errInvalidArchive, n.DisplayShortest(), err)
+			}
+
+			for _, layer := range append([]manifest.Layer{mf.Config}, mf.Layers...) {
+				if layer.Digest != "" {
+					expected[layer.Digest] = layer.Size
+				}
+			}
+
+			manifests = append(manifests, pending{name: n, data: data})
+		case archiveBlobs:
+			digest := strings.Replace(rest, "-", ":", 1)
+			size, ok := expected[digest]
+			if !ok {
+				return nil, fmt.Errorf("%w: blob %s is not referenced by a manifest", errInvalidArchive, rest)
+			}
+			if hdr.Size != size {
+				return nil, fmt.Errorf("%w: blob %s has size %d, expected %d", errInvalidArchive, digest, hdr.Size, size)
+			}
+
+			if err := importBlob(digest, size, tr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected entry %q", errInvalidArchive, hdr.Name)
+		}
+	}
+
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("%w: no model manifest found", errInvalidArchive)
+	}
+
+	for digest, size := range expected {
+		blob, err := manifest.BlobsPath(digest)
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(blob); err != nil || fi.Size() != size {
+			return nil, fmt.Errorf("%w: missing blob %s", errInvalidArchive, digest)
+		}
+	}
+
+	names := make([]model.Name, 0, len(manifests))
+	for _, m := range manifests {
+		p, err := manifest.PathForName(m.name)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(p, m.data, 0o644); err != nil {
+			return nil, err
+		}
+		names = append(names, m.name)
+	}
+
+	return names, nil
+}
+
+// importBlob writes a blob read from r unless a blob with the same digest and
+// size already exists.
+func importBlob(digest string, size int64, r io.Reader) error {
+	blob, err := manifest.BlobsPath(digest)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArchive, err)
+	}
+
+	if fi, err := os.Stat(blob); err == nil && fi.Size() == size {
+		return nil
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(blob), "sha256-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	// hash the blob as it's written so that it's only moved into place
+	// once it's known to be complete and intact
+	h := sha256.New()
+	n, err := io.Copy(temp, io.TeeReader(r, h))
+	if err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if got := fmt.Sprintf("sha256:%x", h.Sum(nil)); got != digest || n != size {
+		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, got)
+	}
+
+	return os.Rename(temp.Name(), blob)
+}
@@ -19,11 +19,14 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/fs/gguf"
+	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/ml/nn/pooling"
 	"github.com/ollama/ollama/model/parsers"
 	"github.com/ollama/ollama/parser"
 	"github.com/ollama/ollama/template"
@@ -42,6 +45,8 @@ var (
 	errCapabilityEmbedding  = errors.New("embedding")
 	errCapabilityThinking   = errors.New("thinking")
 	errCapabilityImage      = errors.New("image generation")
+	errCapabilityRerank     = errors.New("rerank")
+	errCapabilityAudio      = errors.New("audio")
 	errInsecureProtocol     = errors.New("insecure protocol http")
 )
 
@@ -52,6 +57,19 @@ type registryOptions struct {
 	Token    string
 
 	CheckRedirect func(req *http.Request, via []*http.Request) error
+
+	// baseURL, if set, replaces the registry in the model name, e.g. to
+	// pull from a mirror
+	baseURL *url.URL
+}
+
+// base returns the URL of the registry serving n.
+func (r *registryOptions) base(n model.Name) *url.URL {
+	if r != nil && r.baseURL != nil {
+		u := *r.baseURL
+		return &u
+	}
+	return n.BaseURL()
 }
 
 type Model struct {
@@ -62,6 +80,7 @@ type Model struct {
 	ParentModel    string
 	AdapterPaths   []string
 	ProjectorPaths []string
+	ControlPaths   []string
 	System         string
 	License        []string
 	Digest         string
@@ -86,8 +105,12 @@ func (m *Model) Capabilities() []model.Capability {
 		if err == nil {
 			defer f.Close()
 
-			if f.KeyValue("pooling_type").Valid() {
-				capabilities = append(capabilities, model.CapabilityEmbedding)
+			if kv := f.KeyValue("pooling_type"); kv.Valid() {
+				if kv.Uint() == uint64(pooling.TypeRank) {
+					capabilities = append(capabilities, model.CapabilityRerank)
+				} else {
+					capabilities = append(capabilities, model.CapabilityEmbedding)
+				}
 			} else {
 				// If no embedding is specified, we assume the model supports completion
 				capabilities = append(capabilities, model.CapabilityCompletion)
@@ -95,6 +118,9 @@ func (m *Model) Capabilities() []model.Capability {
 			if f.KeyValue("vision.block_count").Valid() {
 				capabilities = append(capabilities, model.CapabilityVision)
 			}
+			if f.KeyValue("audio.block_count").Valid() {
+				capabilities = append(capabilities, model.CapabilityAudio)
+			}
 		} else {
 			slog.Error("couldn't open model file", "error", err)
 		}
@@ -161,6 +187,8 @@ func (m *Model) CheckCapabilities(want ...model.Capability) error {
 		model.CapabilityEmbedding:  errCapabilityEmbedding,
 		model.CapabilityThinking:   errCapabilityThinking,
 		model.CapabilityImage:      errCapabilityImage,
+		model.CapabilityRerank:     errCapabilityRerank,
+		model.CapabilityAudio:      errCapabilityAudio,
 	}
 
 	for _, cap := range want {
@@ -190,6 +218,36 @@ func (m *Model) CheckCapabilities(want ...model.Capability) error {
 	return err
 }
 
+// Loras returns the model's adapters for a completion request, applied with
+// the scale in opts
+func (m *Model) Loras(opts *api.Options) []llm.Lora {
+	if opts.AdapterScale == 0 {
+		return nil
+	}
+
+	var loras []llm.Lora
+	for _, adapter := range m.AdapterPaths {
+		loras = append(loras, llm.Lora{Path: adapter, Scale: opts.AdapterScale})
+	}
+
+	return loras
+}
+
+// ControlVectors returns the model's control vectors for a completion
+// request, applied with the strength in opts
+func (m *Model) ControlVectors(opts *api.Options) []llm.ControlVector {
+	if opts.ControlStrength == 0 {
+		return nil
+	}
+
+	var cvs []llm.ControlVector
+	for _, control := range m.ControlPaths {
+		cvs = append(cvs, llm.ControlVector{Path: control, Strength: opts.ControlStrength})
+	}
+
+	return cvs
+}
+
 func (m *Model) String() string {
 	var modelfile parser.Modelfile
 
@@ -212,6 +270,13 @@ func (m *Model) String() string {
 		})
 	}
 
+	for _, control := range m.ControlPaths {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "control",
+			Args: control,
+		})
+	}
+
 	if m.Template != nil {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "template",
@@ -323,6 +388,8 @@ func GetModel(name string) (*Model, error) {
 			m.AdapterPaths = append(m.AdapterPaths, filename)
 		case "application/vnd.ollama.image.projector":
 			m.ProjectorPaths = append(m.ProjectorPaths, filename)
+		case "application/vnd.ollama.image.control":
+			m.ControlPaths = append(m.ControlPaths, filename)
 		case "application/vnd.ollama.image.prompt",
 			"application/vnd.ollama.image.template":
 			bts, err := os.ReadFile(filename)
@@ -580,9 +647,12 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 
 	fn(api.ProgressResponse{Status: "pulling manifest"})
 
-	mf, err := pullModelManifest(ctx, n, regOpts)
-	if err != nil {
-		return fmt.Errorf("pull model manifest: %s", err)
+	mf, mirror := pullModelManifestFromMirrors(ctx, n)
+	if mf == nil {
+		mf, err = pullModelManifest(ctx, n, regOpts)
+		if err != nil {
+			return fmt.Errorf("pull model manifest: %s", err)
+		}
 	}
 
 	var layers []manifest.Layer
@@ -593,7 +663,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 
 	// Use fast transfer for models with tensor layers (many small blobs)
 	if hasTensorLayers(layers) {
-		if err := pullWithTransfer(ctx, n, layers, mf, regOpts, fn); err != nil {
+		if err := pullWithTransferFromMirror(ctx, mirror, n, layers, mf, regOpts, fn); err != nil {
 			return err
 		}
 		fn(api.ProgressResponse{Status: "success"})
@@ -602,7 +672,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 
 	skipVerify := make(map[string]bool)
 	for _, layer := range layers {
-		cacheHit, err := downloadBlob(ctx, downloadOpts{
+		verified, err := downloadBlobFromMirror(ctx, mirror, downloadOpts{
 			n:       n,
 			digest:  layer.Digest,
 			regOpts: regOpts,
@@ -611,7 +681,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		if err != nil {
 			return err
 		}
-		skipVerify[layer.Digest] = cacheHit
+		skipVerify[layer.Digest] = verified
 		delete(deleteMap, layer.Digest)
 	}
 
@@ -697,7 +767,7 @@ func pullWithTransfer(ctx context.Context, n model.Name, layers []manifest.Layer
 		return err
 	}
 
-	base := n.BaseURL()
+	base := regOpts.base(n)
 	if base.Scheme != "http" && regOpts != nil && regOpts.Insecure {
 		base.Scheme = "http"
 	}
@@ -708,7 +778,11 @@ func pullWithTransfer(ctx context.Context, n model.Name, layers []manifest.Layer
 		totalSize += blob.Size
 	}
 
+	var downloaded atomic.Int64
 	progress := func(completed, total int64) {
+		if delta := completed - downloaded.Swap(completed); delta > 0 {
+			downloadBytesTotal.With().Add(float64(delta))
+		}
 		fn(api.ProgressResponse{
 			Status:    "pulling model",
 			Digest:    "sha256:model",
@@ -815,7 +889,7 @@ func pushWithTransfer(ctx context.Context, n model.Name, layers []manifest.Layer
 }
 
 func pullModelManifest(ctx context.Context, n model.Name, regOpts *registryOptions) (*manifest.Manifest, error) {
-	requestURL := n.BaseURL().JoinPath("v2", n.DisplayNamespaceModel(), "manifests", n.Tag)
+	requestURL := regOpts.base(n).JoinPath("v2", n.DisplayNamespaceModel(), "manifests", n.Tag)
 
 	headers := make(http.Header)
 	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
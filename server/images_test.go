@@ -27,6 +27,18 @@ func TestModelCapabilities(t *testing.T) {
 		"bert.pooling_type":    uint32(1),
 	}, []*ggml.Tensor{})
 
+	// Create audio model (whisper architecture with audio block count)
+	audioModelPath, _ := createBinFile(t, ggml.KV{
+		"general.architecture":      "whisper",
+		"whisper.audio.block_count": uint32(1),
+	}, []*ggml.Tensor{})
+
+	// Create rerank model (bert architecture with rank pooling)
+	rerankModelPath, _ := createBinFile(t, ggml.KV{
+		"general.architecture": "bert",
+		"bert.pooling_type":    uint32(4),
+	}, []*ggml.Tensor{})
+
 	toolsInsertTemplate, err := template.Parse("{{ .prompt }}{{ if .tools }}{{ .tools }}{{ end }}{{ if .suffix }}{{ .suffix }}{{ end }}")
 	if err != nil {
 		t.Fatalf("Failed to parse template: %v", err)
@@ -97,6 +109,14 @@ func TestModelCapabilities(t *testing.T) {
 			},
 			expectedCaps: []model.Capability{model.CapabilityCompletion, model.CapabilityVision, model.CapabilityTools, model.CapabilityInsert},
 		},
+		{
+			name: "model with audio capability",
+			model: Model{
+				ModelPath: audioModelPath,
+				Template:  chatTemplate,
+			},
+			expectedCaps: []model.Capability{model.CapabilityCompletion, model.CapabilityAudio},
+		},
 		{
 			name: "model with embedding capability",
 			model: Model{
@@ -105,6 +125,14 @@ func TestModelCapabilities(t *testing.T) {
 			},
 			expectedCaps: []model.Capability{model.CapabilityEmbedding},
 		},
+		{
+			name: "model with rerank capability",
+			model: Model{
+				ModelPath: rerankModelPath,
+				Template:  chatTemplate,
+			},
+			expectedCaps: []model.Capability{model.CapabilityRerank},
+		},
 	}
 
 	// compare two slices of model.Capability regardless of order
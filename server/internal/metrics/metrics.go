@@ -0,0 +1,360 @@
+// Package metrics implements the counters, gauges and histograms exposed by
+// the server at /metrics in the Prometheus text exposition format.
+//
+// It is intentionally small: metrics are registered once at startup and
+// identified by a fixed set of label names, and series are created on first
+// use.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the exposition format written by
+// [Registry.WriteTo].
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry is a set of metrics written together.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in registration order.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec: newVec[Counter](name, help, "counter", labels)}
+	r.register(v)
+	return v
+}
+
+// Gauge registers a gauge with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec: newVec[Gauge](name, help, "gauge", labels)}
+	r.register(v)
+	return v
+}
+
+// Histogram registers a histogram with the given upper bucket bounds, which
+// must be sorted, and label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{vec: newVec[Histogram](name, help, "histogram", labels), buckets: buckets}
+	r.register(v)
+	return v
+}
+
+// ExponentialBuckets returns count bucket bounds starting at start, each
+// factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// vec holds the series of one metric keyed by label values.
+type vec[T any] struct {
+	name, help, typ string
+	labels          []string
+
+	mu     sync.Mutex
+	series map[string]*series[T]
+}
+
+type series[T any] struct {
+	values []string
+	value  T
+}
+
+func newVec[T any](name, help, typ string, labels []string) vec[T] {
+	return vec[T]{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series[T])}
+}
+
+func (v *vec[T]) with(values []string, init func(*T)) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series[T]{values: slices.Clone(values)}
+		if init != nil {
+			init(&s.value)
+		}
+		v.series[key] = s
+	}
+	return &s.value
+}
+
+// Reset removes every series, e.g. before recording a fresh snapshot of
+// gauges.
+func (v *vec[T]) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	clear(v.series)
+}
+
+// sorted returns the series ordered by label values so output is stable.
+func (v *vec[T]) sorted() []*series[T] {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	s := make([]*series[T], len(keys))
+	for i, k := range keys {
+		s[i] = v.series[k]
+	}
+	return s
+}
+
+func (v *vec[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+// writeSample writes a single sample line. extra is an optional additional
+// label, such as a histogram's "le".
+func writeSample(w *bufio.Writer, name string, labels, values []string, extra []string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || len(extra) > 0 {
+		w.WriteByte('{')
+		for i := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, labels[i], values[i])
+		}
+		if len(extra) > 0 {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extra[0], extra[1])
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	labelEscaper.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// atomicFloat is a float64 that can be updated concurrently.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter is a value that only increases.
+type Counter struct {
+	v atomicFloat
+}
+
+// Add increases the counter by delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(delta)
+}
+
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 { return c.v.Load() }
+
+type CounterVec struct {
+	vec[Counter]
+}
+
+// With returns the counter for the given label values, in the order the
+// label names were registered.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values, nil)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		writeSample(w, v.name, v.labels, s.values, nil, s.value.Value())
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64)     { g.v.Set(v) }
+func (g *Gauge) Add(delta float64) { g.v.Add(delta) }
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 { return g.v.Load() }
+
+type GaugeVec struct {
+	vec[Gauge]
+}
+
+// With returns the gauge for the given label values.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values, nil)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		writeSample(w, v.name, v.labels, s.values, nil, s.value.Value())
+	}
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe records a single observation.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+type HistogramVec struct {
+	vec[Histogram]
+	buckets []float64
+}
+
+// With returns the histogram for the given label values.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values, func(h *Histogram) {
+		h.buckets = v.buckets
+		h.counts = make([]uint64, len(v.buckets))
+	})
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		h := &s.value
+		h.mu.Lock()
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += h.counts[i]
+			writeSample(w, v.name+"_bucket", v.labels, s.values, []string{"le", formatFloat(le)}, float64(cumulative))
+		}
+		writeSample(w, v.name+"_bucket", v.labels, s.values, []string{"le", "+Inf"}, float64(h.count))
+		writeSample(w, v.name+"_sum", v.labels, s.values, nil, h.sum)
+		writeSample(w, v.name+"_count", v.labels, s.values, nil, float64(h.count))
+		h.mu.Unlock()
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
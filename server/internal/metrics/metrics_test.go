@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteTo(t *testing.T) {
+	var r Registry
+	requests := r.Counter("requests_total", "Total requests.", "route", "status")
+	queue := r.Gauge("queue_depth", "Requests waiting.")
+	latency := r.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+
+	requests.With("/b", "200").Inc()
+	requests.With("/a", "500").Add(2)
+	requests.With("/a", "200").Inc()
+	queue.With().Set(3)
+	latency.With("/a").Observe(0.05)
+	latency.With("/a").Observe(0.5)
+	latency.With("/a").Observe(5)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{route="/a",status="200"} 1
+requests_total{route="/a",status="500"} 2
+requests_total{route="/b",status="200"} 1
+# HELP queue_depth Requests waiting.
+# TYPE queue_depth gauge
+queue_depth 3
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+`
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	var r Registry
+	r.Counter("c_total", "Help with \\ and\nnewline.", "model").With("a\"b\\c\nd").Inc()
+
+	var b strings.Builder
+	r.WriteTo(&b)
+
+	if !strings.Contains(b.String(), `# HELP c_total Help with \\ and\nnewline.`) {
+		t.Errorf("help not escaped: %s", b.String())
+	}
+	if !strings.Contains(b.String(), `c_total{model="a\"b\\c\nd"} 1`) {
+		t.Errorf("label not escaped: %s", b.String())
+	}
+}
+
+func TestReset(t *testing.T) {
+	var r Registry
+	g := r.Gauge("loaded", "Loaded models.", "model")
+	g.With("a").Set(1)
+	g.Reset()
+	g.With("b").Set(2)
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	if strings.Contains(b.String(), `model="a"`) || !strings.Contains(b.String(), `loaded{model="b"} 2`) {
+		t.Errorf("unexpected output after reset: %s", b.String())
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var r Registry
+	r.Counter("c_total", "A counter.").With().Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("expected content type %q, got %q", ContentType, ct)
+	}
+	if !strings.Contains(w.Body.String(), "c_total 1\n") {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+
+	var r Registry
+	r.Counter("c_total", "A counter.", "a", "b").With("only one")
+}
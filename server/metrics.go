@@ -0,0 +1,131 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/server/internal/metrics"
+)
+
+// metricsModelKey is the gin context key handlers set to the resolved model
+// name so request metrics can be labeled by model.
+const metricsModelKey = "metrics.model"
+
+var (
+	metricsRegistry metrics.Registry
+
+	requestsTotal = metricsRegistry.Counter("ollama_http_requests_total",
+		"Total number of HTTP requests.", "method", "route", "status", "model")
+	requestDuration = metricsRegistry.Histogram("ollama_http_request_duration_seconds",
+		"Time to complete HTTP requests, including streamed responses.",
+		metrics.ExponentialBuckets(0.005, 2, 16), "method", "route", "model")
+
+	promptTokensTotal = metricsRegistry.Counter("ollama_prompt_tokens_total",
+		"Total number of prompt tokens evaluated.", "model")
+	generatedTokensTotal = metricsRegistry.Counter("ollama_generated_tokens_total",
+		"Total number of tokens generated.", "model")
+	prefillTokensPerSecond = metricsRegistry.Histogram("ollama_prefill_tokens_per_second",
+		"Prompt evaluation throughput per request.",
+		metrics.ExponentialBuckets(1, 2, 16), "model")
+	decodeTokensPerSecond = metricsRegistry.Histogram("ollama_decode_tokens_per_second",
+		"Generation throughput per request.",
+		metrics.ExponentialBuckets(1, 2, 12), "model")
+	timeToFirstToken = metricsRegistry.Histogram("ollama_time_to_first_token_seconds",
+		"Time from a request reaching the runner to its first generated token.",
+		metrics.ExponentialBuckets(0.01, 2, 14), "model")
+	interTokenLatency = metricsRegistry.Histogram("ollama_inter_token_latency_seconds",
+		"Mean time between generated tokens per request.",
+		metrics.ExponentialBuckets(0.001, 2, 14), "model")
+
+	queueDepth = metricsRegistry.Gauge("ollama_scheduler_queue_depth",
+		"Number of requests waiting for a runner.")
+	queueRejectionsTotal = metricsRegistry.Counter("ollama_scheduler_rejections_total",
+		"Total number of requests rejected because the queue was full.")
+
+	runnersLoaded = metricsRegistry.Gauge("ollama_runners_loaded",
+		"Number of loaded runners.")
+	runnerVRAMBytes = metricsRegistry.Gauge("ollama_runner_vram_bytes",
+		"VRAM used by a loaded runner.", "model")
+	runnerSizeBytes = metricsRegistry.Gauge("ollama_runner_size_bytes",
+		"Total memory used by a loaded runner.", "model")
+
+	modelLoadsTotal = metricsRegistry.Counter("ollama_model_loads_total",
+		"Total number of model loads.", "model", "status")
+	modelLoadDuration = metricsRegistry.Histogram("ollama_model_load_duration_seconds",
+		"Time to load a model.", metrics.ExponentialBuckets(0.25, 2, 10), "model")
+	modelUnloadsTotal = metricsRegistry.Counter("ollama_model_unloads_total",
+		"Total number of model unloads.", "model")
+
+	downloadBytesTotal = metricsRegistry.Counter("ollama_download_bytes_total",
+		"Total number of bytes downloaded from registries.")
+)
+
+// metricsMiddleware records the count and latency of every request by route
+// pattern, so path parameters do not create new series.
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	model := c.GetString(metricsModelKey)
+
+	requestsTotal.With(c.Request.Method, route, strconv.Itoa(c.Writer.Status()), model).Inc()
+	requestDuration.With(c.Request.Method, route, model).Observe(time.Since(start).Seconds())
+}
+
+// observeCompletion records token counts, throughput and latency from the
+// final response of a completion.
+func observeCompletion(model string, cr llm.CompletionResponse) {
+	promptTokensTotal.With(model).Add(float64(cr.PromptEvalCount))
+	generatedTokensTotal.With(model).Add(float64(cr.EvalCount))
+
+	if cr.PromptEvalCount > 0 && cr.PromptEvalDuration > 0 {
+		prefillTokensPerSecond.With(model).Observe(float64(cr.PromptEvalCount) / cr.PromptEvalDuration.Seconds())
+	}
+	if cr.EvalCount > 0 && cr.EvalDuration > 0 {
+		decodeTokensPerSecond.With(model).Observe(float64(cr.EvalCount) / cr.EvalDuration.Seconds())
+	}
+	if cr.TimeToFirstToken > 0 {
+		timeToFirstToken.With(model).Observe(cr.TimeToFirstToken.Seconds())
+	}
+	if cr.InterTokenLatency > 0 {
+		interTokenLatency.With(model).Observe(cr.InterTokenLatency.Seconds())
+	}
+}
+
+// MetricsHandler serves metrics in the Prometheus text exposition format.
+func (s *Server) MetricsHandler(c *gin.Context) {
+	if s.sched != nil {
+		s.sched.collectMetrics()
+	}
+	metricsRegistry.ServeHTTP(c.Writer, c.Request)
+}
+
+// collectMetrics snapshots the queue and loaded runners into their gauges.
+func (s *Scheduler) collectMetrics() {
+	queueDepth.With().Set(float64(len(s.pendingReqCh)))
+
+	s.loadedMu.Lock()
+	defer s.loadedMu.Unlock()
+
+	runnersLoaded.With().Set(float64(len(s.loaded)))
+	runnerVRAMBytes.Reset()
+	runnerSizeBytes.Reset()
+	for _, runner := range s.loaded {
+		runnerVRAMBytes.With(runner.metricsName()).Set(float64(runner.vramSize))
+		runnerSizeBytes.With(runner.metricsName()).Set(float64(runner.totalSize))
+	}
+}
+
+func (runner *runnerRef) metricsName() string {
+	if runner.model != nil && runner.model.ShortName != "" {
+		return runner.model.ShortName
+	}
+	return runner.modelPath
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/manifest"
+	"github.com/ollama/ollama/types/model"
+)
+
+// When OLLAMA_SERVE_REGISTRY is set, the server exposes the models in its
+// local store as a read-only registry under /v2/, speaking the same protocol
+// as the upstream registry:
+//
+//	GET|HEAD /v2/{namespace}/{model}/manifests/{tag}
+//	GET|HEAD /v2/{namespace}/{model}/blobs/{digest}
+//	GET      /v2/{namespace}/{model}/chunksums/{digest}
+//
+// Names are resolved against the default registry host, so another instance
+// with OLLAMA_MIRRORS pointing here pulls "llama3.2" from this store before
+// falling back to registry.ollama.ai.
+
+// mirrorChunkSize is the size of the chunks listed by the chunksums endpoint.
+const mirrorChunkSize = 64 << 20
+
+// chunksumsCache holds the chunksums response of each blob, keyed by digest.
+// Blobs are immutable, so entries never need to be invalidated.
+var chunksumsCache sync.Map
+
+func registryError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"errors": []gin.H{{"code": code, "message": message}}})
+}
+
+// registryName returns the model name addressed by the namespace, model and
+// tag path parameters.
+func registryName(c *gin.Context) (model.Name, bool) {
+	n := model.ParseName(c.Param("namespace") + "/" + c.Param("model") + ":" + c.Param("tag"))
+	if !n.IsValid() || n.Namespace != c.Param("namespace") || n.Model != c.Param("model") {
+		return model.Name{}, false
+	}
+	return n, true
+}
+
+func (s *Server) RegistryManifestHandler(c *gin.Context) {
+	n, ok := registryName(c)
+	if !ok {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", "invalid model name")
+		return
+	}
+
+	p, err := manifest.PathForName(n)
+	if err != nil {
+		registryError(c, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest for %s not found", n.DisplayShortest()))
+		return
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest for %s not found", n.DisplayShortest()))
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	c.Header("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Data(http.StatusOK, "application/vnd.docker.distribution.manifest.v2+json", data)
+}
+
+func (s *Server) RegistryBlobHandler(c *gin.Context) {
+	p, err := manifest.BlobsPath(c.Param("digest"))
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UNKNOWN", "blob not found")
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	digest := strings.Replace(filepath.Base(p), "-", ":", 1)
+	c.Header("Docker-Content-Digest", digest)
+	c.Header("ETag", strconv.Quote(digest))
+	c.Header("Content-Type", "application/octet-stream")
+
+	// ServeContent handles HEAD and the range requests used to download
+	// blobs in parallel chunks
+	http.ServeContent(c.Writer, c.Request, "", fi.ModTime(), f)
+}
+
+// RegistryChunksumsHandler lists the sha256 of each chunk of a blob, one
+// "{digest} {start}-{end}" line per chunk, so large blobs can be downloaded
+// and verified in independent pieces.
+func (s *Server) RegistryChunksumsHandler(c *gin.Context) {
+	p, err := manifest.BlobsPath(c.Param("digest"))
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UNKNOWN", "blob not found")
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	blobURL := url.URL{
+		Scheme: "http",
+		Host:   c.Request.Host,
+		Path:   strings.Replace(c.Request.URL.Path, "/chunksums/", "/blobs/", 1),
+	}
+	if c.Request.TLS != nil {
+		blobURL.Scheme = "https"
+	}
+
+	c.Header("Content-Location", blobURL.String())
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+
+	key := filepath.Base(p)
+	if b, ok := chunksumsCache.Load(key); ok {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", b.([]byte))
+		return
+	}
+
+	// Stream each chunk as it is hashed so clients can start downloading
+	// before the whole blob has been read. A truncated response tells the
+	// client to retry.
+	c.Status(http.StatusOK)
+
+	var b bytes.Buffer
+	for start := int64(0); start < fi.Size(); start += mirrorChunkSize {
+		end := min(start+mirrorChunkSize, fi.Size()) - 1
+
+		sha256sum := sha256.New()
+		if _, err := io.Copy(sha256sum, io.NewSectionReader(f, start, end-start+1)); err != nil {
+			slog.Error("failed to hash chunk", "blob", key, "start", start, "error", err)
+			return
+		}
+
+		line := fmt.Sprintf("sha256:%x %d-%d\n", sha256sum.Sum(nil), start, end)
+		b.WriteString(line)
+		if _, err := io.WriteString(c.Writer, line); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+
+	chunksumsCache.Store(key, b.Bytes())
+}
+
+// pullModelManifestFromMirrors returns the manifest of n from the first
+// configured mirror that has it, along with that mirror's base URL. It returns
+// a nil manifest if no mirror applies or none has the model. Mirrors only
+// stand in for the default registry.
+func pullModelManifestFromMirrors(ctx context.Context, n model.Name) (*manifest.Manifest, *url.URL) {
+	if !strings.EqualFold(n.Host, model.DefaultName().Host) {
+		return nil, nil
+	}
+
+	for _, mirror := range envconfig.Mirrors() {
+		mf, err := pullModelManifest(ctx, n, mirrorRegistryOptions(mirror))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil
+			}
+			slog.Debug("mirror does not have model", "mirror", mirror.Redacted(), "model", n.DisplayShortest(), "error", err)
+			continue
+		}
+
+		slog.Info("pulling from mirror", "mirror", mirror.Redacted(), "model", n.DisplayShortest())
+		return mf, mirror
+	}
+
+	return nil, nil
+}
+
+// mirrorRegistryOptions returns the options for requests to a mirror. The
+// upstream credentials are never sent to a mirror, and requests are routed
+// to the mirror rather than the host in the model name. A mirror that
+// requires an API key is given it in the URL, e.g. http://key@host:11434.
+func mirrorRegistryOptions(mirror *url.URL) *registryOptions {
+	opts := &registryOptions{baseURL: mirror}
+	if mirror.User != nil {
+		base := *mirror
+		base.User = nil
+		opts.baseURL = &base
+
+		opts.Token = mirror.User.Username()
+		if password, ok := mirror.User.Password(); ok {
+			opts.Token = password
+		}
+	}
+	return opts
+}
+
+// downloadBlobFromMirror downloads a blob from mirror, falling back to the
+// upstream registry if the mirror fails or serves a blob that does not match
+// its digest. It reports whether the blob is already verified.
+func downloadBlobFromMirror(ctx context.Context, mirror *url.URL, opts downloadOpts) (verified bool, _ error) {
+	if mirror != nil {
+		mopts := opts
+		mopts.regOpts = mirrorRegistryOptions(mirror)
+
+		cacheHit, err := downloadBlob(ctx, mopts)
+		if err == nil && !cacheHit {
+			err = verifyBlob(opts.digest)
+			if errors.Is(err, errDigestMismatch) {
+				if fp, err := manifest.BlobsPath(opts.digest); err == nil {
+					os.Remove(fp)
+				}
+			}
+		}
+
+		switch {
+		case err == nil:
+			return true, nil
+		case ctx.Err() != nil:
+			return false, err
+		}
+
+		slog.Warn("mirror download failed, falling back to upstream", "mirror", mirror.Redacted(), "digest", opts.digest, "error", err)
+	}
+
+	return downloadBlob(ctx, opts)
+}
+
+// pullWithTransferFromMirror is like [downloadBlobFromMirror] for models
+// pulled with [pullWithTransfer]. Blobs completed from the mirror are kept
+// and skipped when falling back to the upstream registry.
+func pullWithTransferFromMirror(ctx context.Context, mirror *url.URL, n model.Name, layers []manifest.Layer, mf *manifest.Manifest, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	if mirror != nil {
+		err := pullWithTransfer(ctx, n, layers, mf, mirrorRegistryOptions(mirror), fn)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil:
+			return err
+		}
+
+		slog.Warn("mirror download failed, falling back to upstream", "mirror", mirror.Redacted(), "error", err)
+	}
+
+	return pullWithTransfer(ctx, n, layers, mf, regOpts, fn)
+}
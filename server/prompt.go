@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/internal/tracing"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/model/renderers"
 	"github.com/ollama/ollama/template"
@@ -17,15 +18,21 @@ import (
 
 type tokenizeFunc func(context.Context, string) ([]int, error)
 
+// TODO: Ideally we would compute this from the projector metadata but some pieces are implementation dependent
+// Clip images are represented as 768 tokens, each an embedding
+const imageNumTokens = 768
+
 // chatPrompt accepts a list of messages and returns the prompt and images that should be used for the next chat turn.
 // chatPrompt truncates any messages that exceed the context window of the model, making sure to always include 1) the
 // latest message and 2) system messages
-func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool, think *api.ThinkValue, truncate bool) (prompt string, images []llm.ImageData, _ error) {
-	var system []api.Message
+func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool, think *api.ThinkValue, truncate bool) (prompt string, images []llm.ImageData, err error) {
+	ctx, span := tracing.Start(ctx, "chatPrompt", tracing.WithAttributes(tracing.Int("messages", len(msgs))))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
-	// TODO: Ideally we would compute this from the projector metadata but some pieces are implementation dependent
-	// Clip images are represented as 768 tokens, each an embedding
-	imageNumTokens := 768
+	var system []api.Message
 
 	n := len(msgs) - 1
 	// in reverse, find all messages that fit into context window
@@ -92,6 +99,18 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 
 			images = append(images, imgData)
 		}
+
+		// audio is passed to the runner with the images and decoded by the
+		// model's multimodal processor
+		for _, a := range msg.Audio {
+			audioData := llm.ImageData{
+				ID:   len(images),
+				Data: a,
+			}
+
+			prefix += fmt.Sprintf("[img-%d]", audioData.ID)
+			images = append(images, audioData)
+		}
 		msgs[currMsgIdx+cnt].Content = prefix + prompt
 	}
 
@@ -214,6 +214,19 @@ func TestChatPrompt(t *testing.T) {
 				images: [][]byte{[]byte("one hotdog"), []byte("two hotdogs")},
 			},
 		},
+		{
+			name:     "images and audio",
+			model:    visionModel,
+			limit:    2048,
+			truncate: true,
+			msgs: []api.Message{
+				{Role: "user", Content: "Describe the picture and the sound", Images: []api.ImageData{[]byte("a picture")}, Audio: []api.AudioData{[]byte("a sound")}},
+			},
+			expect: expect{
+				prompt: "[img-0][img-1]Describe the picture and the sound ",
+				images: [][]byte{[]byte("a picture"), []byte("a sound")},
+			},
+		},
 		{
 			name:     "no truncate with limit exceeded",
 			model:    visionModel,
@@ -202,6 +202,9 @@ func newType(t *fsggml.Tensor, kv fsggml.KV, qs *quantizeState, ftype fsggml.Fil
 	quantize = quantize && !strings.HasPrefix(name, "v.")
 	quantize = quantize && !strings.Contains(name, "mm.")
 
+	// don't quantize audio encoder tensors (named with "a." prefix)
+	quantize = quantize && !strings.HasPrefix(name, "a.")
+
 	// quantize only 2D and 3D tensors (experts)
 	quantize = quantize && (len(t.Shape) >= 2)
 
@@ -20,7 +20,10 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -37,10 +40,12 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/internal/tracing"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/manifest"
 	"github.com/ollama/ollama/middleware"
+	"github.com/ollama/ollama/model/audioproc"
 	"github.com/ollama/ollama/model/parsers"
 	"github.com/ollama/ollama/model/renderers"
 	"github.com/ollama/ollama/server/internal/client/ollama"
@@ -85,6 +90,12 @@ type Server struct {
 	addr    net.Addr
 	sched   *Scheduler
 	lowVRAM bool
+
+	// apiKeys, if set, are required to call the API
+	apiKeys *apiKeys
+
+	// responses keeps Responses API responses created with store
+	responses *middleware.ResponseStore
 }
 
 func init() {
@@ -154,11 +165,15 @@ func (s *Server) scheduleRunner(ctx context.Context, name string, caps []model.C
 		opts.NumCtx = max(opts.NumCtx, 8192)
 	}
 
+	ctx, span := tracing.Start(ctx, "schedule", tracing.WithAttributes(tracing.String("model", model.ShortName)))
+	defer span.End()
+
 	runnerCh, errCh := s.sched.GetRunner(ctx, model, opts, keepAlive)
 	var runner *runnerRef
 	select {
 	case runner = <-runnerCh:
 	case err = <-errCh:
+		span.RecordError(err)
 		return nil, nil, nil, err
 	}
 
@@ -220,6 +235,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		}
 		return
 	}
+	c.Set(metricsModelKey, m.ShortName)
 
 	if req.TopLogprobs < 0 || req.TopLogprobs > 20 {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "top_logprobs must be between 0 and 20"})
@@ -522,15 +538,22 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		var sb strings.Builder
 		defer close(ch)
 		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:      prompt,
-			Images:      images,
-			Format:      req.Format,
-			Options:     opts,
-			Shift:       req.Shift == nil || *req.Shift,
-			Truncate:    req.Truncate == nil || *req.Truncate,
-			Logprobs:    req.Logprobs,
-			TopLogprobs: req.TopLogprobs,
+			Prompt:         prompt,
+			Images:         images,
+			Format:         req.Format,
+			Options:        opts,
+			Shift:          req.Shift == nil || *req.Shift,
+			Truncate:       req.Truncate == nil || *req.Truncate,
+			Logprobs:       req.Logprobs,
+			TopLogprobs:    req.TopLogprobs,
+			Loras:          m.Loras(opts),
+			ControlVectors: m.ControlVectors(opts),
 		}, func(cr llm.CompletionResponse) {
+			if cr.Done {
+				observeCompletion(m.ShortName, cr)
+				chargeTokens(c, cr.PromptEvalCount+cr.EvalCount)
+			}
+
 			res := api.GenerateResponse{
 				Model:     req.Model,
 				CreatedAt: time.Now().UTC(),
@@ -539,8 +562,11 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 				Metrics: api.Metrics{
 					PromptEvalCount:    cr.PromptEvalCount,
 					PromptEvalDuration: cr.PromptEvalDuration,
+					PromptCachedCount:  cr.PromptCachedCount,
 					EvalCount:          cr.EvalCount,
 					EvalDuration:       cr.EvalDuration,
+					TimeToFirstToken:   cr.TimeToFirstToken,
+					InterTokenLatency:  cr.InterTokenLatency,
 				},
 				Logprobs: toAPILogprobs(cr.Logprobs),
 			}
@@ -692,6 +718,7 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		handleScheduleError(c, req.Model, err)
 		return
 	}
+	c.Set(metricsModelKey, m.ShortName)
 
 	checkpointLoaded := time.Now()
 
@@ -709,7 +736,7 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	embedWithRetry := func(text string) ([]float32, int, error) {
-		emb, tokCount, err := r.Embedding(ctx, text)
+		emb, tokCount, err := r.Embedding(ctx, llm.EmbeddingRequest{Content: text})
 		if err == nil {
 			return emb, tokCount, nil
 		}
@@ -748,7 +775,7 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		if err != nil {
 			return nil, 0, err
 		}
-		return r.Embedding(ctx, truncated)
+		return r.Embedding(ctx, llm.EmbeddingRequest{Content: truncated})
 	}
 
 	var g errgroup.Group
@@ -792,6 +819,8 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		return
 	}
 
+	chargeTokens(c, int(totalTokens))
+
 	resp := api.EmbedResponse{
 		Model:           req.Model,
 		Embeddings:      embeddings,
@@ -834,11 +863,12 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
-	r, _, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{}, req.Options, req.KeepAlive)
+	r, m, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{}, req.Options, req.KeepAlive)
 	if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
 	}
+	c.Set(metricsModelKey, m.ShortName)
 
 	// an empty request loads the model
 	if req.Prompt == "" {
@@ -846,12 +876,14 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
-	embedding, _, err := r.Embedding(c.Request.Context(), req.Prompt)
+	embedding, tokenCount, err := r.Embedding(c.Request.Context(), llm.EmbeddingRequest{Content: req.Prompt})
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
 		return
 	}
 
+	chargeTokens(c, tokenCount)
+
 	var e []float64
 	for _, v := range embedding {
 		e = append(e, float64(v))
@@ -863,6 +895,585 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+func (s *Server) RerankHandler(c *gin.Context) {
+	checkpointStart := time.Now()
+	var req api.RerankRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Query == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+
+	if req.TopN < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "top_n must not be negative"})
+		return
+	}
+
+	name, err := getExistingName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{model.CapabilityRerank}, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+	c.Set(metricsModelKey, m.ShortName)
+
+	checkpointLoaded := time.Now()
+
+	if len(req.Documents) == 0 {
+		c.JSON(http.StatusOK, api.RerankResponse{Model: req.Model, Results: []api.RerankResult{}})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	kvData, _, err := getModelData(m.ModelPath, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// cross-encoders score the query and document as a single input,
+	// separated by the same token the tokenizer appends to the document.
+	// they are tokenized separately so special tokens in the text are not
+	// mistaken for the separator
+	separator := int(cmp.Or(
+		kvData.Uint("tokenizer.ggml.separator_token_id"),
+		//nolint:misspell
+		kvData.Uint("tokenizer.ggml.seperator_token_id"),
+		kvData.Uint("tokenizer.ggml.eos_token_id"),
+	))
+
+	query, err := r.Tokenize(ctx, req.Query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the runner adds the model's special tokens around the input
+	ctxLen := min(opts.NumCtx, int(kvData.ContextLength()))
+	if kvData.Bool("tokenizer.ggml.add_bos_token", true) {
+		ctxLen--
+	}
+	if kvData.Bool("tokenizer.ggml.add_eos_token", true) {
+		ctxLen--
+	}
+
+	// documents are truncated but the query is not
+	maxDocument := ctxLen - len(query) - 1
+	if maxDocument <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query exceeds maximum context length"})
+		return
+	}
+
+	var g errgroup.Group
+	results := make([]api.RerankResult, len(req.Documents))
+	var totalTokens uint64
+	for i, document := range req.Documents {
+		g.Go(func() error {
+			tokens, err := r.Tokenize(ctx, document)
+			if err != nil {
+				return err
+			}
+
+			if len(tokens) > maxDocument {
+				if req.Truncate != nil && !*req.Truncate {
+					return api.StatusError{StatusCode: http.StatusBadRequest, ErrorMessage: fmt.Sprintf("document %d exceeds maximum context length", i)}
+				}
+				tokens = tokens[:maxDocument]
+			}
+
+			input := slices.Concat(query, []int{separator}, tokens)
+			logits, tokenCount, err := r.Embedding(ctx, llm.EmbeddingRequest{Tokens: input})
+			if err != nil {
+				return err
+			}
+
+			score, err := relevanceScore(logits)
+			if err != nil {
+				return err
+			}
+
+			results[i] = api.RerankResult{Index: i, RelevanceScore: score}
+			if req.ReturnDocuments {
+				results[i].Document = document
+			}
+			atomic.AddUint64(&totalTokens, uint64(tokenCount))
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		var serr api.StatusError
+		if errors.As(err, &serr) {
+			c.AbortWithStatusJSON(serr.StatusCode, gin.H{
+				"error": strings.TrimSpace(serr.ErrorMessage),
+			})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": strings.TrimSpace(err.Error()),
+		})
+		return
+	}
+
+	slices.SortStableFunc(results, func(a, b api.RerankResult) int {
+		return cmp.Compare(b.RelevanceScore, a.RelevanceScore)
+	})
+	if req.TopN > 0 && req.TopN < len(results) {
+		results = results[:req.TopN]
+	}
+
+	chargeTokens(c, int(totalTokens))
+
+	c.JSON(http.StatusOK, api.RerankResponse{
+		Model:           req.Model,
+		Results:         results,
+		TotalDuration:   time.Since(checkpointStart),
+		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
+		PromptEvalCount: int(totalTokens),
+	})
+}
+
+// relevanceScore converts the output of a cross-encoder's classification head
+// to a relevance score between 0 and 1. Heads with two labels score the
+// probability of the second, relevant, label.
+func relevanceScore(logits []float32) (float64, error) {
+	var logit float64
+	switch len(logits) {
+	case 1:
+		logit = float64(logits[0])
+	case 2:
+		logit = float64(logits[1] - logits[0])
+	default:
+		return 0, fmt.Errorf("expected 1 or 2 relevance labels, got %d", len(logits))
+	}
+
+	if math.IsNaN(logit) {
+		return 0, errors.New("relevance score is NaN")
+	}
+
+	return 1 / (1 + math.Exp(-logit)), nil
+}
+
+// specialTokenRegexp matches the special tokens audio models use to mark the
+// language, task and timestamps of a transcription
+var specialTokenRegexp = regexp.MustCompile(`<\|[^|]*\|>`)
+
+func (s *Server) TranscribeHandler(c *gin.Context) {
+	checkpointStart := time.Now()
+	var req api.TranscribeRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Audio) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "audio is required"})
+		return
+	}
+
+	samples, sampleRate, err := audioproc.Decode(req.Audio)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(samples) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "audio is empty"})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{model.CapabilityAudio}, req.Options, req.KeepAlive)
+	if errors.Is(err, errCapabilityAudio) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support audio input", req.Model)})
+		return
+	} else if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+	c.Set(metricsModelKey, m.ShortName)
+
+	checkpointLoaded := time.Now()
+	ctx := c.Request.Context()
+
+	// the encoder sees 30 seconds of 16 kHz audio at a time so longer audio
+	// is transcribed in windows
+	const transcribeSampleRate = 16000
+	const windowSamples = 30 * transcribeSampleRate
+	samples = audioproc.Resample(samples, sampleRate, transcribeSampleRate)
+
+	// decoding is greedy unless the request sets a temperature, as Whisper
+	// and the OpenAI API do
+	transcribeOpts := *opts
+	if _, ok := req.Options["temperature"]; !ok {
+		transcribeOpts.Temperature = 0
+	}
+
+	var prefix string
+	if prompt := strings.TrimSpace(req.Prompt); prompt != "" {
+		prefix = "<|startofprev|> " + prompt
+	}
+
+	resp := api.TranscribeResponse{
+		Model:    req.Model,
+		Language: req.Language,
+		Duration: float64(len(samples)) / transcribeSampleRate,
+		Segments: []api.TranscribeSegment{},
+	}
+
+	var texts []string
+	for i, window := range slices.Collect(slices.Chunk(samples, windowSamples)) {
+		images := []llm.ImageData{{Data: audioproc.EncodeWAV(window, transcribeSampleRate)}}
+
+		// the language is detected once from the first window, as the
+		// token the model predicts after the start of the transcript
+		if resp.Language == "" {
+			detectOpts := transcribeOpts
+			detectOpts.Temperature = 0
+			detectOpts.NumPredict = 1
+
+			var content string
+			if err := r.Completion(ctx, llm.CompletionRequest{
+				Prompt:  "[img-0]",
+				Images:  images,
+				Options: &detectOpts,
+			}, func(cr llm.CompletionResponse) {
+				content += cr.Content
+			}); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+				return
+			}
+
+			resp.Language = strings.TrimSuffix(strings.TrimPrefix(content, "<|"), "|>")
+			if resp.Language == "" || resp.Language == content {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to detect language"})
+				return
+			}
+		}
+
+		languageToken := "<|" + resp.Language + "|>"
+		if i == 0 {
+			tokens, err := r.Tokenize(ctx, languageToken)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+				return
+			}
+
+			if len(tokens) != 1 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported language %q", resp.Language)})
+				return
+			}
+		}
+
+		var content string
+		if err := r.Completion(ctx, llm.CompletionRequest{
+			Prompt:  prefix + "[img-0]" + languageToken + "<|transcribe|><|notimestamps|>",
+			Images:  images,
+			Options: &transcribeOpts,
+		}, func(cr llm.CompletionResponse) {
+			content += cr.Content
+			if cr.Done {
+				resp.PromptEvalCount += cr.PromptEvalCount
+				resp.EvalCount += cr.EvalCount
+			}
+		}); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+			return
+		}
+
+		text := strings.TrimSpace(specialTokenRegexp.ReplaceAllString(content, ""))
+		resp.Segments = append(resp.Segments, api.TranscribeSegment{
+			Start: float64(i*windowSamples) / transcribeSampleRate,
+			End:   float64(i*windowSamples+len(window)) / transcribeSampleRate,
+			Text:  text,
+		})
+
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	chargeTokens(c, resp.PromptEvalCount+resp.EvalCount)
+
+	resp.Text = strings.Join(texts, " ")
+	resp.TotalDuration = time.Since(checkpointStart)
+	resp.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) TokenizeHandler(c *gin.Context) {
+	var req api.TokenizeRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	r, m, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{}, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+	c.Set(metricsModelKey, m.ShortName)
+
+	tokens, err := r.Tokenize(c.Request.Context(), req.Content)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+		return
+	}
+
+	if tokens == nil {
+		tokens = []int{}
+	}
+
+	c.JSON(http.StatusOK, api.TokenizeResponse{Model: req.Model, Tokens: tokens})
+}
+
+func (s *Server) DetokenizeHandler(c *gin.Context) {
+	var req api.DetokenizeRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	r, m, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{}, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+	c.Set(metricsModelKey, m.ShortName)
+
+	content, err := r.Detokenize(c.Request.Context(), req.Tokens)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.DetokenizeResponse{Model: req.Model, Content: content})
+}
+
+// CountTokensHandler renders a chat request the same way [Server.ChatHandler]
+// does, without truncation, and returns the number of tokens in the prompt.
+func (s *Server) CountTokensHandler(c *gin.Context) {
+	var req api.CountTokensRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	if len(req.Messages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "messages is required"})
+		return
+	}
+
+	caps := []model.Capability{model.CapabilityCompletion}
+	if len(req.Tools) > 0 {
+		caps = append(caps, model.CapabilityTools)
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
+	if errors.Is(err, errCapabilityCompletion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
+		return
+	} else if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+	c.Set(metricsModelKey, m.ShortName)
+
+	// match the thinking default and relaxation of ChatHandler so the count
+	// matches the prompt a chat request would send
+	if slices.Contains(m.Capabilities(), model.CapabilityThinking) {
+		if req.Think == nil {
+			req.Think = &api.ThinkValue{Value: true}
+		}
+	} else if req.Think != nil && req.Think.Bool() {
+		if _, ok := c.Get("relax_thinking"); ok {
+			req.Think = nil
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support thinking", req.Model)})
+			return
+		}
+	}
+
+	msgs, _, processedTools := chatInput(m, req.Messages, req.Tools, req.Think)
+
+	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, processedTools, req.Think, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := r.Tokenize(c.Request.Context(), prompt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+		return
+	}
+
+	count := len(tokens)
+	if m.ProjectorPaths != nil {
+		count += imageNumTokens * len(images)
+	}
+
+	c.JSON(http.StatusOK, api.CountTokensResponse{Model: req.Model, PromptEvalCount: count})
+}
+
+// PerplexityHandler scores content with a model in windows of the context
+// length, streaming the logprobs of the scored tokens of each window.
+func (s *Server) PerplexityHandler(c *gin.Context) {
+	var req api.PerplexityRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.TopLogprobs < 0 || req.TopLogprobs > 20 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "top_logprobs must be between 0 and 20"})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{model.CapabilityCompletion}, req.Options, req.KeepAlive)
+	if errors.Is(err, errCapabilityCompletion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support generate", req.Model)})
+		return
+	} else if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+	c.Set(metricsModelKey, m.ShortName)
+
+	tokens, err := r.Tokenize(c.Request.Context(), req.Content)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+		return
+	}
+
+	if len(tokens) < 2 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "content must be at least two tokens"})
+		return
+	}
+
+	// leave room for the BOS token the runner adds to each window
+	size := max(opts.NumCtx-1, 2)
+	windows := slices.Collect(slices.Chunk(tokens, size))
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+
+		var nll float64
+		var count int
+		for i, window := range windows {
+			// send the tokens themselves since detokenizing and tokenizing
+			// a window again doesn't always give the same tokens
+			var logprobs []llm.Logprob
+			if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
+				Tokens:         window,
+				Options:        opts,
+				Truncate:       true,
+				PromptLogprobs: true,
+				TopLogprobs:    req.TopLogprobs,
+				Loras:          m.Loras(opts),
+				ControlVectors: m.ControlVectors(opts),
+			}, func(cr llm.CompletionResponse) {
+				logprobs = append(logprobs, cr.Logprobs...)
+			}); err != nil {
+				ch <- gin.H{"error": err.Error()}
+				return
+			}
+			chargeTokens(c, len(window))
+
+			if len(logprobs) == 0 {
+				ch <- gin.H{"error": fmt.Sprintf("%q does not support perplexity", req.Model)}
+				return
+			}
+
+			// only score the second half of the window so every token has
+			// enough context for a meaningful prediction
+			logprobs = logprobs[len(logprobs)/2:]
+			for _, lp := range logprobs {
+				nll -= lp.Logprob
+			}
+			count += len(logprobs)
+
+			ch <- api.PerplexityResponse{
+				Model:     req.Model,
+				Logprobs:  toAPILogprobs(logprobs),
+				Completed: i + 1,
+				Total:     len(windows),
+			}
+		}
+
+		ch <- api.PerplexityResponse{
+			Model:      req.Model,
+			Done:       true,
+			Perplexity: math.Exp(nll / float64(count)),
+			EvalCount:  count,
+		}
+	}()
+
+	streamResponse(c, ch)
+}
+
 func (s *Server) PullHandler(c *gin.Context) {
 	var req api.PullRequest
 	err := c.ShouldBindJSON(&req)
@@ -1376,6 +1987,52 @@ func (s *Server) CopyHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) ExportHandler(c *gin.Context) {
+	name := model.ParseName(c.Query("model"))
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errtypes.InvalidModelNameErrMsg})
+		return
+	}
+
+	name, err := getExistingName(name)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	archive, err := newModelArchive(name)
+	if errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", c.Query("model"))})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer archive.Close()
+
+	// ServeContent handles Range and If-Range so interrupted exports can resume
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("ETag", strconv.Quote(archive.digest))
+	http.ServeContent(c.Writer, c.Request, "", archive.modTime, archive)
+}
+
+func (s *Server) ImportHandler(c *gin.Context) {
+	names, err := importModels(c.Request.Body)
+	if errors.Is(err, errInvalidArchive) || errors.Is(err, errDigestMismatch) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resp api.ImportResponse
+	for _, n := range names {
+		resp.Models = append(resp.Models, n.DisplayShortest())
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) HeadBlobHandler(c *gin.Context) {
 	path, err := manifest.BlobsPath(c.Param("digest"))
 	if err != nil {
@@ -1557,11 +2214,18 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	}
 	corsConfig.AllowOrigins = envconfig.AllowedOrigins()
 
+	if s.responses == nil {
+		s.responses = middleware.NewResponseStore(filepath.Join(envconfig.Models(), "responses"), int(envconfig.MaxStoredResponses()))
+	}
+
 	r := gin.Default()
 	r.HandleMethodNotAllowed = true
 	r.Use(
 		cors.New(corsConfig),
 		allowedHostsMiddleware(s.addr),
+		metricsMiddleware,
+		tracingMiddleware,
+		s.authMiddleware,
 	)
 
 	// General
@@ -1569,14 +2233,28 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "Ollama is running") })
 	r.HEAD("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
 	r.GET("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
+	r.GET("/metrics", s.MetricsHandler)
 
-	// Local model cache management (new implementation is at end of function)
-	r.POST("/api/pull", s.PullHandler)
+	// Local model cache management
+	pull, remove := s.PullHandler, s.DeleteHandler
+	if rc != nil {
+		// the new implementation is routed through gin so it runs behind
+		// the same middleware, including API key auth, as other routes
+		rs := &registry.Local{
+			Client: rc,
+			Logger: slog.Default(), // TODO(bmizerany): Take a logger, do not use slog.Default()
+
+			Prune: PruneLayers,
+		}
+		pull, remove = gin.WrapH(rs), gin.WrapH(rs)
+	}
+
+	r.POST("/api/pull", pull)
 	r.POST("/api/push", s.PushHandler)
 	r.HEAD("/api/tags", s.ListHandler)
 	r.GET("/api/tags", s.ListHandler)
 	r.POST("/api/show", s.ShowHandler)
-	r.DELETE("/api/delete", s.DeleteHandler)
+	r.DELETE("/api/delete", remove)
 
 	r.POST("/api/me", s.WhoamiHandler)
 
@@ -1589,6 +2267,8 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
 	r.HEAD("/api/blobs/:digest", s.HeadBlobHandler)
 	r.POST("/api/copy", s.CopyHandler)
+	r.GET("/api/export", s.ExportHandler)
+	r.POST("/api/import", s.ImportHandler)
 
 	// Inference
 	r.GET("/api/ps", s.PsHandler)
@@ -1596,30 +2276,40 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.POST("/api/chat", s.ChatHandler)
 	r.POST("/api/embed", s.EmbedHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
+	r.POST("/api/rerank", s.RerankHandler)
+	r.POST("/api/transcribe", s.TranscribeHandler)
+	r.POST("/api/tokenize", s.TokenizeHandler)
+	r.POST("/api/detokenize", s.DetokenizeHandler)
+	r.POST("/api/chat/count", s.CountTokensHandler)
+	r.POST("/api/perplexity", s.PerplexityHandler)
 
 	// Inference (OpenAI compatibility)
 	r.POST("/v1/chat/completions", middleware.ChatMiddleware(), s.ChatHandler)
 	r.POST("/v1/completions", middleware.CompletionsMiddleware(), s.GenerateHandler)
 	r.POST("/v1/embeddings", middleware.EmbeddingsMiddleware(), s.EmbedHandler)
+	r.POST("/v1/rerank", middleware.RerankMiddleware(), s.RerankHandler)
+	r.POST("/v1/audio/transcriptions", middleware.TranscriptionMiddleware(), s.TranscribeHandler)
 	r.GET("/v1/models", middleware.ListMiddleware(), s.ListHandler)
 	r.GET("/v1/models/:model", middleware.RetrieveMiddleware(), s.ShowHandler)
-	r.POST("/v1/responses", middleware.ResponsesMiddleware(), s.ChatHandler)
+	r.POST("/v1/responses", middleware.ResponsesMiddleware(s.responses), s.ChatHandler)
+	r.GET("/v1/responses/:id", middleware.RetrieveResponseHandler(s.responses))
+	r.DELETE("/v1/responses/:id", middleware.DeleteResponseHandler(s.responses))
 	// OpenAI-compatible image generation endpoint
 	r.POST("/v1/images/generations", middleware.ImageGenerationsMiddleware(), s.GenerateHandler)
+	r.POST("/v1/images/edits", middleware.ImageEditsMiddleware(), s.GenerateHandler)
 
 	// Inference (Anthropic compatibility)
 	r.POST("/v1/messages", middleware.AnthropicMessagesMiddleware(), s.ChatHandler)
+	r.POST("/v1/messages/count_tokens", middleware.AnthropicCountTokensMiddleware(), s.CountTokensHandler)
 
-	if rc != nil {
-		// wrap old with new
-		rs := &registry.Local{
-			Client:   rc,
-			Logger:   slog.Default(), // TODO(bmizerany): Take a logger, do not use slog.Default()
-			Fallback: r,
-
-			Prune: PruneLayers,
-		}
-		return rs, nil
+	// Read-only registry for other Ollama instances to pull from
+	if envconfig.ServeRegistry() {
+		r.GET("/v2/", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+		r.HEAD("/v2/:namespace/:model/manifests/:tag", s.RegistryManifestHandler)
+		r.GET("/v2/:namespace/:model/manifests/:tag", s.RegistryManifestHandler)
+		r.HEAD("/v2/:namespace/:model/blobs/:digest", s.RegistryBlobHandler)
+		r.GET("/v2/:namespace/:model/blobs/:digest", s.RegistryBlobHandler)
+		r.GET("/v2/:namespace/:model/chunksums/:digest", s.RegistryChunksumsHandler)
 	}
 
 	return r, nil
@@ -1657,8 +2347,19 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
+	shutdownTracing := initTracing()
+	defer shutdownTracing(context.Background())
+
 	s := &Server{addr: ln.Addr()}
 
+	if path := envconfig.APIKeysFile(); path != "" {
+		s.apiKeys, err = loadAPIKeys(path)
+		if err != nil {
+			return fmt.Errorf("failed to load API keys: %w", err)
+		}
+		slog.Info("API key authentication enabled", "keys", len(s.apiKeys.keys))
+	}
+
 	var rc *ollama.Registry
 	if useClient2 {
 		var err error
@@ -1927,6 +2628,39 @@ func toolCallId() string {
 	return "call_" + strings.ToLower(string(b))
 }
 
+// chatInput returns the messages to render for a chat request, including
+// the model's own messages and system prompt, along with the model's builtin
+// parser, if any, and the tools as processed by it.
+func chatInput(m *Model, reqMsgs []api.Message, tools []api.Tool, think *api.ThinkValue) ([]api.Message, parsers.Parser, []api.Tool) {
+	msgs := append(m.Messages, reqMsgs...)
+	if reqMsgs[0].Role != "system" && m.System != "" {
+		msgs = append([]api.Message{{Role: "system", Content: m.System}}, msgs...)
+	}
+	msgs = filterThinkTags(msgs, m)
+
+	if shouldUseHarmony(m) && m.Config.Parser == "" {
+		m.Config.Parser = "harmony"
+	}
+
+	var builtinParser parsers.Parser
+	processedTools := tools
+
+	if m.Config.Parser != "" {
+		builtinParser = parsers.ParserForName(m.Config.Parser)
+		if builtinParser != nil {
+			// Determine last message for chat prefill
+			var lastMessage *api.Message
+			if len(msgs) > 0 {
+				lastMessage = &msgs[len(msgs)-1]
+			}
+			// Initialize parser and get processed tools
+			processedTools = builtinParser.Init(tools, lastMessage, think)
+		}
+	}
+
+	return msgs, builtinParser, processedTools
+}
+
 func (s *Server) ChatHandler(c *gin.Context) {
 	checkpointStart := time.Now()
 
@@ -1968,6 +2702,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		}
 		return
 	}
+	c.Set(metricsModelKey, m.ShortName)
 
 	if req.TopLogprobs < 0 || req.TopLogprobs > 20 {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "top_logprobs must be between 0 and 20"})
@@ -2080,6 +2815,10 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		caps = append(caps, model.CapabilityTools)
 	}
 
+	if slices.ContainsFunc(req.Messages, func(msg api.Message) bool { return len(msg.Audio) > 0 }) {
+		caps = append(caps, model.CapabilityAudio)
+	}
+
 	modelCaps := m.Capabilities()
 	if slices.Contains(modelCaps, model.CapabilityThinking) {
 		caps = append(caps, model.CapabilityThinking)
@@ -2103,6 +2842,9 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
 		return
+	} else if errors.Is(err, errCapabilityAudio) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support audio input", req.Model)})
+		return
 	} else if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
@@ -2121,31 +2863,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
-	msgs := append(m.Messages, req.Messages...)
-	if req.Messages[0].Role != "system" && m.System != "" {
-		msgs = append([]api.Message{{Role: "system", Content: m.System}}, msgs...)
-	}
-	msgs = filterThinkTags(msgs, m)
-
-	if shouldUseHarmony(m) && m.Config.Parser == "" {
-		m.Config.Parser = "harmony"
-	}
-
-	var builtinParser parsers.Parser
-	processedTools := req.Tools
-
-	if m.Config.Parser != "" {
-		builtinParser = parsers.ParserForName(m.Config.Parser)
-		if builtinParser != nil {
-			// Determine last message for chat prefill
-			var lastMessage *api.Message
-			if len(msgs) > 0 {
-				lastMessage = &msgs[len(msgs)-1]
-			}
-			// Initialize parser and get processed tools
-			processedTools = builtinParser.Init(req.Tools, lastMessage, req.Think)
-		}
-	}
+	msgs, builtinParser, processedTools := chatInput(m, req.Messages, req.Tools, req.Think)
 
 	truncate := req.Truncate == nil || *req.Truncate
 	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, processedTools, req.Think, truncate)
@@ -2225,15 +2943,22 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			// sets up new context given parent context per request
 			ctx, cancel := context.WithCancel(c.Request.Context())
 			err := r.Completion(ctx, llm.CompletionRequest{
-				Prompt:      prompt,
-				Images:      images,
-				Format:      currentFormat,
-				Options:     opts,
-				Shift:       req.Shift == nil || *req.Shift,
-				Truncate:    truncate,
-				Logprobs:    req.Logprobs,
-				TopLogprobs: req.TopLogprobs,
+				Prompt:         prompt,
+				Images:         images,
+				Format:         currentFormat,
+				Options:        opts,
+				Shift:          req.Shift == nil || *req.Shift,
+				Truncate:       truncate,
+				Logprobs:       req.Logprobs,
+				TopLogprobs:    req.TopLogprobs,
+				Loras:          m.Loras(opts),
+				ControlVectors: m.ControlVectors(opts),
 			}, func(r llm.CompletionResponse) {
+				if r.Done {
+					observeCompletion(m.ShortName, r)
+					chargeTokens(c, r.PromptEvalCount+r.EvalCount)
+				}
+
 				res := api.ChatResponse{
 					Model:     req.Model,
 					CreatedAt: time.Now().UTC(),
@@ -2242,8 +2967,11 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					Metrics: api.Metrics{
 						PromptEvalCount:    r.PromptEvalCount,
 						PromptEvalDuration: r.PromptEvalDuration,
+						PromptCachedCount:  r.PromptCachedCount,
 						EvalCount:          r.EvalCount,
 						EvalDuration:       r.EvalDuration,
+						TimeToFirstToken:   r.TimeToFirstToken,
+						InterTokenLatency:  r.InterTokenLatency,
 					},
 					Logprobs: toAPILogprobs(r.Logprobs),
 				}
@@ -2487,6 +3215,16 @@ func (s *Server) handleImageGenerate(c *gin.Context, req api.GenerateRequest, mo
 		return
 	}
 
+	// Validate image editing parameters
+	if req.Strength < 0 || req.Strength > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "strength must be between 0 and 1"})
+		return
+	}
+	if len(req.Mask) > 0 && len(req.Images) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mask requires an init image"})
+		return
+	}
+
 	// Schedule the runner for image generation
 	runner, _, _, err := s.scheduleRunner(c.Request.Context(), modelName, []model.Capability{model.CapabilityImage}, nil, req.KeepAlive)
 	if err != nil {
@@ -2523,13 +3261,22 @@ func (s *Server) handleImageGenerate(c *gin.Context, req api.GenerateRequest, mo
 		}
 	}
 
+	images := make([]llm.ImageData, len(req.Images))
+	for i := range req.Images {
+		images[i] = llm.ImageData{ID: i, Data: req.Images[i]}
+	}
+
 	var streamStarted bool
 	if err := runner.Completion(c.Request.Context(), llm.CompletionRequest{
-		Prompt: req.Prompt,
-		Width:  req.Width,
-		Height: req.Height,
-		Steps:  req.Steps,
-		Seed:   seed,
+		Prompt:   req.Prompt,
+		Images:   images,
+		Width:    req.Width,
+		Height:   req.Height,
+		Steps:    req.Steps,
+		Seed:     seed,
+		Strength: req.Strength,
+		Mask:     req.Mask,
+		Preview:  req.Preview,
 	}, func(cr llm.CompletionResponse) {
 		streamStarted = true
 		res := api.GenerateResponse{
@@ -2547,6 +3294,10 @@ func (s *Server) handleImageGenerate(c *gin.Context, req api.GenerateRequest, mo
 			res.Image = cr.Image
 		}
 
+		if cr.Preview != "" {
+			res.Preview = cr.Preview
+		}
+
 		if cr.Done {
 			res.DoneReason = cr.DoneReason.String()
 			res.Metrics.TotalDuration = time.Since(checkpointStart)
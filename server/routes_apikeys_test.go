@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/server/internal/client/ollama"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	cases := map[string]string{
+		`{"keys":[{"name":"a","key":"k","scopes":["inference"]}]}`: "",
+		`{"keys":[]}`: "no keys defined",
+		`{"keys":[{"name":"a","scopes":["inference"]}]}`:                           "is empty",
+		`{"keys":[{"name":"a","key":"k"}]}`:                                        "has no scopes",
+		`{"keys":[{"name":"a","key":"k","scopes":["root"]}]}`:                      "unknown scope",
+		`{"keys":[{"key":"k","scopes":["admin"]},{"key":"k","scopes":["admin"]}]}`: "duplicate",
+		`{"keys":`: "unexpected EOF",
+	}
+
+	for content, wantErr := range cases {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := loadAPIKeys(path)
+		switch {
+		case wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", content, err)
+		case wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)):
+			t.Errorf("%s: expected error containing %q, got %v", content, wantErr, err)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh: make(chan *LlmRequest, 1),
+			loaded:       make(map[string]*runnerRef),
+		},
+		apiKeys: &apiKeys{keys: []*apiKey{
+			{Name: "team", Key: "inference-key", Scopes: []string{scopeInference}},
+			{Name: "ops", Key: "admin-key", Scopes: []string{scopeAdmin}},
+			{Name: "limited", Key: "limited-key", Scopes: []string{scopeInference}, RequestsPerMinute: 2},
+			{Name: "quota", Key: "quota-key", Scopes: []string{scopeInference}, TokensPerDay: 100},
+		}},
+	}
+
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	bearer := func(key string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + key}}
+	}
+
+	t.Run("public routes", func(t *testing.T) {
+		for _, path := range []string{"/", "/api/version"} {
+			if w := do(http.MethodGet, path, nil); w.Code != http.StatusOK {
+				t.Errorf("%s: expected status 200, got %d", path, w.Code)
+			}
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/tags", nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status 401, got %d", w.Code)
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Error("expected WWW-Authenticate header")
+		}
+		if w.Body.String() != `{"error":"missing API key"}` {
+			t.Errorf("unexpected body %s", w.Body)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		if w := do(http.MethodGet, "/api/tags", bearer("nope")); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		cases := []struct {
+			method, path, key string
+			code              int
+		}{
+			{http.MethodGet, "/api/tags", "inference-key", http.StatusOK},
+			{http.MethodGet, "/v1/models", "inference-key", http.StatusOK},
+			{http.MethodDelete, "/api/delete", "inference-key", http.StatusForbidden},
+			{http.MethodGet, "/metrics", "inference-key", http.StatusForbidden},
+			{http.MethodGet, "/metrics", "admin-key", http.StatusOK},
+			{http.MethodDelete, "/api/delete", "admin-key", http.StatusBadRequest},
+		}
+
+		for _, tt := range cases {
+			if w := do(tt.method, tt.path, bearer(tt.key)); w.Code != tt.code {
+				t.Errorf("%s %s with %s: expected status %d, got %d: %s", tt.method, tt.path, tt.key, tt.code, w.Code, w.Body)
+			}
+		}
+	})
+
+	t.Run("compatibility headers", func(t *testing.T) {
+		w := do(http.MethodGet, "/v1/models", http.Header{"X-Api-Key": {"inference-key"}})
+		if w.Code != http.StatusOK {
+			t.Errorf("expected x-api-key to be accepted, got %d", w.Code)
+		}
+
+		w = do(http.MethodGet, "/v1/models", nil)
+		var openaiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&openaiErr); err != nil {
+			t.Fatal(err)
+		}
+		if openaiErr.Error.Type != "authentication_error" || openaiErr.Error.Message != "missing API key" {
+			t.Errorf("unexpected OpenAI error %+v", openaiErr)
+		}
+
+		w = do(http.MethodPost, "/v1/messages", http.Header{"X-Api-Key": {"nope"}})
+		var anthropicErr struct {
+			Type  string `json:"type"`
+			Error struct {
+				Type string `json:"type"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&anthropicErr); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusUnauthorized || anthropicErr.Type != "error" || anthropicErr.Error.Type != "authentication_error" {
+			t.Errorf("unexpected Anthropic error %d %+v", w.Code, anthropicErr)
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		for range 2 {
+			if w := do(http.MethodGet, "/api/tags", bearer("limited-key")); w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+		}
+
+		w := do(http.MethodGet, "/api/tags", bearer("limited-key"))
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status 429, got %d", w.Code)
+		}
+		if w.Header().Get("Retry-After") != "30" {
+			t.Errorf("expected Retry-After 30, got %q", w.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		quota := s.apiKeys.lookup("quota-key")
+
+		if w := do(http.MethodGet, "/api/tags", bearer("quota-key")); w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		quota.charge(time.Now(), 100)
+		w := do(http.MethodGet, "/api/tags", bearer("quota-key"))
+		if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "quota") {
+			t.Fatalf("expected quota error, got %d: %s", w.Code, w.Body)
+		}
+
+		// The quota resets the next day
+		if !quota.withinQuota(time.Now().Add(24 * time.Hour)) {
+			t.Error("expected quota to reset the next day")
+		}
+	})
+
+	t.Run("registry client", func(t *testing.T) {
+		s := Server{apiKeys: s.apiKeys}
+		h, err := s.GenerateRoutes(&ollama.Registry{HTTPClient: panicOnRoundTrip})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct{ method, path string }{
+			{http.MethodDelete, "/api/delete"},
+			{http.MethodPost, "/api/pull"},
+		} {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"model":"test"}`))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s: expected status 401, got %d", tt.method, tt.path, w.Code)
+			}
+
+			req = httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"model":"test"}`))
+			req.Header.Set("Authorization", "Bearer inference-key")
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s: expected status 403, got %d", tt.method, tt.path, w.Code)
+			}
+		}
+	})
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	k := &apiKey{RequestsPerMinute: 60}
+	now := time.Now()
+
+	for i := range 60 {
+		if ok, _ := k.allow(now); !ok {
+			t.Fatalf("request %d: expected burst to be allowed", i)
+		}
+	}
+
+	ok, wait := k.allow(now)
+	if ok || wait != time.Second {
+		t.Fatalf("expected to wait 1s, got ok=%v wait=%v", ok, wait)
+	}
+
+	if ok, _ := k.allow(now.Add(time.Second)); !ok {
+		t.Error("expected request to be allowed after refill")
+	}
+}
@@ -956,3 +956,82 @@ func TestDetectModelTypeFromFiles(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateControlVector(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:   "test",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	_, control := createBinFile(t, map[string]any{
+		"general.architecture":     "controlvector",
+		"controlvector.model_hint": "test",
+	}, nil)
+
+	_, otherControl := createBinFile(t, map[string]any{
+		"general.architecture":     "controlvector",
+		"controlvector.model_hint": "llama",
+	}, nil)
+
+	cases := []struct {
+		name           string
+		controlVectors map[string]string
+		status         int
+	}{
+		{"ControlVector", map[string]string{"happy.gguf": control}, http.StatusOK},
+		{"OtherArchitecture", map[string]string{"happy.gguf": otherControl}, http.StatusBadRequest},
+		{"NotControlVector", map[string]string{"test.gguf": digest}, http.StatusBadRequest},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.CreateHandler, api.CreateRequest{
+				Name:           "test2",
+				From:           "test",
+				ControlVectors: tt.controlVectors,
+				Stream:         &stream,
+			})
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status code %d, actual %d: %s", tt.status, w.Code, w.Body.String())
+			}
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			m, err := GetModel("test2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m.ControlPaths) != 1 {
+				t.Errorf("expected 1 control vector, got %v", m.ControlPaths)
+			}
+
+			if cvs := m.ControlVectors(&api.Options{ControlStrength: -0.5}); len(cvs) != 1 || cvs[0].Strength != -0.5 {
+				t.Errorf("unexpected control vectors %v", cvs)
+			}
+
+			if cvs := m.ControlVectors(&api.Options{}); len(cvs) != 0 {
+				t.Errorf("expected control_strength 0 to disable control vectors, got %v", cvs)
+			}
+
+			if !strings.Contains(m.String(), "CONTROL ") {
+				t.Errorf("expected CONTROL in modelfile:\n%s", m.String())
+			}
+		})
+	}
+}
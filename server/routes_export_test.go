@@ -0,0 +1,186 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func exportTestRouter() *gin.Engine {
+	var s Server
+	r := gin.New()
+	r.GET("/api/export", s.ExportHandler)
+	r.POST("/api/import", s.ImportHandler)
+	return r
+}
+
+func TestExportImport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	src := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", src)
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:     "test",
+		Files:    map[string]string{"test.gguf": digest},
+		Template: "{{ .Prompt }}",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	router := exportTestRouter()
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export?model=test", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+	archive := w.Body.Bytes()
+	etag := w.Header().Get("ETag")
+
+	// The archive is a valid tar with the manifest first
+	tr := tar.NewReader(bytes.NewReader(archive))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 4 || names[0] != "manifests/registry.ollama.ai/library/test/latest" {
+		t.Fatalf("unexpected archive entries %v", names)
+	}
+	for _, name := range names[1:] {
+		if !strings.HasPrefix(name, "blobs/sha256-") {
+			t.Errorf("unexpected archive entry %q", name)
+		}
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/export?model=test", nil)
+		req.Header.Set("Range", "bytes=1000-")
+		req.Header.Set("If-Range", etag)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("expected status code 206, actual %d", w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), archive[1000:]) {
+			t.Error("resumed export does not match the archive")
+		}
+
+		req.Header.Set("If-Range", `"stale"`)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200 for stale etag, actual %d", w.Code)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export?model=missing", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected status code 404, actual %d", w.Code)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/import", bytes.NewReader(archive)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.ImportResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Models) != 1 || resp.Models[0] != "test:latest" {
+			t.Errorf("unexpected imported models %v", resp.Models)
+		}
+
+		for _, name := range names {
+			want, err := os.ReadFile(filepath.Join(src, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("%s does not match after import", name)
+			}
+		}
+
+		// Importing again skips the existing blobs
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/import", bytes.NewReader(archive)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("corrupt blob", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		// Flip a byte in the last blob's data
+		corrupt := bytes.Clone(archive)
+		tr := tar.NewReader(bytes.NewReader(corrupt))
+		var last string
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			last = hdr.Name
+		}
+		i := bytes.LastIndex(corrupt, []byte(filepath.Base(last)))
+		offset := (i/512 + 1) * 512
+		corrupt[offset] ^= 0xff
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/import", bytes.NewReader(corrupt)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		checkFileExists(t, filepath.Join(dst, "manifests", "*", "*", "*", "*"), []string{})
+		if _, err := os.Stat(filepath.Join(dst, "blobs", filepath.Base(last))); !os.IsNotExist(err) {
+			t.Errorf("expected corrupt blob not to be written, got %v", err)
+		}
+	})
+
+	t.Run("invalid entry", func(t *testing.T) {
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "blobs/../../etc/passwd", Size: 0, Mode: 0o644})
+		tw.Close()
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/import", &b))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/server/internal/metrics"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh: make(chan *LlmRequest, 4),
+			loaded: map[string]*runnerRef{
+				"/models/a": {model: &Model{ShortName: "a:latest"}, modelPath: "/models/a", vramSize: 1 << 30, totalSize: 2 << 30},
+			},
+		},
+	}
+	s.sched.pendingReqCh <- &LlmRequest{}
+
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other tests share the request metrics
+	requestsTotal.Reset()
+	requestDuration.Reset()
+
+	for _, path := range []string{"/api/version", "/api/version", "/does/not/exist"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != metrics.ContentType {
+		t.Errorf("expected content type %q, got %q", metrics.ContentType, ct)
+	}
+
+	body, _ := io.ReadAll(w.Body)
+	for _, want := range []string{
+		`ollama_http_requests_total{method="GET",route="/api/version",status="200",model=""} 2`,
+		`ollama_http_requests_total{method="GET",route="unmatched",status="404",model=""} 1`,
+		`ollama_http_request_duration_seconds_count{method="GET",route="/api/version",model=""} 2`,
+		"ollama_scheduler_queue_depth 1\n",
+		"ollama_runners_loaded 1\n",
+		`ollama_runner_vram_bytes{model="a:latest"} 1.073741824e+09`,
+		`ollama_runner_size_bytes{model="a:latest"} 2.147483648e+09`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+
+	// Unloaded runners are dropped from the snapshot
+	delete(s.sched.loaded, "/models/a")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(w.Body.String(), `ollama_runner_vram_bytes{model="a:latest"}`) {
+		t.Error("expected unloaded runner to be removed")
+	}
+}
+
+func TestObserveCompletion(t *testing.T) {
+	prompt := promptTokensTotal.With("observe:latest").Value()
+	generated := generatedTokensTotal.With("observe:latest").Value()
+	prefill := prefillTokensPerSecond.With("observe:latest").Count()
+	decode := decodeTokensPerSecond.With("observe:latest").Count()
+	ttft := timeToFirstToken.With("observe:latest").Count()
+	itl := interTokenLatency.With("observe:latest").Count()
+
+	observeCompletion("observe:latest", llm.CompletionResponse{
+		Done:               true,
+		PromptEvalCount:    100,
+		PromptEvalDuration: time.Second,
+		EvalCount:          50,
+		EvalDuration:       2 * time.Second,
+		TimeToFirstToken:   1100 * time.Millisecond,
+		InterTokenLatency:  40 * time.Millisecond,
+	})
+
+	// A fully cached prompt has no prefill to measure
+	observeCompletion("observe:latest", llm.CompletionResponse{
+		Done:         true,
+		EvalCount:    10,
+		EvalDuration: time.Second,
+	})
+
+	if got := promptTokensTotal.With("observe:latest").Value() - prompt; got != 100 {
+		t.Errorf("expected 100 prompt tokens, got %v", got)
+	}
+	if got := generatedTokensTotal.With("observe:latest").Value() - generated; got != 60 {
+		t.Errorf("expected 60 generated tokens, got %v", got)
+	}
+	if got := prefillTokensPerSecond.With("observe:latest").Count() - prefill; got != 1 {
+		t.Errorf("expected 1 prefill observation, got %d", got)
+	}
+	if got := decodeTokensPerSecond.With("observe:latest").Count() - decode; got != 2 {
+		t.Errorf("expected 2 decode observations, got %d", got)
+	}
+	if got := timeToFirstToken.With("observe:latest").Count() - ttft; got != 1 {
+		t.Errorf("expected 1 time to first token observation, got %d", got)
+	}
+	if got := interTokenLatency.With("observe:latest").Count() - itl; got != 1 {
+		t.Errorf("expected 1 inter-token latency observation, got %d", got)
+	}
+}
+
+func TestQueueRejectionMetric(t *testing.T) {
+	s := &Scheduler{
+		pendingReqCh: make(chan *LlmRequest),
+		loaded:       make(map[string]*runnerRef),
+	}
+
+	before := queueRejectionsTotal.With().Value()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	_, errCh := s.GetRunner(ctx, &Model{ModelPath: "/models/a"}, api.DefaultOptions(), nil)
+	if err := <-errCh; !errors.Is(err, ErrMaxQueue) {
+		t.Fatalf("expected ErrMaxQueue, got %v", err)
+	}
+
+	if got := queueRejectionsTotal.With().Value() - before; got != 1 {
+		t.Errorf("expected 1 rejection, got %v", got)
+	}
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+// rerankRunner tokenizes each word to its own id and scores documents by
+// the logit in scores.
+type rerankRunner struct {
+	mockRunner
+
+	mu     sync.Mutex
+	words  []string
+	inputs [][]int
+	scores map[string]float32
+}
+
+func (r *rerankRunner) Tokenize(_ context.Context, s string) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tokens []int
+	for _, word := range strings.Fields(s) {
+		id := slices.Index(r.words, word)
+		if id < 0 {
+			id = len(r.words)
+			r.words = append(r.words, word)
+		}
+		tokens = append(tokens, id)
+	}
+	return tokens, nil
+}
+
+func (r *rerankRunner) Embedding(_ context.Context, req llm.EmbeddingRequest) ([]float32, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.inputs = append(r.inputs, req.Tokens)
+
+	i := slices.Index(req.Tokens, 102)
+	if i < 0 {
+		return nil, 0, errors.New("missing separator")
+	}
+
+	var document []string
+	for _, id := range req.Tokens[i+1:] {
+		document = append(document, r.words[id])
+	}
+	return []float32{r.scores[strings.Join(document, " ")]}, len(req.Tokens), nil
+}
+
+func TestRerank(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mock := rerankRunner{
+		scores: map[string]float32{
+			"pandas eat bamboo":        -4,
+			"ollama runs models":       3,
+			"llamas live in the andes": 0,
+		},
+	}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock.mockRunner),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	create := func(name string, poolingType uint32) {
+		_, digest := createBinFile(t, ggml.KV{
+			"general.architecture":              "bert",
+			"bert.block_count":                  uint32(1),
+			"bert.pooling_type":                 poolingType,
+			"tokenizer.ggml.tokens":             []string{""},
+			"tokenizer.ggml.scores":             []float32{0},
+			"tokenizer.ggml.token_type":         []int32{0},
+			"tokenizer.ggml.seperator_token_id": uint32(102),
+			"bert.context_length":               uint32(512),
+		}, []*ggml.Tensor{
+			{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		})
+
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:  name,
+			Files:  map[string]string{"file.gguf": digest},
+			Stream: &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	create("reranker", 4)
+	create("embedder", 1)
+
+	sigmoid := func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+	t.Run("sorted", func(t *testing.T) {
+		mock.inputs = nil
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:           "reranker",
+			Query:           "what is ollama",
+			Documents:       []string{"pandas eat bamboo", "ollama runs models", "llamas live in the andes"},
+			ReturnDocuments: true,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.RerankResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []api.RerankResult{
+			{Index: 1, Document: "ollama runs models", RelevanceScore: sigmoid(3)},
+			{Index: 2, Document: "llamas live in the andes", RelevanceScore: 0.5},
+			{Index: 0, Document: "pandas eat bamboo", RelevanceScore: sigmoid(-4)},
+		}
+		if diff := cmp.Diff(want, resp.Results); diff != "" {
+			t.Errorf("results mismatch (-want +got):\n%s", diff)
+		}
+
+		query, _ := mock.Tokenize(t.Context(), "what is ollama")
+		for _, input := range mock.inputs {
+			if !slices.Equal(input[:len(query)+1], append(query, 102)) {
+				t.Errorf("expected the query and document to be joined by the separator, got %v", input)
+			}
+		}
+	})
+
+	t.Run("special tokens in text", func(t *testing.T) {
+		mock.inputs = nil
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Query:     "what is [SEP] ollama",
+			Documents: []string{"ollama [SEP] runs models"},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		want, _ := mock.Tokenize(t.Context(), "what is [SEP] ollama")
+		document, _ := mock.Tokenize(t.Context(), "ollama [SEP] runs models")
+		want = slices.Concat(want, []int{102}, document)
+		if diff := cmp.Diff([][]int{want}, mock.inputs); diff != "" {
+			t.Errorf("inputs mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		mock.inputs = nil
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Query:     "what is ollama",
+			Documents: []string{"llamas live in the andes"},
+			Options:   map[string]any{"num_ctx": 8},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		// 8 tokens leaves 2 for the document after [CLS], the query, the
+		// separator and the final [SEP]
+		query, _ := mock.Tokenize(t.Context(), "what is ollama")
+		document, _ := mock.Tokenize(t.Context(), "llamas live")
+		want := slices.Concat(query, []int{102}, document)
+		if diff := cmp.Diff([][]int{want}, mock.inputs); diff != "" {
+			t.Errorf("inputs mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("truncate false", func(t *testing.T) {
+		truncate := false
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Query:     "what is ollama",
+			Documents: []string{"llamas live in the andes"},
+			Truncate:  &truncate,
+			Options:   map[string]any{"num_ctx": 8},
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("query too long", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Query:     "what is ollama and why does it run models",
+			Documents: []string{"llamas live in the andes"},
+			Options:   map[string]any{"num_ctx": 8},
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("top n", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Query:     "what is ollama",
+			Documents: []string{"pandas eat bamboo", "ollama runs models", "llamas live in the andes"},
+			TopN:      1,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.RerankResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []api.RerankResult{{Index: 1, RelevanceScore: sigmoid(3)}}
+		if diff := cmp.Diff(want, resp.Results); diff != "" {
+			t.Errorf("results mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("missing query", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "reranker",
+			Documents: []string{"pandas eat bamboo"},
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("embedding model", func(t *testing.T) {
+		w := createRequest(t, s.RerankHandler, api.RerankRequest{
+			Model:     "embedder",
+			Query:     "what is ollama",
+			Documents: []string{"pandas eat bamboo"},
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "does not support rerank") {
+			t.Errorf("unexpected error: %s", w.Body)
+		}
+	})
+}
+
+func TestRelevanceScore(t *testing.T) {
+	cases := []struct {
+		logits []float32
+		want   float64
+	}{
+		{[]float32{0}, 0.5},
+		{[]float32{2}, 1 / (1 + math.Exp(-2))},
+		{[]float32{1, 3}, 1 / (1 + math.Exp(-2))},
+		{[]float32{3, 1}, 1 / (1 + math.Exp(2))},
+	}
+
+	for _, tt := range cases {
+		got, err := relevanceScore(tt.logits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%v: expected %v, got %v", tt.logits, tt.want, got)
+		}
+	}
+
+	for _, logits := range [][]float32{nil, {1, 2, 3}, {float32(math.NaN())}} {
+		if _, err := relevanceScore(logits); err == nil {
+			t.Errorf("%v: expected error", logits)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+)
+
+func TestTokenize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mock := mockRunner{
+		CompletionResponse: llm.CompletionResponse{
+			Done:       true,
+			DoneReason: llm.DoneReasonStop,
+		},
+	}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"file.gguf": digest},
+		System: "You are a helpful assistant.",
+		Template: `
+{{- if .Tools }}
+{{ .Tools }}
+{{ end }}
+{{- range .Messages }}
+{{- .Role }}: {{ .Content }}
+{{ end }}`,
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("tokenize", func(t *testing.T) {
+		w := createRequest(t, s.TokenizeHandler, api.TokenizeRequest{
+			Model:   "test",
+			Content: "why is the sky blue?",
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.TokenizeResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(api.TokenizeResponse{Model: "test", Tokens: []int{0, 1, 2, 3, 4}}, resp); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("tokenize empty", func(t *testing.T) {
+		w := createRequest(t, s.TokenizeHandler, api.TokenizeRequest{Model: "test"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if diff := cmp.Diff(`{"model":"test","tokens":[]}`, w.Body.String()); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("detokenize", func(t *testing.T) {
+		w := createRequest(t, s.DetokenizeHandler, api.DetokenizeRequest{
+			Model:  "test",
+			Tokens: []int{3, 1, 4},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.DetokenizeResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(api.DetokenizeResponse{Model: "test", Content: "3 1 4"}, resp); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("missing model", func(t *testing.T) {
+		for _, fn := range []gin.HandlerFunc{s.TokenizeHandler, s.DetokenizeHandler, s.CountTokensHandler} {
+			w := createRequest(t, fn, map[string]any{})
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", w.Code)
+			}
+		}
+	})
+
+	t.Run("model not found", func(t *testing.T) {
+		w := createRequest(t, s.TokenizeHandler, api.TokenizeRequest{Model: "missing", Content: "hi"})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("count missing messages", func(t *testing.T) {
+		w := createRequest(t, s.CountTokensHandler, api.CountTokensRequest{Model: "test"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	// count returns the number of tokens in the prompt chat would send
+	count := func(t *testing.T, messages []api.Message, tools api.Tools) int {
+		t.Helper()
+
+		w := createRequest(t, s.CountTokensHandler, api.CountTokensRequest{
+			Model:    "test",
+			Messages: messages,
+			Tools:    tools,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.CountTokensResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model:    "test",
+			Messages: messages,
+			Tools:    tools,
+			Stream:   &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if want := len(strings.Fields(mock.CompletionRequest.Prompt)); resp.PromptEvalCount != want {
+			t.Errorf("expected count %d to match chat prompt, got %d", want, resp.PromptEvalCount)
+		}
+
+		return resp.PromptEvalCount
+	}
+
+	t.Run("count", func(t *testing.T) {
+		messages := []api.Message{
+			{Role: "user", Content: "Hello!"},
+			{Role: "assistant", Content: "Hi, how can I help?"},
+			{Role: "user", Content: "Why is the sky blue?"},
+		}
+
+		// system: You are a helpful assistant.
+		// user: Hello!
+		// assistant: Hi, how can I help?
+		// user: Why is the sky blue?
+		if got := count(t, messages, nil); got != 20 {
+			t.Errorf("expected 20 tokens, got %d", got)
+		}
+
+		tools := api.Tools{
+			{
+				Type: "function",
+				Function: api.ToolFunction{
+					Name:        "get_weather",
+					Description: "Get the current weather",
+				},
+			},
+		}
+
+		if got := count(t, messages, tools); got <= 20 {
+			t.Errorf("expected tools to add tokens, got %d", got)
+		}
+	})
+}
+
+func TestPerplexity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var windows [][]int
+	mock := mockRunner{
+		CompletionFn: func(_ context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			if !r.PromptLogprobs {
+				return errors.New("expected prompt logprobs")
+			}
+			windows = append(windows, r.Tokens)
+
+			// one logprob for each token after the BOS token, each with half
+			// the probability
+			var logprobs []llm.Logprob
+			for _, token := range r.Tokens {
+				logprobs = append(logprobs, llm.Logprob{TokenLogprob: llm.TokenLogprob{Token: strconv.Itoa(token), Logprob: -math.Ln2}})
+			}
+			fn(llm.CompletionResponse{Logprobs: logprobs})
+			fn(llm.CompletionResponse{Done: true})
+			return nil
+		},
+	}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"file.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("windows", func(t *testing.T) {
+		windows = nil
+		w := createRequest(t, s.PerplexityHandler, api.PerplexityRequest{
+			Model:   "test",
+			Content: "a b c d e f g h i j",
+			Options: map[string]any{"num_ctx": 5},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		// windows of four tokens leave room for the BOS token
+		if diff := cmp.Diff([][]int{{0, 1, 2, 3}, {4, 5, 6, 7}, {8, 9}}, windows); diff != "" {
+			t.Errorf("windows mismatch (-want +got):\n%s", diff)
+		}
+
+		var responses []api.PerplexityResponse
+		dec := json.NewDecoder(w.Body)
+		for dec.More() {
+			var resp api.PerplexityResponse
+			if err := dec.Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			responses = append(responses, resp)
+		}
+
+		if len(responses) != 4 {
+			t.Fatalf("expected 3 windows and a final response, got %d", len(responses))
+		}
+
+		// the second half of each window is scored
+		var scored []string
+		for _, resp := range responses[:3] {
+			for _, lp := range resp.Logprobs {
+				scored = append(scored, lp.Token)
+			}
+		}
+		if diff := cmp.Diff([]string{"2", "3", "6", "7", "9"}, scored); diff != "" {
+			t.Errorf("scored tokens mismatch (-want +got):\n%s", diff)
+		}
+
+		final := responses[3]
+		if !final.Done || final.EvalCount != 5 || math.Abs(final.Perplexity-2) > 1e-9 {
+			t.Errorf("unexpected final response %+v", final)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, req := range []api.PerplexityRequest{
+			{Content: "a b c"},
+			{Model: "test", Content: "a"},
+			{Model: "test", Content: "a b c", TopLogprobs: 21},
+		} {
+			w := createRequest(t, s.PerplexityHandler, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%+v: expected status 400, got %d", req, w.Code)
+			}
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		mock.CompletionFn = func(_ context.Context, _ llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			fn(llm.CompletionResponse{Content: "hi", Done: true})
+			return nil
+		}
+
+		w := createRequest(t, s.PerplexityHandler, api.PerplexityRequest{Model: "test", Content: "a b c"})
+		if !strings.Contains(w.Body.String(), "does not support perplexity") {
+			t.Errorf("expected unsupported error, got %d: %s", w.Code, w.Body)
+		}
+	})
+}
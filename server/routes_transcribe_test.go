@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/audioproc"
+)
+
+func TestTranscribe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var prompts []string
+	var windows []int
+	var temperatures []float32
+	mock := mockRunner{
+		CompletionFn: func(_ context.Context, r llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+			prompts = append(prompts, r.Prompt)
+			temperatures = append(temperatures, r.Options.Temperature)
+
+			samples, sampleRate, err := audioproc.Decode(r.Images[0].Data)
+			if err != nil {
+				return err
+			}
+			if sampleRate != 16000 {
+				t.Errorf("expected 16 kHz audio, got %d", sampleRate)
+			}
+
+			if r.Options.NumPredict == 1 {
+				fn(llm.CompletionResponse{Content: "<|en|>", Done: true})
+				return nil
+			}
+
+			windows = append(windows, len(samples))
+			fn(llm.CompletionResponse{Content: " window"})
+			fn(llm.CompletionResponse{Content: " " + string(rune('a'+len(windows)-1)) + ".", Done: true, PromptEvalCount: 4, EvalCount: 2})
+			return nil
+		},
+	}
+
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:    make(chan *LlmRequest, 1),
+			finishedReqCh:   make(chan *LlmRequest, 1),
+			expiredCh:       make(chan *runnerRef, 1),
+			unloadedCh:      make(chan any, 1),
+			loaded:          make(map[string]*runnerRef),
+			newServerFn:     newMockServer(&mock),
+			getGpuFn:        getGpuFn,
+			getSystemInfoFn: getSystemInfoFn,
+			waitForRecovery: 250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ ml.SystemInfo, _ []ml.DeviceInfo, _ bool) bool {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+				return false
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	create := func(name string, kv ggml.KV) {
+		_, digest := createBinFile(t, kv, nil)
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:  name,
+			Files:  map[string]string{"file.gguf": digest},
+			Stream: &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	create("whisper", ggml.KV{
+		"general.architecture":      "whisper",
+		"whisper.block_count":       uint32(1),
+		"whisper.audio.block_count": uint32(1),
+	})
+	create("llama", ggml.KV{
+		"general.architecture": "llama",
+		"llama.block_count":    uint32(1),
+	})
+
+	// 70 seconds at 8 kHz is three windows once resampled
+	audio := audioproc.EncodeWAV(make([]float32, 70*8000), 8000)
+
+	t.Run("detect language", func(t *testing.T) {
+		prompts, windows = nil, nil
+		w := createRequest(t, s.TranscribeHandler, api.TranscribeRequest{
+			Model: "whisper",
+			Audio: audio,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.TranscribeResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Text != "window a. window b. window c." {
+			t.Errorf("unexpected text %q", resp.Text)
+		}
+
+		if resp.Language != "en" || resp.Duration != 70 {
+			t.Errorf("expected language en and duration 70, got %q and %v", resp.Language, resp.Duration)
+		}
+
+		wantSegments := []api.TranscribeSegment{
+			{Start: 0, End: 30, Text: "window a."},
+			{Start: 30, End: 60, Text: "window b."},
+			{Start: 60, End: 70, Text: "window c."},
+		}
+		if diff := cmp.Diff(wantSegments, resp.Segments); diff != "" {
+			t.Errorf("segments mismatch (-want +got):\n%s", diff)
+		}
+
+		if resp.PromptEvalCount != 12 || resp.EvalCount != 6 {
+			t.Errorf("expected 12 prompt and 6 eval tokens, got %d and %d", resp.PromptEvalCount, resp.EvalCount)
+		}
+
+		transcribe := "[img-0]<|en|><|transcribe|><|notimestamps|>"
+		if diff := cmp.Diff([]string{"[img-0]", transcribe, transcribe, transcribe}, prompts); diff != "" {
+			t.Errorf("prompts mismatch (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff([]int{480000, 480000, 160000}, windows); diff != "" {
+			t.Errorf("window sizes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("temperature", func(t *testing.T) {
+		temperatures = nil
+		w := createRequest(t, s.TranscribeHandler, api.TranscribeRequest{
+			Model: "whisper",
+			Audio: audioproc.EncodeWAV(make([]float32, 16000), 16000),
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if diff := cmp.Diff([]float32{0, 0}, temperatures); diff != "" {
+			t.Errorf("default temperatures mismatch (-want +got):\n%s", diff)
+		}
+
+		temperatures = nil
+		w = createRequest(t, s.TranscribeHandler, api.TranscribeRequest{
+			Model:   "whisper",
+			Audio:   audioproc.EncodeWAV(make([]float32, 16000), 16000),
+			Options: map[string]any{"temperature": 0.5},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		// language detection stays greedy
+		if diff := cmp.Diff([]float32{0, 0.5}, temperatures); diff != "" {
+			t.Errorf("temperatures mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("language and prompt", func(t *testing.T) {
+		prompts = nil
+		w := createRequest(t, s.TranscribeHandler, api.TranscribeRequest{
+			Model:    "whisper",
+			Audio:    audioproc.EncodeWAV(make([]float32, 16000), 16000),
+			Language: "de",
+			Prompt:   " Ollama ",
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+
+		if diff := cmp.Diff([]string{"<|startofprev|> Ollama[img-0]<|de|><|transcribe|><|notimestamps|>"}, prompts); diff != "" {
+			t.Errorf("prompts mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	cases := []struct {
+		name string
+		req  api.TranscribeRequest
+		want string
+	}{
+		{"missing audio", api.TranscribeRequest{Model: "whisper"}, "audio is required"},
+		{"invalid audio", api.TranscribeRequest{Model: "whisper", Audio: []byte("not audio")}, audioproc.ErrUnsupportedFormat.Error()},
+		{"low sample rate", api.TranscribeRequest{Model: "whisper", Audio: audioproc.EncodeWAV(make([]float32, 16), 1)}, "unsupported sample rate 1 Hz, expected 8000 to 192000 Hz"},
+		{"unsupported language", api.TranscribeRequest{Model: "whisper", Audio: audio, Language: "not a language"}, `unsupported language "not a language"`},
+		{"no audio capability", api.TranscribeRequest{Model: "llama", Audio: audio}, `"llama" does not support audio input`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.TranscribeHandler, tt.req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body)
+			}
+
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Error != tt.want {
+				t.Errorf("expected error %q, got %q", tt.want, resp.Error)
+			}
+		})
+	}
+}
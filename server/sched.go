@@ -17,6 +17,7 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/internal/tracing"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/ml"
@@ -51,7 +52,7 @@ type Scheduler struct {
 	loaded        map[string]*runnerRef
 
 	loadFn          func(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, requireFull bool) bool
-	newServerFn     func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error)
+	newServerFn     func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, controls []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error)
 	getGpuFn        func(ctx context.Context, runners []ml.FilteredRunnerDiscovery) []ml.DeviceInfo
 	getSystemInfoFn func() ml.SystemInfo
 	waitForRecovery time.Duration
@@ -110,6 +111,7 @@ func (s *Scheduler) GetRunner(c context.Context, m *Model, opts api.Options, ses
 		select {
 		case s.pendingReqCh <- req:
 		default:
+			queueRejectionsTotal.With().Inc()
 			req.errCh <- ErrMaxQueue
 		}
 	}
@@ -363,6 +365,7 @@ func (s *Scheduler) processCompleted(ctx context.Context) {
 				finished := s.waitForVRAMRecovery(runner, runnersSnapshot)
 				runner.unload()
 				delete(s.loaded, runner.modelPath)
+				modelUnloadsTotal.With(runner.metricsName()).Inc()
 				s.loadedMu.Unlock()
 				slog.Debug("runner terminated and removed from list, blocking for VRAM recovery", "runner", runner)
 				<-finished
@@ -399,16 +402,28 @@ func (pending *LlmRequest) useLoadedRunner(runner *runnerRef, finished chan *Llm
 // load creates a new model based on req and loads it. If requireFull is true then the model must be loaded fully onto GPUs
 // (if any). Returns whether the scheduler needs to evict a model to make this one fit.
 func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, requireFull bool) bool {
+	loadStart := time.Now()
 	numParallel := max(int(envconfig.NumParallel()), 1)
 
+	// The span ends when the runner is ready or the load fails, which may be
+	// after load returns
+	ctx, span := tracing.Start(req.ctx, "load model", tracing.WithAttributes(tracing.String("model", req.model.ShortName)))
+
 	// Embedding models should always be loaded with parallel=1
 	if req.model.CheckCapabilities(model.CapabilityCompletion) != nil {
 		numParallel = 1
 	}
 
-	// `mllama`, `qwen3vl`, and `qwen3vlmoe` are snowflakes and uses an encoder cache which cannot be used with num_parallel > 1
+	// `mllama`, `qwen3vl`, `qwen3vlmoe`, and `whisper` are snowflakes and uses an encoder cache which cannot be used with num_parallel > 1
 	// ref: https://github.com/ollama/ollama/issues/4165
-	if slices.Contains([]string{"mllama", "qwen3vl", "qwen3vlmoe"}, req.model.Config.ModelFamily) && numParallel != 1 {
+	if slices.Contains([]string{"mllama", "qwen3vl", "qwen3vlmoe", "whisper"}, req.model.Config.ModelFamily) && numParallel != 1 {
+		numParallel = 1
+		slog.Warn("model architecture does not currently support parallel requests", "architecture", req.model.Config.ModelFamily)
+	}
+
+	// `mamba2` and `granitehybrid` keep recurrent state which can only be updated for
+	// batches where every sequence has the same number of tokens
+	if slices.Contains([]string{"mamba2", "granitehybrid"}, req.model.Config.ModelFamily) && numParallel != 1 {
 		numParallel = 1
 		slog.Warn("model architecture does not currently support parallel requests", "architecture", req.model.Config.ModelFamily)
 	}
@@ -423,7 +438,7 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo
 
 	if llama == nil {
 		var err error
-		llama, err = s.newServerFn(systemInfo, gpus, req.model.ModelPath, f, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts, numParallel)
+		llama, err = s.newServerFn(systemInfo, gpus, req.model.ModelPath, f, req.model.AdapterPaths, req.model.ControlPaths, req.model.ProjectorPaths, req.opts, numParallel)
 		if err != nil {
 			// some older models are not compatible with newer versions of llama.cpp
 			// show a generalized compatibility error until there is a better way to
@@ -432,6 +447,8 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo
 				err = fmt.Errorf("%v: this model may be incompatible with your version of Ollama. If you previously pulled this model, try updating it by running `ollama pull %s`", err, req.model.ShortName)
 			}
 			slog.Info("NewLlamaServer failed", "model", req.model.ModelPath, "error", err)
+			span.RecordError(err)
+			span.End()
 			req.errCh <- err
 			s.loadedMu.Unlock()
 			return false
@@ -463,8 +480,10 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, systemInfo ml.SystemInfo
 			"overhead", format.HumanBytes2(envconfig.GpuOverhead()))
 	}
 
-	gpuIDs, err := llama.Load(req.ctx, systemInfo, gpus, requireFull)
+	gpuIDs, err := llama.Load(ctx, systemInfo, gpus, requireFull)
 	if err != nil {
+		span.RecordError(err)
+		span.End()
 		if errors.Is(err, llm.ErrLoadRequiredFull) {
 			if !requireFull {
 				// No other models loaded, yet we still don't fit, so report an error
@@ -528,7 +547,10 @@ iGPUScan:
 
 	go func() {
 		defer runner.refMu.Unlock()
-		if err = llama.WaitUntilRunning(req.ctx); err != nil {
+		if err = llama.WaitUntilRunning(ctx); err != nil {
+			span.RecordError(err)
+			span.End()
+			modelLoadsTotal.With(runner.metricsName(), "error").Inc()
 			slog.Error("error loading llama server", "error", err)
 			req.errCh <- err
 			slog.Debug("triggering expiration for failed load", "runner", runner)
@@ -536,6 +558,9 @@ iGPUScan:
 			return
 		}
 		slog.Debug("finished setting up", "runner", runner)
+		modelLoadsTotal.With(runner.metricsName(), "success").Inc()
+		modelLoadDuration.With(runner.metricsName()).Observe(time.Since(loadStart).Seconds())
+		span.End()
 		if runner.pid < 0 {
 			runner.pid = llama.Pid()
 		}
@@ -581,6 +606,7 @@ func (s *Scheduler) loadImageGen(req *LlmRequest) bool {
 	s.loadedMu.Lock()
 	s.loaded[req.model.ModelPath] = runner
 	s.loadedMu.Unlock()
+	modelLoadsTotal.With(runner.metricsName(), "success").Inc()
 
 	// Set up expiration timer
 	runner.refMu.Lock()
@@ -696,9 +722,22 @@ func (runner *runnerRef) needsReload(ctx context.Context, req *LlmRequest) bool
 		optsNew.NumGPU = -1
 	}
 
+	// Runners that apply adapters per request can serve models that only
+	// differ by their adapters, as long as they were loaded with room for
+	// adapters
+	adaptersExisting := runner.model.AdapterPaths
+	adaptersNew := req.model.AdapterPaths
+	if swapper, ok := runner.llama.(llm.LoraSwapper); ok && swapper.SwapsLoras() {
+		if !hasAdapters(runner.model) && hasAdapters(req.model) {
+			return true
+		}
+
+		adaptersExisting, adaptersNew = nil, nil
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	if !reflect.DeepEqual(runner.model.AdapterPaths, req.model.AdapterPaths) || // have the adapters changed?
+	if !reflect.DeepEqual(adaptersExisting, adaptersNew) || // have the adapters changed?
 		!reflect.DeepEqual(runner.model.ProjectorPaths, req.model.ProjectorPaths) || // have the projectors changed?
 		!reflect.DeepEqual(optsExisting, optsNew) || // have the runner options changed?
 		runner.llama.Ping(ctx) != nil {
@@ -708,6 +747,11 @@ func (runner *runnerRef) needsReload(ctx context.Context, req *LlmRequest) bool
 	return false
 }
 
+// hasAdapters reports whether m has LoRA adapters or control vectors
+func hasAdapters(m *Model) bool {
+	return len(m.AdapterPaths) > 0 || len(m.ControlPaths) > 0
+}
+
 // Free memory reporting on GPUs can lag for a while even after the runner
 // exits, so we have to keep checking until we see the available memory recover,
 // otherwise subsequent model loads will get far less layers loaded or worse
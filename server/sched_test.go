@@ -49,7 +49,7 @@ func TestSchedLoad(t *testing.T) {
 		sessionDuration: &api.Duration{Duration: 2 * time.Second},
 	}
 	// Fail to load model first
-	s.newServerFn = func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, controls []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		return nil, errors.New("something failed to load model blah")
 	}
 	gpus := []ml.DeviceInfo{}
@@ -64,7 +64,7 @@ func TestSchedLoad(t *testing.T) {
 	require.Contains(t, err.Error(), "this model may be incompatible")
 
 	server := &mockLlm{vramSize: 10, vramByGPU: map[ml.DeviceID]uint64{}}
-	s.newServerFn = func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, controls []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		server.modelPath = model
 		return server, nil
 	}
@@ -106,7 +106,7 @@ type reqBundle struct {
 	f       *ggml.GGML
 }
 
-func (scenario *reqBundle) newServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+func (scenario *reqBundle) newServer(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, controls []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 	scenario.srv.modelPath = model
 	return scenario.srv, nil
 }
@@ -466,7 +466,7 @@ func TestSchedExpireRunner(t *testing.T) {
 	gpus := []ml.DeviceInfo{}
 	systemInfo := ml.SystemInfo{}
 	server := &mockLlm{vramSize: 10, vramByGPU: map[ml.DeviceID]uint64{}}
-	s.newServerFn = func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+	s.newServerFn = func(systemInfo ml.SystemInfo, gpus []ml.DeviceInfo, model string, f *ggml.GGML, adapters []string, controls []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
 		server.modelPath = model
 		return server, nil
 	}
@@ -681,6 +681,48 @@ func TestSchedNeedsReload(t *testing.T) {
 	require.False(t, resp)
 }
 
+type mockLoraLlm struct {
+	mockLlm
+}
+
+func (s *mockLoraLlm) SwapsLoras() bool {
+	return true
+}
+
+func TestSchedNeedsReloadLoras(t *testing.T) {
+	ctx, done := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer done()
+
+	do := api.DefaultOptions()
+	runner := &runnerRef{
+		model:       &Model{AdapterPaths: []string{"adapter1"}},
+		Options:     &do,
+		llama:       &mockLoraLlm{mockLlm{vramByGPU: map[ml.DeviceID]uint64{}}},
+		numParallel: 1,
+	}
+
+	// adapters are applied per request so the runner can be shared
+	req := &LlmRequest{
+		model: &Model{AdapterPaths: []string{"adapter2"}},
+		opts:  api.DefaultOptions(),
+	}
+	require.False(t, runner.needsReload(ctx, req))
+
+	req.model.AdapterPaths = nil
+	require.False(t, runner.needsReload(ctx, req))
+
+	// a runner loaded without adapters has no room for them
+	runner.model.AdapterPaths = nil
+	req.model.ControlPaths = []string{"control1"}
+	require.True(t, runner.needsReload(ctx, req))
+
+	req.model.ControlPaths = nil
+	require.False(t, runner.needsReload(ctx, req))
+
+	req.opts.NumBatch = 1234
+	require.True(t, runner.needsReload(ctx, req))
+}
+
 func TestSchedUnloadAllRunners(t *testing.T) {
 	ctx, done := context.WithTimeout(t.Context(), 100*time.Millisecond)
 	defer done()
@@ -780,7 +822,7 @@ func (s *mockLlm) Completion(ctx context.Context, req llm.CompletionRequest, fn
 	return s.completionResp
 }
 
-func (s *mockLlm) Embedding(ctx context.Context, input string) ([]float32, int, error) {
+func (s *mockLlm) Embedding(ctx context.Context, req llm.EmbeddingRequest) ([]float32, int, error) {
 	return s.embeddingResp, 0, s.embeddingRespErr
 }
 
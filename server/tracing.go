@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/internal/tracing"
+	"github.com/ollama/ollama/version"
+)
+
+// initTracing starts exporting spans if an OTLP endpoint is configured. The
+// returned function flushes any queued spans and is safe to call when tracing
+// is disabled.
+func initTracing() func(context.Context) {
+	endpoint := envconfig.OTLPEndpoint()
+	if endpoint == "" {
+		return func(context.Context) {}
+	}
+
+	shutdown, err := tracing.Init(tracing.Config{
+		Endpoint:       endpoint,
+		Headers:        envconfig.OTLPHeaders(),
+		ServiceName:    envconfig.OTelServiceName(),
+		ServiceVersion: version.Version,
+	})
+	if err != nil {
+		slog.Warn("failed to initialize tracing", "error", err)
+		return func(context.Context) {}
+	}
+
+	slog.Info("exporting traces", "endpoint", endpoint)
+	return func(ctx context.Context) {
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("failed to flush traces", "error", err)
+		}
+	}
+}
+
+// tracingMiddleware starts a server span for every request, continuing the
+// trace from the caller's traceparent header if present. Handlers find the
+// span through the request context.
+func tracingMiddleware(c *gin.Context) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+	ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+		tracing.WithKind(tracing.KindServer),
+		tracing.WithAttributes(
+			tracing.String("http.request.method", c.Request.Method),
+			tracing.String("http.route", route),
+		),
+	)
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(tracing.Int("http.response.status_code", status))
+	if model := c.GetString(metricsModelKey); model != "" {
+		span.SetAttributes(tracing.String("model", model))
+	}
+	if status >= http.StatusInternalServerError {
+		err := c.Errors.Last()
+		if err == nil {
+			span.RecordError(errors.New(http.StatusText(status)))
+		} else {
+			span.RecordError(err)
+		}
+	}
+}
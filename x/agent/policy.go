@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"strings"
+	"time"
+)
+
+// Policy controls tool execution when the agent loop runs without a user
+// present to answer approval prompts.
+type Policy struct {
+	// AutoApprove lists the tool calls that may run without approval.
+	// Entries are tool names (e.g. "web_search"), "bash" to allow any
+	// command not matched by the deny patterns, "bash:<prefix>" to allow
+	// some bash commands, or "*" to allow every tool. A prefix is either
+	// the leading words of a command (e.g. "go test") or a command and
+	// directory in the form of an approval (e.g. "cat:src/"), which also
+	// allows subdirectories.
+	AutoApprove []string
+
+	// MaxTurns is the maximum number of model responses before the loop
+	// stops. Zero means unlimited.
+	MaxTurns int
+
+	// MaxDuration is the maximum wall time for the whole run. Zero means
+	// unlimited.
+	MaxDuration time.Duration
+}
+
+// Allows reports whether a tool call may run under the policy. Bash commands
+// matching a deny pattern are never allowed, regardless of the policy.
+func (p Policy) Allows(toolName string, args map[string]any) bool {
+	var command string
+	if toolName == "bash" {
+		cmd, ok := args["command"].(string)
+		if !ok {
+			return false
+		}
+		if denied, _ := IsDenied(cmd); denied {
+			return false
+		}
+		command = strings.TrimSpace(cmd)
+	}
+
+	for _, entry := range p.AutoApprove {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "*", entry == toolName:
+			return true
+		case toolName == "bash" && strings.HasPrefix(entry, "bash:"):
+			if allowsBash(strings.TrimSpace(strings.TrimPrefix(entry, "bash:")), command) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allowsBash reports whether a "bash:<prefix>" entry allows command. Prefixed
+// commands must stay within the current directory and can't chain or
+// substitute commands after the part of the command covered by the prefix.
+func allowsBash(prefix, command string) bool {
+	if prefix == "" || isCommandOutsideCwd(command) {
+		return false
+	}
+
+	if cmd, dir, ok := strings.Cut(prefix, ":"); ok && !strings.ContainsAny(cmd, " \t") {
+		// approvals only check the first command of a pipeline, so
+		// nothing else may run
+		if hasShellOperator(command) {
+			return false
+		}
+
+		current := extractBashPrefix(command)
+		if current == "" {
+			return false
+		}
+
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+
+		a := NewApprovalManager()
+		a.prefixes[cmd+":"+dir] = true
+		return a.matchesHierarchicalPrefix(current)
+	}
+
+	rest, ok := strings.CutPrefix(command, prefix)
+	if !ok || (rest != "" && !strings.ContainsAny(rest[:1], " \t")) {
+		// the prefix must end on a word boundary so "go test" doesn't
+		// allow "go testdata/run.sh"
+		return false
+	}
+
+	return !hasShellOperator(rest)
+}
+
+// hasShellOperator reports whether command chains, pipes, substitutes or
+// redirects, which includes process substitution with <( and >(
+func hasShellOperator(command string) bool {
+	return strings.ContainsAny(command, ";&|`\n<>") || strings.Contains(command, "$(")
+}
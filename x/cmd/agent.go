@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/x/agent"
+	"github.com/ollama/ollama/x/tools"
+)
+
+var (
+	// ErrMaxTurns is returned when a headless agent run exhausts its turn budget.
+	ErrMaxTurns = errors.New("agent exceeded maximum number of turns")
+
+	// ErrMaxDuration is returned when a headless agent run exceeds its wall time.
+	ErrMaxDuration = errors.New("agent exceeded maximum run time")
+)
+
+// AgentOptions contains options for running a headless agent session.
+type AgentOptions struct {
+	Model     string
+	Prompt    string
+	System    string
+	Format    string
+	Options   map[string]any
+	KeepAlive *api.Duration
+	Think     *api.ThinkValue
+
+	// Tools is the registry of tools offered to the model. A nil registry
+	// runs a single turn without tools.
+	Tools *tools.Registry
+
+	// Policy decides which tool calls run and bounds the length of the run.
+	Policy agent.Policy
+
+	// Output receives the JSON-lines transcript. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// AgentEvent is a single line of the headless agent transcript.
+type AgentEvent struct {
+	// Type is one of "message", "tool_call", "tool_result" or "done".
+	Type string    `json:"type"`
+	Turn int       `json:"turn"`
+	Time time.Time `json:"time"`
+
+	Message  *api.Message  `json:"message,omitempty"`
+	ToolCall *api.ToolCall `json:"tool_call,omitempty"`
+
+	// Approved is set on tool_call events and reports whether the policy
+	// allowed the call to run.
+	Approved *bool `json:"approved,omitempty"`
+
+	// Error is set on tool_result events for failed calls and on done
+	// events for failed runs.
+	Error string `json:"error,omitempty"`
+
+	// Metrics is set on message events with the server reported timings.
+	Metrics *api.Metrics `json:"metrics,omitempty"`
+}
+
+// RunAgent runs the agent loop without user interaction. Tool calls are
+// approved according to opts.Policy and every message, tool call and tool
+// result is written to opts.Output as a JSON line. A final "done" event is
+// always written; its error field is set when the run fails.
+func RunAgent(ctx context.Context, client *api.Client, opts AgentOptions) (err error) {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	enc := json.NewEncoder(out)
+	turn := 0
+	emit := func(ev AgentEvent) error {
+		ev.Turn = turn
+		ev.Time = time.Now().UTC()
+		return enc.Encode(ev)
+	}
+
+	defer func() {
+		done := AgentEvent{Type: "done"}
+		if err != nil {
+			done.Error = err.Error()
+		}
+		if emitErr := emit(done); emitErr != nil && err == nil {
+			err = emitErr
+		}
+	}()
+
+	if opts.Policy.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.Policy.MaxDuration, ErrMaxDuration)
+		defer cancel()
+	}
+
+	var messages []api.Message
+	if opts.System != "" {
+		messages = append(messages, api.Message{Role: "system", Content: opts.System})
+	}
+	messages = append(messages, api.Message{Role: "user", Content: opts.Prompt})
+	for _, m := range messages {
+		if err := emit(AgentEvent{Type: "message", Message: &m}); err != nil {
+			return err
+		}
+	}
+
+	format := opts.Format
+	if format == "json" {
+		format = `"` + format + `"`
+	}
+
+	for {
+		if opts.Policy.MaxTurns > 0 && turn >= opts.Policy.MaxTurns {
+			return ErrMaxTurns
+		}
+		turn++
+
+		req := &api.ChatRequest{
+			Model:     opts.Model,
+			Messages:  messages,
+			Format:    json.RawMessage(format),
+			Options:   opts.Options,
+			Think:     opts.Think,
+			KeepAlive: opts.KeepAlive,
+		}
+		if opts.Tools != nil {
+			if apiTools := opts.Tools.Tools(); len(apiTools) > 0 {
+				req.Tools = apiTools
+			}
+		}
+
+		var content, thinking strings.Builder
+		var toolCalls []api.ToolCall
+		var latest api.ChatResponse
+		if err := client.Chat(ctx, req, func(resp api.ChatResponse) error {
+			latest = resp
+			content.WriteString(resp.Message.Content)
+			thinking.WriteString(resp.Message.Thinking)
+			toolCalls = append(toolCalls, resp.Message.ToolCalls...)
+			return nil
+		}); err != nil {
+			if cause := context.Cause(ctx); cause != nil {
+				return cause
+			}
+			return err
+		}
+
+		assistant := api.Message{
+			Role:      "assistant",
+			Content:   content.String(),
+			Thinking:  thinking.String(),
+			ToolCalls: toolCalls,
+		}
+		messages = append(messages, assistant)
+		if err := emit(AgentEvent{Type: "message", Message: &assistant, Metrics: &latest.Metrics}); err != nil {
+			return err
+		}
+
+		if len(toolCalls) == 0 || opts.Tools == nil {
+			return nil
+		}
+
+		for _, call := range toolCalls {
+			args := call.Function.Arguments.ToMap()
+			approved := opts.Policy.Allows(call.Function.Name, args)
+			if err := emit(AgentEvent{Type: "tool_call", ToolCall: &call, Approved: &approved}); err != nil {
+				return err
+			}
+
+			result := api.Message{Role: "tool", ToolName: call.Function.Name, ToolCallID: call.ID}
+			var toolErr string
+			if approved {
+				output, err := opts.Tools.Execute(ctx, call)
+				if err != nil {
+					toolErr = err.Error()
+					result.Content = fmt.Sprintf("Error: %v", err)
+				} else {
+					result.Content = truncateToolOutput(output, opts.Model)
+				}
+			} else {
+				toolErr = "not approved by policy"
+				result.Content = agent.FormatDenyResult(call.Function.Name, "not permitted by the non-interactive agent policy")
+			}
+
+			messages = append(messages, result)
+			if err := emit(AgentEvent{Type: "tool_result", Message: &result, Error: toolErr}); err != nil {
+				return err
+			}
+
+			if cause := context.Cause(ctx); cause != nil {
+				return cause
+			}
+		}
+	}
+}
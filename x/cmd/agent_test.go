@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/x/agent"
+	"github.com/ollama/ollama/x/tools"
+)
+
+type echoTool struct {
+	calls int
+}
+
+func (e *echoTool) Name() string        { return "echo" }
+func (e *echoTool) Description() string { return "Echo the input" }
+func (e *echoTool) Schema() api.ToolFunction {
+	return api.ToolFunction{Name: "echo", Description: e.Description()}
+}
+
+func (e *echoTool) Execute(_ context.Context, args map[string]any) (string, error) {
+	e.calls++
+	return "echoed", nil
+}
+
+// waitTool is an echo tool that doesn't finish until it is cancelled
+type waitTool struct {
+	echoTool
+}
+
+func (w *waitTool) Execute(ctx context.Context, _ map[string]any) (string, error) {
+	<-ctx.Done()
+	return "", context.Cause(ctx)
+}
+
+// newAgentTestServer returns a client for a chat server that answers with a
+// tool call until it has seen toolTurns tool results, then with plain text.
+func newAgentTestServer(t *testing.T, toolTurns int) *api.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+			return
+		}
+
+		var results int
+		for _, m := range req.Messages {
+			if m.Role == "tool" {
+				results++
+			}
+		}
+
+		resp := api.ChatResponse{Model: req.Model, Done: true, Message: api.Message{Role: "assistant"}}
+		if results < toolTurns {
+			args := api.NewToolCallFunctionArguments()
+			args.Set("text", "hi")
+			resp.Message.ToolCalls = []api.ToolCall{{ID: "call_1", Function: api.ToolCallFunction{Name: "echo", Arguments: args}}}
+		} else {
+			resp.Message.Content = "finished"
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api.NewClient(u, srv.Client())
+}
+
+func decodeEvents(t *testing.T, b []byte) []AgentEvent {
+	t.Helper()
+
+	var events []AgentEvent
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var ev AgentEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("decode transcript: %v", err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestRunAgent(t *testing.T) {
+	t.Run("approved tool call", func(t *testing.T) {
+		tool := &echoTool{}
+		registry := tools.NewRegistry()
+		registry.Register(tool)
+
+		var out bytes.Buffer
+		err := RunAgent(context.Background(), newAgentTestServer(t, 1), AgentOptions{
+			Model:  "test",
+			Prompt: "say hi",
+			Tools:  registry,
+			Policy: agent.Policy{AutoApprove: []string{"echo"}},
+			Output: &out,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tool.calls != 1 {
+			t.Errorf("expected 1 tool call, got %d", tool.calls)
+		}
+
+		var types []string
+		for _, ev := range decodeEvents(t, out.Bytes()) {
+			types = append(types, ev.Type)
+		}
+		expected := []string{"message", "message", "tool_call", "tool_result", "message", "done"}
+		if len(types) != len(expected) {
+			t.Fatalf("expected events %v, got %v", expected, types)
+		}
+		for i := range expected {
+			if types[i] != expected[i] {
+				t.Fatalf("expected events %v, got %v", expected, types)
+			}
+		}
+	})
+
+	t.Run("denied tool call", func(t *testing.T) {
+		tool := &echoTool{}
+		registry := tools.NewRegistry()
+		registry.Register(tool)
+
+		var out bytes.Buffer
+		err := RunAgent(context.Background(), newAgentTestServer(t, 1), AgentOptions{
+			Model:  "test",
+			Prompt: "say hi",
+			Tools:  registry,
+			Output: &out,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tool.calls != 0 {
+			t.Errorf("expected denied tool not to run, got %d calls", tool.calls)
+		}
+
+		for _, ev := range decodeEvents(t, out.Bytes()) {
+			if ev.Type == "tool_call" && (ev.Approved == nil || *ev.Approved) {
+				t.Errorf("expected tool call to be reported as not approved")
+			}
+		}
+	})
+
+	t.Run("max turns", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		registry.Register(&echoTool{})
+
+		var out bytes.Buffer
+		err := RunAgent(context.Background(), newAgentTestServer(t, 10), AgentOptions{
+			Model:  "test",
+			Prompt: "loop",
+			Tools:  registry,
+			Policy: agent.Policy{AutoApprove: []string{"*"}, MaxTurns: 2},
+			Output: &out,
+		})
+		if !errors.Is(err, ErrMaxTurns) {
+			t.Fatalf("expected ErrMaxTurns, got %v", err)
+		}
+
+		events := decodeEvents(t, out.Bytes())
+		last := events[len(events)-1]
+		if last.Type != "done" || last.Error == "" {
+			t.Errorf("expected final done event with error, got %+v", last)
+		}
+	})
+
+	t.Run("max duration", func(t *testing.T) {
+		registry := tools.NewRegistry()
+		registry.Register(&waitTool{})
+
+		var out bytes.Buffer
+		err := RunAgent(context.Background(), newAgentTestServer(t, 1), AgentOptions{
+			Model:  "test",
+			Prompt: "wait",
+			Tools:  registry,
+			Policy: agent.Policy{AutoApprove: []string{"*"}, MaxDuration: 100 * time.Millisecond},
+			Output: &out,
+		})
+		if !errors.Is(err, ErrMaxDuration) {
+			t.Fatalf("expected ErrMaxDuration, got %v", err)
+		}
+	})
+}
@@ -414,7 +414,7 @@ func Chat(ctx context.Context, opts RunOptions) (*api.Message, error) {
 			}
 
 			// Execute the tool
-			toolResult, err := toolRegistry.Execute(call)
+			toolResult, err := toolRegistry.Execute(ctx, call)
 			if err != nil {
 				// Check if web search needs authentication
 				if errors.Is(err, tools.ErrWebSearchAuthRequired) {
@@ -426,7 +426,7 @@ func Chat(ctx context.Context, opts RunOptions) (*api.Message, error) {
 						if signinErr := waitForOllamaSignin(ctx); signinErr == nil {
 							// Retry the web search
 							fmt.Fprintf(os.Stderr, "\033[90mretrying web search...\033[0m\n")
-							toolResult, err = toolRegistry.Execute(call)
+							toolResult, err = toolRegistry.Execute(ctx, call)
 							if err == nil {
 								goto toolSuccess
 							}
@@ -6,11 +6,13 @@
 package imagegen
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"time"
@@ -31,6 +33,14 @@ type ImageGenOptions struct {
 	Steps          int
 	Seed           int
 	NegativePrompt string
+
+	// Image editing: InitImage and Mask are file paths
+	InitImage string
+	Mask      string
+	Strength  float64
+
+	// Preview is a file path that in-progress thumbnails are written to
+	Preview string
 }
 
 // DefaultOptions returns the default image generation options.
@@ -51,12 +61,20 @@ func RegisterFlags(cmd *cobra.Command) {
 	cmd.Flags().Int("steps", 0, "Denoising steps (0 = model default)")
 	cmd.Flags().Int("seed", 0, "Random seed (0 for random)")
 	cmd.Flags().String("negative", "", "Negative prompt")
+	cmd.Flags().String("image", "", "Init image to edit")
+	cmd.Flags().String("mask", "", "Inpainting mask (white areas are regenerated)")
+	cmd.Flags().Float64("strength", 0, "Edit strength from 0 to 1 (0 = default)")
+	cmd.Flags().String("preview", "", "Write in-progress previews to this PNG file")
 	// Hide from main flags section - shown in separate section via AppendFlagsDocs
 	cmd.Flags().MarkHidden("width")
 	cmd.Flags().MarkHidden("height")
 	cmd.Flags().MarkHidden("steps")
 	cmd.Flags().MarkHidden("seed")
 	cmd.Flags().MarkHidden("negative")
+	cmd.Flags().MarkHidden("image")
+	cmd.Flags().MarkHidden("mask")
+	cmd.Flags().MarkHidden("strength")
+	cmd.Flags().MarkHidden("preview")
 }
 
 // AppendFlagsDocs appends image generation flags documentation to the command's usage template.
@@ -68,13 +86,17 @@ Image Generation Flags (experimental):
       --steps int      Denoising steps
       --seed int       Random seed
       --negative str   Negative prompt
+      --image str      Init image to edit
+      --mask str       Inpainting mask
+      --strength float Edit strength (0-1)
+      --preview str    Write in-progress previews to file
 `
 	cmd.SetUsageTemplate(cmd.UsageTemplate() + usage)
 }
 
 // RunCLI handles the CLI for image generation models.
 // Returns true if it handled the request, false if the caller should continue with normal flow.
-// Supports flags: --width, --height, --steps, --seed, --negative
+// Supports flags: --width, --height, --steps, --seed, --negative, --image, --mask, --strength, --preview
 func RunCLI(cmd *cobra.Command, name string, prompt string, interactive bool, keepAlive *api.Duration) error {
 	// Get options from flags (with env var defaults)
 	opts := DefaultOptions()
@@ -94,6 +116,22 @@ func RunCLI(cmd *cobra.Command, name string, prompt string, interactive bool, ke
 		if v, err := cmd.Flags().GetString("negative"); err == nil && v != "" {
 			opts.NegativePrompt = v
 		}
+		if v, err := cmd.Flags().GetString("image"); err == nil && v != "" {
+			opts.InitImage = v
+		}
+		if v, err := cmd.Flags().GetString("mask"); err == nil && v != "" {
+			opts.Mask = v
+		}
+		if v, err := cmd.Flags().GetFloat64("strength"); err == nil && v > 0 {
+			opts.Strength = v
+		}
+		if v, err := cmd.Flags().GetString("preview"); err == nil && v != "" {
+			opts.Preview = v
+		}
+	}
+
+	if opts.Mask != "" && opts.InitImage == "" {
+		return errors.New("--mask requires --image")
 	}
 
 	if interactive {
@@ -112,11 +150,12 @@ func generateImageWithOptions(cmd *cobra.Command, modelName, prompt string, keep
 	}
 
 	req := &api.GenerateRequest{
-		Model:  modelName,
-		Prompt: prompt,
-		Width:  int32(opts.Width),
-		Height: int32(opts.Height),
-		Steps:  int32(opts.Steps),
+		Model:   modelName,
+		Prompt:  prompt,
+		Width:   int32(opts.Width),
+		Height:  int32(opts.Height),
+		Steps:   int32(opts.Steps),
+		Preview: opts.Preview != "",
 	}
 	if opts.Seed != 0 {
 		req.Options = map[string]any{"seed": opts.Seed}
@@ -124,15 +163,37 @@ func generateImageWithOptions(cmd *cobra.Command, modelName, prompt string, keep
 	if keepAlive != nil {
 		req.KeepAlive = keepAlive
 	}
+	if opts.InitImage != "" {
+		data, err := os.ReadFile(opts.InitImage)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+		req.Images = []api.ImageData{data}
+		req.Strength = float32(opts.Strength)
+		// Let the server size the output from the init image
+		if !cmd.Flags().Changed("width") && !cmd.Flags().Changed("height") {
+			req.Width, req.Height = 0, 0
+		}
+	}
+	if opts.Mask != "" {
+		data, err := os.ReadFile(opts.Mask)
+		if err != nil {
+			return fmt.Errorf("failed to read mask: %w", err)
+		}
+		req.Mask = data
+	}
 
 	// Show loading spinner until generation starts
 	p := progress.NewProgress(os.Stderr)
 	spinner := progress.NewSpinner("")
 	p.Add("", spinner)
 
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
 	var stepBar *progress.StepBar
 	var imageBase64 string
-	err = client.Generate(cmd.Context(), req, func(resp api.GenerateResponse) error {
+	err = client.Generate(ctx, req, func(resp api.GenerateResponse) error {
 		// Handle progress updates using structured fields
 		if resp.Total > 0 {
 			if stepBar == nil {
@@ -143,6 +204,10 @@ func generateImageWithOptions(cmd *cobra.Command, modelName, prompt string, keep
 			stepBar.Set(int(resp.Completed))
 		}
 
+		if resp.Preview != "" {
+			writePreview(opts.Preview, resp.Preview)
+		}
+
 		// Handle final response with image data
 		if resp.Done && resp.Image != "" {
 			imageBase64 = resp.Image
@@ -152,7 +217,9 @@ func generateImageWithOptions(cmd *cobra.Command, modelName, prompt string, keep
 	})
 
 	p.StopAndClear()
-	if err != nil {
+	if errors.Is(err, context.Canceled) && cmd.Context().Err() == nil {
+		return errors.New("generation cancelled")
+	} else if err != nil {
 		return err
 	}
 
@@ -260,11 +327,12 @@ func runInteractive(cmd *cobra.Command, modelName string, keepAlive *api.Duratio
 
 		// Generate image with current options
 		req := &api.GenerateRequest{
-			Model:  modelName,
-			Prompt: line,
-			Width:  int32(opts.Width),
-			Height: int32(opts.Height),
-			Steps:  int32(opts.Steps),
+			Model:   modelName,
+			Prompt:  line,
+			Width:   int32(opts.Width),
+			Height:  int32(opts.Height),
+			Steps:   int32(opts.Steps),
+			Preview: opts.Preview != "",
 		}
 		if opts.Seed != 0 {
 			req.Options = map[string]any{"seed": opts.Seed}
@@ -281,7 +349,9 @@ func runInteractive(cmd *cobra.Command, modelName string, keepAlive *api.Duratio
 		var stepBar *progress.StepBar
 		var imageBase64 string
 
-		err = client.Generate(cmd.Context(), req, func(resp api.GenerateResponse) error {
+		// Ctrl+C cancels the current generation rather than exiting
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		err = client.Generate(ctx, req, func(resp api.GenerateResponse) error {
 			// Handle progress updates using structured fields
 			if resp.Total > 0 {
 				if stepBar == nil {
@@ -292,6 +362,10 @@ func runInteractive(cmd *cobra.Command, modelName string, keepAlive *api.Duratio
 				stepBar.Set(int(resp.Completed))
 			}
 
+			if resp.Preview != "" {
+				writePreview(opts.Preview, resp.Preview)
+			}
+
 			// Handle final response with image data
 			if resp.Done && resp.Image != "" {
 				imageBase64 = resp.Image
@@ -300,8 +374,12 @@ func runInteractive(cmd *cobra.Command, modelName string, keepAlive *api.Duratio
 			return nil
 		})
 
+		stop()
 		p.StopAndClear()
-		if err != nil {
+		if errors.Is(err, context.Canceled) && cmd.Context().Err() == nil {
+			fmt.Fprintln(os.Stderr, "Generation cancelled.")
+			continue
+		} else if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			continue
 		}
@@ -336,6 +414,21 @@ func runInteractive(cmd *cobra.Command, modelName string, keepAlive *api.Duratio
 	}
 }
 
+// writePreview saves a base64-encoded preview thumbnail to path. The file is
+// replaced atomically so image viewers watching it never see a partial write.
+func writePreview(path, preview string) {
+	data, err := base64.StdEncoding.DecodeString(preview)
+	if err != nil {
+		return
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
+
 // sanitizeFilename removes characters that aren't safe for filenames.
 func sanitizeFilename(s string) string {
 	s = strings.ToLower(s)
@@ -0,0 +1,72 @@
+package imagegen
+
+import (
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultStrength is the edit strength used when an init image is given
+// without an explicit strength.
+const DefaultStrength = 0.75
+
+// StartStep returns the index of the first denoising step to run when
+// editing an init image. A strength of 1 runs every step (the init image is
+// fully replaced by noise) and smaller strengths run proportionally fewer,
+// but always at least one. A non-positive strength is treated as unset and
+// selects DefaultStrength.
+func StartStep(steps int, strength float32) int {
+	if strength <= 0 {
+		strength = DefaultStrength
+	}
+	if strength > 1 {
+		strength = 1
+	}
+
+	run := int(float32(steps)*strength + 0.5)
+	if run < 1 {
+		run = 1
+	}
+	return max(steps-run, 0)
+}
+
+// ResizeImage scales img to exactly width x height.
+func ResizeImage(img image.Image, width, height int) *image.RGBA {
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, img.Bounds(), draw.Over, nil)
+	return resized
+}
+
+// MaskWeights downsamples an inpainting mask to a gridW x gridH grid in
+// row-major order. Each weight is the mean luminance of the covered mask
+// pixels in [0, 1]: 1 means the cell is regenerated, 0 means it is kept from
+// the init image.
+func MaskWeights(mask image.Image, gridW, gridH int) []float32 {
+	weights := make([]float32, gridW*gridH)
+	bounds := mask.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return weights
+	}
+
+	for gy := range gridH {
+		y0 := gy * h / gridH
+		y1 := max((gy+1)*h/gridH, y0+1)
+		for gx := range gridW {
+			x0 := gx * w / gridW
+			x1 := max((gx+1)*w/gridW, x0+1)
+
+			var sum float32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					gray := color.GrayModel.Convert(mask.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+					sum += float32(gray.Y) / 255
+				}
+			}
+			weights[gy*gridW+gx] = sum / float32((y1-y0)*(x1-x0))
+		}
+	}
+
+	return weights
+}
@@ -0,0 +1,65 @@
+package imagegen
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestStartStep(t *testing.T) {
+	tests := []struct {
+		steps    int
+		strength float32
+		expected int
+	}{
+		{steps: 10, strength: 1, expected: 0},
+		{steps: 10, strength: 0.5, expected: 5},
+		{steps: 10, strength: 0, expected: 2}, // default strength
+		{steps: 4, strength: 0.75, expected: 1},
+		{steps: 4, strength: 0.01, expected: 3}, // always run at least one step
+		{steps: 4, strength: 2, expected: 0},
+	}
+
+	for _, tt := range tests {
+		if got := StartStep(tt.steps, tt.strength); got != tt.expected {
+			t.Errorf("StartStep(%d, %v) = %d, expected %d", tt.steps, tt.strength, got, tt.expected)
+		}
+	}
+}
+
+func TestMaskWeights(t *testing.T) {
+	// Left half black (keep), right half white (regenerate)
+	mask := image.NewGray(image.Rect(0, 0, 8, 4))
+	for y := range 4 {
+		for x := 4; x < 8; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	weights := MaskWeights(mask, 4, 2)
+	expected := []float32{0, 0, 1, 1, 0, 0, 1, 1}
+	if len(weights) != len(expected) {
+		t.Fatalf("expected %d weights, got %d", len(expected), len(weights))
+	}
+	for i := range expected {
+		if weights[i] != expected[i] {
+			t.Errorf("weight %d = %v, expected %v", i, weights[i], expected[i])
+		}
+	}
+
+	// A 2x1 grid over a 4-wide mask with one white column averages to 0.5
+	mask = image.NewGray(image.Rect(0, 0, 4, 1))
+	mask.SetGray(0, 0, color.Gray{Y: 255})
+	weights = MaskWeights(mask, 2, 1)
+	if weights[0] != 0.5 || weights[1] != 0 {
+		t.Errorf("expected [0.5 0], got %v", weights)
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	resized := ResizeImage(img, 64, 32)
+	if b := resized.Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+		t.Errorf("expected 64x32, got %dx%d", b.Dx(), b.Dy())
+	}
+}
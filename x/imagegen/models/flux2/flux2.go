@@ -28,8 +28,12 @@ type GenerateConfig struct {
 	GuidanceScale float32               // Guidance scale (default: 1.0, Klein doesn't need CFG)
 	Seed          int64                 // Random seed
 	Progress      func(step, totalSteps int) // Optional progress callback
+	Preview       func(step, totalSteps int, img *mlx.Array) // Optional low-res preview callback
 	CapturePath   string                // GPU capture path (debug)
 	InputImages   []image.Image         // Reference images for image conditioning (already loaded)
+	InitImage     image.Image           // Init image for image-to-image (already loaded)
+	Mask          image.Image           // Optional inpainting mask for InitImage (white = regenerate)
+	Strength      float32               // How much InitImage is changed, 0-1 (default: 0.75)
 }
 
 // Model represents a FLUX.2 Klein model.
@@ -166,7 +170,7 @@ func (m *Model) GenerateFromConfig(ctx context.Context, cfg *GenerateConfig) (*m
 }
 
 // GenerateImage implements runner.ImageModel interface.
-func (m *Model) GenerateImage(ctx context.Context, prompt string, width, height int32, steps int, seed int64, progress func(step, total int)) (*mlx.Array, error) {
+func (m *Model) GenerateImage(ctx context.Context, prompt string, width, height int32, steps int, seed int64, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error) {
 	return m.GenerateFromConfig(ctx, &GenerateConfig{
 		Prompt:   prompt,
 		Width:    width,
@@ -174,6 +178,23 @@ func (m *Model) GenerateImage(ctx context.Context, prompt string, width, height
 		Steps:    steps,
 		Seed:     seed,
 		Progress: progress,
+		Preview:  preview,
+	})
+}
+
+// EditImage implements runner.ImageEditModel interface.
+func (m *Model) EditImage(ctx context.Context, prompt string, initImage, mask image.Image, strength float32, width, height int32, steps int, seed int64, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error) {
+	return m.GenerateFromConfig(ctx, &GenerateConfig{
+		Prompt:    prompt,
+		Width:     width,
+		Height:    height,
+		Steps:     steps,
+		Seed:      seed,
+		Progress:  progress,
+		Preview:   preview,
+		InitImage: initImage,
+		Mask:      mask,
+		Strength:  strength,
 	})
 }
 
@@ -197,10 +218,14 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	}
 
 	// Determine output dimensions
-	if len(cfg.InputImages) > 0 {
+	sizeImage := cfg.InitImage
+	if sizeImage == nil && len(cfg.InputImages) > 0 {
+		sizeImage = cfg.InputImages[0]
+	}
+	if sizeImage != nil {
 		// With input images, compute missing dimension from aspect ratio
 		// Images are already EXIF-rotated by the caller
-		bounds := cfg.InputImages[0].Bounds()
+		bounds := sizeImage.Bounds()
 		imgW, imgH := bounds.Dx(), bounds.Dy()
 		aspectRatio := float64(imgH) / float64(imgW)
 		if cfg.Width > 0 && cfg.Height <= 0 {
@@ -287,6 +312,25 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	patches := packLatents(latents)
 	noiseSeqLen := patches.Shape()[1]
 
+	// Image-to-image: start partway through the schedule from the noised init image
+	startStep := 0
+	var initPatches, noise, maskWeights *mlx.Array
+	if cfg.InitImage != nil {
+		startStep = imagegen.StartStep(cfg.Steps, cfg.Strength)
+		fmt.Printf("  Encoding init image (%d of %d steps)... ", cfg.Steps-startStep, cfg.Steps)
+		resized := imagegen.ResizeImage(cfg.InitImage, int(cfg.Width), int(cfg.Height))
+		initPatches = mlx.ToBFloat16(m.VAE.EncodeImage(ImageToTensor(resized)))
+		noise = patches
+		patches = scheduler.AddNoise(initPatches, noise, startStep)
+
+		// Inpainting mask at patch resolution [1, L, 1]
+		if cfg.Mask != nil {
+			weights := imagegen.MaskWeights(cfg.Mask, int(patchW), int(patchH))
+			maskWeights = mlx.ToBFloat16(mlx.NewArrayFloat32(weights, []int32{1, imgSeqLen, 1}))
+		}
+		fmt.Println("✓")
+	}
+
 	// RoPE cache - includes reference images if present
 	rope := PrepareRoPECache(textLen, patchH, patchW, tcfg.AxesDimsRoPE, tcfg.RopeTheta, refHeights, refWidths, ImageRefScale)
 
@@ -298,6 +342,13 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		if refTokens != nil {
 			refTokens.Tokens.Free()
 		}
+		if initPatches != nil {
+			initPatches.Free()
+			noise.Free()
+		}
+		if maskWeights != nil {
+			maskWeights.Free()
+		}
 	}()
 
 	// Pre-compute all timesteps before the loop to avoid per-step tensor creation
@@ -315,20 +366,27 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	if refTokens != nil {
 		toEval = append(toEval, refTokens.Tokens)
 	}
+	if initPatches != nil {
+		toEval = append(toEval, initPatches, noise)
+	}
+	if maskWeights != nil {
+		toEval = append(toEval, maskWeights)
+	}
 	mlx.Eval(toEval...)
 	mlx.MetalResetPeakMemory() // Reset peak to measure generation separately
 	fmt.Printf("✓ (%.2fs, %.1f GB)\n", time.Since(setupStart).Seconds(),
 		float64(mlx.MetalGetActiveMemory())/(1024*1024*1024))
 
+	runSteps := cfg.Steps - startStep
 	if cfg.Progress != nil {
-		cfg.Progress(0, cfg.Steps)
+		cfg.Progress(0, runSteps)
 	}
 
 	loopStart := time.Now()
 	stepStart := time.Now()
 
 	// Denoising loop
-	for i := 0; i < cfg.Steps; i++ {
+	for i := startStep; i < cfg.Steps; i++ {
 		// Check for cancellation
 		if ctx != nil {
 			select {
@@ -362,6 +420,12 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		// Scheduler step (keep reference to old patches for the computation graph)
 		newPatches := scheduler.Step(output, patches, i)
 
+		// Inpainting: keep unmasked regions on the init image's noise trajectory
+		if maskWeights != nil {
+			known := scheduler.AddNoise(initPatches, noise, i+1)
+			newPatches = mlx.Add(known, mlx.Mul(maskWeights, mlx.Sub(newPatches, known)))
+		}
+
 		if cfg.CapturePath != "" && i == 1 {
 			mlx.MetalStopCapture()
 		}
@@ -371,21 +435,33 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 
 		elapsed := time.Since(stepStart).Seconds()
 		peakGB := float64(mlx.MetalGetPeakMemory()) / (1024 * 1024 * 1024)
-		if i == 0 {
+		if i == startStep {
 			fmt.Printf("    step %d: %.2fs (JIT warmup), peak %.1f GB\n", i+1, elapsed, peakGB)
 		} else {
 			fmt.Printf("    step %d: %.2fs, peak %.1f GB\n", i+1, elapsed, peakGB)
 		}
 		stepStart = time.Now()
 		if cfg.Progress != nil {
-			cfg.Progress(i+1, cfg.Steps)
+			cfg.Progress(i+1-startStep, runSteps)
 		}
+
+		// Skip the preview on the last step since the full image follows
+		if cfg.Preview != nil && i+1 < cfg.Steps {
+			img := m.preview(patches, patchH, patchW, cfg.Width, cfg.Height)
+			cfg.Preview(i+1-startStep, runSteps, img)
+			img.Free()
+		}
+	}
+
+	// Don't spend time decoding if the request was cancelled during the last step
+	if ctx != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
 
 	loopTime := time.Since(loopStart).Seconds()
 	peakMem := float64(mlx.MetalGetPeakMemory()) / (1024 * 1024 * 1024)
 	fmt.Printf("  Denoised %d steps in %.2fs (%.2fs/step), peak %.1f GB\n",
-		cfg.Steps, loopTime, loopTime/float64(cfg.Steps), peakMem)
+		runSteps, loopTime, loopTime/float64(runSteps), peakMem)
 
 	// Free timesteps now that denoising is done
 	for _, ts := range timesteps {
@@ -412,6 +488,27 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	return decoded, nil
 }
 
+// preview decodes a spatially subsampled copy of the packed latents to a
+// low-resolution image no larger than imagegen.PreviewSize.
+func (m *Model) preview(patches *mlx.Array, patchH, patchW, width, height int32) *mlx.Array {
+	stride := imagegen.PreviewStride(width, height)
+	C := patches.Shape()[2]
+
+	grid := mlx.Reshape(patches, 1, patchH, patchW, C)
+	grid = mlx.SliceStride(grid, []int32{0, 0, 0, 0}, []int32{1, patchH, patchW, C}, []int32{1, stride, stride, 1})
+	h := (patchH + stride - 1) / stride
+	w := (patchW + stride - 1) / stride
+
+	// Previews are small enough to decode without tiling
+	tiling := m.VAE.Tiling
+	m.VAE.Tiling = nil
+	img := m.VAE.Decode(mlx.Reshape(grid, 1, h*w, C), h, w)
+	m.VAE.Tiling = tiling
+
+	mlx.Eval(img)
+	return img
+}
+
 // packLatents converts [B, C, H, W] to [B, H*W, C] (matches diffusers _pack_latents)
 func packLatents(x *mlx.Array) *mlx.Array {
 	shape := x.Shape()
@@ -115,6 +115,17 @@ func (s *FlowMatchScheduler) Step(modelOutput, sample *mlx.Array, timestepIdx in
 	return mlx.ToBFloat16(result)
 }
 
+// AddNoise mixes clean samples with noise at the given timestep index.
+// Used for image-to-image and inpainting: x_t = (1 - sigma) * x_0 + sigma * noise
+func (s *FlowMatchScheduler) AddNoise(cleanSample, noise *mlx.Array, timestepIdx int) *mlx.Array {
+	sigma := s.Sigmas[timestepIdx]
+
+	scaledClean := mlx.MulScalar(mlx.AsType(cleanSample, mlx.DtypeFloat32), 1.0-sigma)
+	scaledNoise := mlx.MulScalar(mlx.AsType(noise, mlx.DtypeFloat32), sigma)
+
+	return mlx.ToBFloat16(mlx.Add(scaledClean, scaledNoise))
+}
+
 // GetTimestep returns the timestep value at the given index
 func (s *FlowMatchScheduler) GetTimestep(idx int) float32 {
 	if idx < len(s.Timesteps) {
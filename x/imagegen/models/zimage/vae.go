@@ -820,3 +820,191 @@ func Upsample2x(x *mlx.Array) *mlx.Array {
 
 	return x
 }
+
+// DownEncoderBlock2D implements a downsampling encoder block
+type DownEncoderBlock2D struct {
+	ResnetBlocks []*ResnetBlock2D
+	Downsample   *Conv2D
+}
+
+// NewDownEncoderBlock2D creates a down encoder block
+func NewDownEncoderBlock2D(weights safetensors.WeightSource, prefix string, numLayers, numGroups int32, hasDownsample bool) (*DownEncoderBlock2D, error) {
+	resnets := make([]*ResnetBlock2D, numLayers)
+	for i := int32(0); i < numLayers; i++ {
+		resPrefix := fmt.Sprintf("%s.resnets.%d", prefix, i)
+		resnet, err := NewResnetBlock2D(weights, resPrefix, numGroups)
+		if err != nil {
+			return nil, err
+		}
+		resnets[i] = resnet
+	}
+
+	var downsample *Conv2D
+	if hasDownsample {
+		downWeight, err := weights.GetTensor(prefix + ".downsamplers.0.conv.weight")
+		if err != nil {
+			return nil, err
+		}
+		downBias, err := weights.GetTensor(prefix + ".downsamplers.0.conv.bias")
+		if err != nil {
+			return nil, err
+		}
+		downsample = NewConv2D(downWeight, downBias, 2, 0)
+	}
+
+	return &DownEncoderBlock2D{
+		ResnetBlocks: resnets,
+		Downsample:   downsample,
+	}, nil
+}
+
+// Forward applies the down encoder block with staged evaluation
+func (db *DownEncoderBlock2D) Forward(x *mlx.Array) *mlx.Array {
+	for _, resnet := range db.ResnetBlocks {
+		prev := x
+		x = resnet.Forward(x)
+		prev.Free()
+	}
+
+	if db.Downsample != nil {
+		// Asymmetric padding (right/bottom) then stride 2 conv, matching diffusers
+		prev := x
+		x = mlx.Pad(x, []int32{0, 0, 0, 1, 0, 1, 0, 0})
+		x = db.Downsample.Forward(x)
+		prev.Free()
+		mlx.Eval(x)
+	}
+
+	return x
+}
+
+// VAEEncoder is the VAE encoder, used to map init images to latents for image editing
+type VAEEncoder struct {
+	Config      *VAEConfig
+	ConvIn      *Conv2D
+	DownBlocks  []*DownEncoderBlock2D
+	MidBlock    *VAEMidBlock
+	ConvNormOut *GroupNormLayer
+	ConvOut     *Conv2D
+}
+
+// Load loads the VAE encoder from ollama blob storage.
+func (m *VAEEncoder) Load(manifest *imagegen.ModelManifest) error {
+	var cfg VAEConfig
+	if err := manifest.ReadConfigJSON("vae/config.json", &cfg); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	m.Config = &cfg
+
+	weights, err := imagegen.LoadWeightsFromManifest(manifest, "vae")
+	if err != nil {
+		return fmt.Errorf("weights: %w", err)
+	}
+	if err := weights.Load(0); err != nil {
+		return fmt.Errorf("load weights: %w", err)
+	}
+	defer weights.ReleaseAll()
+
+	return m.loadWeights(weights, &cfg)
+}
+
+// loadWeights loads VAE encoder weights from any WeightSource
+func (m *VAEEncoder) loadWeights(weights safetensors.WeightSource, cfg *VAEConfig) error {
+	var err error
+
+	fmt.Print("  Loading VAE encoder... ")
+	convInWeight, err := weights.GetTensor("encoder.conv_in.weight")
+	if err != nil {
+		return err
+	}
+	convInBias, err := weights.GetTensor("encoder.conv_in.bias")
+	if err != nil {
+		return err
+	}
+	m.ConvIn = NewConv2D(convInWeight, convInBias, 1, 1)
+
+	numBlocks := len(cfg.BlockOutChannels)
+	m.DownBlocks = make([]*DownEncoderBlock2D, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		prefix := fmt.Sprintf("encoder.down_blocks.%d", i)
+		hasDownsample := i < numBlocks-1
+		m.DownBlocks[i], err = NewDownEncoderBlock2D(weights, prefix, cfg.LayersPerBlock, cfg.NormNumGroups, hasDownsample)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.MidBlock, err = NewVAEMidBlock(weights, "encoder.mid_block", cfg.NormNumGroups)
+	if err != nil {
+		return err
+	}
+
+	normWeight, err := weights.GetTensor("encoder.conv_norm_out.weight")
+	if err != nil {
+		return err
+	}
+	normBias, err := weights.GetTensor("encoder.conv_norm_out.bias")
+	if err != nil {
+		return err
+	}
+	m.ConvNormOut = NewGroupNorm(normWeight, normBias, cfg.NormNumGroups)
+
+	convOutWeight, err := weights.GetTensor("encoder.conv_out.weight")
+	if err != nil {
+		return err
+	}
+	convOutBias, err := weights.GetTensor("encoder.conv_out.bias")
+	if err != nil {
+		return err
+	}
+	m.ConvOut = NewConv2D(convOutWeight, convOutBias, 1, 1)
+	fmt.Printf("✓ [%d blocks]\n", numBlocks)
+
+	return nil
+}
+
+// Encode encodes an image to scaled latents.
+// Input is [B, 3, H, W] in [-1, 1] (NCHW), output is [B, C, H/8, W/8] (NCHW)
+// in the same space the transformer denoises and Decode consumes.
+func (v *VAEEncoder) Encode(image *mlx.Array) *mlx.Array {
+	// Convert NCHW -> NHWC for internal processing
+	x := mlx.Transpose(image, 0, 2, 3, 1)
+	mlx.Eval(x)
+
+	h := v.ConvIn.Forward(x)
+	mlx.Eval(h)
+	x.Free()
+
+	for _, downBlock := range v.DownBlocks {
+		prev := h
+		h = downBlock.Forward(h)
+		prev.Free()
+	}
+
+	prev := h
+	h = v.MidBlock.Forward(h)
+	prev.Free()
+
+	prev = h
+	h = v.ConvNormOut.Forward(h)
+	mlx.Eval(h)
+	prev.Free()
+
+	prev = h
+	h = mlx.SiLU(h)
+	h = v.ConvOut.Forward(h)
+	prev.Free()
+
+	// Take only the mean (first latent_channels) for deterministic encoding
+	shape := h.Shape()
+	h = mlx.Slice(h, []int32{0, 0, 0, 0}, []int32{shape[0], shape[1], shape[2], v.Config.LatentChannels})
+
+	// Inverse of Decode scaling: z = (mean - shift) * scale
+	h = mlx.AddScalar(h, -v.Config.ShiftFactor)
+	h = mlx.MulScalar(h, v.Config.ScalingFactor)
+
+	// Convert NHWC -> NCHW for output
+	h = mlx.Transpose(h, 0, 3, 1, 2)
+	mlx.Eval(h)
+	return h
+}
@@ -5,7 +5,9 @@ package zimage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"image"
 	"time"
 
 	"github.com/ollama/ollama/x/imagegen"
@@ -25,6 +27,7 @@ type GenerateConfig struct {
 	Steps          int                   // Denoising steps (default: 9 for turbo)
 	Seed           int64                 // Random seed
 	Progress       func(step, totalSteps int) // Optional progress callback
+	Preview        func(step, totalSteps int, img *mlx.Array) // Optional low-res preview callback
 	CapturePath    string                // GPU capture path (debug)
 
 	// TeaCache options (timestep embedding aware caching)
@@ -33,6 +36,11 @@ type GenerateConfig struct {
 
 	// Fused QKV (fuse Q/K/V projections into single matmul)
 	FusedQKV bool // Enable fused QKV projection (default: false)
+
+	// Image editing (image-to-image and inpainting)
+	InitImage image.Image // Init image (already loaded); nil = text-to-image
+	Mask      image.Image // Optional inpainting mask for InitImage (white = regenerate)
+	Strength  float32     // How much InitImage is changed, 0-1 (default: 0.75)
 }
 
 // Model represents a Z-Image diffusion model.
@@ -42,7 +50,8 @@ type Model struct {
 	TextEncoder *Qwen3TextEncoder
 	Transformer *Transformer
 	VAEDecoder  *VAEDecoder
-	qkvFused    bool // Track if QKV has been fused (do only once)
+	VAEEncoder  *VAEEncoder // nil if the model has no encoder weights
+	qkvFused    bool        // Track if QKV has been fused (do only once)
 }
 
 // Load loads the Z-Image model from ollama blob storage.
@@ -119,6 +128,15 @@ func (m *Model) Load(modelName string) error {
 		float64(mlx.MetalGetActiveMemory())/(1024*1024*1024),
 		float64(mlx.MetalGetPeakMemory())/(1024*1024*1024))
 
+	// Load VAE encoder (optional, only needed for image editing)
+	m.VAEEncoder = &VAEEncoder{}
+	if err := m.VAEEncoder.Load(manifest); err != nil {
+		fmt.Printf("  VAE encoder not available, image editing disabled: %v\n", err)
+		m.VAEEncoder = nil
+	} else {
+		mlx.Eval(mlx.Collect(m.VAEEncoder)...)
+	}
+
 	mem := mlx.MetalGetActiveMemory()
 	fmt.Printf("  Loaded in %.2fs (%.1f GB VRAM)\n", time.Since(start).Seconds(), float64(mem)/(1024*1024*1024))
 
@@ -178,7 +196,7 @@ func (m *Model) GenerateFromConfig(ctx context.Context, cfg *GenerateConfig) (*m
 }
 
 // GenerateImage implements runner.ImageModel interface.
-func (m *Model) GenerateImage(ctx context.Context, prompt string, width, height int32, steps int, seed int64, progress func(step, total int)) (*mlx.Array, error) {
+func (m *Model) GenerateImage(ctx context.Context, prompt string, width, height int32, steps int, seed int64, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error) {
 	return m.GenerateFromConfig(ctx, &GenerateConfig{
 		Prompt:   prompt,
 		Width:    width,
@@ -186,6 +204,29 @@ func (m *Model) GenerateImage(ctx context.Context, prompt string, width, height
 		Steps:    steps,
 		Seed:     seed,
 		Progress: progress,
+		Preview:  preview,
+	})
+}
+
+// EditImage implements runner.ImageEditModel interface.
+func (m *Model) EditImage(ctx context.Context, prompt string, initImage, mask image.Image, strength float32, width, height int32, steps int, seed int64, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error) {
+	if initImage != nil && width <= 0 && height <= 0 {
+		// Default to the init image size, rounded down to a multiple of 16
+		bounds := initImage.Bounds()
+		width = int32(bounds.Dx() / 16 * 16)
+		height = int32(bounds.Dy() / 16 * 16)
+	}
+	return m.GenerateFromConfig(ctx, &GenerateConfig{
+		Prompt:    prompt,
+		Width:     width,
+		Height:    height,
+		Steps:     steps,
+		Seed:      seed,
+		Progress:  progress,
+		Preview:   preview,
+		InitImage: initImage,
+		Mask:      mask,
+		Strength:  strength,
 	})
 }
 
@@ -204,6 +245,9 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	if cfg.CFGScale <= 0 {
 		cfg.CFGScale = 4.0
 	}
+	if cfg.InitImage != nil && m.VAEEncoder == nil {
+		return nil, errors.New("image editing is not supported: model has no VAE encoder weights")
+	}
 	// TeaCache enabled by default
 	cfg.TeaCache = true
 	if cfg.TeaCacheThreshold <= 0 {
@@ -263,6 +307,27 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		mlx.Eval(latents)
 	}
 
+	// Image-to-image: start partway through the schedule from the noised init image
+	startStep := 0
+	var initLatents, noise, maskWeights *mlx.Array
+	if cfg.InitImage != nil {
+		startStep = imagegen.StartStep(cfg.Steps, cfg.Strength)
+		fmt.Printf("  Encoding init image (%d of %d steps)... ", cfg.Steps-startStep, cfg.Steps)
+		resized := imagegen.ResizeImage(cfg.InitImage, int(cfg.Width), int(cfg.Height))
+		initLatents = mlx.ToBFloat16(m.VAEEncoder.Encode(imageToTensor(resized)))
+		noise = latents
+		latents = scheduler.AddNoise(initLatents, noise, startStep)
+
+		// Inpainting mask at latent resolution [1, 1, H, W], broadcast over channels
+		if cfg.Mask != nil {
+			weights := imagegen.MaskWeights(cfg.Mask, int(latentW), int(latentH))
+			maskWeights = mlx.ToBFloat16(mlx.NewArrayFloat32(weights, []int32{1, 1, latentH, latentW}))
+		}
+		mlx.Keep(initLatents, noise, maskWeights)
+		mlx.Eval(latents)
+		fmt.Println("✓")
+	}
+
 	// RoPE cache
 	var ropeCache *RoPECache
 	{
@@ -301,6 +366,17 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		}
 	}
 
+	// freeEditArrays frees the image editing inputs
+	freeEditArrays := func() {
+		if initLatents != nil {
+			initLatents.Free()
+			noise.Free()
+		}
+		if maskWeights != nil {
+			maskWeights.Free()
+		}
+	}
+
 	// cleanup frees all kept arrays when we need to abort early
 	cleanup := func() {
 		posEmb.Free()
@@ -319,14 +395,16 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		if teaCache != nil {
 			teaCache.Free()
 		}
+		freeEditArrays()
 		latents.Free()
 	}
 
 	// Denoising loop
+	runSteps := cfg.Steps - startStep
 	if cfg.Progress != nil {
-		cfg.Progress(0, cfg.Steps) // Start at 0%
+		cfg.Progress(0, runSteps) // Start at 0%
 	}
-	for i := 0; i < cfg.Steps; i++ {
+	for i := startStep; i < cfg.Steps; i++ {
 		// Check for cancellation
 		if ctx != nil {
 			select {
@@ -415,6 +493,12 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		oldLatents := latents
 		latents = scheduler.Step(noisePred, latents, i)
 
+		// Inpainting: keep unmasked regions on the init image's noise trajectory
+		if maskWeights != nil {
+			known := scheduler.AddNoise(initLatents, noise, i+1)
+			latents = mlx.Add(known, mlx.Mul(maskWeights, mlx.Sub(latents, known)))
+		}
+
 		mlx.Eval(latents)
 		oldLatents.Free()
 
@@ -428,7 +512,14 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 			i+1, cfg.Steps, tCurr, time.Since(stepStart).Seconds(), activeMem, peakMem)
 
 		if cfg.Progress != nil {
-			cfg.Progress(i+1, cfg.Steps) // Report completed step
+			cfg.Progress(i+1-startStep, runSteps) // Report completed step
+		}
+
+		// Skip the preview on the last step since the full image follows
+		if cfg.Preview != nil && i+1 < cfg.Steps {
+			img := m.preview(latents, cfg.Width, cfg.Height)
+			cfg.Preview(i+1-startStep, runSteps, img)
+			img.Free()
 		}
 	}
 
@@ -446,6 +537,7 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	if batchedEmb != nil {
 		batchedEmb.Free()
 	}
+	freeEditArrays()
 	if teaCache != nil {
 		hits, misses := teaCache.Stats()
 		fmt.Printf("  TeaCache stats: %d hits, %d misses (%.1f%% cache rate)\n",
@@ -453,6 +545,12 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 		teaCache.Free()
 	}
 
+	// Don't spend time decoding if the request was cancelled during the last step
+	if ctx != nil && ctx.Err() != nil {
+		latents.Free()
+		return nil, ctx.Err()
+	}
+
 	// VAE decode - enable tiling for larger images to reduce memory
 	// VAE attention is O(n²) on latent pixels, tiling helps significantly
 	if latentH > 64 || latentW > 64 {
@@ -464,6 +562,40 @@ func (m *Model) generate(ctx context.Context, cfg *GenerateConfig) (*mlx.Array,
 	return decoded, nil
 }
 
+// preview decodes a spatially subsampled copy of the latents to a
+// low-resolution image no larger than imagegen.PreviewSize.
+func (m *Model) preview(latents *mlx.Array, width, height int32) *mlx.Array {
+	stride := imagegen.PreviewStride(width, height)
+	shape := latents.Shape()
+	small := mlx.SliceStride(latents, []int32{0, 0, 0, 0}, shape, []int32{1, 1, stride, stride})
+
+	// Previews are small enough to decode without tiling
+	tiling := m.VAEDecoder.Tiling
+	m.VAEDecoder.Tiling = nil
+	img := m.VAEDecoder.Decode(small)
+	m.VAEDecoder.Tiling = tiling
+
+	return img
+}
+
+// imageToTensor converts an image to a tensor in [-1, 1] range with shape [1, 3, H, W].
+func imageToTensor(img image.Image) *mlx.Array {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	data := make([]float32, 3*h*w)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(x+bounds.Min.X, y+bounds.Min.Y).RGBA()
+			data[0*h*w+y*w+x] = float32(r>>8)/127.5 - 1.0
+			data[1*h*w+y*w+x] = float32(g>>8)/127.5 - 1.0
+			data[2*h*w+y*w+x] = float32(b>>8)/127.5 - 1.0
+		}
+	}
+
+	return mlx.NewArrayFloat32(data, []int32{1, 3, int32(h), int32(w)})
+}
+
 // padToLength pads a sequence tensor to the target length by repeating the last token.
 func padToLength(x *mlx.Array, targetLen int32) *mlx.Array {
 	shape := x.Shape()
@@ -0,0 +1,16 @@
+package imagegen
+
+// PreviewSize is the maximum width or height in pixels of the preview
+// thumbnails streamed while an image is being denoised.
+const PreviewSize = 256
+
+// PreviewStride returns the stride at which to subsample a latent grid so
+// that a width x height image decodes to a preview no larger than
+// PreviewSize on its longest side.
+func PreviewStride(width, height int32) int32 {
+	longest := max(width, height)
+	if longest <= PreviewSize {
+		return 1
+	}
+	return (longest + PreviewSize - 1) / PreviewSize
+}
@@ -0,0 +1,22 @@
+package imagegen
+
+import "testing"
+
+func TestPreviewStride(t *testing.T) {
+	tests := []struct {
+		width, height int32
+		expected      int32
+	}{
+		{width: 256, height: 256, expected: 1},
+		{width: 128, height: 64, expected: 1},
+		{width: 512, height: 512, expected: 2},
+		{width: 1024, height: 768, expected: 4},
+		{width: 768, height: 1280, expected: 5},
+	}
+
+	for _, tt := range tests {
+		if got := PreviewStride(tt.width, tt.height); got != tt.expected {
+			t.Errorf("PreviewStride(%d, %d) = %d, expected %d", tt.width, tt.height, got, tt.expected)
+		}
+	}
+}
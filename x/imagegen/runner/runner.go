@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"image"
 	"log/slog"
 	"net/http"
 	"os"
@@ -30,6 +31,14 @@ type Request struct {
 	Height int32  `json:"height,omitempty"`
 	Steps  int    `json:"steps,omitempty"`
 	Seed   int64  `json:"seed,omitempty"`
+
+	// Image editing: init image, optional inpainting mask and strength
+	Image    []byte  `json:"image,omitempty"`
+	Mask     []byte  `json:"mask,omitempty"`
+	Strength float32 `json:"strength,omitempty"`
+
+	// Preview requests a low-resolution preview after each step
+	Preview bool `json:"preview,omitempty"`
 }
 
 // Response is streamed back for each progress update
@@ -39,11 +48,18 @@ type Response struct {
 	Done    bool   `json:"done"`
 	Step    int    `json:"step,omitempty"`
 	Total   int    `json:"total,omitempty"`
+	Preview string `json:"preview,omitempty"` // Base64-encoded PNG thumbnail
 }
 
 // ImageModel is the interface for image generation models
 type ImageModel interface {
-	GenerateImage(ctx context.Context, prompt string, width, height int32, steps int, seed int64, progress func(step, total int)) (*mlx.Array, error)
+	GenerateImage(ctx context.Context, prompt string, width, height int32, steps int, seed int64, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error)
+}
+
+// ImageEditModel is implemented by models that can start from an init image
+// (image-to-image) and optionally regenerate only a masked region (inpainting).
+type ImageEditModel interface {
+	EditImage(ctx context.Context, prompt string, initImage, mask image.Image, strength float32, width, height int32, steps int, seed int64, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error)
 }
 
 // Server holds the model and handles requests
@@ -165,6 +181,11 @@ func (s *Server) completionHandler(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// The client may have gone away while waiting for a previous request
+	if r.Context().Err() != nil {
+		return
+	}
+
 	// Model applies its own defaults for width/height/steps
 	// Only seed needs to be set here if not provided
 	if req.Seed <= 0 {
@@ -192,7 +213,27 @@ func (s *Server) completionHandler(w http.ResponseWriter, r *http.Request) {
 		flusher.Flush()
 	}
 
-	img, err := s.model.GenerateImage(ctx, req.Prompt, req.Width, req.Height, req.Steps, req.Seed, progress)
+	// Preview callback streams a thumbnail of the in-progress image
+	var preview func(step, total int, img *mlx.Array)
+	if req.Preview {
+		preview = func(step, total int, img *mlx.Array) {
+			data, err := imagegen.EncodeImageBase64(img)
+			if err != nil {
+				slog.Warn("failed to encode preview", "error", err)
+				return
+			}
+			enc.Encode(Response{Step: step, Total: total, Preview: data})
+			flusher.Flush()
+		}
+	}
+
+	var img *mlx.Array
+	var err error
+	if len(req.Image) > 0 {
+		img, err = s.editImage(ctx, req, progress, preview)
+	} else {
+		img, err = s.model.GenerateImage(ctx, req.Prompt, req.Width, req.Height, req.Steps, req.Seed, progress, preview)
+	}
 
 	if err != nil {
 		// Don't send error for cancellation
@@ -231,3 +272,26 @@ func (s *Server) completionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("\n"))
 	flusher.Flush()
 }
+
+// editImage decodes the init image and mask and runs an image edit.
+func (s *Server) editImage(ctx context.Context, req Request, progress func(step, total int), preview func(step, total int, img *mlx.Array)) (*mlx.Array, error) {
+	editor, ok := s.model.(ImageEditModel)
+	if !ok {
+		return nil, fmt.Errorf("model %s does not support image editing", s.modelName)
+	}
+
+	initImage, err := imagegen.DecodeImage(req.Image)
+	if err != nil {
+		return nil, fmt.Errorf("decode init image: %w", err)
+	}
+
+	var mask image.Image
+	if len(req.Mask) > 0 {
+		mask, err = imagegen.DecodeImage(req.Mask)
+		if err != nil {
+			return nil, fmt.Errorf("decode mask: %w", err)
+		}
+	}
+
+	return editor.EditImage(ctx, req.Prompt, initImage, mask, req.Strength, req.Width, req.Height, req.Steps, req.Seed, progress, preview)
+}
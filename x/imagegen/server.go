@@ -228,17 +228,27 @@ func (s *Server) Completion(ctx context.Context, req llm.CompletionRequest, fn f
 
 	// Build request for subprocess
 	creq := struct {
-		Prompt string `json:"prompt"`
-		Width  int32  `json:"width,omitempty"`
-		Height int32  `json:"height,omitempty"`
-		Steps  int32  `json:"steps,omitempty"`
-		Seed   int64  `json:"seed,omitempty"`
+		Prompt   string  `json:"prompt"`
+		Width    int32   `json:"width,omitempty"`
+		Height   int32   `json:"height,omitempty"`
+		Steps    int32   `json:"steps,omitempty"`
+		Seed     int64   `json:"seed,omitempty"`
+		Image    []byte  `json:"image,omitempty"`
+		Mask     []byte  `json:"mask,omitempty"`
+		Strength float32 `json:"strength,omitempty"`
+		Preview  bool    `json:"preview,omitempty"`
 	}{
-		Prompt: req.Prompt,
-		Width:  req.Width,
-		Height: req.Height,
-		Steps:  req.Steps,
-		Seed:   seed,
+		Prompt:   req.Prompt,
+		Width:    req.Width,
+		Height:   req.Height,
+		Steps:    req.Steps,
+		Seed:     seed,
+		Mask:     req.Mask,
+		Strength: req.Strength,
+		Preview:  req.Preview,
+	}
+	if len(req.Images) > 0 {
+		creq.Image = req.Images[0].Data
 	}
 
 	body, err := json.Marshal(creq)
@@ -273,6 +283,7 @@ func (s *Server) Completion(ctx context.Context, req llm.CompletionRequest, fn f
 			Done    bool   `json:"done"`
 			Step    int    `json:"step,omitempty"`
 			Total   int    `json:"total,omitempty"`
+			Preview string `json:"preview,omitempty"`
 		}
 		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
 			continue
@@ -285,6 +296,7 @@ func (s *Server) Completion(ctx context.Context, req llm.CompletionRequest, fn f
 			Step:       raw.Step,
 			TotalSteps: raw.Total,
 			Image:      raw.Image,
+			Preview:    raw.Preview,
 		}
 
 		fn(cresp)
@@ -331,7 +343,7 @@ func (s *Server) VRAMByGPU(id ml.DeviceID) uint64 {
 	return s.vramSize
 }
 
-func (s *Server) Embedding(ctx context.Context, input string) ([]float32, int, error) {
+func (s *Server) Embedding(ctx context.Context, req llm.EmbeddingRequest) ([]float32, int, error) {
 	return nil, 0, errors.New("not supported")
 }
 
@@ -1,8 +1,17 @@
 package imagegen
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/ollama/ollama/llm"
 )
 
 // TestPlatformSupport verifies platform validation works correctly.
@@ -80,3 +89,75 @@ func TestServerInterfaceCompliance(t *testing.T) {
 	// This test documents that requirement.
 	t.Log("Server implements llm.LlamaServer interface (compile-time checked)")
 }
+
+func TestCompletionStreamsProgressAndPreview(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Preview bool `json:"preview"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if !req.Preview {
+			t.Errorf("expected preview to be forwarded to the runner")
+		}
+
+		enc := json.NewEncoder(w)
+		enc.Encode(map[string]any{"step": 1, "total": 2})
+		enc.Encode(map[string]any{"step": 1, "total": 2, "preview": "cHJldmlldw=="})
+		enc.Encode(map[string]any{"step": 2, "total": 2})
+		enc.Encode(map[string]any{"image": "aW1hZ2U=", "done": true})
+	}))
+	defer srv.Close()
+
+	port, err := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{port: port, client: srv.Client()}
+
+	var responses []llm.CompletionResponse
+	if err := s.Completion(t.Context(), llm.CompletionRequest{Prompt: "a cat", Preview: true}, func(r llm.CompletionResponse) {
+		responses = append(responses, r)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(responses) != 4 {
+		t.Fatalf("expected 4 responses, got %d", len(responses))
+	}
+	if responses[1].Preview != "cHJldmlldw==" || responses[1].Step != 1 || responses[1].TotalSteps != 2 {
+		t.Errorf("unexpected preview response: %+v", responses[1])
+	}
+	if last := responses[3]; !last.Done || last.Image != "aW1hZ2U=" {
+		t.Errorf("unexpected final response: %+v", last)
+	}
+}
+
+func TestCompletionCancel(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"step": 0, "total": 10})
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	port, err := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{port: port, client: srv.Client()}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	err = s.Completion(ctx, llm.CompletionRequest{Prompt: "a cat"}, func(llm.CompletionResponse) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -50,18 +50,18 @@ func (b *BashTool) Schema() api.ToolFunction {
 }
 
 // Execute runs the bash command.
-func (b *BashTool) Execute(args map[string]any) (string, error) {
+func (b *BashTool) Execute(ctx context.Context, args map[string]any) (string, error) {
 	command, ok := args["command"].(string)
 	if !ok || command == "" {
 		return "", fmt.Errorf("command parameter is required")
 	}
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), bashTimeout)
+	cmdCtx, cancel := context.WithTimeout(ctx, bashTimeout)
 	defer cancel()
 
 	// Execute command
-	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd := exec.CommandContext(cmdCtx, "bash", "-c", command)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -96,7 +96,11 @@ func (b *BashTool) Execute(args map[string]any) (string, error) {
 
 	// Handle errors
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
+		if ctx.Err() != nil {
+			// the caller gave up on the command, such as at a deadline
+			return sb.String(), context.Cause(ctx)
+		}
+		if cmdCtx.Err() == context.DeadlineExceeded {
 			return sb.String() + "\n\nError: command timed out after 60 seconds", nil
 		}
 		// Include exit code in output but don't return as error
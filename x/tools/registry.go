@@ -2,6 +2,7 @@
 package tools
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sort"
@@ -17,8 +18,9 @@ type Tool interface {
 	Description() string
 	// Schema returns the tool's parameter schema for the LLM.
 	Schema() api.ToolFunction
-	// Execute runs the tool with the given arguments.
-	Execute(args map[string]any) (string, error)
+	// Execute runs the tool with the given arguments. It stops when ctx
+	// is done.
+	Execute(ctx context.Context, args map[string]any) (string, error)
 }
 
 // Registry manages available tools.
@@ -91,12 +93,12 @@ func (r *Registry) Tools() api.Tools {
 }
 
 // Execute runs a tool call and returns the result.
-func (r *Registry) Execute(call api.ToolCall) (string, error) {
+func (r *Registry) Execute(ctx context.Context, call api.ToolCall) (string, error) {
 	tool, ok := r.tools[call.Function.Name]
 	if !ok {
 		return "", fmt.Errorf("unknown tool: %s", call.Function.Name)
 	}
-	return tool.Execute(call.Function.Arguments.ToMap())
+	return tool.Execute(ctx, call.Function.Arguments.ToMap())
 }
 
 // Names returns the names of all registered tools, sorted alphabetically.
@@ -65,7 +65,7 @@ func TestRegistry_Execute(t *testing.T) {
 	// Test successful execution
 	args := api.NewToolCallFunctionArguments()
 	args.Set("command", "echo hello")
-	result, err := r.Execute(api.ToolCall{
+	result, err := r.Execute(t.Context(), api.ToolCall{
 		Function: api.ToolCallFunction{
 			Name:      "bash",
 			Arguments: args,
@@ -79,7 +79,7 @@ func TestRegistry_Execute(t *testing.T) {
 	}
 
 	// Test unknown tool
-	_, err = r.Execute(api.ToolCall{
+	_, err = r.Execute(t.Context(), api.ToolCall{
 		Function: api.ToolCallFunction{
 			Name:      "unknown",
 			Arguments: api.NewToolCallFunctionArguments(),
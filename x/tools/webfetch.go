@@ -70,7 +70,7 @@ type webFetchResponse struct {
 
 // Execute fetches content from a web page.
 // Uses Ollama key signing for authentication - this makes requests via ollama.com API.
-func (w *WebFetchTool) Execute(args map[string]any) (string, error) {
+func (w *WebFetchTool) Execute(ctx context.Context, args map[string]any) (string, error) {
 	urlStr, ok := args["url"].(string)
 	if !ok || urlStr == "" {
 		return "", fmt.Errorf("url parameter is required")
@@ -102,7 +102,6 @@ func (w *WebFetchTool) Execute(args map[string]any) (string, error) {
 	fetchURL.RawQuery = q.Encode()
 
 	// Sign the request using Ollama key (~/.ollama/id_ed25519)
-	ctx := context.Background()
 	data := fmt.Appendf(nil, "%s,%s", http.MethodPost, fetchURL.RequestURI())
 	signature, err := auth.Sign(ctx, data)
 	if err != nil {
@@ -76,7 +76,7 @@ type webSearchResult struct {
 
 // Execute performs the web search.
 // Uses Ollama key signing for authentication - this makes requests via ollama.com API.
-func (w *WebSearchTool) Execute(args map[string]any) (string, error) {
+func (w *WebSearchTool) Execute(ctx context.Context, args map[string]any) (string, error) {
 	query, ok := args["query"].(string)
 	if !ok || query == "" {
 		return "", fmt.Errorf("query parameter is required")
@@ -105,7 +105,6 @@ func (w *WebSearchTool) Execute(args map[string]any) (string, error) {
 
 	// Sign the request using Ollama key (~/.ollama/id_ed25519)
 	// This authenticates with ollama.com using the local signing key
-	ctx := context.Background()
 	data := fmt.Appendf(nil, "%s,%s", http.MethodPost, searchURL.RequestURI())
 	signature, err := auth.Sign(ctx, data)
 	if err != nil {